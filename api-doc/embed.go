@@ -0,0 +1,13 @@
+// Package apidoc embeds the OpenAPI reference, so the server publishes the
+// same document that is maintained in this folder.
+package apidoc
+
+import "embed"
+
+// Entry is the root document of the reference within Files.
+const Entry = "openapi.yaml"
+
+// Files holds the root document and the paths and components it references.
+//
+//go:embed openapi.yaml paths components
+var Files embed.FS
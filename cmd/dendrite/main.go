@@ -2,18 +2,21 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"log"
-	"log/slog"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"text/tabwriter"
 
+	gommonbytes "github.com/labstack/gommon/bytes"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/thorstenkramm/dendrite-pulse/internal/app"
 	"github.com/thorstenkramm/dendrite-pulse/internal/config"
 	"github.com/thorstenkramm/dendrite-pulse/internal/files"
 	"github.com/thorstenkramm/dendrite-pulse/internal/logging"
@@ -71,11 +74,100 @@ func newRootCmd() *cobra.Command {
 	if err := viper.BindPFlag("config-check", runCmd.Flags().Lookup("config-check")); err != nil {
 		log.Fatalf("bind config-check flag: %v", err)
 	}
+	runCmd.Flags().String("pid-file", "", "Write the process ID to this file while running")
+	if err := viper.BindPFlag("main.pid_file", runCmd.Flags().Lookup("pid-file")); err != nil {
+		log.Fatalf("bind pid-file flag: %v", err)
+	}
 
 	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(newConfigCmd())
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "roots",
+		Short: "Check the configured file roots",
+		Long: "Print each file root with its source after resolving symlinks, the free space on its filesystem, " +
+			"the number of entries in it and whether it can be read, without starting the server.",
+		Args: cobra.NoArgs,
+		RunE: checkRoots,
+		// Unusable roots are no usage error.
+		SilenceUsage: true,
+	})
 	return rootCmd
 }
 
+// checkRoots prints the state of every file root. It fails when a root is
+// unusable or the configuration does not validate.
+func checkRoots(cmd *cobra.Command, _ []string) error {
+	cfg, err := config.NewLoader(viper.GetViper()).Resolve(viper.GetString("config"))
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+
+	out := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(out, "VIRTUAL\tSOURCE\tRESOLVED\tFREE\tENTRIES\tREADABLE\tERROR")
+	unusable := 0
+	for _, root := range app.FileRoots(cfg) {
+		report := files.InspectRoot(root)
+		free, problem := "-", "-"
+		if report.FreeBytes >= 0 {
+			free = gommonbytes.Format(report.FreeBytes)
+		}
+		if report.Err != nil {
+			problem = report.Err.Error()
+			unusable++
+		}
+		_, _ = fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%d\t%t\t%s\n", root.Virtual, root.Source,
+			cmp.Or(report.Resolved, "-"), free, report.Entries, report.Readable, problem)
+	}
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("write roots: %w", err)
+	}
+
+	if unusable > 0 {
+		return fmt.Errorf("%d of %d file roots are unusable", unusable, len(cfg.FileRoots))
+	}
+	if err := config.Validate(cfg); err != nil {
+		return fmt.Errorf("validate config: %w", err)
+	}
+	return nil
+}
+
+func newConfigCmd() *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration",
+	}
+	dumpCmd := &cobra.Command{
+		Use:   "dump",
+		Short: "Print the effective configuration with secrets redacted",
+		Long: "Print the configuration in effect after merging defaults, config file, environment variables " +
+			"and flags. API keys, the OIDC client secret, the signing secret and tracing headers are redacted.",
+		Args: cobra.NoArgs,
+		RunE: dumpConfig,
+	}
+	dumpCmd.Flags().String("format", "toml", "Output format: toml or json")
+	configCmd.AddCommand(dumpCmd)
+	return configCmd
+}
+
+func dumpConfig(cmd *cobra.Command, _ []string) error {
+	cfg, err := config.NewLoader(viper.GetViper()).Load(viper.GetString("config"))
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return fmt.Errorf("read format flag: %w", err)
+	}
+	out, err := config.Dump(cfg, format)
+	if err != nil {
+		return fmt.Errorf("dump config: %w", err)
+	}
+	if _, err := cmd.OutOrStdout().Write(out); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	return nil
+}
+
 func runServer(_ *cobra.Command, _ []string) error {
 	cfgPath := viper.GetString("config")
 	cfg, err := config.NewLoader(viper.GetViper()).Load(cfgPath)
@@ -88,19 +180,23 @@ func runServer(_ *cobra.Command, _ []string) error {
 		return nil
 	}
 
-	port := cfg.Main.Port
-	listen := cfg.Main.Listen
-	logLevel := strings.ToLower(cfg.Log.Level)
-	logFile := cfg.Log.File
-	logFormat := strings.ToLower(cfg.Log.Format)
+	listeners, err := app.ServerListeners(cfg)
+	if err != nil {
+		return err
+	}
 
-	appLogger, closeLog, err := setupLogger(logFile, logFormat, logLevel)
+	removePIDFile, err := app.WritePIDFile(cfg.Main.PIDFile)
 	if err != nil {
 		return err
 	}
-	loggingEnabled := appLogger != nil
-	if loggingEnabled {
-		appLogger.Info("dendrite server started", "port", port)
+	defer removePIDFile()
+
+	appLogger, levelVar, closeLog, err := app.SetupLogger(cfg.Log.File, strings.ToLower(cfg.Log.Format), cfg.Log.Level)
+	if err != nil {
+		return err
+	}
+	if appLogger != nil {
+		appLogger.Info("dendrite server started", "listen", app.ListenAddrs(listeners), "tls", cfg.TLS.CertFile != "")
 	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
@@ -109,39 +205,41 @@ func runServer(_ *cobra.Command, _ []string) error {
 		defer func() { _ = closeLog() }()
 	}
 
-	fileRoots := make([]files.Root, 0, len(cfg.FileRoots))
-	for _, root := range cfg.FileRoots {
-		fileRoots = append(fileRoots, files.Root{
-			Virtual: root.Virtual,
-			Source:  root.Source,
-		})
-	}
-	fileSvc, err := files.NewService(fileRoots)
+	accessLog, auditLog, closeLogs, err := app.OpenRequestLogs(cfg)
 	if err != nil {
-		return fmt.Errorf("init file service: %w", err)
+		return err
 	}
+	defer closeLogs()
 
-	addr := fmt.Sprintf("%s:%d", listen, port)
-	cfgSrv := server.Config{
-		Logger:      appLogger,
-		LogRequests: loggingEnabled,
-		FileService: fileSvc,
-	}
-	if err := server.Run(ctx, addr, cfgSrv); err != nil {
-		return fmt.Errorf("run server: %w", err)
+	stopTracing, err := app.StartTracing(ctx, cfg.Tracing, appLogger)
+	if err != nil {
+		return err
 	}
-	return nil
-}
+	defer stopTracing()
 
-func setupLogger(logFile, logFormat, logLevel string) (*slog.Logger, func() error, error) {
-	if logFile == "" {
-		return nil, nil, nil
+	fileSvc, err := app.NewFileService(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.Files.HealthInterval > 0 {
+		go fileSvc.MonitorRoots(logging.ContextWithLogger(ctx, appLogger), cfg.Files.HealthInterval)
 	}
+	reload := func() (config.Config, error) { return config.NewLoader(viper.GetViper()).Load(cfgPath) }
+	app.ReloadOnHangup(ctx, reload, fileSvc, levelVar, appLogger)
+	watcher := app.StartWatcher(ctx, cfg, fileSvc, appLogger)
 
-	logger, closer, err := logging.NewLogger(logFile, logFormat, logLevel)
+	cfgSrv, err := app.ServerConfig(ctx, cfg, appLogger, fileSvc)
 	if err != nil {
-		return nil, nil, fmt.Errorf("setup logger: %w", err)
+		return err
 	}
-
-	return logger, closer, nil
+	cfgSrv.AccessLog = accessLog
+	cfgSrv.FileOptions.Audit = auditLog
+	if cfg.API.Events {
+		cfgSrv.FileOptions.Events = watcher
+	}
+	app.NotifySystemd(ctx, &cfgSrv, appLogger)
+	if err := server.Serve(ctx, cfgSrv, listeners...); err != nil {
+		return fmt.Errorf("run server: %w", err)
+	}
+	return nil
 }
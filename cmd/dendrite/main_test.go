@@ -2,8 +2,10 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"regexp"
 	"testing"
 
 	"github.com/spf13/viper"
@@ -139,3 +141,58 @@ source = "` + rootDir + `"
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid listen address")
 }
+
+func TestConfigDump(t *testing.T) {
+	viper.Reset()
+
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "config.toml")
+	cfgContent := `
+[auth]
+api_keys = ["a-plain-api-key-of-at-least-32-characters"]
+
+[[file-root]]
+virtual = "/public"
+source = "` + tmpDir + `"
+`
+	require.NoError(t, os.WriteFile(cfgPath, []byte(cfgContent), 0o600))
+
+	cmd := newRootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"config", "dump", "--config", cfgPath, "--port", "4000", "--format", "json"})
+	require.NoError(t, cmd.Execute())
+
+	var settings map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &settings))
+	assert.InDelta(t, 4000, settings["main"].(map[string]any)["port"], 0, "flags override the config file")
+	assert.Equal(t, []any{"REDACTED"}, settings["auth"].(map[string]any)["api_keys"])
+	assert.NotContains(t, out.String(), "a-plain-api-key")
+}
+
+func TestCheckRoots(t *testing.T) {
+	viper.Reset()
+
+	source := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(source, "a.txt"), []byte("a"), 0o600))
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	run := func(args ...string) (string, error) {
+		viper.Reset()
+		cmd := newRootCmd()
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetErr(&out)
+		cmd.SetArgs(append([]string{"roots", "--config", filepath.Join(t.TempDir(), "none.toml")}, args...))
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	out, err := run("--file-root", "/public:"+source)
+	require.NoError(t, err)
+	assert.Regexp(t, `/public\s+`+regexp.QuoteMeta(source)+`\s+\S+\s+\S+\s+1\s+true\s+-`, out)
+
+	out, err = run("--file-root", "/public:"+source, "--file-root", "/gone:"+missing)
+	require.ErrorContains(t, err, "1 of 2 file roots are unusable")
+	assert.Regexp(t, `/gone\s+`+regexp.QuoteMeta(missing)+`\s+-\s+-\s+0\s+false\s+resolve source`, out)
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// maxRefDepth bounds nested $ref resolution, so cyclic references fail
+// instead of recursing forever.
+const maxRefDepth = 32
+
+// BundleOpenAPI reads the OpenAPI document entry from fsys and returns it as
+// a single JSON document. References to other files are inlined, except
+// those to components registered in the root document, which become local
+// references like #/components/schemas/FileResource.
+func BundleOpenAPI(fsys fs.FS, entry string) ([]byte, error) {
+	b := bundler{fsys: fsys, files: make(map[string]any), components: make(map[string]string)}
+	root, err := b.load(entry)
+	if err != nil {
+		return nil, err
+	}
+	doc := objectOf(root)
+	if doc == nil {
+		return nil, fmt.Errorf("openapi %s: root is not an object", entry)
+	}
+
+	sections := objectOf(doc["components"])
+	b.registerComponents(entry, sections)
+	if err := b.inlineComponents(entry, sections); err != nil {
+		return nil, err
+	}
+	for key, value := range doc {
+		if key == "components" {
+			continue
+		}
+		resolved, err := b.resolve(entry, value, 0)
+		if err != nil {
+			return nil, fmt.Errorf("openapi %s: %w", key, err)
+		}
+		doc[key] = resolved
+	}
+
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("encode openapi: %w", err)
+	}
+	return body, nil
+}
+
+// bundler caches the parsed files of one BundleOpenAPI call.
+type bundler struct {
+	fsys fs.FS
+	// files maps file names to their parsed content.
+	files map[string]any
+	// components maps the file#pointer of registered components to their
+	// local reference.
+	components map[string]string
+}
+
+// registerComponents records the local reference of every component the
+// root document entry registers by reference.
+func (b *bundler) registerComponents(entry string, sections map[string]any) {
+	for section, entries := range sections {
+		for name, value := range objectOf(entries) {
+			if ref, ok := refOf(value); ok {
+				b.components[refKey(entry, ref)] = "#/components/" + section + "/" + name
+			}
+		}
+	}
+}
+
+// inlineComponents replaces the references of registered components with
+// the content of their files, rather than letting them point at themselves.
+func (b *bundler) inlineComponents(entry string, sections map[string]any) error {
+	for section, entries := range sections {
+		named := objectOf(entries)
+		for name, value := range named {
+			ref, ok := refOf(value)
+			if !ok {
+				continue
+			}
+			resolved, err := b.inline(entry, ref, 0)
+			if err != nil {
+				return fmt.Errorf("openapi component %s/%s: %w", section, name, err)
+			}
+			named[name] = resolved
+		}
+	}
+	return nil
+}
+
+func (b *bundler) load(name string) (any, error) {
+	if doc, ok := b.files[name]; ok {
+		return doc, nil
+	}
+	data, err := fs.ReadFile(b.fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", name, err)
+	}
+	b.files[name] = doc
+	return doc, nil
+}
+
+// refKey returns the file#pointer a reference found in file points to.
+func refKey(file, ref string) string {
+	target, pointer, _ := strings.Cut(ref, "#")
+	if target == "" {
+		target = file
+	} else {
+		target = path.Join(path.Dir(file), target)
+	}
+	return target + "#" + pointer
+}
+
+// resolve returns a copy of node, found in file, with its references
+// bundled.
+func (b *bundler) resolve(file string, node any, depth int) (any, error) {
+	switch v := node.(type) {
+	case map[string]any:
+		if ref, ok := refOf(v); ok {
+			if local, ok := b.components[refKey(file, ref)]; ok {
+				return map[string]any{"$ref": local}, nil
+			}
+			return b.inline(file, ref, depth)
+		}
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			resolved, err := b.resolve(file, value, depth)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = resolved
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(v))
+		for i, value := range v {
+			resolved, err := b.resolve(file, value, depth)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = resolved
+		}
+		return out, nil
+	}
+	return node, nil
+}
+
+// inline returns the bundled node a reference found in file points to.
+func (b *bundler) inline(file, ref string, depth int) (any, error) {
+	if depth >= maxRefDepth {
+		return nil, fmt.Errorf("reference %s nested too deeply", ref)
+	}
+	target, pointer, _ := strings.Cut(refKey(file, ref), "#")
+	doc, err := b.load(target)
+	if err != nil {
+		return nil, err
+	}
+	node, err := lookupPointer(doc, pointer)
+	if err != nil {
+		return nil, fmt.Errorf("reference %s: %w", ref, err)
+	}
+	return b.resolve(target, node, depth+1)
+}
+
+// lookupPointer returns the node a JSON pointer like /~1api~1v1~1ping
+// selects within doc.
+func lookupPointer(doc any, pointer string) (any, error) {
+	node := doc
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		object := objectOf(node)
+		if object == nil {
+			return nil, fmt.Errorf("no object at %s", token)
+		}
+		var ok bool
+		if node, ok = object[token]; !ok {
+			return nil, fmt.Errorf("missing %s", token)
+		}
+	}
+	return node, nil
+}
+
+// refOf returns the $ref of a reference object.
+func refOf(node any) (string, bool) {
+	ref, ok := objectOf(node)["$ref"].(string)
+	return ref, ok
+}
+
+// objectOf returns node as an object, or nil when it is none.
+func objectOf(node any) map[string]any {
+	if object, ok := node.(map[string]any); ok {
+		return object
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+// Package app wires the configuration into the services the dendrite
+// command runs: the file service, the server, logs, watchers and reloads.
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4/middleware"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/auth"
+	"github.com/thorstenkramm/dendrite-pulse/internal/config"
+	"github.com/thorstenkramm/dendrite-pulse/internal/files"
+	"github.com/thorstenkramm/dendrite-pulse/internal/logging"
+	"github.com/thorstenkramm/dendrite-pulse/internal/server"
+	"github.com/thorstenkramm/dendrite-pulse/internal/systemd"
+)
+
+// ServerConfig sets up what the server needs besides its listeners.
+func ServerConfig(
+	ctx context.Context, cfg config.Config, appLogger *slog.Logger, fileSvc *files.Service,
+) (server.Config, error) {
+	robotsTxt, securityTxt, err := readWebFiles(cfg.Web)
+	if err != nil {
+		return server.Config{}, err
+	}
+
+	apiKeys, oidcProvider, err := newAuth(ctx, cfg.Auth)
+	if err != nil {
+		return server.Config{}, fmt.Errorf("init auth: %w", err)
+	}
+	tlsCfg, err := tlsConfig(logging.ContextWithLogger(ctx, appLogger), cfg.TLS)
+	if err != nil {
+		return server.Config{}, err
+	}
+	trustedProxies, err := config.TrustedProxies(cfg.Main.TrustedProxies)
+	if err != nil {
+		return server.Config{}, err
+	}
+	serverLimits, err := limits(cfg.Limits)
+	if err != nil {
+		return server.Config{}, err
+	}
+
+	return server.Config{
+		Logger:          appLogger,
+		LogRequests:     appLogger != nil,
+		LogErrors:       cfg.Log.Errors,
+		FileService:     fileSvc,
+		FileOptions:     fileHandlerOptions(cfg),
+		RobotsTxt:       robotsTxt,
+		SecurityTxt:     securityTxt,
+		CORS:            corsConfig(cfg.CORS),
+		APIKeys:         apiKeys,
+		OIDC:            oidcProvider,
+		TLS:             tlsCfg,
+		TrustedProxies:  trustedProxies,
+		Limits:          serverLimits,
+		Timeouts:        server.Timeouts(cfg.Timeouts),
+		Tracing:         cfg.Tracing.Endpoint != "",
+		AccessLogFormat: strings.ToLower(cfg.Log.AccessFormat),
+	}, nil
+}
+
+// ServerListeners returns the addresses server.Serve listens on.
+func ServerListeners(cfg config.Config) ([]server.Listener, error) {
+	configured := cfg.EffectiveListeners()
+	listeners := make([]server.Listener, 0, len(configured))
+	for _, l := range configured {
+		listener := server.Listener{Addr: l.Listen, ProxyProtocol: l.ProxyProtocol}
+		if strings.HasPrefix(l.Listen, "unix:") {
+			mode, err := config.SocketMode(l.SocketMode)
+			if err != nil {
+				return nil, fmt.Errorf("listen on %s: %w", l.Listen, err)
+			}
+			listener.SocketMode = mode
+		} else {
+			listener.Addr = net.JoinHostPort(l.Listen, strconv.Itoa(l.Port))
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// limits maps the [limits] configuration onto the server limits.
+func limits(cfg config.LimitsConfig) (server.Limits, error) {
+	maxBodySize, err := config.ParseSize(cfg.MaxBodySize)
+	if err != nil {
+		return server.Limits{}, fmt.Errorf("limits max_body_size: %w", err)
+	}
+	return server.Limits{
+		MaxConcurrentRequests: cfg.MaxConcurrentRequests,
+		MaxConnections:        cfg.MaxConnections,
+		RetryAfter:            cfg.RetryAfter,
+		MaxBodySize:           maxBodySize,
+	}, nil
+}
+
+// ListenAddrs returns the addresses of listeners for logging.
+func ListenAddrs(listeners []server.Listener) []string {
+	addrs := make([]string, 0, len(listeners))
+	for _, l := range listeners {
+		addrs = append(addrs, l.Addr)
+	}
+	return addrs
+}
+
+// tlsConfig loads the certificate of the [tls] configuration and reloads it
+// on changes until ctx is canceled. It returns nil when HTTPS is disabled.
+func tlsConfig(ctx context.Context, cfg config.TLSConfig) (*tls.Config, error) {
+	if cfg.CertFile == "" {
+		return nil, nil
+	}
+	certs, err := server.NewCertReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("init tls: %w", err)
+	}
+	suites, err := config.TLSCipherSuites(cfg.CipherSuites)
+	if err != nil {
+		return nil, fmt.Errorf("tls cipher suites: %w", err)
+	}
+	go func() {
+		if err := certs.Watch(ctx); err != nil {
+			if logger := logging.FromContext(ctx); logger != nil {
+				logger.Warn("tls certificate changes are not picked up", "error", err)
+			}
+		}
+	}()
+	return &tls.Config{
+		GetCertificate: certs.GetCertificate,
+		MinVersion:     config.TLSMinVersion(cfg.MinVersion),
+		CipherSuites:   suites,
+	}, nil
+}
+
+// newAuth parses the API keys and discovers the OIDC provider, which is nil
+// when OIDC is disabled.
+func newAuth(ctx context.Context, cfg config.AuthConfig) (auth.APIKeys, *auth.OIDC, error) {
+	keys, err := auth.ParseAPIKeys(cfg.APIKeys)
+	if err != nil {
+		return nil, nil, fmt.Errorf("api keys: %w", err)
+	}
+	if cfg.OIDC.Issuer == "" {
+		return keys, nil, nil
+	}
+	oidc := cfg.OIDC
+	provider, err := auth.NewOIDC(ctx, auth.OIDCConfig{
+		Issuer:       oidc.Issuer,
+		ClientID:     oidc.ClientID,
+		ClientSecret: oidc.ClientSecret,
+		RedirectURL:  oidc.RedirectURL,
+		Scopes:       oidc.Scopes,
+		GroupsClaim:  oidc.GroupsClaim,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("oidc provider %s: %w", oidc.Issuer, err)
+	}
+	return keys, provider, nil
+}
+
+// corsConfig maps the [cors] configuration onto the CORS middleware.
+func corsConfig(cors config.CORSConfig) middleware.CORSConfig {
+	return middleware.CORSConfig{
+		AllowOrigins: cors.AllowedOrigins,
+		AllowMethods: cors.AllowedMethods,
+		AllowHeaders: cors.AllowedHeaders,
+		MaxAge:       int(cors.MaxAge.Seconds()),
+	}
+}
+
+// readWebFiles loads the configured robots.txt and security.txt contents.
+func readWebFiles(web config.WebConfig) ([]byte, []byte, error) {
+	read := func(file string) ([]byte, error) {
+		if file == "" {
+			return nil, nil
+		}
+		// #nosec G304 -- the path comes from the validated configuration.
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", file, err)
+		}
+		return content, nil
+	}
+
+	robotsTxt, err := read(web.RobotsTxt)
+	if err != nil {
+		return nil, nil, err
+	}
+	securityTxt, err := read(web.SecurityTxt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return robotsTxt, securityTxt, nil
+}
+
+// NotifySystemd tells systemd when the server is ready and when it stops,
+// and serves the systemd watchdog while the server runs. Without a notify
+// socket in the environment it does nothing.
+func NotifySystemd(ctx context.Context, cfgSrv *server.Config, appLogger *slog.Logger) {
+	notify := func(state string) {
+		if _, err := systemd.Notify(state); err != nil && appLogger != nil {
+			appLogger.Warn("systemd notification failed", "state", state, "error", err)
+		}
+	}
+	cfgSrv.Ready = func() {
+		notify(systemd.Ready)
+		go systemd.RunWatchdog(ctx, func(err error) {
+			if appLogger != nil {
+				appLogger.Warn("systemd watchdog notification failed", "error", err)
+			}
+		})
+	}
+	cfgSrv.Stopping = func() { notify(systemd.Stopping) }
+}
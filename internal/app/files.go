@@ -0,0 +1,108 @@
+package app
+
+import (
+	"fmt"
+
+	"golang.org/x/text/language"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/auth"
+	"github.com/thorstenkramm/dendrite-pulse/internal/config"
+	"github.com/thorstenkramm/dendrite-pulse/internal/files"
+)
+
+// NewFileService creates the file service for the configured file roots.
+func NewFileService(cfg config.Config) (*files.Service, error) {
+	opts, err := fileServiceOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	fileSvc, err := files.NewService(FileRoots(cfg), opts)
+	if err != nil {
+		return nil, fmt.Errorf("init file service: %w", err)
+	}
+	return fileSvc, nil
+}
+
+// FileRoots converts the configured file roots for the file service.
+func FileRoots(cfg config.Config) []files.Root {
+	roots := make([]files.Root, 0, len(cfg.FileRoots))
+	for _, root := range cfg.FileRoots {
+		roots = append(roots, files.Root{
+			Virtual:               root.Virtual,
+			Source:                root.Source,
+			Manifest:              root.Manifest,
+			DefaultLimit:          root.DefaultLimit,
+			Access:                files.AccessPolicy{Allow: accessRules(root.Allow), Deny: accessRules(root.Deny)},
+			ReadOnly:              root.ReadOnly,
+			FollowSymlinksOutside: root.FollowSymlinksOutside,
+			ShowHidden:            root.ShowHidden,
+			HiddenPatterns:        root.HiddenPatterns,
+		})
+	}
+	return roots
+}
+
+// accessRules maps file root rules onto the file service, identifying API
+// keys by digest like authenticated requests.
+func accessRules(rules []config.AccessRule) []files.AccessRule {
+	mapped := make([]files.AccessRule, 0, len(rules))
+	for _, rule := range rules {
+		keys := make([]string, len(rule.APIKeys))
+		for i, key := range rule.APIKeys {
+			keys[i] = auth.KeyID(key)
+		}
+		mapped = append(mapped, files.AccessRule{APIKeys: keys, Users: rule.Users, Groups: rule.Groups, Scopes: rule.Scopes})
+	}
+	return mapped
+}
+
+// fileServiceOptions maps the [files] configuration onto the file service options.
+func fileServiceOptions(cfg config.Config) (files.Options, error) {
+	thumbnailCacheSize, err := config.ParseSize(cfg.Files.ThumbnailCacheSize)
+	if err != nil {
+		return files.Options{}, fmt.Errorf("files thumbnail_cache_size: %w", err)
+	}
+	return files.Options{
+		ExportBase:          cfg.Files.ExportBase,
+		SniffBytes:          cfg.Files.SniffBytes,
+		MaxSymlinkDepth:     cfg.Files.MaxSymlinkDepth,
+		HideOwnership:       !cfg.Files.ExposeOwnership,
+		NumericOwners:       !cfg.Files.ResolveOwners,
+		ExposeFileID:        cfg.Files.ExposeFileID,
+		MaxOpenFiles:        cfg.Files.MaxOpenFiles,
+		MaxPathDepth:        cfg.Files.MaxPathDepth,
+		ExposeACL:           cfg.Files.ExposeACL,
+		StartupConcurrency:  cfg.Files.StartupConcurrency,
+		ListConcurrency:     cfg.Files.ListConcurrency,
+		RespectGitignore:    cfg.Files.RespectGitignore,
+		ListingCacheTTL:     cfg.Files.ListingCacheTTL,
+		ListingCacheEntries: cfg.Files.ListingCacheEntries,
+		MimeTypes:           cfg.MimeTypes,
+		ThumbnailCacheDir:   cfg.Files.ThumbnailCacheDir,
+		ThumbnailCacheSize:  thumbnailCacheSize,
+	}, nil
+}
+
+// fileHandlerOptions maps the [files] and [api] configuration onto the file route options.
+func fileHandlerOptions(cfg config.Config) files.HandlerOptions {
+	return files.HandlerOptions{
+		AnonymousWrites:       cfg.Files.AnonymousWrites,
+		CanonicalRedirect:     cfg.Files.CanonicalRedirect,
+		StrictPaths:           cfg.Files.StrictPaths,
+		CaseInsensitive:       cfg.Files.CaseInsensitive,
+		SigningSecret:         cfg.Files.SigningSecret,
+		SigningMaxTTL:         cfg.Files.SigningMaxTTL,
+		SiblingExtensions:     cfg.Files.SiblingExtensions,
+		RespectLocks:          cfg.Files.RespectLocks,
+		GeneratedAt:           cfg.Files.GeneratedAt,
+		RejectEmptyRanges:     cfg.Files.RejectEmptyRanges,
+		SizeAsString:          cfg.API.SizeAsString,
+		RejectDuplicateParams: cfg.API.RejectDuplicateParams,
+		ServerTiming:          cfg.API.ServerTiming,
+		StreamListings:        cfg.API.StreamListings,
+		Debug:                 cfg.API.Debug,
+		Collation:             cfg.API.Collation,
+		CollationLocale:       language.Make(cfg.API.CollationLocale),
+		ListingMimeDetection:  cfg.API.ListingMimeDetection,
+	}
+}
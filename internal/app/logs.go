@@ -0,0 +1,131 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/audit"
+	"github.com/thorstenkramm/dendrite-pulse/internal/config"
+	"github.com/thorstenkramm/dendrite-pulse/internal/logging"
+	"github.com/thorstenkramm/dendrite-pulse/internal/pidfile"
+	"github.com/thorstenkramm/dendrite-pulse/internal/tracing"
+)
+
+// SetupLogger returns nil when logFile is empty. The level of the logger can
+// be changed through the returned LevelVar.
+func SetupLogger(logFile, logFormat, logLevel string) (*slog.Logger, *slog.LevelVar, func() error, error) {
+	if logFile == "" {
+		return nil, nil, nil, nil
+	}
+
+	lvl, err := logging.ParseLevel(logLevel)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("setup logger: %w", err)
+	}
+	levelVar := new(slog.LevelVar)
+	levelVar.Set(lvl)
+	logger, closer, err := logging.New(logFile, logFormat, levelVar)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("setup logger: %w", err)
+	}
+
+	return logger, levelVar, closer, nil
+}
+
+// OpenRequestLogs opens the access and audit logs, each nil when not
+// configured. The returned function closes both.
+func OpenRequestLogs(cfg config.Config) (io.Writer, *audit.Log, func(), error) {
+	accessLog, closeAccessLog, err := openAccessLog(cfg.Log.AccessFile)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	auditLog, closeAuditLog, err := openAuditLog(cfg.Audit)
+	if err != nil {
+		closeAccessLog()
+		return nil, nil, nil, err
+	}
+	return accessLog, auditLog, func() {
+		closeAuditLog()
+		closeAccessLog()
+	}, nil
+}
+
+// openAccessLog opens the access log unless path is empty. The returned
+// function closes the file.
+func openAccessLog(path string) (io.Writer, func(), error) {
+	if path == "" {
+		return nil, func() {}, nil
+	}
+	w, closer, err := logging.OpenFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open access log: %w", err)
+	}
+	if closer == nil {
+		return w, func() {}, nil
+	}
+	return w, func() { _ = closer() }, nil
+}
+
+// openAuditLog opens the audit log file or connects to syslog, unless
+// neither is configured. The returned function closes the audit log.
+func openAuditLog(cfg config.AuditConfig) (*audit.Log, func(), error) {
+	switch {
+	case cfg.Syslog:
+		w, err := audit.Syslog(cfg.SyslogTag)
+		if err != nil {
+			return nil, nil, fmt.Errorf("open audit log: %w", err)
+		}
+		return audit.New(w), func() { _ = w.Close() }, nil
+	case cfg.File != "":
+		w, closer, err := logging.OpenFile(cfg.File)
+		if err != nil {
+			return nil, nil, fmt.Errorf("open audit log: %w", err)
+		}
+		if closer == nil {
+			return audit.New(w), func() {}, nil
+		}
+		return audit.New(w), func() { _ = closer() }, nil
+	default:
+		return nil, func() {}, nil
+	}
+}
+
+// StartTracing exports traces when an endpoint is configured. The returned
+// function flushes the spans still pending.
+func StartTracing(ctx context.Context, cfg config.TracingConfig, appLogger *slog.Logger) (func(), error) {
+	if cfg.Endpoint == "" {
+		return func() {}, nil
+	}
+	shutdown, err := tracing.Setup(ctx, tracing.Config{
+		Endpoint:    cfg.Endpoint,
+		Headers:     cfg.Headers,
+		ServiceName: cfg.ServiceName,
+		SampleRatio: cfg.SampleRatio,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("init tracing: %w", err)
+	}
+	return func() {
+		flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if err := shutdown(flushCtx); err != nil && appLogger != nil {
+			appLogger.Error("flush traces", "error", err)
+		}
+	}, nil
+}
+
+// WritePIDFile writes the PID file unless path is empty. The returned
+// function removes it.
+func WritePIDFile(path string) (func(), error) {
+	if path == "" {
+		return func() {}, nil
+	}
+	remove, err := pidfile.Write(path)
+	if err != nil {
+		return nil, fmt.Errorf("pid file: %w", err)
+	}
+	return func() { _ = remove() }, nil
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/config"
+	"github.com/thorstenkramm/dendrite-pulse/internal/files"
+	"github.com/thorstenkramm/dendrite-pulse/internal/logging"
+)
+
+// ReloadOnHangup reloads the configuration with load on SIGHUP until ctx is
+// canceled. Reloading swaps the file roots and the log level; other settings
+// only apply after a restart. An invalid configuration is logged and ignored.
+func ReloadOnHangup(
+	ctx context.Context, load func() (config.Config, error), fileSvc *files.Service, levelVar *slog.LevelVar,
+	appLogger *slog.Logger,
+) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hangup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+			}
+			err := reload(load, fileSvc, levelVar)
+			if appLogger == nil {
+				continue
+			}
+			if err != nil {
+				appLogger.Error("config reload failed, keeping the current config", "error", err)
+			} else {
+				appLogger.Info("config reloaded", "file_roots", len(fileSvc.Roots()))
+			}
+		}
+	}()
+}
+
+// reload loads and validates the configuration again and applies its
+// file roots and log level. Nothing is applied when it fails.
+func reload(load func() (config.Config, error), fileSvc *files.Service, levelVar *slog.LevelVar) error {
+	cfg, err := load()
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	lvl, err := logging.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return fmt.Errorf("log level: %w", err)
+	}
+	if err := fileSvc.ReplaceRoots(FileRoots(cfg)); err != nil {
+		return fmt.Errorf("replace file roots: %w", err)
+	}
+	if levelVar != nil {
+		levelVar.Set(lvl)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/config"
+)
+
+func TestReload(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "config.toml")
+	public := filepath.Join(tmpDir, "public")
+	archive := filepath.Join(tmpDir, "archive")
+	require.NoError(t, os.MkdirAll(public, 0o750))
+	require.NoError(t, os.MkdirAll(archive, 0o750))
+	writeConfig := func(level, roots string) {
+		content := "[log]\nlevel = \"" + level + "\"\n" + roots
+		require.NoError(t, os.WriteFile(cfgPath, []byte(content), 0o600))
+	}
+	root := func(virtual, source string) string {
+		return "[[file-root]]\nvirtual = \"" + virtual + "\"\nsource = \"" + source + "\"\n"
+	}
+
+	writeConfig("info", root("/public", public))
+	load := func() (config.Config, error) { return config.Load(cfgPath) }
+	cfg, err := load()
+	require.NoError(t, err)
+	fileSvc, err := NewFileService(cfg)
+	require.NoError(t, err)
+	levelVar := new(slog.LevelVar)
+
+	writeConfig("debug", root("/public", public)+root("/archive", archive))
+	require.NoError(t, reload(load, fileSvc, levelVar))
+	assert.Len(t, fileSvc.Roots(), 2)
+	assert.Equal(t, slog.LevelDebug, levelVar.Level())
+
+	writeConfig("warn", root("/missing", filepath.Join(tmpDir, "missing")))
+	require.Error(t, reload(load, fileSvc, levelVar))
+	assert.Len(t, fileSvc.Roots(), 2, "an invalid config leaves the roots unchanged")
+	assert.Equal(t, slog.LevelDebug, levelVar.Level())
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"path"
+	"slices"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/config"
+	"github.com/thorstenkramm/dendrite-pulse/internal/files"
+	"github.com/thorstenkramm/dendrite-pulse/internal/watch"
+	"github.com/thorstenkramm/dendrite-pulse/internal/webhook"
+)
+
+// StartWatcher watches the file roots the webhooks or, with api.events,
+// the event stream need, and posts their changes to the webhooks until ctx
+// is canceled. It returns nil when nothing needs watching. The roots are
+// watched as they are now; roots added on reload are not.
+func StartWatcher(
+	ctx context.Context, cfg config.Config, fileSvc *files.Service, appLogger *slog.Logger,
+) *watch.Watcher {
+	targets := webhookTargets(cfg.Webhooks)
+	var roots []watch.Root
+	for _, root := range fileSvc.Roots() {
+		if cfg.API.Events || slices.ContainsFunc(targets, func(t webhook.Target) bool { return t.Wants(root.Virtual) }) {
+			roots = append(roots, watch.Root{Virtual: root.Virtual, Source: root.Source})
+		}
+	}
+	if len(roots) == 0 {
+		return nil
+	}
+
+	w := watch.New(roots, appLogger)
+	if cfg.Files.ListingCacheTTL > 0 {
+		// Changes seen by the watcher take effect before the TTL expires.
+		w.Subscribe(func(ev watch.Event) { fileSvc.InvalidateListing(ev.Path) })
+	}
+	go func() {
+		if err := w.Run(ctx); err != nil && appLogger != nil {
+			appLogger.Error("file root watch failed", "error", err)
+		}
+	}()
+	if len(targets) > 0 {
+		go webhook.New(targets, appLogger).Run(ctx, w)
+	}
+	return w
+}
+
+// webhookTargets converts the configured webhooks.
+func webhookTargets(hooks []config.WebhookConfig) []webhook.Target {
+	targets := make([]webhook.Target, 0, len(hooks))
+	for _, hook := range hooks {
+		roots := make([]string, 0, len(hook.Roots))
+		for _, root := range hook.Roots {
+			roots = append(roots, path.Clean(root))
+		}
+		targets = append(targets, webhook.Target{URL: hook.URL, Secret: hook.Secret, Roots: roots})
+	}
+	return targets
+}
@@ -0,0 +1,74 @@
+// Package audit records who changed which file, for compliance in shared
+// storage deployments. Entries are appended as JSON lines, one per change.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Results of an audited operation.
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	// ResultDenied marks operations the client lacked the scope for.
+	ResultDenied = "denied"
+)
+
+// Event describes one mutating operation.
+type Event struct {
+	Time time.Time `json:"time"`
+	// Action is the operation, e.g. move, chmod, chown or chtimes.
+	Action string `json:"action"`
+	// Path is the virtual path of the entry operated on.
+	Path string `json:"path"`
+	// Destination is the virtual path a move targets.
+	Destination string `json:"destination,omitempty"`
+	// Detail holds the new value, e.g. the permission mode of a chmod.
+	Detail string `json:"detail,omitempty"`
+	// Subject is the OIDC subject and APIKey the sha256:<hex digest> of the
+	// API key of the client; both are empty for anonymous clients.
+	Subject   string `json:"subject,omitempty"`
+	APIKey    string `json:"api_key,omitempty"`
+	RemoteIP  string `json:"remote_ip"`
+	RequestID string `json:"request_id,omitempty"`
+	Result    string `json:"result"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Log appends events to a writer. A nil *Log records nothing.
+type Log struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// New returns a Log appending to w.
+func New(w io.Writer) *Log {
+	return &Log{w: w}
+}
+
+// Record appends ev, stamping it with the current time unless set. Each
+// event is written with a single Write call.
+func (l *Log) Record(ev Event) error {
+	if l == nil {
+		return nil
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("encode audit event: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(line); err != nil {
+		return fmt.Errorf("write audit event: %w", err)
+	}
+	return nil
+}
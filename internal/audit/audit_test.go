@@ -0,0 +1,36 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecord(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf)
+
+	require.NoError(t, l.Record(Event{Action: "chmod", Path: "/public/a.txt", Detail: "0640", Result: ResultSuccess}))
+	require.NoError(t, l.Record(Event{Action: "move", Path: "/public/a.txt", Result: ResultDenied}))
+
+	dec := json.NewDecoder(&buf)
+	var ev Event
+	require.NoError(t, dec.Decode(&ev))
+	assert.Equal(t, "chmod", ev.Action)
+	assert.Equal(t, "0640", ev.Detail)
+	assert.Equal(t, ResultSuccess, ev.Result)
+	assert.WithinDuration(t, time.Now(), ev.Time, time.Minute)
+
+	require.NoError(t, dec.Decode(&ev))
+	assert.Equal(t, ResultDenied, ev.Result)
+	assert.False(t, dec.More())
+}
+
+func TestRecord_Nil(t *testing.T) {
+	var l *Log
+	require.NoError(t, l.Record(Event{Action: "chmod"}))
+}
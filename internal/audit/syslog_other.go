@@ -0,0 +1,13 @@
+//go:build !unix
+
+package audit
+
+import (
+	"errors"
+	"io"
+)
+
+// Syslog reports an error on platforms without syslog.
+func Syslog(string) (io.WriteCloser, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package audit
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+)
+
+// Syslog returns a writer sending each audit event as a message to the
+// local syslog daemon, tagged with tag, at notice level of the authpriv
+// facility.
+func Syslog(tag string) (io.WriteCloser, error) {
+	w, err := syslog.New(syslog.LOG_NOTICE|syslog.LOG_AUTHPRIV, tag)
+	if err != nil {
+		return nil, fmt.Errorf("connect to syslog: %w", err)
+	}
+	return w, nil
+}
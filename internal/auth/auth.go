@@ -0,0 +1,87 @@
+// Package auth identifies API clients by API key or OpenID Connect token.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// hashedKeyPrefix marks configured API keys stored as their SHA-256 digest.
+const hashedKeyPrefix = "sha256:"
+
+// Identity describes the authenticated client of a request.
+type Identity struct {
+	// Subject is the OIDC subject; empty for API keys.
+	Subject string
+	// Groups lists the OIDC groups of the subject.
+	Groups []string
+	// APIKey is sha256:<hex digest> of the API key the client sent; empty
+	// for OIDC tokens.
+	APIKey string
+}
+
+type ctxKey struct{}
+
+// ContextWithIdentity stores the client identity in the context.
+func ContextWithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// IdentityFromContext returns the client identity stored in the context.
+// It reports false for anonymous requests.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(ctxKey{}).(Identity)
+	return id, ok
+}
+
+// APIKeys holds the SHA-256 digests of the accepted API keys.
+type APIKeys [][sha256.Size]byte
+
+// ParseAPIKeys returns the digests of configured API keys. Entries are
+// either plain keys or sha256:<hex digest>, so the configuration need not
+// contain the keys themselves.
+func ParseAPIKeys(entries []string) (APIKeys, error) {
+	keys := make(APIKeys, 0, len(entries))
+	for _, entry := range entries {
+		hexDigest, hashed := strings.CutPrefix(entry, hashedKeyPrefix)
+		if !hashed {
+			keys = append(keys, sha256.Sum256([]byte(entry)))
+			continue
+		}
+		digest, err := hex.DecodeString(hexDigest)
+		if err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("invalid API key digest: %s", entry)
+		}
+		keys = append(keys, [sha256.Size]byte(digest))
+	}
+	return keys, nil
+}
+
+// Identify returns the identity of key, or false when it is not one of the
+// accepted keys. Every digest is compared in constant time, so timing does
+// not reveal which one matched.
+func (k APIKeys) Identify(key string) (Identity, bool) {
+	digest := sha256.Sum256([]byte(key))
+	match := 0
+	for _, accepted := range k {
+		match |= subtle.ConstantTimeCompare(digest[:], accepted[:])
+	}
+	if match != 1 {
+		return Identity{}, false
+	}
+	return Identity{APIKey: hashedKeyPrefix + hex.EncodeToString(digest[:])}, true
+}
+
+// KeyID returns the sha256:<hex digest> a configured API key entry is
+// identified by in Identity.APIKey.
+func KeyID(entry string) string {
+	if digest, hashed := strings.CutPrefix(entry, hashedKeyPrefix); hashed {
+		return hashedKeyPrefix + strings.ToLower(digest)
+	}
+	digest := sha256.Sum256([]byte(entry))
+	return hashedKeyPrefix + hex.EncodeToString(digest[:])
+}
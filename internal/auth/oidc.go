@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// SessionCookie carries the ID token of browser sessions started with
+	// the authorization code flow.
+	SessionCookie = "dendrite_session"
+	// stateCookie carries the state and return path of a pending login.
+	stateCookie = "dendrite_oidc_state"
+	// stateTTL bounds how long a login may take at the provider.
+	stateTTL = 10 * time.Minute
+	// defaultReturnTo is where browsers land after a login without return_to.
+	defaultReturnTo = "/api/v1/files"
+)
+
+// OIDCConfig configures OpenID Connect authentication.
+type OIDCConfig struct {
+	// Issuer is the provider URL; its discovery document is read from
+	// <Issuer>/.well-known/openid-configuration.
+	Issuer string
+	// ClientID is the audience tokens must be issued for.
+	ClientID string
+	// ClientSecret and RedirectURL enable the authorization code flow for
+	// browsers. RedirectURL must point at /api/v1/auth/callback.
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// GroupsClaim names the token claim listing the subject's groups.
+	GroupsClaim string
+}
+
+// OIDC validates OpenID Connect ID tokens and runs the authorization code
+// flow for browsers.
+type OIDC struct {
+	verifier    *oidc.IDTokenVerifier
+	oauth       oauth2.Config
+	groupsClaim string
+	secure      bool
+}
+
+// NewOIDC discovers the provider of cfg.Issuer. The provider's signing keys
+// are fetched on demand with ctx, so ctx should live as long as the server.
+func NewOIDC(ctx context.Context, cfg OIDCConfig) (*OIDC, error) {
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	return &OIDC{
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       cfg.Scopes,
+		},
+		groupsClaim: cfg.GroupsClaim,
+		secure:      strings.HasPrefix(cfg.RedirectURL, "https://"),
+	}, nil
+}
+
+// BrowserFlow reports whether the authorization code flow is configured.
+func (o *OIDC) BrowserFlow() bool {
+	return o.oauth.RedirectURL != ""
+}
+
+// Verify checks the signature, issuer, audience and expiry of an ID token
+// and returns the identity it asserts.
+func (o *OIDC) Verify(ctx context.Context, rawToken string) (Identity, error) {
+	token, err := o.verifier.Verify(ctx, rawToken)
+	if err != nil {
+		return Identity{}, fmt.Errorf("verify id token: %w", err)
+	}
+	return o.identity(token)
+}
+
+func (o *OIDC) identity(token *oidc.IDToken) (Identity, error) {
+	var claims map[string]any
+	if err := token.Claims(&claims); err != nil {
+		return Identity{}, fmt.Errorf("decode id token claims: %w", err)
+	}
+	id := Identity{Subject: token.Subject}
+	switch groups := claims[o.groupsClaim].(type) {
+	case string:
+		id.Groups = []string{groups}
+	case []any:
+		for _, group := range groups {
+			if name, ok := group.(string); ok {
+				id.Groups = append(id.Groups, name)
+			}
+		}
+	}
+	return id, nil
+}
+
+// Login answers GET /api/v1/auth/login?return_to=<path> by redirecting the
+// browser to the provider. The state cookie ties the callback to this
+// browser.
+func (o *OIDC) Login(c echo.Context) error {
+	returnTo := c.QueryParam("return_to")
+	if returnTo == "" {
+		returnTo = defaultReturnTo
+	}
+	if !isLocalPath(returnTo) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid return_to: %s", returnTo))
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("create oidc state: %w", err)
+	}
+	state := base64.RawURLEncoding.EncodeToString(buf)
+
+	c.SetCookie(o.cookie(stateCookie, state+"."+base64.RawURLEncoding.EncodeToString([]byte(returnTo)), stateTTL))
+	return c.Redirect(http.StatusFound, o.oauth.AuthCodeURL(state, oidc.Nonce(state)))
+}
+
+// Callback answers the provider's redirect to GET /api/v1/auth/callback. It
+// exchanges the code for an ID token, verifies it and stores it in the
+// session cookie before sending the browser to the path it came from.
+func (o *OIDC) Callback(c echo.Context) error {
+	pending, err := c.Cookie(stateCookie)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "no login in progress")
+	}
+	state, encoded, _ := strings.Cut(pending.Value, ".")
+	returnTo, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || state == "" || c.QueryParam("state") != state {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid login state")
+	}
+	c.SetCookie(o.cookie(stateCookie, "", -1))
+	if reason := c.QueryParam("error"); reason != "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, fmt.Sprintf("login failed: %s", reason))
+	}
+
+	ctx := c.Request().Context()
+	token, err := o.oauth.Exchange(ctx, c.QueryParam("code"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login failed: code exchange rejected")
+	}
+	rawToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login failed: no id token")
+	}
+	idToken, err := o.verifier.Verify(ctx, rawToken)
+	if err != nil || idToken.Nonce != state {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login failed: invalid id token")
+	}
+
+	c.SetCookie(o.cookie(SessionCookie, rawToken, time.Until(idToken.Expiry)))
+	if !isLocalPath(string(returnTo)) {
+		returnTo = []byte(defaultReturnTo)
+	}
+	return c.Redirect(http.StatusFound, string(returnTo))
+}
+
+// cookie returns an HTTP-only cookie for the whole API. A negative ttl
+// deletes it.
+func (o *OIDC) cookie(name, value string, ttl time.Duration) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/api/",
+		MaxAge:   max(int(ttl.Seconds()), -1),
+		HttpOnly: true,
+		Secure:   o.secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// SessionToken returns the ID token of the session cookie, or "" when the
+// request has none.
+func SessionToken(req *http.Request) string {
+	cookie, err := req.Cookie(SessionCookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// isLocalPath reports whether p is an absolute path on this server, so
+// redirecting to it cannot leave the site.
+func isLocalPath(p string) bool {
+	u, err := url.Parse(p)
+	return err == nil && u.Scheme == "" && u.Host == "" && strings.HasPrefix(p, "/") &&
+		!strings.HasPrefix(p, "//") && !strings.Contains(p, `\`)
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOIDCVerify(t *testing.T) {
+	idp := newTestProvider(t)
+	provider, err := NewOIDC(context.Background(), OIDCConfig{
+		Issuer: idp.URL, ClientID: "dendrite", GroupsClaim: "groups",
+	})
+	require.NoError(t, err)
+	assert.False(t, provider.BrowserFlow())
+
+	id, err := provider.Verify(context.Background(), idp.token(t, "dendrite", time.Hour, ""))
+	require.NoError(t, err)
+	assert.Equal(t, Identity{Subject: "alice", Groups: []string{"staff", "admins"}}, id)
+
+	_, err = provider.Verify(context.Background(), idp.token(t, "other-client", time.Hour, ""))
+	require.Error(t, err, "wrong audience")
+	_, err = provider.Verify(context.Background(), idp.token(t, "dendrite", -time.Minute, ""))
+	require.Error(t, err, "expired")
+	_, err = provider.Verify(context.Background(), "not-a-token")
+	require.Error(t, err)
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	idp := newTestProvider(t)
+	provider, err := NewOIDC(context.Background(), OIDCConfig{
+		Issuer:       idp.URL,
+		ClientID:     "dendrite",
+		ClientSecret: "secret",
+		RedirectURL:  "https://files.example.com/api/v1/auth/callback",
+		Scopes:       []string{"openid"},
+		GroupsClaim:  "groups",
+	})
+	require.NoError(t, err)
+	require.True(t, provider.BrowserFlow())
+	e := echo.New()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/login?return_to=//evil.example.com", nil)
+	rec := httptest.NewRecorder()
+	require.Error(t, provider.Login(e.NewContext(req, rec)), "external return_to")
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/auth/login?return_to=/api/v1/files/public", nil)
+	rec = httptest.NewRecorder()
+	require.NoError(t, provider.Login(e.NewContext(req, rec)))
+	require.Equal(t, http.StatusFound, rec.Code)
+	location, err := url.Parse(rec.Header().Get(echo.HeaderLocation))
+	require.NoError(t, err)
+	assert.Equal(t, idp.URL+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+	state := location.Query().Get("state")
+	require.NotEmpty(t, state)
+	assert.Equal(t, state, location.Query().Get("nonce"))
+	stateCookies := rec.Result().Cookies()
+	require.Len(t, stateCookies, 1)
+	idp.nonce = state
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/auth/callback?code=abc&state=forged", nil)
+	req.AddCookie(stateCookies[0])
+	rec = httptest.NewRecorder()
+	require.Error(t, provider.Callback(e.NewContext(req, rec)), "state mismatch")
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/auth/callback?code=abc&state="+state, nil)
+	req.AddCookie(stateCookies[0])
+	rec = httptest.NewRecorder()
+	require.NoError(t, provider.Callback(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "/api/v1/files/public", rec.Header().Get(echo.HeaderLocation))
+
+	session := httptest.NewRequest(http.MethodGet, "/api/v1/files", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == SessionCookie {
+			assert.True(t, cookie.HttpOnly)
+			assert.True(t, cookie.Secure)
+			session.AddCookie(cookie)
+		}
+	}
+	id, err := provider.Verify(context.Background(), SessionToken(session))
+	require.NoError(t, err)
+	assert.Equal(t, "alice", id.Subject)
+}
+
+func TestAPIKeysIdentify(t *testing.T) {
+	keys, err := ParseAPIKeys([]string{
+		"0123456789abcdef0123456789abcdef",
+		"sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", // "test"
+	})
+	require.NoError(t, err)
+
+	id, ok := keys.Identify("test")
+	require.True(t, ok)
+	assert.Equal(t, "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", id.APIKey)
+	_, ok = keys.Identify("0123456789abcdef0123456789abcdef")
+	assert.True(t, ok)
+	_, ok = keys.Identify("wrong")
+	assert.False(t, ok)
+
+	_, err = ParseAPIKeys([]string{"sha256:abc"})
+	require.Error(t, err)
+}
+
+// testProvider is a minimal OpenID provider signing tokens for subject
+// alice.
+type testProvider struct {
+	*httptest.Server
+	key   *rsa.PrivateKey
+	nonce string
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	idp := &testProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(t, w, map[string]any{
+			"issuer":                                idp.URL,
+			"authorization_endpoint":                idp.URL + "/authorize",
+			"token_endpoint":                        idp.URL + "/token",
+			"jwks_uri":                              idp.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(t, w, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: string(jose.RS256), Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "abc", r.PostForm.Get("code"))
+		writeJSON(t, w, map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     idp.token(t, "dendrite", time.Hour, idp.nonce),
+		})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// token returns an ID token for audience expiring after ttl.
+func (p *testProvider) token(t *testing.T, audience string, ttl time.Duration, nonce string) string {
+	t.Helper()
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.RS256,
+		Key:       jose.JSONWebKey{Key: p.key, KeyID: "test"},
+	}, nil)
+	require.NoError(t, err)
+	claims, err := json.Marshal(map[string]any{
+		"iss":    p.URL,
+		"sub":    "alice",
+		"aud":    audience,
+		"iat":    time.Now().Unix(),
+		"exp":    time.Now().Add(ttl).Unix(),
+		"nonce":  nonce,
+		"groups": []string{"staff", "admins"},
+	})
+	require.NoError(t, err)
+	signed, err := signer.Sign(claims)
+	require.NoError(t, err)
+	raw, err := signed.CompactSerialize()
+	require.NoError(t, err)
+	return raw
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, v any) {
+	t.Helper()
+	w.Header().Set("Content-Type", "application/json")
+	require.NoError(t, json.NewEncoder(w).Encode(v))
+}
@@ -2,30 +2,191 @@
 package config
 
 import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"fmt"
+	"io/fs"
+	"mime"
 	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/labstack/gommon/bytes"
+	"golang.org/x/text/language"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/parallel"
 )
 
 // Config represents application configuration.
 type Config struct {
-	Main      MainConfig `mapstructure:"main"`
-	Log       LogConfig  `mapstructure:"log"`
-	FileRoots []FileRoot `mapstructure:"file-root"`
+	Main      MainConfig     `mapstructure:"main"`
+	Log       LogConfig      `mapstructure:"log"`
+	Files     FilesConfig    `mapstructure:"files"`
+	API       APIConfig      `mapstructure:"api"`
+	Web       WebConfig      `mapstructure:"web"`
+	CORS      CORSConfig     `mapstructure:"cors"`
+	Auth      AuthConfig     `mapstructure:"auth"`
+	TLS       TLSConfig      `mapstructure:"tls"`
+	Limits    LimitsConfig   `mapstructure:"limits"`
+	Timeouts  TimeoutsConfig `mapstructure:"timeouts"`
+	Tracing   TracingConfig  `mapstructure:"tracing"`
+	Audit     AuditConfig    `mapstructure:"audit"`
+	FileRoots []FileRoot     `mapstructure:"file-root"`
+	// MimeTypes maps lowercase file name extensions with their leading dot
+	// to the MIME types reported in place of sniffed ones.
+	MimeTypes map[string]string `mapstructure:"mime"`
+	// Listeners replace the address of Main when set.
+	Listeners []ListenerConfig `mapstructure:"listener"`
+	Webhooks  []WebhookConfig  `mapstructure:"webhook"`
+}
+
+// TLSConfig enables HTTPS. The server speaks plain HTTP while CertFile and
+// KeyFile are empty.
+type TLSConfig struct {
+	CertFile   string `mapstructure:"cert_file"`
+	KeyFile    string `mapstructure:"key_file"`
+	MinVersion string `mapstructure:"min_version"`
+	// CipherSuites restricts the TLS 1.2 cipher suites by name, e.g.
+	// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. TLS 1.3 suites are not
+	// configurable. Empty uses Go's defaults.
+	CipherSuites []string `mapstructure:"cipher_suites"`
+}
+
+// LimitsConfig protects small servers from overload. Zero means no limit.
+type LimitsConfig struct {
+	MaxConcurrentRequests int           `mapstructure:"max_concurrent_requests"`
+	MaxConnections        int           `mapstructure:"max_connections"`
+	RetryAfter            time.Duration `mapstructure:"retry_after"`
+	// MaxBodySize is a size like 10M; empty or 0 means no limit.
+	MaxBodySize string `mapstructure:"max_body_size"`
+}
+
+// TimeoutsConfig bounds how long clients and handlers may take. Zero
+// disables a timeout.
+type TimeoutsConfig struct {
+	ReadHeader time.Duration `mapstructure:"read_header"`
+	Read       time.Duration `mapstructure:"read"`
+	Write      time.Duration `mapstructure:"write"`
+	Idle       time.Duration `mapstructure:"idle"`
+	Handler    time.Duration `mapstructure:"handler"`
+}
+
+// AuditConfig selects where changes of files are recorded.
+type AuditConfig struct {
+	// File receives one JSON line per change; "-" is stdout.
+	File string `mapstructure:"file"`
+	// Syslog sends the changes to the local syslog daemon instead.
+	Syslog    bool   `mapstructure:"syslog"`
+	SyslogTag string `mapstructure:"syslog_tag"`
+}
+
+// WebhookConfig posts the changes below file roots to URL.
+type WebhookConfig struct {
+	URL string `mapstructure:"url"`
+	// Secret signs the requests with HMAC-SHA256; empty sends them unsigned.
+	Secret string `mapstructure:"secret"`
+	// Roots limits the events to these virtual folders; empty covers all
+	// file roots.
+	Roots []string `mapstructure:"roots"`
+}
+
+// TracingConfig exports OpenTelemetry traces. Tracing is disabled while
+// Endpoint is empty.
+type TracingConfig struct {
+	// Endpoint is the URL of an OTLP/HTTP traces endpoint.
+	Endpoint    string            `mapstructure:"endpoint"`
+	Headers     map[string]string `mapstructure:"headers"`
+	ServiceName string            `mapstructure:"service_name"`
+	SampleRatio float64           `mapstructure:"sample_ratio"`
 }
 
 // FileRoot maps a virtual folder to a source directory.
 type FileRoot struct {
-	Virtual string `mapstructure:"virtual"`
-	Source  string `mapstructure:"source"`
+	Virtual      string `mapstructure:"virtual"`
+	Source       string `mapstructure:"source"`
+	Manifest     string `mapstructure:"manifest"`
+	DefaultLimit int    `mapstructure:"default_limit"`
+	// ReadOnly rejects changes to the root's entries with 403.
+	ReadOnly bool `mapstructure:"read_only"`
+	// FollowSymlinksOutside lists absolute folders outside Source that
+	// symlinks within the root may point into.
+	FollowSymlinksOutside []string `mapstructure:"follow_symlinks_outside"`
+	// ShowHidden lists dotfiles and entries matching HiddenPatterns, which
+	// are hidden by default.
+	ShowHidden     bool     `mapstructure:"show_hidden"`
+	HiddenPatterns []string `mapstructure:"hidden_patterns"`
+	// Allow and Deny restrict which clients may use the root.
+	Allow []AccessRule `mapstructure:"allow"`
+	Deny  []AccessRule `mapstructure:"deny"`
+}
+
+// AccessRule matches clients by API key, OIDC subject or group and grants
+// or denies them scopes of a file root. Without principals it matches every
+// client; without scopes it covers all of them.
+type AccessRule struct {
+	APIKeys []string `mapstructure:"api_keys"`
+	Users   []string `mapstructure:"users"`
+	Groups  []string `mapstructure:"groups"`
+	Scopes  []string `mapstructure:"scopes"`
 }
 
 // MainConfig covers network binding.
 type MainConfig struct {
+	// Listen is an IP address, or unix:<absolute path> of a Unix domain
+	// socket, in which case Port is ignored.
 	Listen string `mapstructure:"listen"`
 	Port   int    `mapstructure:"port"`
+	// SocketMode is the octal permission mode of a Unix domain socket.
+	SocketMode string `mapstructure:"socket_mode"`
+	// ProxyProtocol expects the HAProxy PROXY protocol header, version 1 or
+	// 2, on every connection.
+	ProxyProtocol bool `mapstructure:"proxy_protocol"`
+	// TrustedProxies lists the CIDR ranges or addresses of reverse proxies
+	// whose X-Forwarded-For header is trusted for the client IP.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+	// PIDFile receives the process ID while the server runs. Empty disables it.
+	PIDFile string `mapstructure:"pid_file"`
+}
+
+// ListenerConfig is one address the server listens on. Port and SocketMode
+// default to those of MainConfig; ProxyProtocol is set per listener.
+type ListenerConfig struct {
+	Listen        string `mapstructure:"listen"`
+	Port          int    `mapstructure:"port"`
+	SocketMode    string `mapstructure:"socket_mode"`
+	ProxyProtocol bool   `mapstructure:"proxy_protocol"`
+}
+
+// EffectiveListeners returns the configured listeners with the defaults of
+// Main applied, or the address of Main when there are none.
+func (c Config) EffectiveListeners() []ListenerConfig {
+	if len(c.Listeners) == 0 {
+		return []ListenerConfig{{
+			Listen:        c.Main.Listen,
+			Port:          c.Main.Port,
+			SocketMode:    c.Main.SocketMode,
+			ProxyProtocol: c.Main.ProxyProtocol,
+		}}
+	}
+	listeners := make([]ListenerConfig, 0, len(c.Listeners))
+	for _, l := range c.Listeners {
+		if l.Port == 0 {
+			l.Port = c.Main.Port
+		}
+		if l.SocketMode == "" {
+			l.SocketMode = c.Main.SocketMode
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners
 }
 
 // LogConfig covers logging options.
@@ -33,6 +194,92 @@ type LogConfig struct {
 	File   string `mapstructure:"file"`
 	Level  string `mapstructure:"level"`
 	Format string `mapstructure:"format"`
+	Errors bool   `mapstructure:"errors"`
+	// AccessFile receives one line per completed request; "-" is stdout
+	// and empty disables the access log.
+	AccessFile   string `mapstructure:"access_file"`
+	AccessFormat string `mapstructure:"access_format"`
+}
+
+// APIConfig covers response rendering options.
+type APIConfig struct {
+	SizeAsString          bool   `mapstructure:"size_as_string"`
+	RejectDuplicateParams bool   `mapstructure:"reject_duplicate_params"`
+	ServerTiming          bool   `mapstructure:"server_timing"`
+	StreamListings        bool   `mapstructure:"stream_listings"`
+	Debug                 bool   `mapstructure:"debug"`
+	Events                bool   `mapstructure:"events"`
+	Collation             string `mapstructure:"collation"`
+	CollationLocale       string `mapstructure:"collation_locale"`
+	ListingMimeDetection  string `mapstructure:"listing_mime_detection"`
+}
+
+// WebConfig covers files served for crawlers and security researchers.
+type WebConfig struct {
+	RobotsTxt   string `mapstructure:"robots_txt"`
+	SecurityTxt string `mapstructure:"security_txt"`
+}
+
+// CORSConfig covers cross-origin requests of browser applications.
+// CORS is disabled while AllowedOrigins is empty.
+type CORSConfig struct {
+	AllowedOrigins []string      `mapstructure:"allowed_origins"`
+	AllowedMethods []string      `mapstructure:"allowed_methods"`
+	AllowedHeaders []string      `mapstructure:"allowed_headers"`
+	MaxAge         time.Duration `mapstructure:"max_age"`
+}
+
+// AuthConfig covers API authentication. Authentication is disabled while
+// APIKeys and OIDC.Issuer are empty.
+type AuthConfig struct {
+	// APIKeys are plain keys or sha256:<hex digest> of a key.
+	APIKeys []string   `mapstructure:"api_keys"`
+	OIDC    OIDCConfig `mapstructure:"oidc"`
+}
+
+// OIDCConfig covers OpenID Connect authentication. It is disabled while
+// Issuer is empty; RedirectURL enables the login flow for browsers.
+type OIDCConfig struct {
+	Issuer       string   `mapstructure:"issuer"`
+	ClientID     string   `mapstructure:"client_id"`
+	ClientSecret string   `mapstructure:"client_secret"`
+	RedirectURL  string   `mapstructure:"redirect_url"`
+	Scopes       []string `mapstructure:"scopes"`
+	GroupsClaim  string   `mapstructure:"groups_claim"`
+}
+
+// FilesConfig covers file serving options.
+type FilesConfig struct {
+	AnonymousWrites    bool          `mapstructure:"anonymous_writes"`
+	CanonicalRedirect  bool          `mapstructure:"canonical_redirect"`
+	StrictPaths        bool          `mapstructure:"strict_paths"`
+	ExportBase         string        `mapstructure:"export_base"`
+	SniffBytes         int           `mapstructure:"sniff_bytes"`
+	HealthInterval     time.Duration `mapstructure:"health_interval"`
+	GeneratedAt        bool          `mapstructure:"generated_at"`
+	RejectEmptyRanges  bool          `mapstructure:"reject_empty_ranges"`
+	MaxSymlinkDepth    int           `mapstructure:"max_symlink_depth"`
+	ExposeOwnership    bool          `mapstructure:"expose_ownership"`
+	ResolveOwners      bool          `mapstructure:"resolve_owners"`
+	CaseInsensitive    bool          `mapstructure:"case_insensitive"`
+	ExposeFileID       bool          `mapstructure:"expose_file_id"`
+	MaxOpenFiles       int           `mapstructure:"max_open_files"`
+	SigningSecret      string        `mapstructure:"signing_secret"`
+	SigningMaxTTL      time.Duration `mapstructure:"signing_max_ttl"`
+	SiblingExtensions  []string      `mapstructure:"sibling_extensions"`
+	MergeFileRoots     bool          `mapstructure:"merge_file_roots"`
+	MaxPathDepth       int           `mapstructure:"max_path_depth"`
+	ExposeACL          bool          `mapstructure:"expose_acl"`
+	RespectLocks       bool          `mapstructure:"respect_locks"`
+	RespectGitignore   bool          `mapstructure:"respect_gitignore"`
+	StartupConcurrency int           `mapstructure:"startup_concurrency"`
+	ListConcurrency    int           `mapstructure:"list_concurrency"`
+	// ListingCacheTTL caches folder listings; 0s disables the cache.
+	ListingCacheTTL     time.Duration `mapstructure:"listing_cache_ttl"`
+	ListingCacheEntries int           `mapstructure:"listing_cache_entries"`
+	ThumbnailCacheDir   string        `mapstructure:"thumbnail_cache_dir"`
+	// ThumbnailCacheSize is a size like 1GiB bounding thumbnail_cache_dir.
+	ThumbnailCacheSize string `mapstructure:"thumbnail_cache_size"`
 }
 
 const (
@@ -40,35 +287,568 @@ const (
 	defaultPort     = 3000
 	defaultLogLevel = "info"
 	defaultLogFmt   = "text"
+
+	defaultSniffBytes = 512
+	minSniffBytes     = 512
+	maxSniffBytes     = 64 * 1024
+
+	// minSigningSecret is the shortest accepted HMAC secret for signed URLs.
+	minSigningSecret = 32
+	// minAPIKey is the shortest accepted plain API key.
+	minAPIKey = 32
+	// oidcCallbackPath is the route finishing the OIDC login flow.
+	oidcCallbackPath = "/api/v1/auth/callback"
+
+	// maxListLimit matches the largest page[limit] accepted by the API.
+	maxListLimit = 500
+
+	// envFileRoot is the environment variable viper maps onto file-root.
+	envFileRoot = "DENDRITE_FILE_ROOT"
+
+	defaultMaxSymlinkDepth = 8
+	// maxSymlinkDepth matches the Linux kernel limit (MAXSYMLINKS).
+	maxSymlinkDepth = 40
 )
 
 // Validate validates configuration fields.
 func Validate(cfg Config) error {
-	if ip := net.ParseIP(cfg.Main.Listen); ip == nil {
-		return fmt.Errorf("invalid listen address: %s", cfg.Main.Listen)
+	if err := validateListeners(cfg); err != nil {
+		return err
+	}
+	if err := validateTLS(cfg.TLS); err != nil {
+		return err
+	}
+	if _, err := TrustedProxies(cfg.Main.TrustedProxies); err != nil {
+		return err
+	}
+
+	if err := validateLog(cfg.Log); err != nil {
+		return err
 	}
-	if cfg.Main.Port < 1 || cfg.Main.Port > 65535 {
-		return fmt.Errorf("invalid port: %d", cfg.Main.Port)
+
+	if err := validateLimits(cfg.Limits, cfg.Timeouts); err != nil {
+		return err
+	}
+	if err := validateFiles(cfg.Files); err != nil {
+		return err
+	}
+	if err := validateWeb(cfg.Web); err != nil {
+		return err
+	}
+	if err := validateAPI(cfg.API); err != nil {
+		return err
+	}
+	if err := validateCORS(cfg.CORS); err != nil {
+		return err
+	}
+	if err := validateTracing(cfg.Tracing); err != nil {
+		return err
+	}
+	if err := validateAudit(cfg.Audit); err != nil {
+		return err
+	}
+	if err := validateWebhooks(cfg.Webhooks, cfg.FileRoots); err != nil {
+		return err
+	}
+	if err := validateAuth(cfg.Auth); err != nil {
+		return err
+	}
+	if err := validateMimeTypes(cfg.MimeTypes); err != nil {
+		return err
+	}
+	return validateRoots(cfg)
+}
+
+// validateRoots checks the file roots and the access rules restricting them.
+func validateRoots(cfg Config) error {
+	if err := validateAccessRules(cfg.FileRoots, cfg.Auth); err != nil {
+		return err
+	}
+	return validateFileRoots(cfg.FileRoots, cfg.Files.StartupConcurrency)
+}
+
+// validateMimeTypes checks that the [mime] section maps extensions to valid
+// media types.
+func validateMimeTypes(types map[string]string) error {
+	for ext, mimeType := range types {
+		if ext == "." || strings.ContainsAny(ext, "/\\") {
+			return fmt.Errorf("mime: invalid extension: %q", ext)
+		}
+		mediaType, _, err := mime.ParseMediaType(mimeType)
+		if typ, subtype, ok := strings.Cut(mediaType, "/"); err != nil || !ok || typ == "" || subtype == "" {
+			return fmt.Errorf("mime: invalid type for %s: %q", ext, mimeType)
+		}
 	}
+	return nil
+}
 
-	level := strings.ToLower(cfg.Log.Level)
-	switch level {
+func validateLog(cfg LogConfig) error {
+	switch strings.ToLower(cfg.Level) {
 	case "debug", "info", "warn", "error":
 	default:
-		return fmt.Errorf("invalid log level: %s", cfg.Log.Level)
+		return fmt.Errorf("invalid log level: %s", cfg.Level)
 	}
 
-	format := strings.ToLower(cfg.Log.Format)
-	switch format {
+	switch strings.ToLower(cfg.Format) {
 	case "text", "json":
 	default:
-		return fmt.Errorf("invalid log format: %s", cfg.Log.Format)
+		return fmt.Errorf("invalid log format: %s", cfg.Format)
+	}
+
+	switch strings.ToLower(cfg.AccessFormat) {
+	case "", "json", "combined":
+	default:
+		return fmt.Errorf("invalid log access_format: %s", cfg.AccessFormat)
+	}
+	return nil
+}
+
+func validateListeners(cfg Config) error {
+	for i, l := range cfg.EffectiveListeners() {
+		err := validateListener(l)
+		if err == nil {
+			continue
+		}
+		if len(cfg.Listeners) > 0 {
+			return fmt.Errorf("listener %d: %w", i+1, err)
+		}
+		return err
+	}
+	return nil
+}
+
+func validateListener(l ListenerConfig) error {
+	if socket, ok := strings.CutPrefix(l.Listen, "unix:"); ok {
+		if !filepath.IsAbs(socket) {
+			return fmt.Errorf("listen socket must be an absolute path: %s", l.Listen)
+		}
+		if _, err := SocketMode(l.SocketMode); err != nil {
+			return err
+		}
+		return nil
+	}
+	if ip := net.ParseIP(l.Listen); ip == nil {
+		return fmt.Errorf("invalid listen address: %s", l.Listen)
+	}
+	if l.Port < 1 || l.Port > 65535 {
+		return fmt.Errorf("invalid port: %d", l.Port)
+	}
+	return nil
+}
+
+// TrustedProxies parses main trusted_proxies. Plain addresses cover a single
+// host.
+func TrustedProxies(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("main trusted_proxies must list CIDR ranges or IP addresses: %q", entry)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// SocketMode parses an octal socket_mode, e.g. "0660".
+func SocketMode(mode string) (fs.FileMode, error) {
+	bits, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || bits > 0o777 {
+		return 0, fmt.Errorf("socket_mode must be an octal permission mode like 0660: %s", mode)
+	}
+	return fs.FileMode(bits), nil
+}
+
+// tlsVersions maps tls min_version onto the protocol versions.
+var tlsVersions = map[string]uint16{"1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13}
+
+// validateTLS checks that certificate and key are configured together as
+// readable files, and that the minimum version and cipher suites are known.
+func validateTLS(cfg TLSConfig) error {
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return fmt.Errorf("tls cert_file and key_file must be set together")
+	}
+	if cfg.CertFile == "" {
+		return nil
+	}
+	for key, file := range map[string]string{"cert_file": cfg.CertFile, "key_file": cfg.KeyFile} {
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("tls %s: stat %s: %w", key, file, err)
+		}
+	}
+	if _, ok := tlsVersions[cfg.MinVersion]; !ok {
+		return fmt.Errorf("tls min_version must be 1.2 or 1.3: %s", cfg.MinVersion)
+	}
+	if _, err := TLSCipherSuites(cfg.CipherSuites); err != nil {
+		return err
+	}
+	return nil
+}
+
+// TLSMinVersion returns the protocol version tls min_version names.
+func TLSMinVersion(version string) uint16 {
+	return tlsVersions[version]
+}
+
+// TLSCipherSuites returns the IDs of the named cipher suites. Only suites
+// Go considers secure are accepted.
+func TLSCipherSuites(names []string) ([]uint16, error) {
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		i := slices.IndexFunc(tls.CipherSuites(), func(suite *tls.CipherSuite) bool { return suite.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("tls cipher_suites must name secure cipher suites: %q", name)
+		}
+		ids = append(ids, tls.CipherSuites()[i].ID)
+	}
+	return ids, nil
+}
+
+// ParseSize returns the bytes of a size like 512K or 10M, with decimal
+// units, or 10MiB with binary ones. Empty is 0.
+func ParseSize(size string) (int64, error) {
+	if size == "" {
+		return 0, nil
+	}
+	n, err := bytes.Parse(size)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, want e.g. 10M", size)
+	}
+	return n, nil
+}
+
+func validateTracing(tracing TracingConfig) error {
+	if tracing.Endpoint == "" {
+		return nil
+	}
+	if !isHTTPURL(tracing.Endpoint) {
+		return fmt.Errorf("tracing endpoint must be an http or https URL: %s", tracing.Endpoint)
+	}
+	if tracing.ServiceName == "" {
+		return fmt.Errorf("tracing service_name must not be empty")
+	}
+	if tracing.SampleRatio < 0 || tracing.SampleRatio > 1 {
+		return fmt.Errorf("tracing sample_ratio must be between 0 and 1: %g", tracing.SampleRatio)
+	}
+	return nil
+}
+
+func validateAudit(cfg AuditConfig) error {
+	if cfg.File != "" && cfg.Syslog {
+		return fmt.Errorf("audit file and syslog cannot be used together")
+	}
+	return nil
+}
+
+// validateWebhooks checks that webhooks post to http or https URLs and only
+// name configured file roots.
+func validateWebhooks(hooks []WebhookConfig, roots []FileRoot) error {
+	for i, hook := range hooks {
+		if !isHTTPURL(hook.URL) {
+			return fmt.Errorf("webhook %d: url must be an http or https URL: %q", i+1, hook.URL)
+		}
+		for _, virtual := range hook.Roots {
+			known := slices.ContainsFunc(roots, func(root FileRoot) bool {
+				return path.Clean(root.Virtual) == path.Clean(virtual)
+			})
+			if !known {
+				return fmt.Errorf("webhook %d: unknown file root: %s", i+1, virtual)
+			}
+		}
+	}
+	return nil
+}
+
+// validateLimits checks the [limits] and [timeouts] sections.
+func validateLimits(limits LimitsConfig, timeouts TimeoutsConfig) error {
+	if limits.MaxConcurrentRequests < 0 {
+		return fmt.Errorf("limits max_concurrent_requests must not be negative: %d", limits.MaxConcurrentRequests)
+	}
+	if limits.MaxConnections < 0 {
+		return fmt.Errorf("limits max_connections must not be negative: %d", limits.MaxConnections)
+	}
+	if _, err := ParseSize(limits.MaxBodySize); err != nil {
+		return fmt.Errorf("limits max_body_size: %w", err)
+	}
+	if limits.RetryAfter < 0 {
+		return fmt.Errorf("limits retry_after must not be negative: %s", limits.RetryAfter)
+	}
+	for _, timeout := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"read_header", timeouts.ReadHeader},
+		{"read", timeouts.Read},
+		{"write", timeouts.Write},
+		{"idle", timeouts.Idle},
+		{"handler", timeouts.Handler},
+	} {
+		if timeout.d < 0 {
+			return fmt.Errorf("timeouts %s must not be negative: %s", timeout.name, timeout.d)
+		}
+	}
+	return nil
+}
+
+func validateFiles(files FilesConfig) error {
+	absolute := map[string]string{"export_base": files.ExportBase, "thumbnail_cache_dir": files.ThumbnailCacheDir}
+	for key, dir := range absolute {
+		if dir != "" && !filepath.IsAbs(dir) {
+			return fmt.Errorf("files %s must be an absolute path: %s", key, dir)
+		}
+	}
+	// Zero leaves the default sample size in place.
+	if files.SniffBytes != 0 && (files.SniffBytes < minSniffBytes || files.SniffBytes > maxSniffBytes) {
+		return fmt.Errorf("files sniff_bytes must be between %d and %d: %d", minSniffBytes, maxSniffBytes, files.SniffBytes)
+	}
+	if files.MaxSymlinkDepth < 0 || files.MaxSymlinkDepth > maxSymlinkDepth {
+		return fmt.Errorf("files max_symlink_depth must be between 1 and %d: %d", maxSymlinkDepth, files.MaxSymlinkDepth)
+	}
+	if files.SigningSecret != "" && len(files.SigningSecret) < minSigningSecret {
+		return fmt.Errorf("files signing_secret must be at least %d characters", minSigningSecret)
+	}
+	if files.SigningMaxTTL < 0 {
+		return fmt.Errorf("files signing_max_ttl must not be negative: %s", files.SigningMaxTTL)
+	}
+	for _, limit := range []struct {
+		name  string
+		value int
+	}{
+		{"max_open_files", files.MaxOpenFiles},
+		{"startup_concurrency", files.StartupConcurrency},
+		{"list_concurrency", files.ListConcurrency},
+		{"max_path_depth", files.MaxPathDepth},
+	} {
+		if limit.value < 0 {
+			return fmt.Errorf("files %s must not be negative: %d", limit.name, limit.value)
+		}
+	}
+	if _, err := ParseSize(files.ThumbnailCacheSize); err != nil {
+		return fmt.Errorf("files thumbnail_cache_size: %w", err)
+	}
+	if files.HealthInterval < 0 {
+		return fmt.Errorf("files health_interval must not be negative: %s", files.HealthInterval)
+	}
+	if err := validateListingCache(files.ListingCacheTTL, files.ListingCacheEntries); err != nil {
+		return err
+	}
+	return validateSiblingExtensions(files.SiblingExtensions)
+}
+
+func validateListingCache(ttl time.Duration, entries int) error {
+	if ttl < 0 {
+		return fmt.Errorf("files listing_cache_ttl must not be negative: %s", ttl)
+	}
+	if entries < 0 {
+		return fmt.Errorf("files listing_cache_entries must not be negative: %d", entries)
+	}
+	return nil
+}
+
+// validateSiblingExtensions rejects extensions carrying a dot or a path separator.
+func validateSiblingExtensions(exts []string) error {
+	for _, ext := range exts {
+		if ext == "" || strings.ContainsAny(ext, "./\\") {
+			return fmt.Errorf("files sibling_extensions must be bare extensions such as \"html\": %q", ext)
+		}
+	}
+	return nil
+}
+
+// validateAPI checks the default collation, its locale and the MIME type
+// detection of listings.
+func validateAPI(api APIConfig) error {
+	switch api.Collation {
+	case "", "binary", "natural", "locale":
+	default:
+		return fmt.Errorf("api collation must be binary, natural or locale: %s", api.Collation)
+	}
+	if api.CollationLocale != "" {
+		if _, err := language.Parse(api.CollationLocale); err != nil {
+			return fmt.Errorf("api collation_locale must be a BCP 47 language tag: %s", api.CollationLocale)
+		}
+	}
+	switch api.ListingMimeDetection {
+	case "", "content", "extension":
+	default:
+		return fmt.Errorf("api listing_mime_detection must be content or extension: %s", api.ListingMimeDetection)
+	}
+	return nil
+}
+
+// corsMethods are the methods cors allowed_methods accepts.
+var corsMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// validateCORS checks that origins are "*" or bare origins like
+// https://app.example.com and that methods are known.
+func validateCORS(cors CORSConfig) error {
+	for _, origin := range cors.AllowedOrigins {
+		if origin != "*" && !isOrigin(origin) {
+			return fmt.Errorf("cors allowed_origins must be \"*\" or scheme://host[:port]: %q", origin)
+		}
+	}
+	for _, method := range cors.AllowedMethods {
+		if !corsMethods[method] {
+			return fmt.Errorf("cors allowed_methods must be upper-case HTTP methods: %q", method)
+		}
+	}
+	if cors.MaxAge < 0 {
+		return fmt.Errorf("cors max_age must not be negative: %s", cors.MaxAge)
+	}
+	return nil
+}
+
+// validateAuth checks that API keys are long enough to resist guessing, or
+// well-formed SHA-256 digests when given as sha256:<hex>.
+func validateAuth(auth AuthConfig) error {
+	for i, key := range auth.APIKeys {
+		if err := validateAPIKey(key); err != nil {
+			return fmt.Errorf("auth api_keys[%d] %w", i, err)
+		}
+	}
+	return validateOIDC(auth.OIDC)
+}
+
+func validateAPIKey(key string) error {
+	if digest, ok := strings.CutPrefix(key, "sha256:"); ok {
+		if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != sha256.Size {
+			return fmt.Errorf("must be sha256: followed by 64 hex digits")
+		}
+		return nil
+	}
+	if len(key) < minAPIKey {
+		return fmt.Errorf("must be at least %d characters", minAPIKey)
+	}
+	return nil
+}
+
+// accessScopes are the scopes file root rules accept.
+var accessScopes = map[string]bool{"read": true, "write": true, "delete": true}
+
+// validateAccessRules checks the scopes and API keys of file root rules.
+// Rules need authentication, since anonymous clients match none of them.
+func validateAccessRules(roots []FileRoot, auth AuthConfig) error {
+	for i, root := range roots {
+		if len(root.Allow)+len(root.Deny) == 0 {
+			continue
+		}
+		if len(auth.APIKeys) == 0 && auth.OIDC.Issuer == "" {
+			return fmt.Errorf("file root %d: allow and deny rules require auth api_keys or oidc", i)
+		}
+		for _, rule := range slices.Concat(root.Allow, root.Deny) {
+			for _, scope := range rule.Scopes {
+				if !accessScopes[scope] {
+					return fmt.Errorf("file root %d: scopes must be read, write or delete: %q", i, scope)
+				}
+			}
+			for _, key := range rule.APIKeys {
+				if err := validateAPIKey(key); err != nil {
+					return fmt.Errorf("file root %d: api_keys %w", i, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateOIDC checks that an enabled provider has a client ID and that the
+// login flow has the client secret and callback URL it needs.
+func validateOIDC(oidc OIDCConfig) error {
+	if oidc.Issuer == "" {
+		return nil
+	}
+	if !isHTTPURL(oidc.Issuer) {
+		return fmt.Errorf("auth oidc issuer must be an http or https URL: %s", oidc.Issuer)
+	}
+	if oidc.ClientID == "" {
+		return fmt.Errorf("auth oidc client_id is required with issuer")
+	}
+	if oidc.RedirectURL == "" {
+		return nil
+	}
+	if !isHTTPURL(oidc.RedirectURL) || !strings.HasSuffix(oidc.RedirectURL, oidcCallbackPath) {
+		return fmt.Errorf("auth oidc redirect_url must be an http or https URL ending in %s: %s",
+			oidcCallbackPath, oidc.RedirectURL)
+	}
+	if oidc.ClientSecret == "" {
+		return fmt.Errorf("auth oidc client_secret is required with redirect_url")
+	}
+	return nil
+}
+
+// isHTTPURL reports whether s is an absolute http or https URL.
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// isOrigin reports whether s is an http or https origin without path,
+// query or credentials.
+func isOrigin(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
 	}
+	return u.Path == "" && u.RawQuery == "" && u.Fragment == "" && u.User == nil
+}
 
-	return validateFileRoots(cfg.FileRoots)
+// validateWeb checks that configured web files are absolute paths that exist.
+func validateWeb(web WebConfig) error {
+	for key, file := range map[string]string{"robots_txt": web.RobotsTxt, "security_txt": web.SecurityTxt} {
+		if file == "" {
+			continue
+		}
+		if !filepath.IsAbs(file) {
+			return fmt.Errorf("web %s must be an absolute path: %s", key, file)
+		}
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("web %s: stat %s: %w", key, file, err)
+		}
+	}
+	return nil
+}
+
+// validateFileRootOptions checks the optional settings of a file root.
+func validateFileRootOptions(i int, root FileRoot) error {
+	if root.Manifest != "" {
+		if !filepath.IsAbs(root.Manifest) {
+			return fmt.Errorf("file root %d: manifest must be an absolute path: %s", i, root.Manifest)
+		}
+		if _, err := os.Stat(root.Manifest); err != nil {
+			return fmt.Errorf("file root %d: stat manifest %s: %w", i, root.Manifest, err)
+		}
+	}
+	if root.DefaultLimit < 0 || root.DefaultLimit > maxListLimit {
+		return fmt.Errorf("file root %d: default_limit must be between 1 and %d: %d", i, maxListLimit, root.DefaultLimit)
+	}
+	for _, dir := range root.FollowSymlinksOutside {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("file root %d: follow_symlinks_outside must list absolute paths: %s", i, dir)
+		}
+		if _, err := os.Stat(dir); err != nil {
+			return fmt.Errorf("file root %d: stat follow_symlinks_outside %s: %w", i, dir, err)
+		}
+	}
+	for _, pattern := range root.HiddenPatterns {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" || strings.Contains(pattern, "/") {
+			return fmt.Errorf("file root %d: hidden_patterns must be name globs such as \"*.bak\": %q", i, pattern)
+		}
+	}
+	return nil
 }
 
-func validateFileRoots(roots []FileRoot) error {
+func validateFileRoots(roots []FileRoot, concurrency int) error {
 	if len(roots) == 0 {
 		return fmt.Errorf("no file roots configured")
 	}
@@ -102,19 +882,32 @@ func validateFileRoots(roots []FileRoot) error {
 			return fmt.Errorf("file root %d: source must be an absolute path starting with '/': %s", i, root.Source)
 		}
 
-		info, err := os.Stat(root.Source)
-		if err != nil {
-			return fmt.Errorf("file root %d: stat source %s: %w", i, root.Source, err)
-		}
-		if !info.IsDir() {
-			return fmt.Errorf("file root %d: source is not a directory: %s", i, root.Source)
-		}
-
 		if _, exists := seenVirtuals[root.Virtual]; exists {
 			return fmt.Errorf("file root %d: duplicate virtual path: %s", i, root.Virtual)
 		}
 		seenVirtuals[root.Virtual] = struct{}{}
 	}
 
+	// Sources may live on slow storage; stat them concurrently and report
+	// every failing root rather than the first one.
+	err := parallel.Each(len(roots), concurrency, func(i int) error {
+		return validateFileRootSource(i, roots[i])
+	})
+	if err != nil {
+		return fmt.Errorf("check file root sources: %w", err)
+	}
 	return nil
 }
+
+// validateFileRootSource checks that the source of a file root is a directory
+// and that its optional files exist.
+func validateFileRootSource(i int, root FileRoot) error {
+	info, err := os.Stat(root.Source)
+	if err != nil {
+		return fmt.Errorf("file root %d: stat source %s: %w", i, root.Source, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("file root %d: source is not a directory: %s", i, root.Source)
+	}
+	return validateFileRootOptions(i, root)
+}
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -19,12 +23,14 @@ func TestValidateListenAddress(t *testing.T) {
 		{"hostname rejected", "localhost", "invalid listen address: localhost"},
 		{"empty rejected", "", "invalid listen address: "},
 		{"malformed IP", "192.168.1.999", "invalid listen address: 192.168.1.999"},
+		{"unix socket", "unix:/run/dendrite.sock", ""},
+		{"relative unix socket rejected", "unix:dendrite.sock", "listen socket must be an absolute path"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := Config{
-				Main:      MainConfig{Listen: tt.listen, Port: 3000},
+				Main:      MainConfig{Listen: tt.listen, Port: 3000, SocketMode: "0660"},
 				Log:       LogConfig{Level: "info", Format: "text"},
 				FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
 			}
@@ -39,6 +45,20 @@ func TestValidateListenAddress(t *testing.T) {
 	}
 }
 
+func TestSocketMode(t *testing.T) {
+	mode, err := SocketMode("0660")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o660), mode)
+	mode, err = SocketMode("777")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o777), mode)
+
+	for _, invalid := range []string{"", "0800", "1777", "rw-rw----"} {
+		_, err := SocketMode(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
 func TestValidatePort(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -218,3 +238,589 @@ func TestValidateFileRootMultiFolder(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "must be '/' or a single folder")
 }
+
+func TestValidateFilesExportBase(t *testing.T) {
+	cfg := Config{
+		Main:      MainConfig{Listen: "127.0.0.1", Port: 3000},
+		Log:       LogConfig{Level: "info", Format: "text"},
+		Files:     FilesConfig{ExportBase: "exports"},
+		FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
+	}
+	err := Validate(cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "export_base must be an absolute path")
+
+	cfg.Files.ExportBase = "/srv/exports"
+	require.NoError(t, Validate(cfg))
+}
+
+func TestValidateFilesThumbnailCacheDir(t *testing.T) {
+	cfg := Config{
+		Main:      MainConfig{Listen: "127.0.0.1", Port: 3000},
+		Log:       LogConfig{Level: "info", Format: "text"},
+		Files:     FilesConfig{ThumbnailCacheDir: "thumbnails"},
+		FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
+	}
+	err := Validate(cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "thumbnail_cache_dir must be an absolute path")
+
+	cfg.Files.ThumbnailCacheDir = "/var/cache/dendrite/thumbnails"
+	require.NoError(t, Validate(cfg))
+
+	cfg.Files.ThumbnailCacheSize = "lots"
+	err = Validate(cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "files thumbnail_cache_size")
+
+	cfg.Files.ThumbnailCacheSize = "500MB"
+	require.NoError(t, Validate(cfg))
+}
+
+func TestValidateFilesSigningMaxTTL(t *testing.T) {
+	cfg := Config{
+		Main:      MainConfig{Listen: "127.0.0.1", Port: 3000},
+		Log:       LogConfig{Level: "info", Format: "text"},
+		Files:     FilesConfig{SigningMaxTTL: -time.Hour},
+		FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
+	}
+	err := Validate(cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "signing_max_ttl must not be negative")
+
+	cfg.Files.SigningMaxTTL = time.Hour
+	require.NoError(t, Validate(cfg))
+}
+
+func TestValidateFilesSniffBytes(t *testing.T) {
+	tests := []struct {
+		name       string
+		sniffBytes int
+		wantErr    string
+	}{
+		{"unset uses default", 0, ""},
+		{"minimum", 512, ""},
+		{"larger sample", 4096, ""},
+		{"maximum", 65536, ""},
+		{"below minimum", 100, "sniff_bytes must be between 512 and 65536: 100"},
+		{"above maximum", 65537, "sniff_bytes must be between 512 and 65536: 65537"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				Main:      MainConfig{Listen: "127.0.0.1", Port: 3000},
+				Log:       LogConfig{Level: "info", Format: "text"},
+				Files:     FilesConfig{SniffBytes: tt.sniffBytes},
+				FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
+			}
+			err := Validate(cfg)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateMimeTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		types   map[string]string
+		wantErr string
+	}{
+		{"unset", nil, ""},
+		{"valid", map[string]string{".gpx": "application/gpx+xml", ".txt": "text/plain; charset=utf-8"}, ""},
+		{"empty extension", map[string]string{".": "text/plain"}, `invalid extension: "."`},
+		{"path in extension", map[string]string{".a/b": "text/plain"}, `invalid extension: ".a/b"`},
+		{"invalid type", map[string]string{".gpx": "gpx"}, `invalid type for .gpx: "gpx"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				Main:      MainConfig{Listen: "127.0.0.1", Port: 3000},
+				Log:       LogConfig{Level: "info", Format: "text"},
+				MimeTypes: tt.types,
+				FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
+			}
+			err := Validate(cfg)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateFilesMaxSymlinkDepth(t *testing.T) {
+	tests := []struct {
+		name    string
+		depth   int
+		wantErr string
+	}{
+		{"unset uses default", 0, ""},
+		{"minimum", 1, ""},
+		{"maximum", 40, ""},
+		{"negative", -1, "max_symlink_depth must be between 1 and 40: -1"},
+		{"above maximum", 41, "max_symlink_depth must be between 1 and 40: 41"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				Main:      MainConfig{Listen: "127.0.0.1", Port: 3000},
+				Log:       LogConfig{Level: "info", Format: "text"},
+				Files:     FilesConfig{MaxSymlinkDepth: tt.depth},
+				FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
+			}
+			err := Validate(cfg)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAPICollation(t *testing.T) {
+	tests := []struct {
+		name    string
+		api     APIConfig
+		wantErr string
+	}{
+		{"unset uses binary", APIConfig{}, ""},
+		{"natural", APIConfig{Collation: "natural"}, ""},
+		{"locale", APIConfig{Collation: "locale", CollationLocale: "de-DE"}, ""},
+		{"unknown collation", APIConfig{Collation: "numeric"}, "collation must be binary, natural or locale: numeric"},
+		{"invalid locale", APIConfig{CollationLocale: "not a tag"}, "collation_locale must be a BCP 47 language tag"},
+		{"extension mime detection", APIConfig{ListingMimeDetection: "extension"}, ""},
+		{"unknown mime detection", APIConfig{ListingMimeDetection: "magic"},
+			"listing_mime_detection must be content or extension: magic"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				Main:      MainConfig{Listen: "127.0.0.1", Port: 3000},
+				Log:       LogConfig{Level: "info", Format: "text"},
+				API:       tt.api,
+				FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
+			}
+			err := Validate(cfg)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateCORS(t *testing.T) {
+	tests := []struct {
+		name    string
+		cors    CORSConfig
+		wantErr string
+	}{
+		{"disabled", CORSConfig{}, ""},
+		{"origins", CORSConfig{AllowedOrigins: []string{"https://app.example.com", "http://localhost:5173"}}, ""},
+		{"any origin", CORSConfig{AllowedOrigins: []string{"*"}, MaxAge: time.Hour}, ""},
+		{"origin with path", CORSConfig{AllowedOrigins: []string{"https://app.example.com/"}}, "allowed_origins"},
+		{"origin without scheme", CORSConfig{AllowedOrigins: []string{"app.example.com"}}, "allowed_origins"},
+		{"lower-case method", CORSConfig{AllowedMethods: []string{"get"}}, "allowed_methods"},
+		{"negative max age", CORSConfig{MaxAge: -time.Second}, "max_age must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				Main:      MainConfig{Listen: "127.0.0.1", Port: 3000},
+				Log:       LogConfig{Level: "info", Format: "text"},
+				CORS:      tt.cors,
+				FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
+			}
+			err := Validate(cfg)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []string
+		wantErr string
+	}{
+		{"disabled", nil, ""},
+		{"plain key", []string{strings.Repeat("k", 32)}, ""},
+		{"hashed key", []string{"sha256:" + strings.Repeat("ab", 32)}, ""},
+		{"short key", []string{"secret"}, "api_keys[0] must be at least 32 characters"},
+		{"short digest", []string{"sha256:abcd"}, "api_keys[0] must be sha256:"},
+		{"digest not hex", []string{"sha256:" + strings.Repeat("zz", 32)}, "api_keys[0] must be sha256:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				Main:      MainConfig{Listen: "127.0.0.1", Port: 3000},
+				Log:       LogConfig{Level: "info", Format: "text"},
+				Auth:      AuthConfig{APIKeys: tt.keys},
+				FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
+			}
+			err := Validate(cfg)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateOIDC(t *testing.T) {
+	const callback = "https://files.example.com/api/v1/auth/callback"
+	tests := []struct {
+		name    string
+		oidc    OIDCConfig
+		wantErr string
+	}{
+		{"disabled", OIDCConfig{ClientID: "ignored"}, ""},
+		{"token validation", OIDCConfig{Issuer: "https://id.example.com", ClientID: "dendrite"}, ""},
+		{"login flow", OIDCConfig{
+			Issuer: "https://id.example.com", ClientID: "dendrite", ClientSecret: "s", RedirectURL: callback,
+		}, ""},
+		{"issuer not a URL", OIDCConfig{Issuer: "id.example.com", ClientID: "dendrite"}, "issuer must be"},
+		{"missing client id", OIDCConfig{Issuer: "https://id.example.com"}, "client_id is required"},
+		{"missing client secret", OIDCConfig{
+			Issuer: "https://id.example.com", ClientID: "dendrite", RedirectURL: callback,
+		}, "client_secret is required"},
+		{"wrong callback", OIDCConfig{
+			Issuer: "https://id.example.com", ClientID: "dendrite", ClientSecret: "s",
+			RedirectURL: "https://files.example.com/callback",
+		}, "redirect_url must be"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				Main:      MainConfig{Listen: "127.0.0.1", Port: 3000},
+				Log:       LogConfig{Level: "info", Format: "text"},
+				Auth:      AuthConfig{OIDC: tt.oidc},
+				FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
+			}
+			err := Validate(cfg)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAccessRules(t *testing.T) {
+	keys := AuthConfig{APIKeys: []string{strings.Repeat("k", 32)}}
+	tests := []struct {
+		name    string
+		auth    AuthConfig
+		rule    AccessRule
+		wantErr string
+	}{
+		{"group rule", keys, AccessRule{Groups: []string{"staff"}, Scopes: []string{"read", "write"}}, ""},
+		{"hashed key", keys, AccessRule{APIKeys: []string{"sha256:" + strings.Repeat("ab", 32)}}, ""},
+		{"without auth", AuthConfig{}, AccessRule{Users: []string{"alice"}}, "require auth"},
+		{"unknown scope", keys, AccessRule{Scopes: []string{"admin"}}, "scopes must be read, write or delete"},
+		{"short key", keys, AccessRule{APIKeys: []string{"secret"}}, "api_keys must be at least 32 characters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				Main: MainConfig{Listen: "127.0.0.1", Port: 3000},
+				Log:  LogConfig{Level: "info", Format: "text"},
+				Auth: tt.auth,
+				FileRoots: []FileRoot{
+					{Virtual: "/public", Source: t.TempDir(), Deny: []AccessRule{tt.rule}},
+				},
+			}
+			err := Validate(cfg)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	nets, err := TrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32", "::1"})
+	require.NoError(t, err)
+	got := make([]string, 0, len(nets))
+	for _, n := range nets {
+		got = append(got, n.String())
+	}
+	assert.Equal(t, []string{"10.0.0.0/8", "192.0.2.1/32", "2001:db8::/32", "::1/128"}, got)
+
+	_, err = TrustedProxies([]string{"proxy.example.com"})
+	require.ErrorContains(t, err, "trusted_proxies")
+
+	cfg := Config{
+		Main:      MainConfig{Listen: "127.0.0.1", Port: 3000, TrustedProxies: []string{"10.0.0.0/33"}},
+		Log:       LogConfig{Level: "info", Format: "text"},
+		FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
+	}
+	require.ErrorContains(t, Validate(cfg), "trusted_proxies")
+}
+
+func TestValidateLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  LimitsConfig
+		wantErr string
+	}{
+		{"unlimited", LimitsConfig{}, ""},
+		{"limited", LimitsConfig{MaxConcurrentRequests: 64, MaxConnections: 256, RetryAfter: 5 * time.Second}, ""},
+		{"negative requests", LimitsConfig{MaxConcurrentRequests: -1}, "max_concurrent_requests"},
+		{"negative connections", LimitsConfig{MaxConnections: -1}, "max_connections"},
+		{"negative retry after", LimitsConfig{RetryAfter: -time.Second}, "retry_after"},
+		{"body size", LimitsConfig{MaxBodySize: "512K"}, ""},
+		{"invalid body size", LimitsConfig{MaxBodySize: "10 megabytes"}, "max_body_size"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				Main:      MainConfig{Listen: "127.0.0.1", Port: 3000},
+				Log:       LogConfig{Level: "info", Format: "text"},
+				Limits:    tt.limits,
+				FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
+			}
+			err := Validate(cfg)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for size, want := range map[string]int64{
+		"": 0, "0": 0, "100": 100, "512K": 512_000, "10M": 10_000_000, "1GB": 1_000_000_000, "10MiB": 10 << 20,
+	} {
+		got, err := ParseSize(size)
+		require.NoError(t, err, size)
+		assert.Equal(t, want, got, size)
+	}
+	_, err := ParseSize("-1M")
+	require.Error(t, err)
+}
+
+func TestValidateTracing(t *testing.T) {
+	tests := []struct {
+		name    string
+		tracing TracingConfig
+		wantErr string
+	}{
+		{"disabled", TracingConfig{}, ""},
+		{"enabled", TracingConfig{Endpoint: "http://localhost:4318/v1/traces", ServiceName: "dendrite", SampleRatio: 0.1}, ""},
+		{"not a URL", TracingConfig{Endpoint: "localhost:4318", ServiceName: "dendrite", SampleRatio: 1}, "endpoint"},
+		{"no service name", TracingConfig{Endpoint: "http://localhost:4318/v1/traces", SampleRatio: 1}, "service_name"},
+		{"ratio above 1", TracingConfig{Endpoint: "http://localhost:4318/v1/traces", ServiceName: "dendrite",
+			SampleRatio: 1.5}, "sample_ratio"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				Main:      MainConfig{Listen: "127.0.0.1", Port: 3000},
+				Log:       LogConfig{Level: "info", Format: "text"},
+				Tracing:   tt.tracing,
+				FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
+			}
+			err := Validate(cfg)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateTimeouts(t *testing.T) {
+	cfg := Config{
+		Main:      MainConfig{Listen: "127.0.0.1", Port: 3000},
+		Log:       LogConfig{Level: "info", Format: "text"},
+		Timeouts:  TimeoutsConfig{ReadHeader: 5 * time.Second, Write: time.Hour, Handler: time.Minute},
+		FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
+	}
+	require.NoError(t, Validate(cfg))
+
+	cfg.Timeouts.Idle = -time.Second
+	require.ErrorContains(t, Validate(cfg), "timeouts idle must not be negative")
+}
+
+func TestValidateTLS(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "cert.pem")
+	key := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(cert, []byte("cert"), 0o600))
+	require.NoError(t, os.WriteFile(key, []byte("key"), 0o600))
+
+	tests := []struct {
+		name    string
+		tls     TLSConfig
+		wantErr string
+	}{
+		{"disabled", TLSConfig{MinVersion: "1.2"}, ""},
+		{"enabled", TLSConfig{CertFile: cert, KeyFile: key, MinVersion: "1.3"}, ""},
+		{"cipher suites", TLSConfig{CertFile: cert, KeyFile: key, MinVersion: "1.2",
+			CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}}, ""},
+		{"key missing", TLSConfig{CertFile: cert, MinVersion: "1.2"}, "must be set together"},
+		{"cert not found", TLSConfig{CertFile: filepath.Join(dir, "missing.pem"), KeyFile: key, MinVersion: "1.2"},
+			"tls cert_file"},
+		{"old version", TLSConfig{CertFile: cert, KeyFile: key, MinVersion: "1.0"}, "min_version must be 1.2 or 1.3"},
+		{"insecure suite", TLSConfig{CertFile: cert, KeyFile: key, MinVersion: "1.2",
+			CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}, "cipher_suites"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				Main:      MainConfig{Listen: "127.0.0.1", Port: 3000},
+				Log:       LogConfig{Level: "info", Format: "text"},
+				TLS:       tt.tls,
+				FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
+			}
+			err := Validate(cfg)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateLogAccessFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		wantErr string
+	}{
+		{"json", "json", ""},
+		{"combined", "combined", ""},
+		{"uppercase", "COMBINED", ""},
+		{"empty defaults to json", "", ""},
+		{"invalid", "common", "invalid log access_format: common"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				Main:      MainConfig{Listen: "127.0.0.1", Port: 3000},
+				Log:       LogConfig{Level: "info", Format: "text", AccessFormat: tt.format},
+				FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
+			}
+			err := Validate(cfg)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAudit(t *testing.T) {
+	cfg := Config{
+		Main:      MainConfig{Listen: "127.0.0.1", Port: 3000},
+		Log:       LogConfig{Level: "info", Format: "text"},
+		Audit:     AuditConfig{File: "/var/log/dendrite-audit.log"},
+		FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
+	}
+	require.NoError(t, Validate(cfg))
+
+	cfg.Audit.Syslog = true
+	require.ErrorContains(t, Validate(cfg), "audit file and syslog cannot be used together")
+}
+
+func TestValidateWebhooks(t *testing.T) {
+	tests := []struct {
+		name    string
+		hook    WebhookConfig
+		wantErr string
+	}{
+		{"all roots", WebhookConfig{URL: "https://hooks.example.com/dendrite"}, ""},
+		{"named root", WebhookConfig{URL: "http://localhost:8080/", Secret: "s3cret", Roots: []string{"/public/"}}, ""},
+		{"not a URL", WebhookConfig{URL: "hooks.example.com"}, "webhook 1: url must be an http or https URL"},
+		{"unknown root", WebhookConfig{URL: "https://hooks.example.com/", Roots: []string{"/private"}},
+			"webhook 1: unknown file root: /private"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				Main:      MainConfig{Listen: "127.0.0.1", Port: 3000},
+				Log:       LogConfig{Level: "info", Format: "text"},
+				FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
+				Webhooks:  []WebhookConfig{tt.hook},
+			}
+			err := Validate(cfg)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateFilesListingCache(t *testing.T) {
+	cfg := Config{
+		Main:      MainConfig{Listen: "127.0.0.1", Port: 3000},
+		Log:       LogConfig{Level: "info", Format: "text"},
+		Files:     FilesConfig{ListingCacheTTL: 30 * time.Second, ListingCacheEntries: 100},
+		FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
+	}
+	require.NoError(t, Validate(cfg))
+
+	cfg.Files.ListingCacheEntries = -1
+	require.ErrorContains(t, Validate(cfg), "files listing_cache_entries must not be negative")
+	cfg.Files.ListingCacheTTL = -time.Second
+	require.ErrorContains(t, Validate(cfg), "files listing_cache_ttl must not be negative")
+}
+
+func TestValidateFilesListConcurrency(t *testing.T) {
+	cfg := Config{
+		Main:      MainConfig{Listen: "127.0.0.1", Port: 3000},
+		Log:       LogConfig{Level: "info", Format: "text"},
+		Files:     FilesConfig{ListConcurrency: 32},
+		FileRoots: []FileRoot{{Virtual: "/public", Source: t.TempDir()}},
+	}
+	require.NoError(t, Validate(cfg))
+
+	cfg.Files.ListConcurrency = -1
+	require.ErrorContains(t, Validate(cfg), "files list_concurrency must not be negative: -1")
+}
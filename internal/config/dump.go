@@ -0,0 +1,139 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// redacted replaces secrets in dumped configurations.
+const redacted = "REDACTED"
+
+// Dump renders cfg as TOML or JSON, using the keys of the config file, with
+// secrets redacted. It shows the configuration in effect after defaults,
+// config file, environment and flags were merged.
+func Dump(cfg Config, format string) ([]byte, error) {
+	settings := settingsOf(reflect.ValueOf(cfg.Redacted()))
+	switch strings.ToLower(format) {
+	case "toml":
+		out, err := toml.Marshal(settings)
+		if err != nil {
+			return nil, fmt.Errorf("encode toml: %w", err)
+		}
+		return out, nil
+	case "json":
+		out, err := json.MarshalIndent(settings, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("encode json: %w", err)
+		}
+		return append(out, '\n'), nil
+	default:
+		return nil, fmt.Errorf("invalid dump format: %s", format)
+	}
+}
+
+// Redacted returns a copy of cfg with its secrets replaced: plain API keys
+// (their sha256: digests are kept), the OIDC client secret, the signing
+// secret, webhook secrets and the values of tracing headers.
+func (c Config) Redacted() Config {
+	c.Auth.APIKeys = redactAPIKeys(c.Auth.APIKeys)
+	if c.Auth.OIDC.ClientSecret != "" {
+		c.Auth.OIDC.ClientSecret = redacted
+	}
+	if c.Files.SigningSecret != "" {
+		c.Files.SigningSecret = redacted
+	}
+	if c.Tracing.Headers != nil {
+		headers := make(map[string]string, len(c.Tracing.Headers))
+		for name := range c.Tracing.Headers {
+			headers[name] = redacted
+		}
+		c.Tracing.Headers = headers
+	}
+
+	roots := make([]FileRoot, len(c.FileRoots))
+	for i, root := range c.FileRoots {
+		root.Allow = redactRules(root.Allow)
+		root.Deny = redactRules(root.Deny)
+		roots[i] = root
+	}
+	c.FileRoots = roots
+
+	hooks := make([]WebhookConfig, len(c.Webhooks))
+	for i, hook := range c.Webhooks {
+		if hook.Secret != "" {
+			hook.Secret = redacted
+		}
+		hooks[i] = hook
+	}
+	c.Webhooks = hooks
+	return c
+}
+
+func redactRules(rules []AccessRule) []AccessRule {
+	if rules == nil {
+		return nil
+	}
+	out := make([]AccessRule, len(rules))
+	for i, rule := range rules {
+		rule.APIKeys = redactAPIKeys(rule.APIKeys)
+		out[i] = rule
+	}
+	return out
+}
+
+func redactAPIKeys(keys []string) []string {
+	if keys == nil {
+		return nil
+	}
+	out := make([]string, len(keys))
+	for i, key := range keys {
+		if strings.HasPrefix(key, "sha256:") {
+			out[i] = key
+		} else {
+			out[i] = redacted
+		}
+	}
+	return out
+}
+
+// settingsOf converts v into maps keyed by the mapstructure tags, slices and
+// plain values, as found in a config file. Durations become strings such as
+// "1m30s".
+func settingsOf(v reflect.Value) any {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		settings := make(map[string]any, v.NumField())
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			key := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+			if !field.IsExported() || key == "" || key == "-" {
+				continue
+			}
+			settings[key] = settingsOf(v.Field(i))
+		}
+		return settings
+	case reflect.Slice:
+		items := make([]any, v.Len())
+		for i := range v.Len() {
+			items[i] = settingsOf(v.Index(i))
+		}
+		return items
+	case reflect.Map:
+		entries := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			entries[fmt.Sprint(iter.Key().Interface())] = settingsOf(iter.Value())
+		}
+		return entries
+	default:
+		return v.Interface()
+	}
+}
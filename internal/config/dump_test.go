@@ -0,0 +1,72 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDump(t *testing.T) {
+	digest := "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	cfg := Config{
+		Main:     MainConfig{Listen: "127.0.0.1", Port: 3000},
+		Auth:     AuthConfig{APIKeys: []string{"plain-secret-key", digest}, OIDC: OIDCConfig{ClientSecret: "oidc"}},
+		Files:    FilesConfig{SigningSecret: "signing", HealthInterval: 90 * time.Second},
+		Tracing:  TracingConfig{Headers: map[string]string{"Authorization": "Bearer token"}},
+		Timeouts: TimeoutsConfig{ReadHeader: 5 * time.Second},
+		FileRoots: []FileRoot{{Virtual: "/public", Source: "/srv/public", Allow: []AccessRule{
+			{APIKeys: []string{"rule-key"}},
+		}}},
+		Webhooks: []WebhookConfig{{URL: "https://hooks.example.com/", Secret: "hook-secret"}},
+	}
+
+	out, err := Dump(cfg, "toml")
+	require.NoError(t, err)
+	var settings map[string]any
+	require.NoError(t, toml.Unmarshal(out, &settings))
+	assertDumped(t, settings, digest)
+
+	out, err = Dump(cfg, "JSON")
+	require.NoError(t, err)
+	settings = nil
+	require.NoError(t, json.Unmarshal(out, &settings))
+	assertDumped(t, settings, digest)
+
+	assert.Equal(t, "plain-secret-key", cfg.Auth.APIKeys[0], "the dumped config is left unchanged")
+	assert.Equal(t, "rule-key", cfg.FileRoots[0].Allow[0].APIKeys[0])
+	assert.Equal(t, "hook-secret", cfg.Webhooks[0].Secret)
+
+	_, err = Dump(cfg, "yaml")
+	require.ErrorContains(t, err, "invalid dump format: yaml")
+}
+
+func assertDumped(t *testing.T, settings map[string]any, digest string) {
+	t.Helper()
+	main := settings["main"].(map[string]any)
+	assert.Equal(t, "127.0.0.1", main["listen"])
+
+	auth := settings["auth"].(map[string]any)
+	assert.Equal(t, []any{redacted, digest}, auth["api_keys"])
+	assert.Equal(t, redacted, auth["oidc"].(map[string]any)["client_secret"])
+
+	files := settings["files"].(map[string]any)
+	assert.Equal(t, redacted, files["signing_secret"])
+	assert.Equal(t, "1m30s", files["health_interval"])
+	assert.Equal(t, "5s", settings["timeouts"].(map[string]any)["read_header"])
+	assert.Equal(t, redacted, settings["tracing"].(map[string]any)["headers"].(map[string]any)["Authorization"])
+
+	roots := settings["file-root"].([]any)
+	require.Len(t, roots, 1)
+	root := roots[0].(map[string]any)
+	assert.Equal(t, "/srv/public", root["source"])
+	assert.Equal(t, []any{redacted}, root["allow"].([]any)[0].(map[string]any)["api_keys"])
+
+	hooks := settings["webhook"].([]any)
+	require.Len(t, hooks, 1)
+	assert.Equal(t, "https://hooks.example.com/", hooks[0].(map[string]any)["url"])
+	assert.Equal(t, redacted, hooks[0].(map[string]any)["secret"])
+}
@@ -4,10 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"os"
+	"path"
 	"strings"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/files"
 )
 
 // Loader loads dendrite-pulse configuration using a shared Viper instance.
@@ -25,51 +29,220 @@ func NewLoader(v *viper.Viper) *Loader {
 
 // Load resolves configuration with precedence: defaults < config file < env < flags.
 func (l *Loader) Load(configPath string) (Config, error) {
+	cfg, err := l.Resolve(configPath)
+	if err != nil {
+		return cfg, err
+	}
+	if err := Validate(cfg); err != nil {
+		return cfg, fmt.Errorf("validate config: %w", err)
+	}
+	return cfg, nil
+}
+
+// Resolve is Load without validation, for diagnosing configurations that do
+// not validate.
+func (l *Loader) Resolve(configPath string) (Config, error) {
 	v := l.v
 	v.SetConfigType("toml")
 	v.SetConfigFile(configPath)
 
 	v.SetDefault("main.listen", defaultListen)
 	v.SetDefault("main.port", defaultPort)
+	v.SetDefault("main.socket_mode", "0660")
+	v.SetDefault("main.proxy_protocol", false)
+	v.SetDefault("main.trusted_proxies", []string{})
+	v.SetDefault("main.pid_file", "")
 	v.SetDefault("log.level", defaultLogLevel)
 	v.SetDefault("log.format", defaultLogFmt)
+	v.SetDefault("log.errors", false)
+	v.SetDefault("log.access_file", "")
+	v.SetDefault("log.access_format", "json")
+	v.SetDefault("files.anonymous_writes", false)
+	v.SetDefault("files.canonical_redirect", false)
+	v.SetDefault("files.strict_paths", false)
+	v.SetDefault("files.export_base", "")
+	v.SetDefault("files.sniff_bytes", defaultSniffBytes)
+	v.SetDefault("files.health_interval", "0s")
+	v.SetDefault("files.generated_at", false)
+	v.SetDefault("files.reject_empty_ranges", false)
+	v.SetDefault("files.max_symlink_depth", defaultMaxSymlinkDepth)
+	v.SetDefault("files.expose_ownership", true)
+	v.SetDefault("files.resolve_owners", true)
+	v.SetDefault("files.case_insensitive", false)
+	v.SetDefault("files.expose_file_id", false)
+	v.SetDefault("files.expose_acl", false)
+	v.SetDefault("files.respect_locks", false)
+	v.SetDefault("files.respect_gitignore", false)
+	v.SetDefault("files.max_open_files", 0)
+	v.SetDefault("files.max_path_depth", 0)
+	v.SetDefault("files.startup_concurrency", files.DefaultStartupConcurrency)
+	v.SetDefault("files.list_concurrency", files.DefaultListConcurrency)
+	v.SetDefault("files.signing_secret", "")
+	v.SetDefault("files.signing_max_ttl", "24h")
+	v.SetDefault("files.sibling_extensions", []string{})
+	v.SetDefault("files.merge_file_roots", false)
+	v.SetDefault("files.listing_cache_ttl", "0s")
+	v.SetDefault("files.listing_cache_entries", files.DefaultListingCacheEntries)
+	v.SetDefault("files.thumbnail_cache_dir", "")
+	v.SetDefault("files.thumbnail_cache_size", "1GiB")
+	v.SetDefault("api.size_as_string", false)
+	v.SetDefault("api.reject_duplicate_params", false)
+	v.SetDefault("api.server_timing", false)
+	v.SetDefault("api.stream_listings", false)
+	v.SetDefault("api.debug", false)
+	v.SetDefault("api.events", false)
+	v.SetDefault("api.collation", "binary")
+	v.SetDefault("api.collation_locale", "")
+	v.SetDefault("api.listing_mime_detection", "content")
+	v.SetDefault("cors.allowed_origins", []string{})
+	v.SetDefault("cors.allowed_methods", []string{"GET", "HEAD", "POST", "PATCH"})
+	v.SetDefault("cors.allowed_headers", []string{})
+	v.SetDefault("cors.max_age", "0s")
+	v.SetDefault("auth.api_keys", []string{})
+	v.SetDefault("auth.oidc.issuer", "")
+	v.SetDefault("auth.oidc.client_id", "")
+	v.SetDefault("auth.oidc.client_secret", "")
+	v.SetDefault("auth.oidc.redirect_url", "")
+	v.SetDefault("auth.oidc.scopes", []string{"openid", "profile", "email"})
+	v.SetDefault("auth.oidc.groups_claim", "groups")
+	v.SetDefault("tls.cert_file", "")
+	v.SetDefault("tls.key_file", "")
+	v.SetDefault("limits.max_concurrent_requests", 0)
+	v.SetDefault("limits.max_connections", 0)
+	v.SetDefault("limits.retry_after", "1s")
+	v.SetDefault("limits.max_body_size", "10M")
+	v.SetDefault("timeouts.read_header", "5s")
+	v.SetDefault("timeouts.read", "0s")
+	v.SetDefault("timeouts.write", "0s")
+	v.SetDefault("timeouts.idle", "0s")
+	v.SetDefault("timeouts.handler", "0s")
+	v.SetDefault("tracing.endpoint", "")
+	v.SetDefault("tracing.service_name", "dendrite")
+	v.SetDefault("tracing.sample_ratio", 1.0)
+	v.SetDefault("audit.file", "")
+	v.SetDefault("audit.syslog", false)
+	v.SetDefault("audit.syslog_tag", "dendrite")
+	v.SetDefault("tls.min_version", "1.2")
+	v.SetDefault("tls.cipher_suites", []string{})
+	v.SetDefault("web.robots_txt", "")
+	v.SetDefault("web.security_txt", "")
 
 	v.SetEnvPrefix("DENDRITE")
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
 	v.AutomaticEnv()
 
-	if err := v.ReadInConfig(); err != nil {
-		var cfg Config
-		var notFound viper.ConfigFileNotFoundError
-		switch {
-		case errors.As(err, &notFound):
-		case errors.Is(err, fs.ErrNotExist):
-		default:
-			return cfg, fmt.Errorf("read config: %w", err)
-		}
+	if err := v.ReadInConfig(); err != nil && !isMissingConfig(err) {
+		return Config{}, fmt.Errorf("read config: %w", err)
 	}
 
 	var cfg Config
 	settings := v.AllSettings()
 	delete(settings, "file-root")
+	// Viper splits keys at dots, which would break up extensions like ".gpx".
+	delete(settings, "mime")
 
 	if err := decodeSettings(settings, &cfg); err != nil {
 		return cfg, fmt.Errorf("unmarshal config: %w", err)
 	}
 
-	roots, err := decodeFileRoots(v.Get("file-root"))
+	roots, err := l.fileRoots(configPath)
 	if err != nil {
 		return cfg, err
 	}
 	if len(roots) > 0 {
 		cfg.FileRoots = roots
 	}
+	if cfg.MimeTypes, err = decodeMimeTypes(l.v.Get("mime")); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
 
-	if err := Validate(cfg); err != nil {
-		return cfg, fmt.Errorf("validate config: %w", err)
+// isMissingConfig reports whether err means the config file does not exist,
+// in which case defaults, environment and flags apply alone.
+func isMissingConfig(err error) bool {
+	var notFound viper.ConfigFileNotFoundError
+	return errors.As(err, &notFound) || errors.Is(err, fs.ErrNotExist)
+}
+
+// fileRoots returns the file roots of the highest-precedence source. With
+// files.merge_file_roots the roots of all sources are merged instead: a root
+// from a higher-precedence source overrides the root with the same virtual
+// folder from lower ones, and all other roots persist. Either way, a source
+// defining a virtual folder twice is an error.
+func (l *Loader) fileRoots(configPath string) ([]FileRoot, error) {
+	top, err := decodeFileRoots(l.v.Get("file-root"))
+	if err != nil || !l.v.GetBool("files.merge_file_roots") {
+		return top, err
 	}
 
-	return cfg, nil
+	fromFile, err := configFileRoots(configPath)
+	if err != nil {
+		return nil, err
+	}
+	var fromEnv []FileRoot
+	if def := os.Getenv(envFileRoot); def != "" {
+		if fromEnv, err = parseFileRootDefinitions([]string{def}); err != nil {
+			return nil, err
+		}
+	}
+	// top repeats the highest source that is set, which merges idempotently.
+	return mergeFileRoots(
+		fileRootLayer{"config file", fromFile},
+		fileRootLayer{envFileRoot, fromEnv},
+		fileRootLayer{"--file-root", top},
+	)
+}
+
+// configFileRoots reads the file roots defined in the config file alone.
+func configFileRoots(configPath string) ([]FileRoot, error) {
+	v := viper.New()
+	v.SetConfigType("toml")
+	v.SetConfigFile(configPath)
+	if err := v.ReadInConfig(); err != nil {
+		if isMissingConfig(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	return decodeFileRoots(v.Get("file-root"))
+}
+
+// fileRootLayer holds the file roots defined by one configuration source.
+type fileRootLayer struct {
+	source string
+	roots  []FileRoot
+}
+
+// mergeFileRoots merges layers of file roots ordered from lowest to highest
+// precedence. Virtual folders are compared after cleaning, so "/public/"
+// overrides "/public". A root overrides the root with the same virtual
+// folder from lower layers, keeping its position; a layer defining the same
+// virtual folder twice is an error, as it would be without merging.
+func mergeFileRoots(layers ...fileRootLayer) ([]FileRoot, error) {
+	var merged []FileRoot
+	for _, layer := range layers {
+		index := make(map[string]int, len(merged))
+		for i, root := range merged {
+			index[root.Virtual] = i
+		}
+		seen := make(map[string]struct{}, len(layer.roots))
+		for _, root := range layer.roots {
+			if root.Virtual != "" {
+				root.Virtual = path.Clean(root.Virtual)
+			}
+			if _, ok := seen[root.Virtual]; ok {
+				return nil, fmt.Errorf("%s: duplicate virtual path: %s", layer.source, root.Virtual)
+			}
+			seen[root.Virtual] = struct{}{}
+			if i, ok := index[root.Virtual]; ok {
+				merged[i] = root
+				continue
+			}
+			merged = append(merged, root)
+		}
+	}
+	return merged, nil
 }
 
 // Load is a convenience wrapper that uses a fresh Viper instance.
@@ -117,6 +290,11 @@ func decodeSettings(settings map[string]interface{}, cfg *Config) error {
 	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
 		TagName: "mapstructure",
 		Result:  cfg,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			// Lists set through environment variables arrive comma-separated.
+			mapstructure.StringToSliceHookFunc(","),
+		),
 	})
 	if err != nil {
 		return fmt.Errorf("init decoder: %w", err)
@@ -154,3 +332,36 @@ func decodeFileRoots(raw interface{}) ([]FileRoot, error) {
 
 	return roots, nil
 }
+
+// decodeMimeTypes reads the [mime] section, or the comma-separated ext=type
+// pairs of DENDRITE_MIME. Extensions are lowercased and get a leading dot, so
+// "GPX" and ".gpx" both match "track.gpx".
+func decodeMimeTypes(raw interface{}) (map[string]string, error) {
+	pairs := make(map[string]interface{})
+	switch raw := raw.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		for _, pair := range strings.Split(raw, ",") {
+			ext, mimeType, ok := strings.Cut(pair, "=")
+			if !ok {
+				return nil, fmt.Errorf("mime: expected format ext=type: %q", pair)
+			}
+			pairs[strings.TrimSpace(ext)] = strings.TrimSpace(mimeType)
+		}
+	case map[string]interface{}:
+		pairs = raw
+	default:
+		return nil, fmt.Errorf("mime: expected a table of extensions, got %T", raw)
+	}
+
+	types := make(map[string]string, len(pairs))
+	for ext, mimeType := range pairs {
+		s, ok := mimeType.(string)
+		if !ok {
+			return nil, fmt.Errorf("mime: type of %s must be a string", ext)
+		}
+		types["."+strings.TrimPrefix(strings.ToLower(ext), ".")] = s
+	}
+	return types, nil
+}
@@ -5,11 +5,14 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/files"
 )
 
 func TestLoaderPrecedence(t *testing.T) {
@@ -91,6 +94,11 @@ func TestLoaderMissingConfigFileUsesDefaults(t *testing.T) {
 	require.Len(t, cfg.FileRoots, 1)
 	assert.Equal(t, "/env", cfg.FileRoots[0].Virtual)
 	assert.Equal(t, root, cfg.FileRoots[0].Source)
+	assert.True(t, cfg.Files.ResolveOwners, "owner names are looked up by default")
+	assert.False(t, cfg.Files.AnonymousWrites, "unauthenticated clients cannot change entries by default")
+	assert.Equal(t, 24*time.Hour, cfg.Files.SigningMaxTTL)
+	assert.Equal(t, files.DefaultStartupConcurrency, cfg.Files.StartupConcurrency)
+	assert.Equal(t, "1GiB", cfg.Files.ThumbnailCacheSize)
 }
 
 func TestLoaderValidatesConfig(t *testing.T) {
@@ -116,6 +124,208 @@ source = "%s"
 	assert.Contains(t, err.Error(), "invalid listen address")
 }
 
+func TestLoaderDecodesDurations(t *testing.T) {
+	v := viper.New()
+	loader := NewLoader(v)
+	root := filepath.Join(t.TempDir(), "root")
+	require.NoError(t, os.MkdirAll(root, 0o750))
+	cfgPath := writeTempConfig(t, fmt.Sprintf(`
+[files]
+health_interval = "45s"
+
+[[file-root]]
+virtual = "/root"
+source = "%s"
+`, root))
+
+	cfg, err := loader.Load(cfgPath)
+	require.NoError(t, err)
+	assert.Equal(t, 45*time.Second, cfg.Files.HealthInterval)
+}
+
+func TestLoaderDecodesAccessRules(t *testing.T) {
+	v := viper.New()
+	loader := NewLoader(v)
+	root := filepath.Join(t.TempDir(), "root")
+	require.NoError(t, os.MkdirAll(root, 0o750))
+	cfgPath := writeTempConfig(t, fmt.Sprintf(`
+[auth]
+api_keys = ["0123456789abcdef0123456789abcdef"]
+
+[[file-root]]
+virtual = "/root"
+source = "%s"
+
+[[file-root.allow]]
+groups = ["staff"]
+
+[[file-root.deny]]
+users = ["mallory"]
+scopes = ["write", "delete"]
+`, root))
+
+	cfg, err := loader.Load(cfgPath)
+	require.NoError(t, err)
+	require.Len(t, cfg.FileRoots, 1)
+	assert.Equal(t, []AccessRule{{Groups: []string{"staff"}}}, cfg.FileRoots[0].Allow)
+	assert.Equal(t, []AccessRule{{Users: []string{"mallory"}, Scopes: []string{"write", "delete"}}},
+		cfg.FileRoots[0].Deny)
+}
+
+func TestLoaderDecodesListeners(t *testing.T) {
+	v := viper.New()
+	loader := NewLoader(v)
+	root := filepath.Join(t.TempDir(), "root")
+	require.NoError(t, os.MkdirAll(root, 0o750))
+	cfgPath := writeTempConfig(t, fmt.Sprintf(`
+[main]
+port = 8080
+
+[[listener]]
+listen = "127.0.0.1"
+
+[[listener]]
+listen = "::1"
+port = 8081
+proxy_protocol = true
+
+[[listener]]
+listen = "unix:/run/dendrite.sock"
+socket_mode = "0600"
+
+[[file-root]]
+virtual = "/root"
+source = "%s"
+`, root))
+
+	cfg, err := loader.Load(cfgPath)
+	require.NoError(t, err)
+	assert.Equal(t, []ListenerConfig{
+		{Listen: "127.0.0.1", Port: 8080, SocketMode: "0660"},
+		{Listen: "::1", Port: 8081, SocketMode: "0660", ProxyProtocol: true},
+		{Listen: "unix:/run/dendrite.sock", Port: 8080, SocketMode: "0600"},
+	}, cfg.EffectiveListeners())
+
+	cfgPath = writeTempConfig(t, fmt.Sprintf(`
+[[listener]]
+listen = "localhost"
+
+[[file-root]]
+virtual = "/root"
+source = "%s"
+`, root))
+	_, err = NewLoader(viper.New()).Load(cfgPath)
+	require.ErrorContains(t, err, "listener 1: invalid listen address: localhost")
+}
+
+func TestLoaderDecodesListsFromEnv(t *testing.T) {
+	v := viper.New()
+	loader := NewLoader(v)
+	root := filepath.Join(t.TempDir(), "root")
+	require.NoError(t, os.MkdirAll(root, 0o750))
+	t.Setenv("DENDRITE_FILE_ROOT", "/env:"+root)
+	t.Setenv("DENDRITE_FILES_SIBLING_EXTENSIONS", "html,md")
+
+	cfg, err := loader.Load(filepath.Join(t.TempDir(), "missing.toml"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"html", "md"}, cfg.Files.SiblingExtensions)
+}
+
+func TestLoaderDecodesMimeTypes(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "root")
+	require.NoError(t, os.MkdirAll(root, 0o750))
+	cfgPath := writeTempConfig(t, fmt.Sprintf(`
+[mime]
+".gpx" = "application/gpx+xml"
+KML = "application/vnd.google-earth.kml+xml"
+
+[[file-root]]
+virtual = "/root"
+source = "%s"
+`, root))
+
+	cfg, err := NewLoader(viper.New()).Load(cfgPath)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		".gpx": "application/gpx+xml",
+		".kml": "application/vnd.google-earth.kml+xml",
+	}, cfg.MimeTypes)
+
+	t.Setenv("DENDRITE_MIME", "gpx=application/gpx+xml, geojson=application/geo+json")
+	cfg, err = NewLoader(viper.New()).Load(cfgPath)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{".gpx": "application/gpx+xml", ".geojson": "application/geo+json"}, cfg.MimeTypes)
+
+	t.Setenv("DENDRITE_MIME", "gpx")
+	_, err = NewLoader(viper.New()).Load(cfgPath)
+	assert.ErrorContains(t, err, "expected format ext=type")
+}
+
+func TestLoaderMergesFileRoots(t *testing.T) {
+	v := viper.New()
+	loader := NewLoader(v)
+	docsRoot := filepath.Join(t.TempDir(), "docs")
+	require.NoError(t, os.MkdirAll(docsRoot, 0o750))
+	configPublic := filepath.Join(t.TempDir(), "config-public")
+	require.NoError(t, os.MkdirAll(configPublic, 0o750))
+	envRoot := filepath.Join(t.TempDir(), "env")
+	require.NoError(t, os.MkdirAll(envRoot, 0o750))
+	flagPublic := filepath.Join(t.TempDir(), "flag-public")
+	require.NoError(t, os.MkdirAll(flagPublic, 0o750))
+
+	cfgPath := writeTempConfig(t, fmt.Sprintf(`
+[files]
+merge_file_roots = true
+
+[[file-root]]
+virtual = "/docs"
+source = "%s"
+
+[[file-root]]
+virtual = "/public"
+source = "%s"
+`, docsRoot, configPublic))
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.StringArray("file-root", nil, "")
+	require.NoError(t, flags.Parse([]string{"--file-root", "/public/:" + flagPublic}))
+	require.NoError(t, v.BindPFlag("file-root", flags.Lookup("file-root")))
+	t.Setenv("DENDRITE_FILE_ROOT", "/env:"+envRoot)
+
+	cfg, err := loader.Load(cfgPath)
+	require.NoError(t, err)
+
+	assert.Equal(t, []FileRoot{
+		{Virtual: "/docs", Source: docsRoot},
+		{Virtual: "/public", Source: flagPublic},
+		{Virtual: "/env", Source: envRoot},
+	}, cfg.FileRoots)
+}
+
+func TestMergeFileRoots(t *testing.T) {
+	merged, err := mergeFileRoots(
+		fileRootLayer{"config file", []FileRoot{{Virtual: "/a", Source: "/config/a"}, {Virtual: "/b", Source: "/config/b"}}},
+		fileRootLayer{"env", []FileRoot{{Virtual: "/b/", Source: "/env/b"}}},
+		fileRootLayer{"flag", []FileRoot{{Virtual: "/c", Source: "/flag/c"}, {Virtual: "/b", Source: "/flag/b"}}},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []FileRoot{
+		{Virtual: "/a", Source: "/config/a"},
+		{Virtual: "/b", Source: "/flag/b"},
+		{Virtual: "/c", Source: "/flag/c"},
+	}, merged, "higher layers override lower ones")
+
+	// Duplicates within one layer are rejected rather than overriding each other.
+	for _, dup := range []fileRootLayer{
+		{"config file", []FileRoot{{Virtual: "/c", Source: "/config/c"}, {Virtual: "/c/", Source: "/config/c2"}}},
+		{"flag", []FileRoot{{Virtual: "/c", Source: "/flag/c"}, {Virtual: "/c", Source: "/flag/c2"}}},
+	} {
+		_, err = mergeFileRoots(fileRootLayer{"env", []FileRoot{{Virtual: "/c", Source: "/env/c"}}}, dup)
+		require.Error(t, err, dup.source)
+		assert.Contains(t, err.Error(), dup.source+": duplicate virtual path: /c")
+	}
+}
+
 func TestParseFileRootDefinitions(t *testing.T) {
 	defs := []string{"/public:/var/www/public,/docs:/srv/docs", "/tmp:/tmp"}
 
@@ -164,6 +374,106 @@ func TestValidateFileRoots(t *testing.T) {
 		assert.Contains(t, err.Error(), "stat source")
 	})
 
+	t.Run("relative manifest", func(t *testing.T) {
+		cfg := base
+		cfg.FileRoots = []FileRoot{{Virtual: "/public", Source: t.TempDir(), Manifest: "public.manifest"}}
+		err := Validate(cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "manifest must be an absolute path")
+	})
+
+	t.Run("missing manifest", func(t *testing.T) {
+		cfg := base
+		cfg.FileRoots = []FileRoot{{Virtual: "/public", Source: t.TempDir(), Manifest: "/definitely/missing"}}
+		err := Validate(cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "stat manifest")
+	})
+
+	t.Run("default limit above maximum", func(t *testing.T) {
+		cfg := base
+		cfg.FileRoots = []FileRoot{{Virtual: "/public", Source: t.TempDir(), DefaultLimit: 501}}
+		err := Validate(cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "default_limit must be between 1 and 500")
+	})
+
+	t.Run("relative symlink target folder", func(t *testing.T) {
+		cfg := base
+		cfg.FileRoots = []FileRoot{{Virtual: "/public", Source: t.TempDir(), FollowSymlinksOutside: []string{"mnt/data"}}}
+		err := Validate(cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "file root 0: follow_symlinks_outside must list absolute paths: mnt/data")
+	})
+
+	t.Run("missing symlink target folder", func(t *testing.T) {
+		cfg := base
+		cfg.FileRoots = []FileRoot{{
+			Virtual: "/public", Source: t.TempDir(), FollowSymlinksOutside: []string{"/definitely/missing"},
+		}}
+		err := Validate(cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "stat follow_symlinks_outside /definitely/missing")
+	})
+
+	t.Run("hidden pattern with a slash", func(t *testing.T) {
+		cfg := base
+		cfg.FileRoots = []FileRoot{{Virtual: "/public", Source: t.TempDir(), HiddenPatterns: []string{"*.bak", "tmp/*"}}}
+		err := Validate(cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `hidden_patterns must be name globs such as "*.bak": "tmp/*"`)
+	})
+
+	t.Run("malformed hidden pattern", func(t *testing.T) {
+		cfg := base
+		cfg.FileRoots = []FileRoot{{Virtual: "/public", Source: t.TempDir(), HiddenPatterns: []string{"[a-"}}}
+		err := Validate(cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "file root 0: hidden_patterns")
+	})
+
+	t.Run("relative robots.txt", func(t *testing.T) {
+		cfg := base
+		cfg.FileRoots = []FileRoot{{Virtual: "/public", Source: t.TempDir()}}
+		cfg.Web.RobotsTxt = "robots.txt"
+		err := Validate(cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "web robots_txt must be an absolute path")
+	})
+
+	t.Run("missing security.txt", func(t *testing.T) {
+		cfg := base
+		cfg.FileRoots = []FileRoot{{Virtual: "/public", Source: t.TempDir()}}
+		cfg.Web.SecurityTxt = "/definitely/missing/security.txt"
+		err := Validate(cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "web security_txt: stat")
+	})
+
+	t.Run("dotted sibling extension", func(t *testing.T) {
+		cfg := base
+		cfg.FileRoots = []FileRoot{{Virtual: "/public", Source: t.TempDir()}}
+		cfg.Files.SiblingExtensions = []string{".html"}
+		err := Validate(cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "files sibling_extensions must be bare extensions")
+	})
+
+	t.Run("reports every missing source", func(t *testing.T) {
+		cfg := base
+		cfg.Files.StartupConcurrency = 2
+		cfg.FileRoots = []FileRoot{
+			{Virtual: "/first", Source: "/definitely/missing/first"},
+			{Virtual: "/second", Source: t.TempDir()},
+			{Virtual: "/third", Source: "/definitely/missing/third"},
+		}
+		err := Validate(cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "file root 0: stat source /definitely/missing/first")
+		assert.Contains(t, err.Error(), "file root 2: stat source /definitely/missing/third")
+		assert.NotContains(t, err.Error(), "file root 1")
+	})
+
 	t.Run("duplicate virtual", func(t *testing.T) {
 		dir := t.TempDir()
 		cfg := base
@@ -0,0 +1,93 @@
+package files
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/auth"
+)
+
+// Scopes of the access rules of a root.
+const (
+	ScopeRead   = "read"   // listings, downloads, searches and signed URLs
+	ScopeWrite  = "write"  // changes to entries, including renames
+	ScopeDelete = "delete" // removing entries from the root, e.g. by moving them to another root
+)
+
+// AccessRule grants or denies scopes to clients. A client matches when its
+// API key, OIDC subject or one of its groups is listed; a rule listing none
+// of them matches every client.
+type AccessRule struct {
+	// APIKeys lists keys as sha256:<hex digest>, like auth.Identity.APIKey.
+	APIKeys []string
+	Users   []string
+	Groups  []string
+	// Scopes lists the affected scopes; empty means all.
+	Scopes []string
+}
+
+// AccessPolicy restricts which clients may use a root. Without rules every
+// client may use it. Otherwise a client needs an allow rule for the scope,
+// unless there are only deny rules, and no deny rule may match.
+type AccessPolicy struct {
+	Allow []AccessRule
+	Deny  []AccessRule
+}
+
+// permits reports whether the policy grants scope to id. Anonymous clients
+// are only permitted on roots without rules.
+func (p AccessPolicy) permits(id auth.Identity, authenticated bool, scope string) bool {
+	if len(p.Allow) == 0 && len(p.Deny) == 0 {
+		return true
+	}
+	if !authenticated {
+		return false
+	}
+	for _, rule := range p.Deny {
+		if rule.matches(id, scope) {
+			return false
+		}
+	}
+	if len(p.Allow) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(p.Allow, func(rule AccessRule) bool { return rule.matches(id, scope) })
+}
+
+func (r AccessRule) matches(id auth.Identity, scope string) bool {
+	if len(r.Scopes) > 0 && !slices.Contains(r.Scopes, scope) {
+		return false
+	}
+	if len(r.APIKeys) == 0 && len(r.Users) == 0 && len(r.Groups) == 0 {
+		return true
+	}
+	return (id.APIKey != "" && slices.Contains(r.APIKeys, id.APIKey)) ||
+		(id.Subject != "" && slices.Contains(r.Users, id.Subject)) ||
+		slices.ContainsFunc(id.Groups, func(group string) bool { return slices.Contains(r.Groups, group) })
+}
+
+// authorize checks that the client of the request may use scope on root.
+// Roots the client may not read are reported as missing, so their names do
+// not leak. Read-only roots grant no other scope to anyone.
+func authorize(c echo.Context, root Root, scope string) error {
+	id, authenticated := auth.IdentityFromContext(c.Request().Context())
+	if !root.Access.permits(id, authenticated, ScopeRead) {
+		return echo.NewHTTPError(http.StatusNotFound, "file root not found")
+	}
+	if scope != ScopeRead && root.ReadOnly {
+		return echo.NewHTTPError(http.StatusForbidden, "file root is read-only")
+	}
+	if scope != ScopeRead && !root.Access.permits(id, authenticated, scope) {
+		return echo.NewHTTPError(http.StatusForbidden, "access denied")
+	}
+	return nil
+}
+
+// readableRoots returns the entries of roots the client may read.
+func readableRoots(c echo.Context, roots []Descriptor) []Descriptor {
+	return slices.DeleteFunc(roots, func(desc Descriptor) bool {
+		return authorize(c, desc.Root, ScopeRead) != nil
+	})
+}
@@ -0,0 +1,30 @@
+package files
+
+import "os"
+
+// ACLEntry is a simplified POSIX access ACL entry.
+type ACLEntry struct {
+	// Tag is one of user_obj, user, group_obj, group, mask or other.
+	Tag string `json:"tag"`
+	// ID is the user or group ID of named user and group entries.
+	ID *int `json:"id,omitempty"`
+	// Permissions is rendered like ls, e.g. "rw-".
+	Permissions string `json:"permissions"`
+}
+
+// ACL lists the access ACL entries of a file.
+type ACL []ACLEntry
+
+// acl returns the access ACL of the described entry when exposed. It points
+// to a nil ACL when the platform has no POSIX ACLs or the entry carries no
+// extended ACL, so the attribute renders as null.
+func (s *Service) acl(desc Descriptor, info os.FileInfo) *ACL {
+	if !s.opts.ExposeACL {
+		return nil
+	}
+	var entries ACL
+	if info.Mode()&os.ModeSymlink == 0 {
+		entries = readACL(desc.AbsolutePath)
+	}
+	return &entries
+}
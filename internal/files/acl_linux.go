@@ -0,0 +1,75 @@
+//go:build linux
+
+package files
+
+import (
+	"encoding/binary"
+	"syscall"
+)
+
+// xattrACLAccess holds the access ACL in the kernel's binary format: a
+// version header followed by tag, permission and ID per entry.
+const (
+	xattrACLAccess    = "system.posix_acl_access"
+	aclHeaderSize     = 4
+	aclEntrySize      = 8
+	aclVersion        = 2
+	aclUndefinedID    = 0xFFFFFFFF
+	aclMaxXattrLength = 64 * 1024
+)
+
+var aclTags = map[uint16]string{
+	0x01: "user_obj",
+	0x02: "user",
+	0x04: "group_obj",
+	0x08: "group",
+	0x10: "mask",
+	0x20: "other",
+}
+
+// readACL returns the access ACL of absPath, or nil when it has none or the
+// filesystem does not support ACLs.
+func readACL(absPath string) ACL {
+	buf := make([]byte, aclMaxXattrLength)
+	n, err := syscall.Getxattr(absPath, xattrACLAccess, buf)
+	if err != nil {
+		return nil
+	}
+	return parseACL(buf[:n])
+}
+
+// parseACL decodes the posix_acl_access xattr, returning nil for malformed values.
+func parseACL(data []byte) ACL {
+	if len(data) < aclHeaderSize || (len(data)-aclHeaderSize)%aclEntrySize != 0 {
+		return nil
+	}
+	if binary.LittleEndian.Uint32(data) != aclVersion {
+		return nil
+	}
+
+	entries := make(ACL, 0, (len(data)-aclHeaderSize)/aclEntrySize)
+	for off := aclHeaderSize; off < len(data); off += aclEntrySize {
+		tag, ok := aclTags[binary.LittleEndian.Uint16(data[off:])]
+		if !ok {
+			return nil
+		}
+		perm := binary.LittleEndian.Uint16(data[off+2:])
+		entry := ACLEntry{Tag: tag, Permissions: aclPermissions(perm)}
+		if id := binary.LittleEndian.Uint32(data[off+4:]); id != aclUndefinedID {
+			qualifier := int(id)
+			entry.ID = &qualifier
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func aclPermissions(perm uint16) string {
+	out := []byte("---")
+	for i, c := range []byte("rwx") {
+		if perm&(4>>i) != 0 {
+			out[i] = c
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,56 @@
+//go:build linux
+
+package files
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescribeExposesACL(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "shared.txt")
+	require.NoError(t, os.WriteFile(file, []byte("shared"), 0o600))
+
+	// user::rw-, user:12345:r--, group::---, mask::r--, other::---
+	acl := []struct {
+		tag, perm uint16
+		id        uint32
+	}{
+		{0x01, 6, aclUndefinedID},
+		{0x02, 4, 12345},
+		{0x04, 0, aclUndefinedID},
+		{0x10, 4, aclUndefinedID},
+		{0x20, 0, aclUndefinedID},
+	}
+	value := binary.LittleEndian.AppendUint32(nil, aclVersion)
+	for _, entry := range acl {
+		value = binary.LittleEndian.AppendUint16(value, entry.tag)
+		value = binary.LittleEndian.AppendUint16(value, entry.perm)
+		value = binary.LittleEndian.AppendUint32(value, entry.id)
+	}
+	if err := syscall.Setxattr(file, xattrACLAccess, value, 0); err != nil {
+		if errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EOPNOTSUPP) {
+			t.Skip("filesystem does not support POSIX ACLs")
+		}
+		require.NoError(t, err)
+	}
+
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root}}, Options{ExposeACL: true})
+	require.NoError(t, err)
+
+	desc, err := svc.Describe(t.Context(), "/public", "shared.txt")
+	require.NoError(t, err)
+	require.NotNil(t, desc.Metadata.ACL)
+
+	id := 12345
+	assert.Contains(t, *desc.Metadata.ACL, ACLEntry{Tag: "user", ID: &id, Permissions: "r--"})
+	assert.Contains(t, *desc.Metadata.ACL, ACLEntry{Tag: "user_obj", Permissions: "rw-"})
+}
@@ -0,0 +1,252 @@
+package files
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// archiveContentTypes maps the supported ?archive= formats to their
+// Content-Type.
+var archiveContentTypes = map[string]string{
+	"tar":    "application/x-tar",
+	"tar.gz": "application/gzip",
+}
+
+// maxArchivePaths caps the number of paths of one batch archive request.
+const maxArchivePaths = 1000
+
+// ArchiveRequest is the JSON:API document accepted by POST
+// /api/v1/files:archive, listing the resources to download.
+type ArchiveRequest struct {
+	Data []ResourceIdentifier `json:"data"`
+}
+
+// ResourceIdentifier identifies a file resource by its virtual path.
+type ResourceIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// ArchiveEntry is a resolved entry added to an archive under Name.
+type ArchiveEntry struct {
+	Name string
+	Desc Descriptor
+}
+
+// archiveResources answers POST /api/v1/files:archive with one archive of
+// the listed files and folders, which may live in different roots. Entries
+// are stored under their virtual paths, so equal names from different
+// folders do not collide.
+func (h Handler) archiveResources(c echo.Context) error {
+	var req ArchiveRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+	}
+	if len(req.Data) == 0 || len(req.Data) > maxArchivePaths {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("between 1 and %d resources are required", maxArchivePaths))
+	}
+	paths := make([]string, len(req.Data))
+	for i, resource := range req.Data {
+		if resource.Type != "files" {
+			return echo.NewHTTPError(http.StatusConflict, `resource type must be "files"`)
+		}
+		paths[i] = resource.ID
+		// Match the root the way ResolvePaths does, so IDs without a leading
+		// slash cannot skip the access check.
+		if root, _, ok := matchRoot(path.Clean("/"+resource.ID), h.svc.Roots()); ok {
+			if err := authorize(c, root, ScopeRead); err != nil {
+				return err
+			}
+		}
+	}
+
+	descs, err := h.svc.ResolvePaths(c.Request().Context(), paths)
+	if err != nil {
+		// Report every failing path, not just the first kind of failure.
+		var httpErr *echo.HTTPError
+		if errors.As(toHTTPError(err), &httpErr) {
+			return echo.NewHTTPError(httpErr.Code, strings.ReplaceAll(err.Error(), "\n", "; "))
+		}
+		return err
+	}
+
+	entries := make([]ArchiveEntry, len(descs))
+	for i, desc := range descs {
+		entries[i] = ArchiveEntry{Name: archivePathName(desc), Desc: desc}
+	}
+	format := c.QueryParam("archive")
+	if format == "" {
+		format = "tar.gz"
+	}
+	return h.serveArchive(c, "archive", format, entries)
+}
+
+// serveArchive streams entries as an attachment named name plus the format
+// extension. Errors after the first byte can no longer change the status;
+// they abort the response, leaving a truncated archive clients detect.
+func (h Handler) serveArchive(c echo.Context, name, format string, entries []ArchiveEntry) error {
+	ctype, ok := archiveContentTypes[format]
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid archive format: %s", format))
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, ctype)
+	header.Set(echo.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="%s"`, dispositionEscaper.Replace(name+"."+format)))
+	c.Response().WriteHeader(http.StatusOK)
+
+	var w io.Writer = c.Response()
+	var gz *gzip.Writer
+	if format == "tar.gz" {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	if err := h.svc.WriteArchive(c.Request().Context(), w, entries); err != nil {
+		return fmt.Errorf("write archive: %w", err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("write archive: %w", err)
+		}
+	}
+	return nil
+}
+
+// WriteArchive streams entries to w as a tar archive, each under its name.
+// Folders are added recursively.
+// Symlinks below them are stored as links rather than followed, and
+// permission modes, modification times and, unless hidden, ownership are
+// preserved. FIFOs, sockets and devices are skipped, as are entries hidden by
+// gitignore rules when those are respected.
+func (s *Service) WriteArchive(ctx context.Context, w io.Writer, entries []ArchiveEntry) error {
+	tw := tar.NewWriter(w)
+	for _, entry := range entries {
+		desc := entry.Desc
+		if err := s.addToArchive(ctx, tw, desc.Root, desc.RelPath, desc.AbsolutePath, entry.Name); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("close archive: %w", err)
+	}
+	return nil
+}
+
+// archiveName returns the top-level name of desc within an archive.
+func archiveName(desc Descriptor) string {
+	if desc.Name == "/" {
+		return "root"
+	}
+	return desc.Name
+}
+
+// archivePathName returns the name of desc in a batch archive: its virtual
+// path without the leading slash.
+func archivePathName(desc Descriptor) string {
+	if desc.VirtualPath == "/" {
+		return "root"
+	}
+	return strings.TrimPrefix(desc.VirtualPath, "/")
+}
+
+// addToArchive adds the entry at absPath, rel within root, under name.
+func (s *Service) addToArchive(ctx context.Context, tw *tar.Writer, root Root, rel, absPath, name string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context canceled: %w", err)
+	}
+	info, err := os.Lstat(absPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Removed since its folder was read; archive the remaining entries.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", joinVirtual(root.Virtual, rel), err)
+	}
+	if isSpecialKind(classify(info)) {
+		return nil
+	}
+
+	var link string
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if link, err = os.Readlink(absPath); err != nil {
+			return fmt.Errorf("read link %s: %w", joinVirtual(root.Virtual, rel), err)
+		}
+	}
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return fmt.Errorf("archive header of %s: %w", joinVirtual(root.Virtual, rel), err)
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	if s.opts.HideOwnership {
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("write archive header: %w", err)
+	}
+
+	switch {
+	case info.Mode().IsRegular():
+		return s.copyToArchive(ctx, tw, absPath, hdr.Size)
+	case info.IsDir():
+		return s.addFolderToArchive(ctx, tw, root, rel, absPath, name)
+	}
+	return nil
+}
+
+// addFolderToArchive adds the children of the folder at absPath.
+func (s *Service) addFolderToArchive(ctx context.Context, tw *tar.Writer, root Root, rel, absPath, name string) error {
+	entries, err := s.readDir(absPath)
+	if err != nil {
+		return fmt.Errorf("read dir: %w", err)
+	}
+	ignores := s.listingIgnores(root, rel)
+	for _, entry := range entries {
+		childRel := path.Join(rel, entry.Name())
+		if ignores.ignored(childRel, entry.IsDir()) {
+			continue
+		}
+		childPath := filepath.Join(absPath, entry.Name())
+		if err := s.addToArchive(ctx, tw, root, childRel, childPath, name+"/"+entry.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyToArchive writes the size bytes announced in the header of a file.
+func (s *Service) copyToArchive(ctx context.Context, tw *tar.Writer, absPath string, size int64) error {
+	release, err := s.openFiles.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// #nosec G304 -- the path is resolved within a configured root.
+	f, err := os.Open(absPath)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", absPath, err)
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := io.CopyN(tw, f, size); err != nil {
+		return fmt.Errorf("archive %s: %w", absPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package files
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/audit"
+	"github.com/thorstenkramm/dendrite-pulse/internal/auth"
+	"github.com/thorstenkramm/dendrite-pulse/internal/logging"
+)
+
+// audit records ev in the audit log, completed with the client of the
+// request and the outcome err. Failing to write the audit log is logged but
+// does not fail the request, as the change has already been carried out.
+func (h Handler) audit(c echo.Context, ev audit.Event, err error) {
+	if h.opts.Audit == nil {
+		return
+	}
+	req := c.Request()
+	if id, ok := auth.IdentityFromContext(req.Context()); ok {
+		ev.Subject = id.Subject
+		ev.APIKey = id.APIKey
+	}
+	ev.RemoteIP = c.RealIP()
+	ev.RequestID = c.Response().Header().Get(echo.HeaderXRequestID)
+	if ev.RequestID == "" {
+		ev.RequestID = req.Header.Get(echo.HeaderXRequestID)
+	}
+
+	var httpErr *echo.HTTPError
+	switch {
+	case err == nil:
+		ev.Result = audit.ResultSuccess
+	case errors.As(err, &httpErr) &&
+		(httpErr.Code == http.StatusForbidden || httpErr.Code == http.StatusNotFound):
+		ev.Result = audit.ResultDenied
+	default:
+		ev.Result = audit.ResultFailure
+		ev.Error = err.Error()
+	}
+
+	if err := h.opts.Audit.Record(ev); err != nil {
+		if logger := logging.FromContext(req.Context()); logger != nil {
+			logger.ErrorContext(req.Context(), "audit log failed", "error", err, "action", ev.Action, "path", ev.Path)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/labstack/echo/v4"
+)
+
+// describeBroken describes the entry at rel that describe failed on with
+// err, e.g. a looping or dangling symlink, from the entry itself, so
+// listings report it along with the error instead of failing. It returns
+// fs.ErrNotExist when the entry was removed meanwhile.
+func (s *Service) describeBroken(ctx context.Context, root Root, rel string, err error) (Descriptor, error) {
+	info, statErr := os.Lstat(filepath.Join(root.Source, filepath.FromSlash(rel)))
+	if errors.Is(statErr, fs.ErrNotExist) {
+		return Descriptor{}, fmt.Errorf("stat %s: %w", joinVirtual(root.Virtual, rel), statErr)
+	}
+	if statErr != nil {
+		virtualPath := joinVirtual(root.Virtual, rel)
+		name := entryName(root, rel)
+		return Descriptor{
+			Root:        root,
+			RelPath:     rel,
+			Name:        name,
+			VirtualPath: virtualPath,
+			Metadata:    Metadata{Name: name, VirtualPath: virtualPath},
+			Err:         err,
+		}, nil
+	}
+	desc := s.describeItself(ctx, root, rel, info)
+	desc.Err = err
+	return desc, nil
+}
+
+// EntryMeta carries the error of a listed entry that could not be described.
+type EntryMeta struct {
+	Error string `json:"error"`
+}
+
+// entryMeta reports why desc could not be described, or nil. Errors not
+// mapped to a detail are not passed on, as they may hold source paths.
+func entryMeta(desc Descriptor) *EntryMeta {
+	if desc.Err == nil {
+		return nil
+	}
+	var he *echo.HTTPError
+	if errors.As(toHTTPError(desc.Err), &he) {
+		return &EntryMeta{Error: fmt.Sprint(he.Message)}
+	}
+	return &EntryMeta{Error: "entry could not be read"}
+}
@@ -0,0 +1,84 @@
+package files
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Collations of names selectable with ?collation=.
+const (
+	collationBinary  = "binary"  // byte-wise, the default
+	collationNatural = "natural" // digit runs by numeric value: file2 before file10
+	collationLocale  = "locale"  // the rules of the configured locale
+)
+
+// validCollation reports whether name is a supported collation.
+func validCollation(name string) bool {
+	return name == collationBinary || name == collationNatural || name == collationLocale
+}
+
+func (h Handler) parseCollation(c echo.Context, params *ListParams) error {
+	collation := c.QueryParam("collation")
+	if collation != "" && !validCollation(collation) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid collation: %s", collation))
+	}
+	params.Collation = collation
+	params.compareNames = nameComparer(cmp.Or(collation, h.opts.Collation), h.opts.CollationLocale)
+	return nil
+}
+
+// nameComparer returns the comparison of names for collation. Locale
+// collators are not safe for concurrent use, so every call creates one.
+func nameComparer(collation string, locale language.Tag) func(a, b string) int {
+	switch collation {
+	case collationNatural:
+		return naturalCompare
+	case collationLocale:
+		return collate.New(locale).CompareString
+	}
+	return strings.Compare
+}
+
+// naturalCompare compares names byte-wise, except that runs of digits
+// compare by their numeric value. Names that only differ in leading zeros
+// fall back to byte order, so the order is total.
+func naturalCompare(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			var x, y string
+			x, i = digitRun(a, i)
+			y, j = digitRun(b, j)
+			if c := cmp.Or(cmp.Compare(len(x), len(y)), strings.Compare(x, y)); c != 0 {
+				return c
+			}
+			continue
+		}
+		if a[i] != b[j] {
+			return cmp.Compare(a[i], b[j])
+		}
+		i++
+		j++
+	}
+	return cmp.Or(cmp.Compare(len(a)-i, len(b)-j), strings.Compare(a, b))
+}
+
+// digitRun returns the digits of s starting at i without leading zeros,
+// and the index after them.
+func digitRun(s string, i int) (string, int) {
+	start := i
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return strings.TrimLeft(s[start:i], "0"), i
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
@@ -0,0 +1,94 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// copyEntry copies src to dst recursively, recreating symlinks and keeping
+// permission modes and modification times. Special files are rejected.
+func copyEntry(ctx context.Context, src, dst string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context canceled: %w", err)
+	}
+	info, err := os.Lstat(src)
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", src, err)
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return fmt.Errorf("read link %s: %w", src, err)
+		}
+		if err := os.Symlink(target, dst); err != nil {
+			return fmt.Errorf("create link %s: %w", dst, err)
+		}
+		return nil
+	case info.IsDir():
+		if err := copyDir(ctx, src, dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+	case info.Mode().IsRegular():
+		if err := copyFile(src, dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: cannot copy special file %s", ErrInvalidMove, filepath.Base(src))
+	}
+
+	if err := os.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("set times of %s: %w", dst, err)
+	}
+	return nil
+}
+
+func copyDir(ctx context.Context, src, dst string, perm os.FileMode) error {
+	if err := os.Mkdir(dst, perm); err != nil {
+		return fmt.Errorf("create folder %s: %w", dst, err)
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return fmt.Errorf("read dir: %w", err)
+	}
+	for _, entry := range entries {
+		if err := copyEntry(ctx, filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	// Mkdir applies the umask; restore the original mode.
+	if err := os.Chmod(dst, perm); err != nil {
+		return fmt.Errorf("chmod %s: %w", dst, err)
+	}
+	return nil
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	// #nosec G304 -- src is resolved within a configured root.
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", src, err)
+	}
+	defer func() { _ = in.Close() }()
+
+	// #nosec G304 -- dst is resolved within a configured root.
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", dst, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("copy %s: %w", src, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("close %s: %w", dst, err)
+	}
+	if err := os.Chmod(dst, perm); err != nil {
+		return fmt.Errorf("chmod %s: %w", dst, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package files
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/api"
+)
+
+const headerETag = "ETag"
+
+// ComputeETag returns the weak entity tag of a descriptor, derived from the
+// modification time and size of the content it resolves to. The same value is
+// used for the download header, the listing attribute and conditional requests.
+// An empty string is returned when the modification time is unknown.
+func ComputeETag(desc Descriptor) string {
+	meta := desc.Metadata
+	if desc.Target != nil {
+		meta = *desc.Target
+	}
+	if meta.ModifiedAt == nil {
+		return ""
+	}
+
+	var size int64
+	if meta.SizeBytes != nil {
+		size = *meta.SizeBytes
+	}
+	return fmt.Sprintf(`W/"%x-%x"`, meta.ModifiedAt.UnixNano(), size)
+}
+
+// listingETag returns the weak entity tag of a folder listing, combining the
+// subtree fingerprint with the query and the media type that shape the
+// listing. Fingerprinting walks the whole subtree, so it is only done for
+// requests carrying If-None-Match. An empty string is returned for other
+// requests and when the subtree is too large to fingerprint.
+func (h Handler) listingETag(c echo.Context, desc Descriptor) string {
+	if c.Request().Header.Get("If-None-Match") == "" {
+		return ""
+	}
+	fingerprint, ok, err := h.svc.SubtreeFingerprint(c.Request().Context(), desc)
+	if err != nil || !ok {
+		return ""
+	}
+
+	mediaType := api.ContentType
+	if wantsNDJSON(c) {
+		mediaType = MIMENDJSON
+	}
+	representation := fnv.New64a()
+	_, _ = representation.Write([]byte(c.Request().URL.RawQuery + "\x00" + mediaType))
+	return fmt.Sprintf(`W/"%x-%x"`, fingerprint, representation.Sum64())
+}
+
+// etagMatches reports whether an If-None-Match header matches etag using the
+// weak comparison function of RFC 9110.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified reports whether the request's If-None-Match header matches etag.
+func notModified(r *http.Request, etag string) bool {
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	return ifNoneMatch != "" && etagMatches(ifNoneMatch, etag)
+}
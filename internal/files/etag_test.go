@@ -0,0 +1,40 @@
+package files
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeETag(t *testing.T) {
+	modified := time.Unix(1700000000, 5).UTC()
+	size := int64(42)
+
+	desc := Descriptor{Metadata: Metadata{ModifiedAt: &modified, SizeBytes: &size}}
+	assert.Equal(t, `W/"17979cfe362a0005-2a"`, ComputeETag(desc))
+
+	assert.Empty(t, ComputeETag(Descriptor{}), "unknown modification time yields no etag")
+}
+
+func TestETagMatches(t *testing.T) {
+	const etag = `W/"abc-1"`
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        bool
+	}{
+		{"exact weak", `W/"abc-1"`, true},
+		{"strong form matches weakly", `"abc-1"`, true},
+		{"list", `"other", W/"abc-1"`, true},
+		{"wildcard", "*", true},
+		{"different", `W/"abc-2"`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, etagMatches(tt.ifNoneMatch, etag))
+		})
+	}
+}
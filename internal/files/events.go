@@ -0,0 +1,124 @@
+package files
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/watch"
+)
+
+const (
+	// eventBuffer bounds the events waiting for a slow client. A client
+	// falling further behind is disconnected; it reconnects and reloads the
+	// listing rather than missing changes silently.
+	eventBuffer = 256
+	// eventHeartbeat keeps idle streams from being closed by proxies.
+	eventHeartbeat = 30 * time.Second
+)
+
+// streamEvents answers GET /api/v1/events?path=<folder>&recursive=true with a
+// Server-Sent Events stream of the entries created, modified and deleted in
+// the folder, or below it with recursive. Each event is named after its type
+// and carries the JSON of a watch.Event.
+func (h Handler) streamEvents(c echo.Context) error {
+	folder := c.QueryParam("path")
+	if !strings.HasPrefix(folder, "/") {
+		return echo.NewHTTPError(http.StatusBadRequest, "events require an absolute path")
+	}
+	recursive, err := parseRecursive(c)
+	if err != nil {
+		return err
+	}
+	root, rel, ok := matchRoot(path.Clean(folder), h.svc.Roots())
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "file root not found")
+	}
+	if err := authorize(c, root, ScopeRead); err != nil {
+		return err
+	}
+	rel, err = h.resolvePath(c, root, rel)
+	if err != nil {
+		return err
+	}
+	desc, err := h.svc.Describe(c.Request().Context(), root.Virtual, rel)
+	if err != nil {
+		return toHTTPError(err)
+	}
+	if desc.TargetKind != kindFolder {
+		return echo.NewHTTPError(http.StatusBadRequest, "events require a folder")
+	}
+	folder = joinVirtual(root.Virtual, rel)
+	c.Set(ctxKeyRoot, root.Virtual)
+	c.Set(ctxKeyPath, folder)
+
+	events := make(chan watch.Event, eventBuffer)
+	overflow := make(chan struct{})
+	var once sync.Once
+	unsubscribe := h.opts.Events.Subscribe(func(ev watch.Event) {
+		entryRel := strings.TrimPrefix(strings.TrimPrefix(ev.Path, root.Virtual), "/")
+		if !inFolder(folder, ev.Path, recursive) || h.svc.checkIgnored(root, entryRel) != nil {
+			return
+		}
+		select {
+		case events <- ev:
+		default:
+			once.Do(func() { close(overflow) })
+		}
+	})
+	defer unsubscribe()
+
+	return writeEvents(c, events, overflow)
+}
+
+// writeEvents streams events until the client goes away or overflow is
+// closed.
+func writeEvents(c echo.Context, events <-chan watch.Event, overflow <-chan struct{}) error {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	// Keeps nginx from buffering the stream.
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	ctx := c.Request().Context()
+	for {
+		var msg string
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-overflow:
+			return nil
+		case <-heartbeat.C:
+			msg = ": keep-alive\n\n"
+		case ev := <-events:
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return fmt.Errorf("encode event: %w", err)
+			}
+			msg = fmt.Sprintf("event: %s\ndata: %s\n\n", ev.Type, data)
+		}
+		if _, err := res.Write([]byte(msg)); err != nil {
+			return fmt.Errorf("write event stream: %w", err)
+		}
+		res.Flush()
+	}
+}
+
+// inFolder reports whether the virtual path p is an entry of folder, or
+// lies anywhere below it with recursive.
+func inFolder(folder, p string, recursive bool) bool {
+	if !recursive {
+		return path.Dir(p) == folder
+	}
+	return folder == "/" || strings.HasPrefix(p, folder+"/")
+}
@@ -0,0 +1,100 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// attributeNames lists the attributes selectable with fields[files].
+var attributeNames = map[string]bool{
+	"name": true, "resource_kind": true, "size_bytes": true, "permission_mode": true,
+	"user": true, "group": true, "user_id": true, "group_id": true, "mime_type": true,
+	"accessed_at": true, "modified_at": true, "changed_at": true, "born_at": true,
+	"etag": true, "mount_path": true, "link_target": true, "file_id": true, "acl": true, "target": true,
+}
+
+// nameOnlyFields are the attributes available from directory entries alone.
+var nameOnlyFields = map[string]bool{"name": true, "resource_kind": true}
+
+// parseFields parses the JSON:API sparse fieldset fields[files].
+func parseFields(c echo.Context, params *ListParams) error {
+	raw := c.QueryParam("fields[files]")
+	if raw == "" {
+		return nil
+	}
+
+	fields := make(map[string]bool)
+	for _, field := range strings.Split(raw, ",") {
+		if !attributeNames[field] {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid fields[files]: %s", field))
+		}
+		fields[field] = true
+	}
+	params.Fields = fields
+	return nil
+}
+
+// namesOnly reports whether the listing needs nothing beyond names and kinds,
+// so entries can be listed without describing each of them.
+func (p ListParams) namesOnly() bool {
+	if len(p.Fields) == 0 || p.ModeFilter != nil || p.ResolveLinks || !nameOnlyFields[p.SortField] {
+		return false
+	}
+	if p.Filter != nil && p.Filter.needsMetadata() {
+		return false
+	}
+	for field := range p.Fields {
+		if !nameOnlyFields[field] {
+			return false
+		}
+	}
+	return true
+}
+
+// sparseAttributes drops the attributes of an encoded object not in fields.
+func sparseAttributes(data []byte, fields map[string]bool) ([]byte, error) {
+	var attrs map[string]json.RawMessage
+	if err := json.Unmarshal(data, &attrs); err != nil {
+		return nil, fmt.Errorf("decode attributes: %w", err)
+	}
+	for name := range attrs {
+		if !fields[name] {
+			delete(attrs, name)
+		}
+	}
+	sparse, err := json.Marshal(attrs)
+	if err != nil {
+		return nil, fmt.Errorf("encode attributes: %w", err)
+	}
+	return sparse, nil
+}
+
+type ownerNamesKey struct{}
+
+// contextWithoutOwnerNames marks describes within ctx to skip the account
+// lookups of user and group names, which can be slow with remote user
+// databases.
+func contextWithoutOwnerNames(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ownerNamesKey{}, false)
+}
+
+// ownerNamesWanted reports whether describes within ctx look up user and
+// group names.
+func ownerNamesWanted(ctx context.Context) bool {
+	wanted, ok := ctx.Value(ownerNamesKey{}).(bool)
+	return !ok || wanted
+}
+
+// needsOwnerNames reports whether the listing renders or sorts by user or
+// group names.
+func (p ListParams) needsOwnerNames() bool {
+	if len(p.Fields) == 0 || p.SortField == "user" || p.SortField == "group" {
+		return true
+	}
+	return p.Fields["user"] || p.Fields["group"] || p.Fields["target"]
+}
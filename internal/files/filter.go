@@ -0,0 +1,207 @@
+package files
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Permission mode match semantics for filter[mode].
+const (
+	modeMatchExact = "exact" // mode equals the mask
+	modeMatchAny   = "any"   // mode has at least one bit of the mask
+	modeMatchAll   = "all"   // mode has every bit of the mask
+)
+
+// ModeFilter selects entries by permission mode.
+type ModeFilter struct {
+	Mask  uint32
+	Match string
+}
+
+// matches reports whether an octal permission mode string satisfies the filter.
+func (f ModeFilter) matches(permissionMode string) bool {
+	mode, err := strconv.ParseUint(permissionMode, 8, 32)
+	if err != nil {
+		return false
+	}
+
+	switch bits := uint32(mode); f.Match {
+	case modeMatchAny:
+		return bits&f.Mask != 0
+	case modeMatchAll:
+		return bits&f.Mask == f.Mask
+	default:
+		return bits == f.Mask
+	}
+}
+
+// query renders the filter as query parameters for pagination links.
+func (f ModeFilter) query() string {
+	return fmt.Sprintf("&filter[mode]=%04o&mode_match=%s", f.Mask, f.Match)
+}
+
+func parseModeFilter(c echo.Context, params *ListParams) error {
+	raw := c.QueryParam("filter[mode]")
+	match := c.QueryParam("mode_match")
+	if raw == "" {
+		if match != "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "mode_match requires filter[mode]")
+		}
+		return nil
+	}
+
+	mask, err := strconv.ParseUint(raw, 8, 32)
+	if err != nil || mask > 0o7777 {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid filter[mode]: %s", raw))
+	}
+
+	switch match {
+	case "":
+		match = modeMatchExact
+	case modeMatchExact, modeMatchAny, modeMatchAll:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid mode_match: %s", match))
+	}
+
+	params.ModeFilter = &ModeFilter{Mask: uint32(mask), Match: match}
+	return nil
+}
+
+// resourceKinds are the values filter[resource_kind] accepts.
+var resourceKinds = map[string]bool{
+	kindFile: true, kindFolder: true, kindSymlink: true, kindFIFO: true, kindSocket: true, kindDevice: true,
+}
+
+// EntryFilter selects entries by the filter[...] attribute parameters. Empty
+// fields do not restrict the entries.
+type EntryFilter struct {
+	ResourceKind string
+	// MimeType is a MIME type without parameters, or a type with a wildcard
+	// subtype like image/*.
+	MimeType string
+	// Name is a path.Match glob matched against entry names.
+	Name          string
+	MinSize       *int64
+	ModifiedAfter *time.Time
+}
+
+// matches reports whether the metadata of an entry satisfies the filter.
+func (f EntryFilter) matches(meta Metadata) bool {
+	if f.ResourceKind != "" && meta.ResourceKind != f.ResourceKind {
+		return false
+	}
+	if f.Name != "" {
+		if matched, err := path.Match(f.Name, meta.Name); err != nil || !matched {
+			return false
+		}
+	}
+	if f.MimeType != "" && !mimeTypeMatches(f.MimeType, meta.MimeType) {
+		return false
+	}
+	if f.MinSize != nil && (meta.SizeBytes == nil || *meta.SizeBytes < *f.MinSize) {
+		return false
+	}
+	if f.ModifiedAfter != nil && (meta.ModifiedAt == nil || !meta.ModifiedAt.After(*f.ModifiedAfter)) {
+		return false
+	}
+	return true
+}
+
+// needsMetadata reports whether the filter looks at more than names and kinds.
+func (f EntryFilter) needsMetadata() bool {
+	return f.MimeType != "" || f.MinSize != nil || f.ModifiedAfter != nil
+}
+
+// query renders the filter as query parameters for pagination links.
+func (f EntryFilter) query() string {
+	var query string
+	if f.ResourceKind != "" {
+		query += "&filter[resource_kind]=" + f.ResourceKind
+	}
+	if f.MimeType != "" {
+		query += "&filter[mime_type]=" + url.QueryEscape(f.MimeType)
+	}
+	if f.Name != "" {
+		query += "&filter[name]=" + url.QueryEscape(f.Name)
+	}
+	if f.MinSize != nil {
+		query += fmt.Sprintf("&filter[min_size]=%d", *f.MinSize)
+	}
+	if f.ModifiedAfter != nil {
+		query += "&filter[modified_after]=" + url.QueryEscape(f.ModifiedAfter.Format(time.RFC3339Nano))
+	}
+	return query
+}
+
+// mimeTypeMatches reports whether mimeType, possibly with parameters like
+// a charset, is pattern or falls under a pattern like image/*.
+func mimeTypeMatches(pattern, mimeType string) bool {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	mimeType = strings.TrimSpace(mimeType)
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(strings.ToLower(mimeType), strings.ToLower(prefix)+"/")
+	}
+	return strings.EqualFold(mimeType, pattern)
+}
+
+func parseEntryFilter(c echo.Context, params *ListParams) error {
+	f := EntryFilter{
+		ResourceKind: c.QueryParam("filter[resource_kind]"),
+		MimeType:     c.QueryParam("filter[mime_type]"),
+		Name:         c.QueryParam("filter[name]"),
+	}
+	if f.ResourceKind != "" && !resourceKinds[f.ResourceKind] {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid filter[resource_kind]: %s", f.ResourceKind))
+	}
+	if typ, subtype, ok := strings.Cut(f.MimeType, "/"); f.MimeType != "" && (!ok || typ == "" || subtype == "") {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid filter[mime_type]: %s", f.MimeType))
+	}
+	if _, err := path.Match(f.Name, ""); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid filter[name]: %s", f.Name))
+	}
+	if raw := c.QueryParam("filter[min_size]"); raw != "" {
+		size, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || size < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid filter[min_size]: %s", raw))
+		}
+		f.MinSize = &size
+	}
+	if raw := c.QueryParam("filter[modified_after]"); raw != "" {
+		after, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid filter[modified_after]: %s", raw))
+		}
+		f.ModifiedAfter = &after
+	}
+
+	if f != (EntryFilter{}) {
+		params.Filter = &f
+	}
+	return nil
+}
+
+// filterDescriptors returns the entries matching the filters of params.
+func filterDescriptors(entries []Descriptor, params ListParams) []Descriptor {
+	if params.ModeFilter == nil && params.Filter == nil {
+		return entries
+	}
+
+	filtered := make([]Descriptor, 0, len(entries))
+	for _, entry := range entries {
+		if params.ModeFilter != nil && !params.ModeFilter.matches(entry.Metadata.PermissionMode) {
+			continue
+		}
+		if params.Filter != nil && !params.Filter.matches(entry.Metadata) {
+			continue
+		}
+		filtered = append(filtered, entry)
+	}
+	return filtered
+}
@@ -0,0 +1,137 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/api"
+)
+
+// maxFingerprintEntries bounds the number of entries hashed for a subtree
+// fingerprint. Larger subtrees get no fingerprint, so a conditional listing
+// never costs more than walking this many entries.
+const maxFingerprintEntries = 10000
+
+// errFingerprintLimit stops the walk once maxFingerprintEntries is exceeded.
+var errFingerprintLimit = errors.New("subtree exceeds fingerprint limit")
+
+// SubtreeFingerprint hashes the path, kind, permissions, size and
+// modification time of every entry below the folder desc resolves to, so any
+// change in the subtree yields a different value. Entries hidden from
+// listings are left out, and symlinks are hashed as links and not followed.
+// ok is false when the subtree has more than maxFingerprintEntries entries.
+// With the listing cache, fingerprints are reused like listings.
+func (s *Service) SubtreeFingerprint(ctx context.Context, desc Descriptor) (fingerprint uint64, ok bool, err error) {
+	modTime := folderModTime(desc)
+	if fingerprint, ok, found := s.listings.getFingerprint(desc.VirtualPath, modTime); found {
+		return fingerprint, ok, nil
+	}
+	fingerprint, ok, err = s.subtreeFingerprint(ctx, desc)
+	if err != nil {
+		return 0, false, err
+	}
+	s.listings.putFingerprint(desc.VirtualPath, modTime, fingerprint, ok)
+	return fingerprint, ok, nil
+}
+
+func (s *Service) subtreeFingerprint(ctx context.Context, desc Descriptor) (uint64, bool, error) {
+	h := fnv.New64a()
+	if desc.RelPath == "" && desc.Root.Manifest != "" {
+		// Root listings of manifest roots change with the manifest.
+		info, err := os.Stat(desc.Root.Manifest)
+		if err != nil {
+			return 0, false, fmt.Errorf("stat manifest: %w", err)
+		}
+		writeFingerprintEntry(h, "", info)
+	}
+	info, err := os.Stat(desc.AbsolutePath)
+	if err != nil {
+		return 0, false, fmt.Errorf("fingerprint %s: %w", desc.VirtualPath, err)
+	}
+	writeFingerprintEntry(h, ".", info)
+
+	entries := 0
+	walker := treeWalker{
+		svc:  s,
+		root: desc.Root,
+		visit: func(rel, _ string, info fs.FileInfo, _ int) (bool, error) {
+			entries++
+			if entries > maxFingerprintEntries {
+				return false, errFingerprintLimit
+			}
+			writeFingerprintEntry(h, strings.TrimPrefix(rel, desc.RelPath+"/"), info)
+			return true, nil
+		},
+	}
+	err = walker.walk(ctx, desc.RelPath, desc.AbsolutePath)
+	if errors.Is(err, errFingerprintLimit) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("fingerprint %s: %w", desc.VirtualPath, err)
+	}
+
+	return h.Sum64(), true, nil
+}
+
+func writeFingerprintEntry(w io.Writer, rel string, info fs.FileInfo) {
+	record := rel + "\x00" + strconv.FormatUint(uint64(info.Mode()), 16) +
+		"\x00" + strconv.FormatInt(info.Size(), 16) +
+		"\x00" + strconv.FormatInt(info.ModTime().UnixNano(), 16) + "\n"
+	_, _ = w.Write([]byte(record))
+}
+
+// FingerprintResponse is the JSON:API document of a subtree fingerprint.
+type FingerprintResponse struct {
+	Data FingerprintResource `json:"data"`
+}
+
+// FingerprintResource represents the fingerprint of a folder's subtree.
+type FingerprintResource struct {
+	ID         string                `json:"id"`
+	Type       string                `json:"type"`
+	Attributes FingerprintAttributes `json:"attributes"`
+}
+
+// FingerprintAttributes holds the subtree hash.
+type FingerprintAttributes struct {
+	Fingerprint string `json:"fingerprint"`
+}
+
+// sendFingerprint answers ?fingerprint=1 on a folder with the hash of its
+// subtree instead of a listing, so sync clients can cheaply detect changes.
+func (h Handler) sendFingerprint(c echo.Context, desc Descriptor) error {
+	if desc.TargetKind != kindFolder {
+		return echo.NewHTTPError(http.StatusBadRequest, "fingerprint requires a folder")
+	}
+
+	fingerprint, ok, err := h.svc.SubtreeFingerprint(c.Request().Context(), desc)
+	if err != nil {
+		return toHTTPError(err)
+	}
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity,
+			fmt.Sprintf("folder has more than %d entries to fingerprint", maxFingerprintEntries))
+	}
+
+	resp := FingerprintResponse{Data: FingerprintResource{
+		ID:         desc.VirtualPath,
+		Type:       "fingerprints",
+		Attributes: FingerprintAttributes{Fingerprint: fmt.Sprintf("%016x", fingerprint)},
+	}}
+	c.Response().Header().Set(echo.HeaderContentType, api.ContentType)
+	if err := c.JSON(http.StatusOK, resp); err != nil {
+		return fmt.Errorf("write fingerprint response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package files
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// gitignoreFile holds the ignore rules of a folder and its descendants.
+const gitignoreFile = ".gitignore"
+
+// ignoreRule is a single .gitignore pattern. The matcher is deliberately
+// minimal: it supports comments, "!" negation, a trailing "/" for folders,
+// anchoring with "/", a leading "**/" and the wildcards of path.Match.
+type ignoreRule struct {
+	base     string // folder of the .gitignore, relative to the root
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreRules are evaluated in order; the last matching rule wins.
+type ignoreRules []ignoreRule
+
+func parseGitignore(base string, data []byte) ignoreRules {
+	var rules ignoreRules
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r ")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		line = strings.TrimPrefix(line, "**/")
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// ignored reports whether the rules hide rel, a path relative to the root.
+func (r ignoreRules) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range r {
+		if rule.matches(rel, isDir) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+func (rule ignoreRule) matches(rel string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	target := rel
+	if rule.base != "" {
+		if !strings.HasPrefix(rel, rule.base+"/") {
+			return false
+		}
+		target = strings.TrimPrefix(rel, rule.base+"/")
+	}
+	if !rule.anchored {
+		target = path.Base(target)
+	}
+	ok, err := path.Match(rule.pattern, target)
+	return err == nil && ok
+}
+
+// ignoreRulesFor collects the rules of every .gitignore from the root down to
+// dirRel and reports whether dirRel or one of its parents is ignored itself.
+func ignoreRulesFor(root Root, dirRel string) (ignoreRules, bool) {
+	rules := readGitignore(root, "")
+	if dirRel == "" {
+		return rules, false
+	}
+	current := ""
+	for _, segment := range strings.Split(dirRel, "/") {
+		current = path.Join(current, segment)
+		if rules.ignored(current, true) {
+			return rules, true
+		}
+		rules = append(rules, readGitignore(root, current)...)
+	}
+	return rules, false
+}
+
+// readGitignore parses the .gitignore of a folder; a missing or unreadable
+// file contributes no rules.
+func readGitignore(root Root, dirRel string) ignoreRules {
+	// #nosec G304 -- the path is built from a configured root and a cleaned relative path.
+	data, err := os.ReadFile(filepath.Join(root.Source, filepath.FromSlash(dirRel), gitignoreFile))
+	if err != nil {
+		return nil
+	}
+	return parseGitignore(dirRel, data)
+}
+
+// listingIgnores returns the rules filtering the entries of folder rel: the
+// hidden entries of the root and, with gitignore support, the gitignore rules.
+func (s *Service) listingIgnores(root Root, rel string) ignoreRules {
+	hidden := hiddenRules(root)
+	if !s.opts.RespectGitignore {
+		return hidden
+	}
+	rules, _ := ignoreRulesFor(root, rel)
+	// The last matching rule wins, so negations in .gitignore files cannot
+	// reveal hidden entries.
+	return append(rules, hidden...)
+}
+
+// checkIgnored reports a not-found error for paths hidden by the root or by
+// gitignore rules.
+func (s *Service) checkIgnored(root Root, rel string) error {
+	if isHidden(root, rel) {
+		return fmt.Errorf("stat %s: %w", joinVirtual(root.Virtual, rel), fs.ErrNotExist)
+	}
+	if !s.opts.RespectGitignore || rel == "" {
+		return nil
+	}
+	parent := path.Dir(rel)
+	if parent == "." {
+		parent = ""
+	}
+	rules, ignored := ignoreRulesFor(root, parent)
+	if !ignored {
+		info, err := os.Lstat(filepath.Join(root.Source, filepath.FromSlash(rel)))
+		ignored = rules.ignored(rel, err == nil && info.IsDir())
+	}
+	if ignored {
+		return fmt.Errorf("stat %s: %w", joinVirtual(root.Virtual, rel), fs.ErrNotExist)
+	}
+	return nil
+}
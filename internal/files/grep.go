@@ -0,0 +1,308 @@
+package files
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/api"
+)
+
+const (
+	// grepSegment is the path suffix that turns a request into a content
+	// search of the file or the files below the folder, e.g.
+	// /api/v1/files/public/-/grep?query=TODO.
+	grepSegment = "-/grep"
+	// maxGrepQueryBytes bounds the length of a query or regular expression.
+	maxGrepQueryBytes = 1024
+	// maxGrepMatches bounds the matching lines of one content search.
+	maxGrepMatches = 1000
+	// maxGrepFileSize is the largest file a content search reads; larger
+	// files are skipped.
+	maxGrepFileSize = 16 << 20
+	// maxGrepLineBytes is the longest line a content search reads; the rest
+	// of a file with a longer line is skipped.
+	maxGrepLineBytes = 1 << 20
+	// grepSnippetBytes bounds the snippet returned for a matching line.
+	grepSnippetBytes = 200
+)
+
+// errGrepLimit stops a content search once maxGrepMatches lines matched.
+var errGrepLimit = errors.New("content search exceeds match limit")
+
+// GrepOptions selects what a content search looks for.
+type GrepOptions struct {
+	// Pattern is matched against every line of the searched files.
+	Pattern *regexp.Regexp
+	// Name optionally restricts the search to files whose names match this
+	// path.Match glob.
+	Name string
+}
+
+// GrepMatch is a matching line of a file.
+type GrepMatch struct {
+	Line    int    `json:"line"`
+	Snippet string `json:"snippet"`
+}
+
+// GrepStats summarizes a content search.
+type GrepStats struct {
+	ScannedCount int `json:"scanned_count"`
+	// SkippedCount counts the files left out as binary, too large or
+	// unreadable.
+	SkippedCount int  `json:"skipped_count"`
+	FileCount    int  `json:"file_count"`
+	MatchCount   int  `json:"match_count"`
+	Truncated    bool `json:"truncated"`
+}
+
+// Grep searches the text file desc resolves to, or the text files below the
+// folder down to maxSearchDepth levels, for lines matching opts.Pattern. It
+// calls emit with the virtual path and matches of every file that has any,
+// as soon as the file is read. Binary files are detected by their MIME type
+// and skipped like files above maxGrepFileSize; symlinks are not followed
+// below a folder, and entries hidden by respected gitignore rules are left
+// out. After maxGrepMatches matching lines the search stops and reports
+// itself truncated. It stops with an error once ctx is canceled.
+func (s *Service) Grep(ctx context.Context, desc Descriptor, opts GrepOptions,
+	emit func(virtualPath string, matches []GrepMatch) error) (GrepStats, error) {
+	g := grepRun{svc: s, opts: opts, emit: emit}
+	var err error
+	if desc.TargetKind == kindFolder {
+		walker := treeWalker{
+			svc:  s,
+			root: desc.Root,
+			visit: func(rel, absPath string, info fs.FileInfo, depth int) (bool, error) {
+				if info.Mode().IsRegular() {
+					return false, g.file(ctx, joinVirtual(desc.Root.Virtual, rel), absPath, info)
+				}
+				return depth < maxSearchDepth, nil
+			},
+			unreadable: func(string) { g.stats.SkippedCount++ },
+		}
+		err = walker.walk(ctx, desc.RelPath, desc.AbsolutePath)
+	} else {
+		var info fs.FileInfo
+		if info, err = os.Stat(desc.AbsolutePath); err == nil {
+			err = g.file(ctx, desc.VirtualPath, desc.AbsolutePath, info)
+		}
+	}
+	if errors.Is(err, errGrepLimit) {
+		g.stats.Truncated = true
+		return g.stats, nil
+	}
+	if err != nil {
+		return g.stats, fmt.Errorf("content search: %w", err)
+	}
+	return g.stats, nil
+}
+
+// grepRun carries the state of one Grep call.
+type grepRun struct {
+	svc   *Service
+	opts  GrepOptions
+	emit  func(virtualPath string, matches []GrepMatch) error
+	stats GrepStats
+}
+
+// file searches one regular file and emits its matches.
+func (g *grepRun) file(ctx context.Context, virtualPath, absPath string, info fs.FileInfo) error {
+	if g.opts.Name != "" {
+		if matched, err := path.Match(g.opts.Name, info.Name()); err != nil || !matched {
+			return nil
+		}
+	}
+	if info.Size() > maxGrepFileSize {
+		g.stats.SkippedCount++
+		return nil
+	}
+
+	matches, limited, err := g.scan(ctx, absPath)
+	if errors.Is(err, fs.ErrPermission) || errors.Is(err, fs.ErrNotExist) {
+		g.stats.SkippedCount++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(matches) > 0 {
+		g.stats.FileCount++
+		g.stats.MatchCount += len(matches)
+		if err := g.emit(virtualPath, matches); err != nil {
+			return err
+		}
+	}
+	if limited {
+		return errGrepLimit
+	}
+	return nil
+}
+
+// scan returns the matching lines of the file at absPath and whether the
+// match limit was reached. Binary files and files with overlong lines yield
+// no further matches and count as skipped.
+func (g *grepRun) scan(ctx context.Context, absPath string) ([]GrepMatch, bool, error) {
+	release, err := g.svc.openFiles.acquire(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer release()
+
+	// #nosec G304 -- the path is resolved within a configured root.
+	f, err := os.Open(absPath)
+	if err != nil {
+		return nil, false, fmt.Errorf("open %s: %w", absPath, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	sample := make([]byte, g.svc.opts.SniffBytes)
+	n, err := io.ReadFull(f, sample)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, false, fmt.Errorf("read %s: %w", absPath, err)
+	}
+	if !strings.HasPrefix(detectContentType(sample[:n]), "text/") {
+		g.stats.SkippedCount++
+		return nil, false, nil
+	}
+	g.stats.ScannedCount++
+
+	scanner := bufio.NewScanner(io.MultiReader(bytes.NewReader(sample[:n]), f))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxGrepLineBytes)
+	var matches []GrepMatch
+	for line := 1; scanner.Scan(); line++ {
+		if err := ctx.Err(); err != nil {
+			return nil, false, fmt.Errorf("context canceled: %w", err)
+		}
+		loc := g.opts.Pattern.FindIndex(scanner.Bytes())
+		if loc == nil {
+			continue
+		}
+		matches = append(matches, GrepMatch{Line: line, Snippet: grepSnippet(scanner.Bytes(), loc[0])})
+		if g.stats.MatchCount+len(matches) == maxGrepMatches {
+			return matches, true, nil
+		}
+	}
+	if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		g.stats.SkippedCount++
+		return matches, false, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, false, fmt.Errorf("read %s: %w", absPath, err)
+	}
+	return matches, false, nil
+}
+
+// grepSnippet returns line, or for long lines the grepSnippetBytes around
+// the match starting at offset, without partial UTF-8 sequences.
+func grepSnippet(line []byte, offset int) string {
+	line = bytes.TrimRight(line, "\r")
+	if len(line) > grepSnippetBytes {
+		start := max(0, min(offset-grepSnippetBytes/4, len(line)-grepSnippetBytes))
+		line = line[start : start+grepSnippetBytes]
+	}
+	return strings.ToValidUTF8(string(line), "")
+}
+
+// GrepResource represents the matching lines of one file.
+type GrepResource struct {
+	ID         string         `json:"id"`
+	Type       string         `json:"type"`
+	Attributes GrepAttributes `json:"attributes"`
+}
+
+// GrepAttributes holds the matching lines of a file in line order.
+type GrepAttributes struct {
+	Matches []GrepMatch `json:"matches"`
+}
+
+// serveGrep answers GET <path>/-/grep?query=<text> by streaming a JSON:API
+// collection with a resource per matching file, followed by meta with the
+// search statistics. Errors after the first byte can no longer change the
+// status; they abort the response, leaving a truncated document.
+func (h Handler) serveGrep(c echo.Context, root Root, rel string) error {
+	opts, err := parseGrepOptions(c)
+	if err != nil {
+		return err
+	}
+	ctx := c.Request().Context()
+	desc, err := h.svc.Describe(ctx, root.Virtual, rel)
+	if err != nil {
+		return toHTTPError(err)
+	}
+	if desc.TargetKind != kindFolder && desc.TargetKind != kindFile {
+		return echo.NewHTTPError(http.StatusBadRequest, "content search requires a file or folder")
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, api.ContentType)
+	c.Response().WriteHeader(http.StatusOK)
+	w := bufio.NewWriter(c.Response())
+	cw := collectionWriter{w: w}
+	cw.raw(`{"data":[`)
+	first := true
+	stats, err := h.svc.Grep(ctx, desc, opts, func(virtualPath string, matches []GrepMatch) error {
+		if !first {
+			cw.raw(",")
+		}
+		first = false
+		cw.value(GrepResource{ID: virtualPath, Type: "content_matches", Attributes: GrepAttributes{Matches: matches}})
+		if cw.err == nil {
+			cw.err = w.Flush()
+			c.Response().Flush()
+		}
+		return cw.err
+	})
+	if err != nil {
+		return fmt.Errorf("write content search response: %w", err)
+	}
+	cw.raw(`],"meta":`)
+	cw.value(stats)
+	cw.raw("}\n")
+	if cw.err == nil {
+		cw.err = w.Flush()
+	}
+	if cw.err != nil {
+		return fmt.Errorf("write content search response: %w", cw.err)
+	}
+	return nil
+}
+
+func parseGrepOptions(c echo.Context) (GrepOptions, error) {
+	query := c.QueryParam("query")
+	if query == "" {
+		return GrepOptions{}, echo.NewHTTPError(http.StatusBadRequest, "content search requires query")
+	}
+	if len(query) > maxGrepQueryBytes {
+		return GrepOptions{}, echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("query exceeds %d bytes", maxGrepQueryBytes))
+	}
+
+	switch c.QueryParam("regex") {
+	case "", "false":
+		query = regexp.QuoteMeta(query)
+	case "true":
+	default:
+		return GrepOptions{}, echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("invalid regex: %s", c.QueryParam("regex")))
+	}
+	pattern, err := regexp.Compile(query)
+	if err != nil {
+		return GrepOptions{}, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid query: %v", err))
+	}
+
+	opts := GrepOptions{Pattern: pattern, Name: c.QueryParam("name")}
+	if _, err := path.Match(opts.Name, ""); err != nil {
+		return GrepOptions{}, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid name pattern: %s", opts.Name))
+	}
+	return opts, nil
+}
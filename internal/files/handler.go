@@ -2,13 +2,16 @@ package files
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
+	"maps"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -16,8 +19,11 @@ import (
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"golang.org/x/text/language"
 
 	"github.com/thorstenkramm/dendrite-pulse/internal/api"
+	"github.com/thorstenkramm/dendrite-pulse/internal/audit"
+	"github.com/thorstenkramm/dendrite-pulse/internal/watch"
 )
 
 const (
@@ -25,43 +31,166 @@ const (
 	maxLimit     = 500
 )
 
+// HandlerOptions configures the HTTP behavior of the file routes.
+type HandlerOptions struct {
+	// CanonicalRedirect answers requests whose path casing differs from the
+	// on-disk names with a 308 redirect to the canonical path.
+	CanonicalRedirect bool
+	// StrictPaths rejects backslashes and path segments that contain
+	// separators once decoded (e.g. %2F, %5C).
+	StrictPaths bool
+	// GeneratedAt adds the server time of each response as meta.generated_at.
+	GeneratedAt bool
+	// RejectEmptyRanges answers Range requests for empty files with 416
+	// instead of serving the empty body with 200.
+	RejectEmptyRanges bool
+	// SizeAsString renders size_bytes as a JSON string so clients parsing
+	// numbers as float64 keep full precision above 2^53.
+	SizeAsString bool
+	// RejectDuplicateParams answers requests repeating a recognized query
+	// parameter with 400 instead of silently using the first value.
+	RejectDuplicateParams bool
+	// ServerTiming adds a Server-Timing header to listings, breaking down the
+	// time spent reading directories, describing entries and serializing.
+	ServerTiming bool
+	// CaseInsensitive matches request path segments naming no entry against
+	// the on-disk names ignoring case and reports the on-disk casing.
+	CaseInsensitive bool
+	// SigningSecret enables time-limited signed download URLs, created with
+	// POST ?sign=1&ttl=... and validated on GET. Empty disables signing.
+	SigningSecret string
+	// SigningMaxTTL bounds the ttl of signed URLs. Defaults to
+	// DefaultSigningMaxTTL when zero.
+	SigningMaxTTL time.Duration
+	// SiblingExtensions lists, in order of preference, the extensions tried
+	// for extensionless paths that do not exist, e.g. page -> page.html.
+	// ?accept=<ext> picks one explicitly. Empty disables sibling resolution.
+	SiblingExtensions []string
+	// AnonymousWrites lets unauthenticated clients change entries. Without
+	// it, PATCH requests without an authenticated identity are answered with
+	// 403, so servers without authentication only serve reads.
+	AnonymousWrites bool
+	// RespectLocks answers downloads of files another process holds an
+	// exclusive flock on with 503, so partially written files are not served.
+	RespectLocks bool
+	// StreamListings encodes listing resources one at a time straight to the
+	// response instead of building the whole document in memory first.
+	StreamListings bool
+	// Debug enables diagnostics requested per call, such as the heap
+	// allocations of a listing with ?debug=mem.
+	Debug bool
+	// Collation orders names when sorting listings by name and the request
+	// omits ?collation=: binary, natural or locale. Empty means binary.
+	Collation string
+	// CollationLocale is the locale of locale collation; the root
+	// locale (language.Und) applies the Unicode default order.
+	CollationLocale language.Tag
+	// ListingMimeDetection derives the MIME types of listing entries when
+	// the request omits ?mime_detection=: content sniffs the leading bytes of
+	// every file, extension looks up file name extensions. Empty means
+	// content.
+	ListingMimeDetection string
+	// Audit records every attempted change of an entry. Nil disables it.
+	Audit *audit.Log
+	// Events serves the changes of folders as Server-Sent Events at
+	// /api/v1/events. Nil disables the route.
+	Events *watch.Watcher
+}
+
 // RegisterRoutes wires file handlers.
-func RegisterRoutes(e *echo.Echo, svc *Service) {
-	h := Handler{svc: svc}
+func RegisterRoutes(e *echo.Echo, svc *Service, opts HandlerOptions) {
+	h := Handler{svc: svc, opts: opts}
 
 	files := e.Group("/api/v1/files")
+	if opts.RejectDuplicateParams {
+		files.Use(rejectDuplicateParams)
+	}
+	if opts.Debug {
+		files.Use(collectMemStats)
+	}
+	if opts.ServerTiming {
+		files.Use(collectServerTiming)
+	}
 	files.GET("", h.listRoots)
 	files.GET("/*", h.getResource)
+	files.HEAD("", h.listRoots, headOnly)
+	files.HEAD("/*", h.getResource, headOnly)
+	files.POST("/*", h.signResource)
+	files.PATCH("/*", h.patchResource)
+	// The colon is escaped; unescaped it would start a path parameter.
+	files.POST("\\:archive", h.archiveResources)
+
+	if opts.Events != nil {
+		e.GET("/api/v1/events", h.streamEvents)
+	}
+}
+
+// queryParams lists the query parameters recognized by the file routes.
+var queryParams = []string{
+	"page[limit]", "page[offset]", "sort", "filter[mode]", "mode_match",
+	"resolve_links", "download", "metadata", "follow", "fields[files]",
+	"sign", "ttl", paramExpires, paramSignature, "include_self",
+	"fingerprint", "accept", "debug", "archive", "checksum", "depth",
+	"usage", "name", "recursive", "query", "regex", "filter[resource_kind]",
+	"filter[mime_type]", "filter[name]", "filter[min_size]", "filter[modified_after]", "collation",
+	"mime_detection", "w", "h",
+}
+
+// rejectDuplicateParams fails requests that repeat a recognized query parameter.
+func rejectDuplicateParams(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		query := c.QueryParams()
+		for _, name := range queryParams {
+			if len(query[name]) > 1 {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("duplicate query parameter: %s", name))
+			}
+		}
+		return next(c)
+	}
 }
 
 // Handler serves file and directory requests.
 type Handler struct {
-	svc *Service
+	svc  *Service
+	opts HandlerOptions
 }
 
 func (h Handler) listRoots(c echo.Context) error {
-	params, err := parseListParams(c)
-	if err != nil {
-		return err
-	}
-
 	ctx := c.Request().Context()
 
 	// Special case: if there's a single root with virtual "/", list its contents directly
 	if h.svc.HasSingleRootSlash() {
+		if err := authorize(c, h.svc.Roots()[0], ScopeRead); err != nil {
+			return err
+		}
+		params, err := h.parseListParams(c, h.svc.Roots()[0])
+		if err != nil {
+			return err
+		}
+		if wantsNDJSON(c) {
+			desc, err := h.svc.Describe(ctx, "/", "")
+			if err != nil {
+				return toHTTPError(err)
+			}
+			return h.streamListing(c, desc, params)
+		}
 		entries, err := h.svc.ListDirectory(ctx, "/", "")
 		if err != nil {
 			return toHTTPError(err)
 		}
-		return sendCollectionJSON(c, entries, params)
+		return h.sendCollectionJSON(c, entries, params, nil)
 	}
 
+	params, err := h.parseListParams(c, Root{})
+	if err != nil {
+		return err
+	}
 	roots, err := h.svc.ListRoots(ctx)
 	if err != nil {
 		return toHTTPError(err)
 	}
 
-	return sendCollectionJSON(c, roots, params)
+	return h.sendCollectionJSON(c, readableRoots(c, roots), params, nil)
 }
 
 func (h Handler) getResource(c echo.Context) error {
@@ -69,6 +198,45 @@ func (h Handler) getResource(c echo.Context) error {
 	if err != nil {
 		return err
 	}
+	if h.opts.StrictPaths {
+		if err := checkStrictPath(c); err != nil {
+			return err
+		}
+	}
+	if IsSignedRequest(c) {
+		if err := h.verifySignedRequest(c, joinVirtual(root.Virtual, rel)); err != nil {
+			return err
+		}
+	} else if err := authorize(c, root, ScopeRead); err != nil {
+		return err
+	}
+
+	if h.opts.CanonicalRedirect {
+		if location, ok := h.canonicalLocation(c, root, rel); ok {
+			return c.Redirect(http.StatusPermanentRedirect, location)
+		}
+	}
+
+	rel, search := cutSearchPath(rel)
+	if err := rejectComputedHead(c, search); err != nil {
+		return err
+	}
+	rel, err = h.resolvePath(c, root, rel)
+	if err != nil {
+		return err
+	}
+	switch search {
+	case searchSegment:
+		return h.serveSearch(c, root, rel)
+	case grepSegment:
+		return h.serveGrep(c, root, rel)
+	case thumbnailSegment:
+		return h.serveThumbnail(c, root, rel)
+	}
+
+	if c.QueryParam("metadata") == "1" {
+		return h.sendResourceJSON(c, root, rel)
+	}
 
 	ctx := c.Request().Context()
 	desc, err := h.svc.Describe(ctx, root.Virtual, rel)
@@ -76,52 +244,284 @@ func (h Handler) getResource(c echo.Context) error {
 		return toHTTPError(err)
 	}
 
-	if desc.TargetKind == "folder" {
-		params, err := parseListParams(c)
-		if err != nil {
-			return err
+	return h.serveDescribed(c, desc)
+}
+
+// serveDescribed answers with the representation of desc the query selects:
+// a fingerprint, checksum, disk usage, tree or archive, else the listing or file content.
+func (h Handler) serveDescribed(c echo.Context, desc Descriptor) error {
+	switch {
+	case c.QueryParam("fingerprint") == "1":
+		return h.sendFingerprint(c, desc)
+	case c.QueryParam("checksum") != "":
+		return h.sendChecksum(c, desc, c.QueryParam("checksum"))
+	case c.QueryParam("usage") != "":
+		return h.sendUsage(c, desc, c.QueryParam("usage"))
+	case c.QueryParam("depth") != "":
+		return h.serveTree(c, desc)
+	case c.QueryParam("archive") != "":
+		entries := []ArchiveEntry{{Name: archiveName(desc), Desc: desc}}
+		return h.serveArchive(c, archiveName(desc), c.QueryParam("archive"), entries)
+	case desc.TargetKind == kindFolder:
+		return h.serveListing(c, desc)
+	}
+	return h.serveFile(c, desc)
+}
+
+// serveListing answers a folder request with its listing, or 304 when the
+// listing ETag matches If-None-Match.
+func (h Handler) serveListing(c echo.Context, desc Descriptor) error {
+	params, err := h.parseListParams(c, desc.Root)
+	if err != nil {
+		return err
+	}
+
+	// Accept selects between the JSON:API document and the NDJSON stream.
+	c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+	if etag := h.listingETag(c, desc); etag != "" {
+		c.Response().Header().Set(headerETag, etag)
+		if notModified(c.Request(), etag) {
+			return c.NoContent(http.StatusNotModified)
 		}
+	}
 
-		entries, err := h.svc.ListDirectory(ctx, root.Virtual, rel)
+	if wantsNDJSON(c) {
+		return h.streamListing(c, desc, params)
+	}
+	if h.pagesByName(desc, params) {
+		page, total, err := h.svc.ListPage(c.Request().Context(), desc.Root.Virtual, desc.RelPath, params)
 		if err != nil {
 			return toHTTPError(err)
 		}
+		return h.sendPage(c, h.pageResponse(c, total, params), page, params, &desc)
+	}
+	list := h.svc.ListDirectory
+	if params.namesOnly() {
+		list = h.svc.ListNames
+	}
+	entries, err := list(c.Request().Context(), desc.Root.Virtual, desc.RelPath)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return h.sendCollectionJSON(c, entries, params, &desc)
+}
 
-		return sendCollectionJSON(c, entries, params)
+// canonicalLocation returns the redirect target when the requested casing differs from the on-disk names.
+func (h Handler) canonicalLocation(c echo.Context, root Root, rel string) (string, bool) {
+	canonical, err := h.svc.CanonicalPath(c.Request().Context(), root.Virtual, rel)
+	if err != nil || canonical == rel {
+		return "", false
 	}
 
-	return h.serveFile(c, desc)
+	location := escapeVirtualPath(joinVirtual(root.Virtual, canonical))
+	if query := c.Request().URL.RawQuery; query != "" {
+		location += "?" + query
+	}
+	return location, true
+}
+
+// escapeVirtualPath builds the URL for a virtual path, escaping every segment.
+func escapeVirtualPath(virtualPath string) string {
+	var b strings.Builder
+	b.WriteString("/api/v1/files")
+	for _, segment := range strings.Split(strings.Trim(virtualPath, "/"), "/") {
+		if segment == "" {
+			continue
+		}
+		b.WriteString("/")
+		b.WriteString(url.PathEscape(segment))
+	}
+	return b.String()
+}
+
+// sendCollectionJSON writes a listing. self is the listed folder, attached as
+// meta.resource when requested with include_self=1.
+func (h Handler) sendCollectionJSON(c echo.Context, entries []Descriptor, params ListParams, self *Descriptor) error {
+	sortDescriptors(entries, params)
+	resp, paged := h.collectionResponse(c, entries, params)
+	return h.sendPage(c, resp, paged, params, self)
+}
+
+// pagesByName reports whether the listing of desc is better paginated before
+// describing its entries, see ListPage. Manifest listings describe every
+// entry anyway, and cached listings are cheaper to page through whole.
+func (h Handler) pagesByName(desc Descriptor, params ListParams) bool {
+	if desc.RelPath == "" && desc.Root.Manifest != "" {
+		return false
+	}
+	return params.pagesByName() && !params.namesOnly() && h.svc.listings == nil
 }
 
-func sendCollectionJSON(c echo.Context, entries []Descriptor, params ListParams) error {
-	sortDescriptors(entries, params.SortField, params.Descending)
-	resp := collectionResponse(c, entries, params)
+// sendPage writes the page of a listing in the envelope resp.
+func (h Handler) sendPage(c echo.Context, resp Response, paged []Descriptor, params ListParams, self *Descriptor) error {
+	if params.IncludeSelf && self != nil {
+		resource := h.resourceFrom(*self, ListParams{})
+		resp.Meta.Resource = &resource
+	}
+	if h.opts.GeneratedAt {
+		now := time.Now()
+		resp.Meta.GeneratedAt = formatTime(&now)
+	}
 	c.Response().Header().Set(echo.HeaderContentType, api.ContentType)
+
+	if h.opts.StreamListings {
+		resp.Meta.Memory = memoryStatsSince(c.Request().Context())
+		return h.streamCollection(c, resp, paged, params)
+	}
+	resp.Data = make([]Resource, 0, len(paged))
+	for _, entry := range paged {
+		resp.Data = append(resp.Data, h.resourceFrom(entry, params))
+	}
+	resp.Meta.Memory = memoryStatsSince(c.Request().Context())
+
+	if timings := timingsFromContext(c.Request().Context()); timings != nil {
+		start := time.Now()
+		body, err := json.Marshal(resp)
+		if err != nil {
+			return fmt.Errorf("encode collection response: %w", err)
+		}
+		timings.add(timingSerialize, time.Since(start))
+		c.Response().Header().Set("Server-Timing", timings.header())
+		if err := c.Blob(http.StatusOK, api.ContentType, body); err != nil {
+			return fmt.Errorf("write collection response: %w", err)
+		}
+		return nil
+	}
+
 	if err := c.JSON(http.StatusOK, resp); err != nil {
 		return fmt.Errorf("write collection response: %w", err)
 	}
 	return nil
 }
 
+// sendResourceJSON answers ?metadata=1 with the resource itself instead of its
+// content or listing. With follow=false a symlink reports its own metadata,
+// otherwise the metadata of its target.
+func (h Handler) sendResourceJSON(c echo.Context, root Root, rel string) error {
+	follow := true
+	switch c.QueryParam("follow") {
+	case "", "true":
+	case "false":
+		follow = false
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid follow: %s", c.QueryParam("follow")))
+	}
+
+	describe := h.svc.Describe
+	if !follow {
+		describe = h.svc.DescribeLink
+	}
+	desc, err := describe(c.Request().Context(), root.Virtual, rel)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	res := h.resourceFrom(desc, ListParams{})
+	if follow && desc.Target != nil {
+		etag := res.Attributes.ETag
+		res.Attributes = attributesFrom(*desc.Target)
+		res.Attributes.ETag = etag
+		res.Attributes.sizeAsString = h.opts.SizeAsString
+	}
+
+	resp := ResourceResponse{Data: res}
+	if h.opts.GeneratedAt {
+		now := time.Now()
+		resp.Meta = &ResourceMeta{GeneratedAt: formatTime(&now)}
+	}
+	c.Response().Header().Set(echo.HeaderContentType, api.ContentType)
+	if err := c.JSON(http.StatusOK, resp); err != nil {
+		return fmt.Errorf("write resource response: %w", err)
+	}
+	return nil
+}
+
 func (h Handler) serveFile(c echo.Context, desc Descriptor) error {
-	// Check for download=1 query param to force attachment download
-	if c.QueryParam("download") == "1" {
-		if err := c.Attachment(desc.AbsolutePath, desc.Metadata.Name); err != nil {
-			return fmt.Errorf("serve attachment: %w", err)
+	if isSpecialKind(desc.TargetKind) {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("cannot download %s: not a regular file", desc.TargetKind))
+	}
+	// Advertised on every download response, including 304 and 416, so
+	// clients know they can resume.
+	c.Response().Header().Set("Accept-Ranges", "bytes")
+
+	if etag := ComputeETag(desc); etag != "" {
+		c.Response().Header().Set(headerETag, etag)
+		if notModified(c.Request(), etag) {
+			return c.NoContent(http.StatusNotModified)
 		}
-		return nil
 	}
 
+	if h.opts.RejectEmptyRanges && isEmptyRangeRequest(c.Request(), desc) {
+		c.Response().Header().Set("Content-Range", "bytes */0")
+		return echo.NewHTTPError(http.StatusRequestedRangeNotSatisfiable, "range not satisfiable for empty file")
+	}
+
+	release, err := h.svc.openFiles.acquire(c.Request().Context())
+	if err != nil {
+		return toHTTPError(err)
+	}
+	defer release()
+
+	if h.opts.RespectLocks {
+		locked, err := isLocked(desc.AbsolutePath)
+		if err != nil {
+			return toHTTPError(err)
+		}
+		if locked {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "file is locked by another process")
+		}
+	}
+
+	return serveContent(c, desc)
+}
+
+// dispositionEscaper escapes file names quoted in Content-Disposition.
+var dispositionEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// serveContent writes the file of desc inline or, with download=1, as an
+// attachment. Both honor Range and If-Range so interrupted downloads resume;
+// unlike http.ServeFile, paths ending in /index.html are not redirected.
+func serveContent(c echo.Context, desc Descriptor) (err error) {
+	_, span := startSpan(c.Request().Context(), "files.serve", desc.Root.Virtual, desc.RelPath)
+	defer func() { endSpan(span, err) }()
+
+	header := c.Response().Header()
 	ctype := desc.Metadata.MimeType
 	if ctype == "" {
 		ctype = "application/octet-stream"
 	}
-	c.Response().Header().Set(echo.HeaderContentType, ctype)
+	header.Set(echo.HeaderContentType, ctype)
+	if c.QueryParam("download") == "1" {
+		header.Set(echo.HeaderContentDisposition,
+			fmt.Sprintf(`attachment; filename="%s"`, dispositionEscaper.Replace(desc.Metadata.Name)))
+	}
+
+	// #nosec G304 -- the path is resolved within a configured root.
+	f, err := os.Open(desc.AbsolutePath)
+	if err != nil {
+		return toHTTPError(err)
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return toHTTPError(err)
+	}
+	span.SetAttributes(attrSize.Int64(info.Size()))
 
-	http.ServeFile(c.Response(), c.Request(), desc.AbsolutePath)
+	http.ServeContent(c.Response(), c.Request(), desc.Metadata.Name, info.ModTime(), f)
 	return nil
 }
 
+// isEmptyRangeRequest reports whether a byte range is requested from an empty file.
+// No range can be satisfied for zero bytes, but net/http ignores the header then.
+func isEmptyRangeRequest(r *http.Request, desc Descriptor) bool {
+	if !strings.HasPrefix(r.Header.Get("Range"), "bytes=") {
+		return false
+	}
+	return desc.Metadata.SizeBytes != nil && *desc.Metadata.SizeBytes == 0
+}
+
 func parseVirtualPath(c echo.Context, roots []Root) (Root, string, error) {
 	raw := c.Request().URL.RawPath
 	if raw == "" {
@@ -157,9 +557,41 @@ func parseVirtualPath(c echo.Context, roots []Root) (Root, string, error) {
 		return Root{}, "", echo.NewHTTPError(http.StatusNotFound, "file root not found")
 	}
 
+	c.Set(ctxKeyRoot, root.Virtual)
+	c.Set(ctxKeyPath, joinVirtual(root.Virtual, rel))
 	return root, rel, nil
 }
 
+// Echo context keys of the root and virtual path a request targets.
+const (
+	ctxKeyRoot = "files.root"
+	ctxKeyPath = "files.path"
+)
+
+// RequestTarget returns the root and virtual path of the file the request
+// targets, or empty strings when it targets none, e.g. for access logs.
+func RequestTarget(c echo.Context) (root, virtualPath string) {
+	root, _ = c.Get(ctxKeyRoot).(string)
+	virtualPath, _ = c.Get(ctxKeyPath).(string)
+	return root, virtualPath
+}
+
+// checkStrictPath rejects request paths whose segments contain backslashes or
+// decode to path separators or parent references.
+func checkStrictPath(c echo.Context) error {
+	raw := c.Request().URL.EscapedPath()
+	for _, segment := range strings.Split(strings.TrimPrefix(raw, "/api/v1/files/"), "/") {
+		decoded, err := url.PathUnescape(segment)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid path: %v", err))
+		}
+		if decoded == ".." || strings.ContainsAny(decoded, `/\`) {
+			return echo.NewHTTPError(http.StatusBadRequest, "path segment contains a separator or traversal")
+		}
+	}
+	return nil
+}
+
 func matchRoot(requestPath string, roots []Root) (Root, string, bool) {
 	sorted := make([]Root, len(roots))
 	copy(sorted, roots)
@@ -186,7 +618,11 @@ func matchRoot(requestPath string, roots []Root) (Root, string, bool) {
 	return Root{}, "", false
 }
 
-func collectionResponse(c echo.Context, entries []Descriptor, params ListParams) Response {
+// collectionResponse filters and paginates entries. It returns the envelope
+// with meta and links, and the entries of the requested page that make up
+// its data.
+func (h Handler) collectionResponse(c echo.Context, entries []Descriptor, params ListParams) (Response, []Descriptor) {
+	entries = filterDescriptors(entries, params)
 	total := len(entries)
 
 	// Apply pagination
@@ -199,38 +635,25 @@ func collectionResponse(c echo.Context, entries []Descriptor, params ListParams)
 		end = total
 	}
 
-	paged := entries[start:end]
-	data := make([]Resource, 0, len(paged))
-	for _, entry := range paged {
-		data = append(data, resourceFrom(entry))
-	}
-
-	// Build pagination links
-	basePath := c.Request().URL.Path
-	links := buildPaginationLinks(basePath, params, total)
+	return h.pageResponse(c, total, params), entries[start:end]
+}
 
+// pageResponse returns the envelope of a page of a listing of total entries.
+func (h Handler) pageResponse(c echo.Context, total int, params ListParams) Response {
 	return Response{
 		Meta: &PaginationMeta{
 			TotalCount: total,
 			Offset:     params.Offset,
 			Limit:      params.Limit,
 		},
-		Data:  data,
-		Links: links,
+		Links: buildPaginationLinks(c.Request().URL.Path, params, total),
 	}
 }
 
 func buildPaginationLinks(basePath string, params ListParams, total int) *PaginationLinks {
+	query := listQuery(params)
 	buildURL := func(offset int) string {
-		u := fmt.Sprintf("%s?page[offset]=%d&page[limit]=%d", basePath, offset, params.Limit)
-		if params.SortField != "name" || params.Descending {
-			sortPrefix := ""
-			if params.Descending {
-				sortPrefix = "-"
-			}
-			u += fmt.Sprintf("&sort=%s%s", sortPrefix, params.SortField)
-		}
-		return u
+		return fmt.Sprintf("%s?page[offset]=%d&page[limit]=%d%s", basePath, offset, params.Limit, query)
 	}
 
 	// Calculate last page offset
@@ -264,21 +687,55 @@ func buildPaginationLinks(basePath string, params ListParams, total int) *Pagina
 	return links
 }
 
-func resourceFrom(desc Descriptor) Resource {
-	attrs := Attributes{
-		Name:           desc.Metadata.Name,
-		ResourceKind:   desc.Metadata.ResourceKind,
-		SizeBytes:      desc.Metadata.SizeBytes,
-		PermissionMode: desc.Metadata.PermissionMode,
-		User:           desc.Metadata.User,
-		Group:          desc.Metadata.Group,
-		UserID:         desc.Metadata.UserID,
-		GroupID:        desc.Metadata.GroupID,
-		MimeType:       desc.Metadata.MimeType,
-		AccessedAt:     formatTime(desc.Metadata.AccessedAt),
-		ModifiedAt:     formatTime(desc.Metadata.ModifiedAt),
-		ChangedAt:      formatTime(desc.Metadata.ChangedAt),
-		BornAt:         formatTime(desc.Metadata.BornAt),
+// listQuery renders the non-pagination list parameters for pagination links.
+func listQuery(params ListParams) string {
+	var query string
+	if params.SortField != "name" || params.Descending {
+		sortPrefix := ""
+		if params.Descending {
+			sortPrefix = "-"
+		}
+		query += fmt.Sprintf("&sort=%s%s", sortPrefix, params.SortField)
+	}
+	if params.ResolveLinks {
+		query += "&resolve_links=full"
+	}
+	if params.KeepLinks {
+		query += "&resolve_links=none"
+	}
+	if params.ModeFilter != nil {
+		query += params.ModeFilter.query()
+	}
+	if params.Filter != nil {
+		query += params.Filter.query()
+	}
+	if params.IncludeSelf {
+		query += "&include_self=1"
+	}
+	if params.Collation != "" {
+		query += "&collation=" + params.Collation
+	}
+	if params.MimeDetection != "" {
+		query += "&mime_detection=" + params.MimeDetection
+	}
+	if params.Search != nil {
+		query += params.Search.query()
+	}
+	if len(params.Fields) > 0 {
+		query += "&fields[files]=" + strings.Join(slices.Sorted(maps.Keys(params.Fields)), ",")
+	}
+	return query
+}
+
+func (h Handler) resourceFrom(desc Descriptor, params ListParams) Resource {
+	attrs := attributesFrom(desc.Metadata)
+	attrs.ETag = ComputeETag(desc)
+	attrs.sizeAsString = h.opts.SizeAsString
+	attrs.fields = params.Fields
+	if params.ResolveLinks && desc.Target != nil {
+		target := attributesFrom(*desc.Target)
+		target.sizeAsString = h.opts.SizeAsString
+		attrs.Target = &target
 	}
 
 	return Resource{
@@ -288,6 +745,29 @@ func resourceFrom(desc Descriptor) Resource {
 		Links: ResourceLinks{
 			Self: path.Join("/api/v1/files", desc.Metadata.VirtualPath),
 		},
+		Meta: entryMeta(desc),
+	}
+}
+
+func attributesFrom(meta Metadata) Attributes {
+	return Attributes{
+		Name:           meta.Name,
+		ResourceKind:   meta.ResourceKind,
+		SizeBytes:      meta.SizeBytes,
+		PermissionMode: meta.PermissionMode,
+		User:           meta.User,
+		Group:          meta.Group,
+		UserID:         meta.UserID,
+		GroupID:        meta.GroupID,
+		MimeType:       meta.MimeType,
+		AccessedAt:     formatTime(meta.AccessedAt),
+		ModifiedAt:     formatTime(meta.ModifiedAt),
+		ChangedAt:      formatTime(meta.ChangedAt),
+		BornAt:         formatTime(meta.BornAt),
+		MountPath:      meta.MountPath,
+		LinkTarget:     meta.LinkTarget,
+		FileID:         meta.FileID,
+		ACL:            meta.ACL,
 	}
 }
 
@@ -299,19 +779,43 @@ func formatTime(t *time.Time) *string {
 	return &formatted
 }
 
+// errorStatuses maps service errors onto HTTP statuses. Errors with an empty
+// detail report their full message, which carries the affected path.
+var errorStatuses = []struct {
+	err    error
+	code   int
+	detail string
+}{
+	{ErrRootNotFound, http.StatusNotFound, "file root not found"},
+	{ErrOutsideRoot, http.StatusBadRequest, "path escapes configured root"},
+	{ErrSymlinkDepth, http.StatusBadRequest, "symlink chain exceeds maximum depth"},
+	{ErrPathDepth, http.StatusBadRequest, "path exceeds maximum depth"},
+	{ErrOverlappingPaths, http.StatusBadRequest, ""},
+	{ErrRootUnavailable, http.StatusServiceUnavailable, "file root unavailable"},
+	{ErrRootEntry, http.StatusForbidden, "root folders cannot be modified"},
+	{ErrExists, http.StatusConflict, ""},
+	{ErrInvalidMove, http.StatusBadRequest, ""},
+	{ErrInvalidOwner, http.StatusBadRequest, ""},
+	{ErrUnsupportedImage, http.StatusUnsupportedMediaType, "unsupported image format"},
+	{ErrImageTooLarge, http.StatusUnprocessableEntity, "image too large for a thumbnail"},
+	{context.Canceled, http.StatusRequestTimeout, "request canceled"},
+}
+
 func toHTTPError(err error) error {
 	var httpErr *echo.HTTPError
 	if errors.As(err, &httpErr) {
 		return httpErr
 	}
 
-	switch {
-	case errors.Is(err, ErrRootNotFound):
-		return echo.NewHTTPError(http.StatusNotFound, "file root not found")
-	case errors.Is(err, ErrOutsideRoot):
-		return echo.NewHTTPError(http.StatusBadRequest, "path escapes configured root")
-	case errors.Is(err, context.Canceled):
-		return echo.NewHTTPError(http.StatusRequestTimeout, "request canceled")
+	for _, s := range errorStatuses {
+		if !errors.Is(err, s.err) {
+			continue
+		}
+		detail := s.detail
+		if detail == "" {
+			detail = err.Error()
+		}
+		return echo.NewHTTPError(s.code, detail)
 	}
 
 	if os.IsPermission(err) || errors.Is(err, os.ErrPermission) || errors.Is(err, syscall.EACCES) {
@@ -331,11 +835,25 @@ type Response struct {
 	Links *PaginationLinks `json:"links,omitempty"`
 }
 
+// ResourceResponse represents a JSON:API single-resource envelope for files.
+type ResourceResponse struct {
+	Meta *ResourceMeta `json:"meta,omitempty"`
+	Data Resource      `json:"data"`
+}
+
+// ResourceMeta contains single-resource metadata.
+type ResourceMeta struct {
+	GeneratedAt *string `json:"generated_at,omitempty"`
+}
+
 // PaginationMeta contains pagination metadata.
 type PaginationMeta struct {
-	TotalCount int `json:"total_count"`
-	Offset     int `json:"offset"`
-	Limit      int `json:"limit"`
+	TotalCount  int          `json:"total_count"`
+	Offset      int          `json:"offset"`
+	Limit       int          `json:"limit"`
+	GeneratedAt *string      `json:"generated_at,omitempty"`
+	Resource    *Resource    `json:"resource,omitempty"`
+	Memory      *MemoryStats `json:"memory,omitempty"`
 }
 
 // PaginationLinks contains pagination links.
@@ -349,10 +867,12 @@ type PaginationLinks struct {
 
 // Resource represents a single file or folder resource.
 type Resource struct {
-	ID         string        `json:"id"`
-	Type       string        `json:"type"`
-	Attributes Attributes    `json:"attributes"`
-	Links      ResourceLinks `json:"links,omitempty"`
+	ID            string                 `json:"id"`
+	Type          string                 `json:"type"`
+	Attributes    Attributes             `json:"attributes"`
+	Relationships *ResourceRelationships `json:"relationships,omitempty"`
+	Links         ResourceLinks          `json:"links,omitempty"`
+	Meta          *EntryMeta             `json:"meta,omitempty"`
 }
 
 // Attributes captures file metadata attributes.
@@ -370,6 +890,38 @@ type Attributes struct {
 	ModifiedAt     *string `json:"modified_at"`
 	ChangedAt      *string `json:"changed_at"`
 	BornAt         *string `json:"born_at"`
+	ETag           string  `json:"etag,omitempty"`
+	MountPath      *string `json:"mount_path,omitempty"`
+	LinkTarget     *string `json:"link_target,omitempty"`
+	FileID         *string `json:"file_id,omitempty"`
+	ACL            *ACL    `json:"acl,omitempty"`
+	// Target holds the resolved target of a symlink when requested via resolve_links=full.
+	Target *Attributes `json:"target,omitempty"`
+
+	sizeAsString bool
+	fields       map[string]bool
+}
+
+// MarshalJSON renders size_bytes as a string when requested by the handler
+// options and drops attributes outside a requested sparse fieldset.
+func (a Attributes) MarshalJSON() ([]byte, error) {
+	type plain Attributes
+	var v any = plain(a)
+	if a.sizeAsString && a.SizeBytes != nil {
+		v = struct {
+			plain
+			SizeBytes string `json:"size_bytes"`
+		}{plain: plain(a), SizeBytes: strconv.FormatInt(*a.SizeBytes, 10)}
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("marshal attributes: %w", err)
+	}
+	if a.fields == nil {
+		return data, nil
+	}
+	return sparseAttributes(data, a.fields)
 }
 
 // ResourceLinks contains resource links.
@@ -383,6 +935,28 @@ type ListParams struct {
 	Offset     int
 	SortField  string
 	Descending bool
+	// ResolveLinks inlines the resolved target attributes of symlinks.
+	ResolveLinks bool
+	// KeepLinks lists symlinks as themselves with their link target instead
+	// of describing their targets.
+	KeepLinks bool
+	// ModeFilter restricts the listing to entries matching a permission mask.
+	ModeFilter *ModeFilter
+	// Filter restricts the listing to entries matching filter[...] attributes.
+	Filter *EntryFilter
+	// Fields restricts the rendered attributes (JSON:API sparse fieldsets).
+	Fields map[string]bool
+	// IncludeSelf attaches the listed folder's own resource as meta.resource.
+	IncludeSelf bool
+	// Search holds the options of a search, kept in pagination links.
+	Search *SearchOptions
+	// Collation is the requested collation of names, empty for the default.
+	Collation string
+	// MimeDetection is the requested MIME type detection, empty for the
+	// default.
+	MimeDetection string
+	// compareNames orders names; nil compares them byte-wise.
+	compareNames func(a, b string) int
 }
 
 // validSortFields are the allowed sort field names.
@@ -402,21 +976,88 @@ var validSortFields = map[string]bool{
 	"born_at":         true,
 }
 
-func parseListParams(c echo.Context) (ListParams, error) {
+// ownershipSortFields are rejected when ownership is hidden.
+var ownershipSortFields = map[string]bool{
+	"user":     true,
+	"group":    true,
+	"user_id":  true,
+	"group_id": true,
+}
+
+// parseListParams parses the listing query parameters. The page size defaults
+// to the DefaultLimit of root when set.
+func (h Handler) parseListParams(c echo.Context, root Root) (ListParams, error) {
 	params := ListParams{
 		Limit:     defaultLimit,
 		Offset:    0,
 		SortField: "name",
 	}
+	if root.DefaultLimit > 0 {
+		params.Limit = min(root.DefaultLimit, maxLimit)
+	}
+
+	if err := parsePageParams(c, &params); err != nil {
+		return params, err
+	}
+	if err := parseSortParam(c, &params); err != nil {
+		return params, err
+	}
+	if h.svc.opts.HideOwnership && ownershipSortFields[params.SortField] {
+		return params, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("sort field not available: %s", params.SortField))
+	}
+	if err := parseModeFilter(c, &params); err != nil {
+		return params, err
+	}
+	if err := parseEntryFilter(c, &params); err != nil {
+		return params, err
+	}
+	if err := parseFields(c, &params); err != nil {
+		return params, err
+	}
+	if !params.needsOwnerNames() {
+		req := c.Request()
+		c.SetRequest(req.WithContext(contextWithoutOwnerNames(req.Context())))
+	}
+	if err := h.parseCollation(c, &params); err != nil {
+		return params, err
+	}
+	if err := h.parseMimeDetection(c, &params); err != nil {
+		return params, err
+	}
+
+	// Parse resolve_links
+	switch resolve := c.QueryParam("resolve_links"); resolve {
+	case "":
+	case "full":
+		params.ResolveLinks = true
+	case "none":
+		params.KeepLinks = true
+		req := c.Request()
+		c.SetRequest(req.WithContext(contextWithoutLinkResolution(req.Context())))
+	default:
+		return params, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid resolve_links: %s", resolve))
+	}
+
+	switch includeSelf := c.QueryParam("include_self"); includeSelf {
+	case "":
+	case "1":
+		params.IncludeSelf = true
+	default:
+		return params, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid include_self: %s", includeSelf))
+	}
+
+	return params, nil
+}
 
+func parsePageParams(c echo.Context, params *ListParams) error {
 	// Parse page[limit]
 	if limitStr := c.QueryParam("page[limit]"); limitStr != "" {
 		limit, err := strconv.Atoi(limitStr)
 		if err != nil || limit < 1 {
-			return params, echo.NewHTTPError(http.StatusBadRequest, "invalid page[limit]: must be a positive integer")
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid page[limit]: must be a positive integer")
 		}
 		if limit > maxLimit {
-			return params, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("page[limit] exceeds maximum of %d", maxLimit))
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("page[limit] exceeds maximum of %d", maxLimit))
 		}
 		params.Limit = limit
 	}
@@ -425,39 +1066,49 @@ func parseListParams(c echo.Context) (ListParams, error) {
 	if offsetStr := c.QueryParam("page[offset]"); offsetStr != "" {
 		offset, err := strconv.Atoi(offsetStr)
 		if err != nil || offset < 0 {
-			return params, echo.NewHTTPError(http.StatusBadRequest, "invalid page[offset]: must be a non-negative integer")
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid page[offset]: must be a non-negative integer")
 		}
 		params.Offset = offset
 	}
 
-	// Parse sort
-	if sortParam := c.QueryParam("sort"); sortParam != "" {
-		// Check for multi-field sort (comma-separated)
-		if strings.Contains(sortParam, ",") {
-			return params, echo.NewHTTPError(http.StatusBadRequest, "sorting by multiple fields is not supported")
-		}
+	return nil
+}
 
-		field := sortParam
-		if strings.HasPrefix(field, "-") {
-			params.Descending = true
-			field = strings.TrimPrefix(field, "-")
-		}
+func parseSortParam(c echo.Context, params *ListParams) error {
+	sortParam := c.QueryParam("sort")
+	if sortParam == "" {
+		return nil
+	}
 
-		if !validSortFields[field] {
-			return params, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid sort field: %s", field))
-		}
-		params.SortField = field
+	// Check for multi-field sort (comma-separated)
+	if strings.Contains(sortParam, ",") {
+		return echo.NewHTTPError(http.StatusBadRequest, "sorting by multiple fields is not supported")
 	}
 
-	return params, nil
+	field := sortParam
+	if strings.HasPrefix(field, "-") {
+		params.Descending = true
+		field = strings.TrimPrefix(field, "-")
+	}
+
+	if !validSortFields[field] {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid sort field: %s", field))
+	}
+	params.SortField = field
+
+	return nil
 }
 
-func sortDescriptors(entries []Descriptor, field string, descending bool) {
+func sortDescriptors(entries []Descriptor, params ListParams) {
+	compareNames := params.compareNames
+	if compareNames == nil {
+		compareNames = strings.Compare
+	}
 	sort.SliceStable(entries, func(i, j int) bool {
 		var less bool
-		switch field {
+		switch params.SortField {
 		case "name":
-			less = entries[i].Metadata.Name < entries[j].Metadata.Name
+			less = compareNames(entries[i].Metadata.Name, entries[j].Metadata.Name) < 0
 		case "resource_kind":
 			less = entries[i].Metadata.ResourceKind < entries[j].Metadata.ResourceKind
 		case "size_bytes":
@@ -483,9 +1134,9 @@ func sortDescriptors(entries []Descriptor, field string, descending bool) {
 		case "born_at":
 			less = comparePtrTime(entries[i].Metadata.BornAt, entries[j].Metadata.BornAt)
 		default:
-			less = entries[i].Metadata.Name < entries[j].Metadata.Name
+			less = compareNames(entries[i].Metadata.Name, entries[j].Metadata.Name) < 0
 		}
-		if descending {
+		if params.Descending {
 			return !less
 		}
 		return less
@@ -1,21 +1,40 @@
 package files
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"os/user"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
 
 	"github.com/thorstenkramm/dendrite-pulse/internal/api"
+	"github.com/thorstenkramm/dendrite-pulse/internal/audit"
+	"github.com/thorstenkramm/dendrite-pulse/internal/auth"
+	"github.com/thorstenkramm/dendrite-pulse/internal/watch"
 )
 
 func TestListDirectoryHandler(t *testing.T) {
@@ -27,7 +46,7 @@ func TestListDirectoryHandler(t *testing.T) {
 	svc := newTestService(t, root)
 	e := echo.New()
 	e.HTTPErrorHandler = jsonAPIError
-	RegisterRoutes(e, svc)
+	RegisterRoutes(e, svc, HandlerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public", nil)
 	rec := httptest.NewRecorder()
@@ -57,7 +76,7 @@ func TestFileDownloadHandler(t *testing.T) {
 	svc := newTestService(t, root)
 	e := echo.New()
 	e.HTTPErrorHandler = jsonAPIError
-	RegisterRoutes(e, svc)
+	RegisterRoutes(e, svc, HandlerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/hello.txt", nil)
 	rec := httptest.NewRecorder()
@@ -74,7 +93,7 @@ func TestPathTraversalReturnsBadRequest(t *testing.T) {
 	svc := newTestService(t, root)
 	e := echo.New()
 	e.HTTPErrorHandler = jsonAPIError
-	RegisterRoutes(e, svc)
+	RegisterRoutes(e, svc, HandlerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/../etc/passwd", nil)
 	rec := httptest.NewRecorder()
@@ -93,12 +112,12 @@ func TestDirectoryListingAndDownload_VirtualSlash(t *testing.T) {
 	dirName := "00_Hasenaugengesicht"
 	require.NoError(t, os.MkdirAll(filepath.Join(root, dirName), 0o750))
 
-	svc, err := NewService([]Root{{Virtual: "/", Source: root}})
+	svc, err := NewService([]Root{{Virtual: "/", Source: root}}, Options{})
 	require.NoError(t, err)
 
 	e := echo.New()
 	e.HTTPErrorHandler = jsonAPIError
-	RegisterRoutes(e, svc)
+	RegisterRoutes(e, svc, HandlerOptions{})
 
 	listReq := httptest.NewRequest(http.MethodGet, "/api/v1/files/"+url.PathEscape(dirName), nil)
 	listRec := httptest.NewRecorder()
@@ -116,12 +135,12 @@ func TestDirectoryListingAndDownload_PublicRoot(t *testing.T) {
 	root := t.TempDir()
 	require.NoError(t, os.WriteFile(filepath.Join(root, "report.txt"), []byte("report"), 0o600))
 
-	svc, err := NewService([]Root{{Virtual: "/public", Source: root}})
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root}}, Options{})
 	require.NoError(t, err)
 
 	e := echo.New()
 	e.HTTPErrorHandler = jsonAPIError
-	RegisterRoutes(e, svc)
+	RegisterRoutes(e, svc, HandlerOptions{})
 
 	listReq := httptest.NewRequest(http.MethodGet, "/api/v1/files/public", nil)
 	listRec := httptest.NewRecorder()
@@ -137,12 +156,12 @@ func TestDirectoryListingAndDownload_PublicRoot(t *testing.T) {
 
 func TestNonExistingFileReturns404(t *testing.T) {
 	root := t.TempDir()
-	svc, err := NewService([]Root{{Virtual: "/public", Source: root}})
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root}}, Options{})
 	require.NoError(t, err)
 
 	e := echo.New()
 	e.HTTPErrorHandler = jsonAPIError
-	RegisterRoutes(e, svc)
+	RegisterRoutes(e, svc, HandlerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/missing.txt", nil)
 	rec := httptest.NewRecorder()
@@ -163,12 +182,12 @@ func TestDirectoryListingAndDownload_MultipleRoots(t *testing.T) {
 		{Virtual: "/public", Source: publicRoot},
 		{Virtual: "/Docs & Notes", Source: docsRoot},
 	}
-	svc, err := NewService(roots)
+	svc, err := NewService(roots, Options{})
 	require.NoError(t, err)
 
 	e := echo.New()
 	e.HTTPErrorHandler = jsonAPIError
-	RegisterRoutes(e, svc)
+	RegisterRoutes(e, svc, HandlerOptions{})
 
 	listReq := httptest.NewRequest(http.MethodGet, "/api/v1/files/Docs%20%26%20Notes", nil)
 	listRec := httptest.NewRecorder()
@@ -192,7 +211,7 @@ func TestUnicodeFilenames(t *testing.T) {
 	svc := newTestService(t, root)
 	e := echo.New()
 	e.HTTPErrorHandler = jsonAPIError
-	RegisterRoutes(e, svc)
+	RegisterRoutes(e, svc, HandlerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public", nil)
 	rec := httptest.NewRecorder()
@@ -233,7 +252,7 @@ func TestSpecialCharacterFilenames(t *testing.T) {
 	svc := newTestService(t, root)
 	e := echo.New()
 	e.HTTPErrorHandler = jsonAPIError
-	RegisterRoutes(e, svc)
+	RegisterRoutes(e, svc, HandlerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public", nil)
 	rec := httptest.NewRecorder()
@@ -258,7 +277,7 @@ func TestPagination(t *testing.T) {
 	svc := newTestService(t, root)
 	e := echo.New()
 	e.HTTPErrorHandler = jsonAPIError
-	RegisterRoutes(e, svc)
+	RegisterRoutes(e, svc, HandlerOptions{})
 
 	// Test with limit=3
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public?page[limit]=3", nil)
@@ -298,7 +317,7 @@ func TestPaginationLimitExceeded(t *testing.T) {
 	svc := newTestService(t, root)
 	e := echo.New()
 	e.HTTPErrorHandler = jsonAPIError
-	RegisterRoutes(e, svc)
+	RegisterRoutes(e, svc, HandlerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public?page[limit]=501", nil)
 	rec := httptest.NewRecorder()
@@ -316,7 +335,7 @@ func TestSorting(t *testing.T) {
 	svc := newTestService(t, root)
 	e := echo.New()
 	e.HTTPErrorHandler = jsonAPIError
-	RegisterRoutes(e, svc)
+	RegisterRoutes(e, svc, HandlerOptions{})
 
 	// Test ascending sort (default)
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public?sort=name", nil)
@@ -351,7 +370,7 @@ func TestSortingInvalidField(t *testing.T) {
 	svc := newTestService(t, root)
 	e := echo.New()
 	e.HTTPErrorHandler = jsonAPIError
-	RegisterRoutes(e, svc)
+	RegisterRoutes(e, svc, HandlerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public?sort=invalid_field", nil)
 	rec := httptest.NewRecorder()
@@ -366,7 +385,7 @@ func TestSortingMultiFieldRejected(t *testing.T) {
 	svc := newTestService(t, root)
 	e := echo.New()
 	e.HTTPErrorHandler = jsonAPIError
-	RegisterRoutes(e, svc)
+	RegisterRoutes(e, svc, HandlerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public?sort=name,size_bytes", nil)
 	rec := httptest.NewRecorder()
@@ -384,7 +403,7 @@ func TestDownloadAttachment(t *testing.T) {
 	svc := newTestService(t, root)
 	e := echo.New()
 	e.HTTPErrorHandler = jsonAPIError
-	RegisterRoutes(e, svc)
+	RegisterRoutes(e, svc, HandlerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/download.txt?download=1", nil)
 	rec := httptest.NewRecorder()
@@ -401,12 +420,12 @@ func TestRootSlashSpecialCase(t *testing.T) {
 	require.NoError(t, os.WriteFile(filepath.Join(root, "file.txt"), []byte("content"), 0o600))
 
 	// Create service with virtual "/" (root slash)
-	svc, err := NewService([]Root{{Virtual: "/", Source: root}})
+	svc, err := NewService([]Root{{Virtual: "/", Source: root}}, Options{})
 	require.NoError(t, err)
 
 	e := echo.New()
 	e.HTTPErrorHandler = jsonAPIError
-	RegisterRoutes(e, svc)
+	RegisterRoutes(e, svc, HandlerOptions{})
 
 	// GET /api/v1/files should return contents of root directly
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/files", nil)
@@ -431,12 +450,12 @@ func TestListRootsWithMultipleRoots(t *testing.T) {
 	svc, err := NewService([]Root{
 		{Virtual: "/public", Source: root1},
 		{Virtual: "/private", Source: root2},
-	})
+	}, Options{})
 	require.NoError(t, err)
 
 	e := echo.New()
 	e.HTTPErrorHandler = jsonAPIError
-	RegisterRoutes(e, svc)
+	RegisterRoutes(e, svc, HandlerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/files", nil)
 	rec := httptest.NewRecorder()
@@ -455,6 +474,2610 @@ func TestListRootsWithMultipleRoots(t *testing.T) {
 	assert.Contains(t, names, "private")
 }
 
+func TestCanonicalCaseRedirect(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "Docs"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "Docs", "readme.txt"), []byte("read me"), 0o600))
+
+	svc := newTestService(t, root)
+
+	t.Run("enabled", func(t *testing.T) {
+		e := echo.New()
+		e.HTTPErrorHandler = jsonAPIError
+		RegisterRoutes(e, svc, HandlerOptions{CanonicalRedirect: true})
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/docs/ReadMe.TXT?download=1", nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusPermanentRedirect, rec.Code)
+		assert.Equal(t, "/api/v1/files/public/Docs/readme.txt?download=1", rec.Header().Get(echo.HeaderLocation))
+
+		req = httptest.NewRequest(http.MethodGet, "/api/v1/files/public/Docs/readme.txt", nil)
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "read me", rec.Body.String())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		e := echo.New()
+		e.HTTPErrorHandler = jsonAPIError
+		RegisterRoutes(e, svc, HandlerOptions{})
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/docs/ReadMe.TXT", nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		assert.NotEqual(t, http.StatusPermanentRedirect, rec.Code)
+	})
+}
+
+func TestListingResolveLinksFull(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "data.bin"), []byte("0123456789"), 0o600))
+	require.NoError(t, os.Symlink("data.bin", filepath.Join(root, "latest")))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public?resolve_links=full", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp Response
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Len(t, resp.Data, 2)
+
+	link := resp.Data[1].Attributes
+	assert.Equal(t, "latest", link.Name)
+	assert.Equal(t, "symlink", link.ResourceKind)
+	assert.Nil(t, link.SizeBytes)
+	require.NotNil(t, link.Target)
+	assert.Equal(t, "data.bin", link.Target.Name)
+	assert.Equal(t, "file", link.Target.ResourceKind)
+	require.NotNil(t, link.Target.SizeBytes)
+	assert.Equal(t, int64(10), *link.Target.SizeBytes)
+	assert.Nil(t, resp.Data[0].Attributes.Target, "regular files carry no target")
+	assert.Contains(t, resp.Links.Self, "resolve_links=full")
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/files/public", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), `"target"`)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/files/public?resolve_links=partial", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestETagConsistentBetweenListingAndDownload(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "report.txt"), []byte("quarterly report"), 0o600))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	listReq := httptest.NewRequest(http.MethodGet, "/api/v1/files/public", nil)
+	listRec := httptest.NewRecorder()
+	e.ServeHTTP(listRec, listReq)
+	require.Equal(t, http.StatusOK, listRec.Code)
+
+	var resp Response
+	require.NoError(t, json.NewDecoder(listRec.Body).Decode(&resp))
+	require.Len(t, resp.Data, 1)
+	listed := resp.Data[0].Attributes.ETag
+	require.NotEmpty(t, listed)
+	assert.True(t, strings.HasPrefix(listed, `W/"`), "etag must be weak")
+
+	for _, query := range []string{"", "?download=1"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/report.txt"+query, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, listed, rec.Header().Get("ETag"))
+
+		req = httptest.NewRequest(http.MethodGet, "/api/v1/files/public/report.txt"+query, nil)
+		req.Header.Set("If-None-Match", listed)
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+		assert.Empty(t, rec.Body.Bytes())
+	}
+}
+
+func TestStrictPathsRejectEncodedSeparators(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "docs"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "docs", "a.txt"), []byte("a"), 0o600))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{StrictPaths: true})
+
+	tests := []struct {
+		name   string
+		target string
+		want   int
+	}{
+		{"backslash traversal", "/api/v1/files/public/docs/..\\a.txt", http.StatusBadRequest},
+		{"encoded backslash", "/api/v1/files/public/docs%5ca.txt", http.StatusBadRequest},
+		{"encoded dots", "/api/v1/files/public/docs/%2e%2e/docs", http.StatusBadRequest},
+		{"encoded slash", "/api/v1/files/public/docs%2Fa.txt", http.StatusBadRequest},
+		{"plain path", "/api/v1/files/public/docs/a.txt", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
+
+func TestListingFilterByMode(t *testing.T) {
+	root := t.TempDir()
+	modes := map[string]os.FileMode{"open.txt": 0o666, "private.txt": 0o600, "shared.sh": 0o777}
+	for name, mode := range modes {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.WriteFile(path, []byte(name), 0o600))
+		require.NoError(t, os.Chmod(path, mode)) // #nosec G302 -- world-writable fixtures are the point
+	}
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "exact by default", query: "filter[mode]=0600", want: []string{"private.txt"}},
+		{name: "any bit", query: "filter[mode]=0002&mode_match=any", want: []string{"open.txt", "shared.sh"}},
+		{name: "all bits", query: "filter[mode]=0111&mode_match=all", want: []string{"shared.sh"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public?"+tt.query+"&page[limit]=1", nil)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			var resp Response
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+			require.NotNil(t, resp.Meta)
+			assert.Equal(t, len(tt.want), resp.Meta.TotalCount, "total_count reflects the filtered set")
+			require.Len(t, resp.Data, 1)
+			assert.Equal(t, tt.want[0], resp.Data[0].Attributes.Name)
+			assert.Contains(t, resp.Links.Self, "filter[mode]=")
+		})
+	}
+
+	for _, query := range []string{"filter[mode]=9", "filter[mode]=0644&mode_match=some", "mode_match=any"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public?"+query, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+func TestListingFilterByAttributes(t *testing.T) {
+	root := t.TempDir()
+	png := []byte("\x89PNG\r\n\x1a\n")
+	require.NoError(t, os.WriteFile(filepath.Join(root, "app.log"), []byte(strings.Repeat("l", 100)), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "old.log"), []byte("o"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "photo.png"), png, 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "logs"), 0o750))
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(root, "old.log"), old, old))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	since := url.QueryEscape(time.Now().Add(-24 * time.Hour).Format(time.RFC3339))
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "kind", query: "filter[resource_kind]=folder", want: []string{"logs"}},
+		{name: "mime wildcard", query: "filter[mime_type]=image/*", want: []string{"photo.png"}},
+		{name: "mime exact", query: "filter[mime_type]=text/plain", want: []string{"app.log", "old.log"}},
+		{name: "name glob", query: "filter[name]=*.log", want: []string{"app.log", "old.log"}},
+		{name: "name with fields", query: "filter[name]=log*&fields[files]=name", want: []string{"logs"}},
+		{name: "min size", query: "filter[min_size]=50&filter[resource_kind]=file", want: []string{"app.log"}},
+		{name: "modified after", query: "filter[name]=*.log&filter[modified_after]=" + since, want: []string{"app.log"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public?"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+			var resp Response
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+			names := []string{}
+			for _, r := range resp.Data {
+				names = append(names, r.Attributes.Name)
+			}
+			assert.Equal(t, tt.want, names)
+			assert.Equal(t, len(tt.want), resp.Meta.TotalCount)
+			assert.Contains(t, resp.Links.Self, "filter[")
+		})
+	}
+
+	for _, query := range []string{
+		"filter[resource_kind]=dir", "filter[mime_type]=image", "filter[name]=[",
+		"filter[min_size]=-1", "filter[modified_after]=yesterday",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public?"+query, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+func TestListingCollation(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"file10.txt", "file2.txt", "File1.txt", "zebra", "äpfel", "file02.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(name), 0o600))
+	}
+	svc := newTestService(t, root)
+
+	list := func(opts HandlerOptions, query string) ([]string, *PaginationLinks) {
+		e := echo.New()
+		e.HTTPErrorHandler = jsonAPIError
+		RegisterRoutes(e, svc, opts)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public?"+query, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var resp Response
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+		names := []string{}
+		for _, r := range resp.Data {
+			names = append(names, r.Attributes.Name)
+		}
+		return names, resp.Links
+	}
+
+	names, _ := list(HandlerOptions{}, "")
+	assert.Equal(t, []string{"File1.txt", "file02.txt", "file10.txt", "file2.txt", "zebra", "äpfel"}, names)
+
+	names, links := list(HandlerOptions{}, "collation=natural")
+	assert.Equal(t, []string{"File1.txt", "file02.txt", "file2.txt", "file10.txt", "zebra", "äpfel"}, names)
+	assert.Contains(t, links.Self, "&collation=natural")
+
+	names, _ = list(HandlerOptions{}, "collation=natural&sort=-name")
+	assert.Equal(t, []string{"äpfel", "zebra", "file10.txt", "file2.txt", "file02.txt", "File1.txt"}, names)
+
+	names, _ = list(HandlerOptions{Collation: "locale", CollationLocale: language.German}, "")
+	assert.Equal(t, []string{"äpfel", "file02.txt", "File1.txt", "file10.txt", "file2.txt", "zebra"}, names)
+
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public?collation=numeric", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestGeneratedAtMeta(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o600))
+
+	svc := newTestService(t, root)
+
+	for _, enabled := range []bool{true, false} {
+		e := echo.New()
+		e.HTTPErrorHandler = jsonAPIError
+		RegisterRoutes(e, svc, HandlerOptions{GeneratedAt: enabled})
+
+		for _, target := range []string{"/api/v1/files", "/api/v1/files/public"} {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			var resp Response
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+			require.NotNil(t, resp.Meta)
+			if !enabled {
+				assert.Nil(t, resp.Meta.GeneratedAt, target)
+				continue
+			}
+			require.NotNil(t, resp.Meta.GeneratedAt, target)
+			_, err := time.Parse(time.RFC3339, *resp.Meta.GeneratedAt)
+			assert.NoError(t, err, target)
+		}
+	}
+}
+
+func TestEmptyFileRange(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "empty.txt"), nil, 0o600))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{RejectEmptyRanges: true})
+
+	lenient := echo.New()
+	lenient.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(lenient, svc, HandlerOptions{})
+
+	tests := []struct {
+		name         string
+		target       string
+		rangeHeader  string
+		wantStatus   int
+		contentRange string
+	}{
+		{name: "no range", target: "/api/v1/files/public/empty.txt", wantStatus: http.StatusOK},
+		{
+			name:         "first byte",
+			target:       "/api/v1/files/public/empty.txt",
+			rangeHeader:  "bytes=0-0",
+			wantStatus:   http.StatusRequestedRangeNotSatisfiable,
+			contentRange: "bytes */0",
+		},
+		{
+			name:         "open range",
+			target:       "/api/v1/files/public/empty.txt",
+			rangeHeader:  "bytes=0-",
+			wantStatus:   http.StatusRequestedRangeNotSatisfiable,
+			contentRange: "bytes */0",
+		},
+		{
+			name:         "attachment",
+			target:       "/api/v1/files/public/empty.txt?download=1",
+			rangeHeader:  "bytes=0-0",
+			wantStatus:   http.StatusRequestedRangeNotSatisfiable,
+			contentRange: "bytes */0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.rangeHeader != "" {
+				req.Header.Set("Range", tt.rangeHeader)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.contentRange, rec.Header().Get("Content-Range"))
+			if tt.wantStatus == http.StatusOK {
+				assert.Empty(t, rec.Body.Bytes())
+			}
+
+			rec = httptest.NewRecorder()
+			lenient.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code, "ranges are ignored by default")
+			assert.Empty(t, rec.Body.Bytes())
+		})
+	}
+}
+
+func TestMetadataFollowSymlink(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "data.bin"), []byte("0123456789"), 0o600))
+	require.NoError(t, os.Symlink("data.bin", filepath.Join(root, "latest")))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	fetch := func(t *testing.T, query string) ResourceResponse {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/latest?metadata=1"+query, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, api.ContentType, rec.Header().Get(echo.HeaderContentType))
+		var resp ResourceResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+		return resp
+	}
+
+	for _, query := range []string{"", "&follow=true"} {
+		resp := fetch(t, query)
+		attrs := resp.Data.Attributes
+		assert.Equal(t, "/public/latest", resp.Data.ID)
+		assert.Equal(t, "file", attrs.ResourceKind, query)
+		require.NotNil(t, attrs.SizeBytes)
+		assert.Equal(t, int64(10), *attrs.SizeBytes, "target size")
+	}
+
+	resp := fetch(t, "&follow=false")
+	attrs := resp.Data.Attributes
+	assert.Equal(t, "latest", attrs.Name)
+	assert.Equal(t, "symlink", attrs.ResourceKind)
+	assert.Equal(t, "inode/symlink", attrs.MimeType)
+	require.NotNil(t, attrs.SizeBytes)
+	assert.Equal(t, int64(len("data.bin")), *attrs.SizeBytes, "link size is the length of its target path")
+
+	linkInfo, err := os.Lstat(filepath.Join(root, "latest"))
+	require.NoError(t, err)
+	require.NotNil(t, attrs.ModifiedAt)
+	assert.Equal(t, linkInfo.ModTime().UTC().Format(time.RFC3339Nano), *attrs.ModifiedAt)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/latest?metadata=1&follow=maybe", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestSizeAsString(t *testing.T) {
+	huge := int64(1<<53 + 1)
+	data, err := json.Marshal(Attributes{Name: "huge.img", SizeBytes: &huge, sizeAsString: true})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"size_bytes":"9007199254740993"`)
+
+	data, err = json.Marshal(Attributes{Name: "huge.img", SizeBytes: &huge})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"size_bytes":9007199254740993`)
+
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "small.txt"), []byte("0123456789"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "large.txt"), bytes.Repeat([]byte("x"), 100), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "dir"), 0o750))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{SizeAsString: true})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public?sort=-size_bytes", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Data []struct {
+			Attributes map[string]any `json:"attributes"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Len(t, resp.Data, 3)
+	assert.Equal(t, "100", resp.Data[0].Attributes["size_bytes"], "sorted numerically, not as strings")
+	assert.Equal(t, "10", resp.Data[1].Attributes["size_bytes"])
+	assert.Nil(t, resp.Data[2].Attributes["size_bytes"], "folders have no size")
+
+	require.NoError(t, os.Symlink("small.txt", filepath.Join(root, "link.txt")))
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/files/public/link.txt?metadata=1", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var single struct {
+		Data struct {
+			Attributes map[string]any `json:"attributes"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&single))
+	assert.Equal(t, "10", single.Data.Attributes["size_bytes"], "followed symlinks keep size_as_string")
+}
+
+func TestHideOwnership(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o600))
+
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root}}, Options{HideOwnership: true})
+	require.NoError(t, err)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp Response
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Len(t, resp.Data, 1)
+	attrs := resp.Data[0].Attributes
+	assert.Empty(t, attrs.User)
+	assert.Empty(t, attrs.Group)
+	assert.Zero(t, attrs.UserID)
+	assert.Zero(t, attrs.GroupID)
+
+	for _, field := range []string{"user", "-group", "user_id", "group_id"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public?sort="+field, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, field)
+	}
+}
+
+func TestListingETagCoversSubtree(t *testing.T) {
+	root := t.TempDir()
+	deep := filepath.Join(root, "a", "b", "c")
+	require.NoError(t, os.MkdirAll(deep, 0o750))
+	deepFile := filepath.Join(deep, "data.txt")
+	require.NoError(t, os.WriteFile(deepFile, []byte("v1"), 0o600))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	list := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := list("")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("ETag"), "plain listings skip the subtree walk")
+	assert.Equal(t, "Accept", rec.Header().Get("Vary"))
+
+	rec = list(`W/"unknown"`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	rec = list(etag)
+	assert.Equal(t, http.StatusNotModified, rec.Code, "unchanged subtree")
+	assert.Empty(t, rec.Body.Bytes())
+
+	require.NoError(t, os.WriteFile(deepFile, []byte("version 2"), 0o600))
+
+	rec = list(etag)
+	require.Equal(t, http.StatusOK, rec.Code, "deep modification invalidates the listing")
+	assert.NotEqual(t, etag, rec.Header().Get("ETag"))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public?page[limit]=1", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	pageRec := httptest.NewRecorder()
+	e.ServeHTTP(pageRec, req)
+	assert.Equal(t, http.StatusOK, pageRec.Code, "other pages carry their own ETag")
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/files/public", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	req.Header.Set(echo.HeaderAccept, MIMENDJSON)
+	streamRec := httptest.NewRecorder()
+	e.ServeHTTP(streamRec, req)
+	assert.Equal(t, http.StatusOK, streamRec.Code, "the NDJSON stream carries its own ETag")
+	assert.NotEqual(t, rec.Header().Get("ETag"), streamRec.Header().Get("ETag"))
+}
+
+func TestRangeRequestThroughSymlink(t *testing.T) {
+	root := t.TempDir()
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "large.bin"), content, 0o600))
+	require.NoError(t, os.Symlink("large.bin", filepath.Join(root, "current")))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	fetch := func(name string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/"+name, nil)
+		req.Header.Set("Range", "bytes=50000-50009")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := fetch("current")
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, content[50000:50010], rec.Body.Bytes())
+	assert.Equal(t, fmt.Sprintf("bytes 50000-50009/%d", len(content)), rec.Header().Get("Content-Range"))
+
+	direct := fetch("large.bin")
+	require.Equal(t, http.StatusPartialContent, direct.Code)
+	assert.Equal(t, direct.Header().Get("ETag"), rec.Header().Get("ETag"), "ETag derives from the target")
+	assert.Equal(t, direct.Header().Get("Content-Range"), rec.Header().Get("Content-Range"))
+}
+
+func TestDefaultLimitPerRoot(t *testing.T) {
+	logs := t.TempDir()
+	conf := t.TempDir()
+	for i := range 5 {
+		name := fmt.Sprintf("file-%d.txt", i)
+		require.NoError(t, os.WriteFile(filepath.Join(logs, name), []byte(name), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(conf, name), []byte(name), 0o600))
+	}
+
+	svc, err := NewService([]Root{
+		{Virtual: "/logs", Source: logs, DefaultLimit: 2},
+		{Virtual: "/conf", Source: conf},
+	}, Options{})
+	require.NoError(t, err)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	tests := []struct {
+		target    string
+		wantLimit int
+		wantLen   int
+	}{
+		{target: "/api/v1/files/logs", wantLimit: 2, wantLen: 2},
+		{target: "/api/v1/files/conf", wantLimit: defaultLimit, wantLen: 5},
+		{target: "/api/v1/files/logs?page[limit]=4", wantLimit: 4, wantLen: 4},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code, tt.target)
+
+		var resp Response
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+		assert.Equal(t, tt.wantLimit, resp.Meta.Limit, tt.target)
+		assert.Len(t, resp.Data, tt.wantLen, tt.target)
+		assert.Equal(t, 5, resp.Meta.TotalCount, tt.target)
+	}
+}
+
+func TestRejectDuplicateParams(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "b.txt"), []byte("bb"), 0o600))
+
+	svc := newTestService(t, root)
+	const target = "/api/v1/files/public?sort=-name&sort=name"
+
+	strict := echo.New()
+	strict.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(strict, svc, HandlerOptions{RejectDuplicateParams: true})
+
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	rec := httptest.NewRecorder()
+	strict.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "duplicate query parameter: sort")
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/files/public?mime_detection=content&mime_detection=extension", nil)
+	rec = httptest.NewRecorder()
+	strict.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "duplicate query parameter: mime_detection")
+
+	lenient := echo.New()
+	lenient.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(lenient, svc, HandlerOptions{})
+
+	req = httptest.NewRequest(http.MethodGet, target, nil)
+	rec = httptest.NewRecorder()
+	lenient.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp Response
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Len(t, resp.Data, 2)
+	assert.Equal(t, "b.txt", resp.Data[0].Attributes.Name, "first value wins")
+}
+
+func TestServerTimingHeader(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o600))
+
+	svc := newTestService(t, root)
+
+	for _, enabled := range []bool{true, false} {
+		e := echo.New()
+		e.HTTPErrorHandler = jsonAPIError
+		RegisterRoutes(e, svc, HandlerOptions{ServerTiming: enabled})
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public", nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		header := rec.Header().Get("Server-Timing")
+		if !enabled {
+			assert.Empty(t, header)
+			continue
+		}
+		for _, metric := range []string{"readdir;dur=", "describe;dur=", "serialize;dur="} {
+			assert.Contains(t, header, metric)
+		}
+
+		var resp Response
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+		assert.Len(t, resp.Data, 1)
+	}
+}
+
+func TestCaseInsensitiveMatchReportsOnDiskName(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "readme.txt"), []byte("read me"), 0o600))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{CaseInsensitive: true})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/README.TXT?download=1", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get(echo.HeaderContentDisposition), `filename="readme.txt"`)
+	assert.Equal(t, "read me", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/files/public/README.TXT?metadata=1", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp ResourceResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, "readme.txt", resp.Data.Attributes.Name)
+	assert.Equal(t, "/public/readme.txt", resp.Data.ID)
+}
+
+func TestSparseFieldsets(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "dir"), 0o750))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	tests := []struct {
+		name     string
+		fields   string
+		wantKeys []string
+	}{
+		{name: "names and kinds", fields: "name,resource_kind", wantKeys: []string{"name", "resource_kind"}},
+		{name: "needs stat", fields: "name,size_bytes", wantKeys: []string{"name", "size_bytes"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public?fields[files]="+tt.fields, nil)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			var resp struct {
+				Data []struct {
+					Attributes map[string]any `json:"attributes"`
+				} `json:"data"`
+				Links PaginationLinks `json:"links"`
+			}
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+			require.Len(t, resp.Data, 2)
+			for _, item := range resp.Data {
+				keys := make([]string, 0, len(item.Attributes))
+				for key := range item.Attributes {
+					keys = append(keys, key)
+				}
+				assert.ElementsMatch(t, tt.wantKeys, keys)
+			}
+			assert.Equal(t, "a.txt", resp.Data[0].Attributes["name"])
+			assert.Equal(t, "dir", resp.Data[1].Attributes["name"])
+			assert.Contains(t, resp.Links.Self, "fields[files]="+tt.fields)
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public?fields[files]=name,owner", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestFIFOIsClassifiedAndNotOpened(t *testing.T) {
+	root := t.TempDir()
+	// Opening a FIFO without a writer blocks, so sniffing it would hang the test.
+	require.NoError(t, syscall.Mkfifo(filepath.Join(root, "pipe"), 0o600))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp Response
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Len(t, resp.Data, 1)
+	assert.Equal(t, "fifo", resp.Data[0].Attributes.ResourceKind)
+	assert.Equal(t, "inode/fifo", resp.Data[0].Attributes.MimeType)
+	assert.Nil(t, resp.Data[0].Attributes.SizeBytes)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/files/public/pipe", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestMaxOpenFilesSerializesDownloads(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o600))
+
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root}}, Options{MaxOpenFiles: 1})
+	require.NoError(t, err)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	// Occupy the only slot, as a concurrent download would.
+	release, err := svc.openFiles.acquire(t.Context())
+	require.NoError(t, err)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/a.txt", nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		done <- rec
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("download must wait for a free slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	canceled, cancel := context.WithCancel(t.Context())
+	cancel()
+	assert.Empty(t, svc.mimeFor(canceled, kindFile, filepath.Join(root, "a.txt")),
+		"sniffing stops waiting for a slot once the request is canceled")
+
+	release()
+	select {
+	case rec := <-done:
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "a", rec.Body.String())
+	case <-time.After(5 * time.Second):
+		t.Fatal("download did not resume after the slot was released")
+	}
+}
+
+func TestSignedDownloadURL(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file.txt"), []byte("shared"), 0o600))
+
+	const secret = "0123456789abcdef0123456789abcdef"
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{SigningSecret: secret})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/files/public/file.txt?sign=1&ttl=1h", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var resp SignedURLResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	signed := resp.Data.Attributes.URL
+	require.Contains(t, signed, "signature=")
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec = get(signed)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "shared", rec.Body.String())
+
+	tampered := strings.Replace(signed, "/public/file.txt", "/public/other.txt", 1)
+	assert.Equal(t, http.StatusForbidden, get(tampered).Code, "signature is bound to the path")
+
+	withArchive := signed + "&archive=zip"
+	assert.Equal(t, http.StatusBadRequest, get(withArchive).Code, "the query is not signed")
+
+	post := func(target string) int {
+		req := httptest.NewRequest(http.MethodPost, target, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusBadRequest, post("/api/v1/files/public?sign=1&ttl=1h"), "folders cannot be signed")
+	assert.Equal(t, http.StatusBadRequest, post("/api/v1/files/public/file.txt?sign=1&ttl=25h"),
+		"ttl is bounded by DefaultSigningMaxTTL")
+
+	bounded := echo.New()
+	bounded.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(bounded, svc, HandlerOptions{SigningSecret: secret, SigningMaxTTL: time.Minute})
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/files/public/file.txt?sign=1&ttl=1h", nil)
+	rec = httptest.NewRecorder()
+	bounded.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	expires := time.Now().Add(-time.Minute).Unix()
+	expired := fmt.Sprintf("/api/v1/files/public/file.txt?expires=%d&signature=%s",
+		expires, signPath(secret, "/public/file.txt", expires))
+	assert.Equal(t, http.StatusForbidden, get(expired).Code)
+
+	disabled := echo.New()
+	disabled.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(disabled, svc, HandlerOptions{})
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/files/public/file.txt?sign=1&ttl=1h", nil)
+	rec = httptest.NewRecorder()
+	disabled.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestListingIncludeSelf(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "shared")
+	require.NoError(t, os.Mkdir(dir, 0o750))
+	require.NoError(t, os.Chmod(dir, 0o751))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o600))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/shared?include_self=1", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp Response
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.NotNil(t, resp.Meta.Resource)
+	assert.Equal(t, "/public/shared", resp.Meta.Resource.ID)
+	assert.Equal(t, "folder", resp.Meta.Resource.Attributes.ResourceKind)
+	assert.Equal(t, "0751", resp.Meta.Resource.Attributes.PermissionMode)
+	assert.Len(t, resp.Data, 1)
+	assert.Contains(t, resp.Links.Self, "include_self=1")
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/files/public/shared", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	resp = Response{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Nil(t, resp.Meta.Resource)
+}
+
+func TestFolderFingerprint(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "a", "b")
+	require.NoError(t, os.MkdirAll(nested, 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(nested, "one.txt"), []byte("one"), 0o600))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	fingerprint := func() string {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public?fingerprint=1", nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var resp FingerprintResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+		assert.Equal(t, "fingerprints", resp.Data.Type)
+		assert.Equal(t, "/public", resp.Data.ID)
+		require.NotEmpty(t, resp.Data.Attributes.Fingerprint)
+		return resp.Data.Attributes.Fingerprint
+	}
+
+	first := fingerprint()
+	assert.Equal(t, first, fingerprint(), "stable while nothing changes")
+
+	require.NoError(t, os.WriteFile(filepath.Join(nested, "two.txt"), []byte("two"), 0o600))
+	assert.NotEqual(t, first, fingerprint(), "a nested file changes the fingerprint")
+
+	require.NoError(t, os.WriteFile(filepath.Join(nested, ".cache"), []byte("hidden"), 0o600))
+	third := fingerprint()
+	require.NoError(t, os.WriteFile(filepath.Join(nested, ".cache"), []byte("changed"), 0o600))
+	assert.Equal(t, third, fingerprint(), "hidden entries are left out")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/a/b/one.txt?fingerprint=1", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// With the listing cache, fingerprints are reused until the subtree is
+	// reported as changed.
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root}}, Options{ListingCacheTTL: time.Minute})
+	require.NoError(t, err)
+	e = echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+	cached := fingerprint()
+	require.NoError(t, os.WriteFile(filepath.Join(nested, "one.txt"), []byte("changed"), 0o600))
+	assert.Equal(t, cached, fingerprint(), "the cached fingerprint is reused")
+	svc.InvalidateListing("/public/a/b/one.txt")
+	assert.NotEqual(t, cached, fingerprint(), "changes below a folder invalidate its fingerprint")
+}
+
+func TestSiblingResolution(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "page.md"), []byte("# Page"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "page.html"), []byte("<h1>Page</h1>"), 0o600))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{SiblingExtensions: []string{"html", "md"}})
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		wantBody string
+	}{
+		{name: "accept html", query: "?accept=html", wantCode: http.StatusOK, wantBody: "<h1>Page</h1>"},
+		{name: "accept md", query: "?accept=md", wantCode: http.StatusOK, wantBody: "# Page"},
+		{name: "preference order", query: "", wantCode: http.StatusOK, wantBody: "<h1>Page</h1>"},
+		{name: "unsupported accept", query: "?accept=pdf", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/page"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.wantCode, rec.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestMaxPathDepth(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "a", "b", "c"), 0o750))
+
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root}}, Options{MaxPathDepth: 2})
+	require.NoError(t, err)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+	}{
+		{name: "within depth", path: "/api/v1/files/public/a/b", wantCode: http.StatusOK},
+		{name: "exceeds depth", path: "/api/v1/files/public/a/b/c", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantCode, rec.Code)
+		})
+	}
+}
+
+func TestStreamedListingMatchesBuffered(t *testing.T) {
+	root := t.TempDir()
+	for i := range 5 {
+		name := fmt.Sprintf("file-%d.txt", i)
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(strings.Repeat("x", i)), 0o600))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(root, "docs & notes"), 0o750))
+
+	svc := newTestService(t, root)
+	list := func(opts HandlerOptions) string {
+		e := echo.New()
+		e.HTTPErrorHandler = jsonAPIError
+		RegisterRoutes(e, svc, opts)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public?page[limit]=3&sort=-name&include_self=1", nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, api.ContentType, rec.Header().Get(echo.HeaderContentType))
+		return rec.Body.String()
+	}
+
+	// The first listing sniffs MIME types, which may update access times.
+	list(HandlerOptions{})
+	buffered := list(HandlerOptions{})
+	streamed := list(HandlerOptions{StreamListings: true})
+	assert.Equal(t, buffered, streamed)
+}
+
+func TestDebugMemoryStats(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o600))
+	svc := newTestService(t, root)
+
+	tests := []struct {
+		name       string
+		debug      bool
+		query      string
+		wantCode   int
+		wantMemory bool
+	}{
+		{name: "flag and param", debug: true, query: "?debug=mem", wantCode: http.StatusOK, wantMemory: true},
+		{name: "flag only", debug: true, query: "", wantCode: http.StatusOK},
+		{name: "param only", debug: false, query: "?debug=mem", wantCode: http.StatusOK},
+		{name: "unknown value", debug: true, query: "?debug=cpu", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.HTTPErrorHandler = jsonAPIError
+			RegisterRoutes(e, svc, HandlerOptions{Debug: tt.debug})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			require.Equal(t, tt.wantCode, rec.Code)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Meta map[string]json.RawMessage `json:"meta"`
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			_, hasMemory := resp.Meta["memory"]
+			assert.Equal(t, tt.wantMemory, hasMemory)
+			if tt.wantMemory {
+				var stats MemoryStats
+				require.NoError(t, json.Unmarshal(resp.Meta["memory"], &stats))
+				assert.Positive(t, stats.TotalAllocBytes)
+			}
+		})
+	}
+}
+
+func TestPatchMovesResource(t *testing.T) {
+	public := t.TempDir()
+	archive := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(public, "a.txt"), []byte("a"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(public, "b.txt"), []byte("b"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(public, "docs"), 0o750))
+
+	svc, err := NewService([]Root{
+		{Virtual: "/public", Source: public},
+		{Virtual: "/archive", Source: archive},
+	}, Options{})
+	require.NoError(t, err)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{AnonymousWrites: true})
+
+	patch := func(target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, api.ContentType)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := patch("/api/v1/files/public/a.txt",
+		`{"data":{"type":"files","id":"/public/a.txt","attributes":{"name":"renamed.txt"}}}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp ResourceResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, "/public/renamed.txt", resp.Data.ID)
+	assert.FileExists(t, filepath.Join(public, "renamed.txt"))
+	assert.NoFileExists(t, filepath.Join(public, "a.txt"))
+
+	rec = patch("/api/v1/files/public/renamed.txt",
+		`{"data":{"type":"files","attributes":{"path":"/archive/moved.txt"}}}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	content, err := os.ReadFile(filepath.Join(archive, "moved.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(content))
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		status int
+	}{
+		{"destination exists", "/api/v1/files/public/b.txt",
+			`{"data":{"type":"files","attributes":{"path":"/archive/moved.txt"}}}`, http.StatusConflict},
+		{"root folder", "/api/v1/files/public",
+			`{"data":{"type":"files","attributes":{"name":"other"}}}`, http.StatusForbidden},
+		{"folder into itself", "/api/v1/files/public/docs",
+			`{"data":{"type":"files","attributes":{"path":"/public/docs/sub"}}}`, http.StatusBadRequest},
+		{"invalid name", "/api/v1/files/public/b.txt",
+			`{"data":{"type":"files","attributes":{"name":"../b.txt"}}}`, http.StatusBadRequest},
+		{"unknown root", "/api/v1/files/public/b.txt",
+			`{"data":{"type":"files","attributes":{"path":"/missing/b.txt"}}}`, http.StatusBadRequest},
+		{"id mismatch", "/api/v1/files/public/b.txt",
+			`{"data":{"type":"files","id":"/public/c.txt","attributes":{"name":"c.txt"}}}`, http.StatusConflict},
+		{"missing source", "/api/v1/files/public/missing.txt",
+			`{"data":{"type":"files","attributes":{"name":"c.txt"}}}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.status, patch(tt.target, tt.body).Code)
+		})
+	}
+	assert.FileExists(t, filepath.Join(public, "b.txt"))
+}
+
+func TestAnonymousWrites(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file.txt"), []byte("data"), 0o600))
+	svc := newTestService(t, root)
+
+	patch := func(opts HandlerOptions, user string) int {
+		e := echo.New()
+		e.HTTPErrorHandler = jsonAPIError
+		e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				if user != "" {
+					ctx := auth.ContextWithIdentity(c.Request().Context(), auth.Identity{Subject: user})
+					c.SetRequest(c.Request().WithContext(ctx))
+				}
+				return next(c)
+			}
+		})
+		RegisterRoutes(e, svc, opts)
+		body := `{"data":{"type":"files","attributes":{"permission_mode":"0640"}}}`
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/files/public/file.txt", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	mode := func() os.FileMode {
+		info, err := os.Stat(filepath.Join(root, "file.txt"))
+		require.NoError(t, err)
+		return info.Mode().Perm()
+	}
+
+	assert.Equal(t, http.StatusForbidden, patch(HandlerOptions{}, ""), "anonymous writes are off by default")
+	assert.Equal(t, os.FileMode(0o600), mode())
+	assert.Equal(t, http.StatusOK, patch(HandlerOptions{}, "alice"))
+	assert.Equal(t, os.FileMode(0o640), mode())
+	require.NoError(t, os.Chmod(filepath.Join(root, "file.txt"), 0o600))
+	assert.Equal(t, http.StatusOK, patch(HandlerOptions{AnonymousWrites: true}, ""))
+	assert.Equal(t, os.FileMode(0o640), mode())
+}
+
+func TestReadOnlyRoot(t *testing.T) {
+	public := t.TempDir()
+	archive := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(public, "a.txt"), []byte("a"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(archive, "old.txt"), []byte("old"), 0o600))
+
+	svc, err := NewService([]Root{
+		{Virtual: "/public", Source: public},
+		{Virtual: "/archive", Source: archive, ReadOnly: true},
+	}, Options{})
+	require.NoError(t, err)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{AnonymousWrites: true})
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, api.ContentType)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+	}{
+		{"rename", "/api/v1/files/archive/old.txt", `{"data":{"type":"files","attributes":{"name":"new.txt"}}}`},
+		{"permission mode", "/api/v1/files/archive/old.txt",
+			`{"data":{"type":"files","attributes":{"permission_mode":"0644"}}}`},
+		{"move out", "/api/v1/files/archive/old.txt",
+			`{"data":{"type":"files","attributes":{"path":"/public/old.txt"}}}`},
+		{"move in", "/api/v1/files/public/a.txt",
+			`{"data":{"type":"files","attributes":{"path":"/archive/a.txt"}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(http.MethodPatch, tt.target, tt.body)
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.Contains(t, rec.Body.String(), "file root is read-only")
+		})
+	}
+	assert.FileExists(t, filepath.Join(archive, "old.txt"))
+	assert.FileExists(t, filepath.Join(public, "a.txt"))
+	assert.NoFileExists(t, filepath.Join(archive, "a.txt"))
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/v1/files/archive/old.txt", "").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodPatch, "/api/v1/files/public/a.txt",
+		`{"data":{"type":"files","attributes":{"name":"b.txt"}}}`).Code, "other roots stay writable")
+}
+
+func TestRootAccessRules(t *testing.T) {
+	public := t.TempDir()
+	staff := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(public, "a.txt"), []byte("a"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(staff, "b.txt"), []byte("b"), 0o600))
+
+	svc, err := NewService([]Root{
+		{Virtual: "/public", Source: public, Access: AccessPolicy{
+			Allow: []AccessRule{{Scopes: []string{ScopeRead}}, {Groups: []string{"staff"}}},
+			Deny:  []AccessRule{{Users: []string{"mallory"}, Scopes: []string{ScopeWrite}}},
+		}},
+		{Virtual: "/staff", Source: staff, Access: AccessPolicy{
+			Allow: []AccessRule{{Groups: []string{"staff"}}, {APIKeys: []string{"sha256:backup"}, Scopes: []string{ScopeRead}}},
+		}},
+	}, Options{})
+	require.NoError(t, err)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id := auth.Identity{Subject: c.Request().Header.Get("X-Test-User"), APIKey: c.Request().Header.Get("X-Test-Key")}
+			if group := c.Request().Header.Get("X-Test-Group"); group != "" {
+				id.Groups = []string{group}
+			}
+			if id.Subject != "" || id.APIKey != "" {
+				c.SetRequest(c.Request().WithContext(auth.ContextWithIdentity(c.Request().Context(), id)))
+			}
+			return next(c)
+		}
+	})
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	request := func(method, target, user, group, key string) *httptest.ResponseRecorder {
+		body := `{"data":{"type":"files","attributes":{"modified_at":"2024-01-02T03:04:05Z"}}}`
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("X-Test-User", user)
+		req.Header.Set("X-Test-Group", group)
+		req.Header.Set("X-Test-Key", key)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request(http.MethodGet, "/api/v1/files", "bob", "", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp Response
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Len(t, resp.Data, 1, "roots the client may not read are hidden")
+	assert.Equal(t, "/public", resp.Data[0].ID)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		user   string
+		group  string
+		key    string
+		status int
+	}{
+		{"anonymous", http.MethodGet, "/api/v1/files/public/a.txt", "", "", "", http.StatusNotFound},
+		{"read for everyone", http.MethodGet, "/api/v1/files/public/a.txt", "bob", "", "", http.StatusOK},
+		{"write needs group", http.MethodPatch, "/api/v1/files/public/a.txt", "bob", "", "", http.StatusForbidden},
+		{"group may write", http.MethodPatch, "/api/v1/files/public/a.txt", "alice", "staff", "", http.StatusOK},
+		{"deny overrides allow", http.MethodPatch, "/api/v1/files/public/a.txt", "mallory", "staff", "",
+			http.StatusForbidden},
+		{"root hidden", http.MethodGet, "/api/v1/files/staff/b.txt", "bob", "", "", http.StatusNotFound},
+		{"api key may read", http.MethodGet, "/api/v1/files/staff/b.txt", "", "", "sha256:backup", http.StatusOK},
+		{"api key may not write", http.MethodPatch, "/api/v1/files/staff/b.txt", "", "", "sha256:backup",
+			http.StatusForbidden},
+		{"search needs read", http.MethodGet, "/api/v1/files/staff/-/search?name=*", "bob", "", "",
+			http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := request(tt.method, tt.target, tt.user, tt.group, tt.key)
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+		})
+	}
+
+	for _, id := range []string{"/staff/b.txt", "staff/b.txt", "/public/../staff/b.txt"} {
+		t.Run("archive needs read "+id, func(t *testing.T) {
+			body := fmt.Sprintf(`{"data":[{"type":"files","id":%q}]}`, id)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/files:archive", strings.NewReader(body))
+			req.Header.Set("X-Test-User", "bob")
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestPatchPermissionMode(t *testing.T) {
+	root := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "outside.txt")
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file.txt"), []byte("data"), 0o600))
+	require.NoError(t, os.WriteFile(outside, []byte("secret"), 0o600))
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "escape")))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{AnonymousWrites: true})
+
+	patch := func(target, mode string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"data":{"type":"files","attributes":{"permission_mode":%q}}}`, mode)
+		req := httptest.NewRequest(http.MethodPatch, target, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := patch("/api/v1/files/public/file.txt", "0640")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp ResourceResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, "0640", resp.Data.Attributes.PermissionMode)
+	info, err := os.Stat(filepath.Join(root, "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+	assert.Equal(t, http.StatusBadRequest, patch("/api/v1/files/public/file.txt", "0999").Code)
+	assert.Equal(t, http.StatusBadRequest, patch("/api/v1/files/public/file.txt", "17777").Code)
+	assert.Equal(t, http.StatusBadRequest, patch("/api/v1/files/public/file.txt", "4755").Code, "no setuid bit")
+	assert.Equal(t, http.StatusBadRequest, patch("/api/v1/files/public/file.txt", "1777").Code, "no sticky bit")
+	assert.Equal(t, http.StatusForbidden, patch("/api/v1/files/public", "0755").Code)
+	assert.Equal(t, http.StatusBadRequest, patch("/api/v1/files/public/escape", "0644").Code)
+
+	info, err = os.Stat(outside)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm(), "targets outside the root are left untouched")
+}
+
+func TestPatchOwnership(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file.txt"), []byte("data"), 0o600))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{AnonymousWrites: true})
+
+	patch := func(attributes string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"data":{"type":"files","attributes":%s}}`, attributes)
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/files/public/file.txt", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	current, err := user.Current()
+	require.NoError(t, err)
+	rec := patch(fmt.Sprintf(`{"user":%q,"group_id":%d}`, current.Username, os.Getegid()))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp ResourceResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, os.Geteuid(), resp.Data.Attributes.UserID)
+	assert.Equal(t, os.Getegid(), resp.Data.Attributes.GroupID)
+
+	assert.Equal(t, http.StatusBadRequest, patch(`{"user":"no-such-user-dendrite"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, patch(`{"group":"no-such-group-dendrite"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, patch(fmt.Sprintf(`{"user":%q,"user_id":0}`, current.Username)).Code)
+	assert.Equal(t, http.StatusBadRequest, patch(`{"user_id":-2}`).Code)
+
+	rec = patch(`{"permission_mode":"0644","user":"no-such-user-dendrite"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	info, err := os.Stat(filepath.Join(root, "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm(), "an unknown owner leaves the mode unchanged")
+
+	if os.Geteuid() == 0 {
+		rec = patch(`{"user_id":1}`)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		info, err := os.Stat(filepath.Join(root, "file.txt"))
+		require.NoError(t, err)
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		require.True(t, ok)
+		assert.Equal(t, uint32(1), stat.Uid)
+		return
+	}
+	assert.Equal(t, http.StatusForbidden, patch(`{"user_id":0}`).Code, "chown needs CAP_CHOWN")
+}
+
+func TestPatchTimestamps(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "file.txt")
+	require.NoError(t, os.WriteFile(file, []byte("data"), 0o600))
+	accessed := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	require.NoError(t, os.Chtimes(file, accessed, time.Now()))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{AnonymousWrites: true})
+
+	patch := func(attributes string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"data":{"type":"files","attributes":%s}}`, attributes)
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/files/public/file.txt", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := patch(`{"modified_at":"2020-01-02T03:04:05Z"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp ResourceResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NotNil(t, resp.Data.Attributes.ModifiedAt)
+	assert.Equal(t, formatTime(&modified), resp.Data.Attributes.ModifiedAt)
+	require.NotNil(t, resp.Data.Attributes.AccessedAt)
+	assert.Equal(t, formatTime(&accessed), resp.Data.Attributes.AccessedAt, "omitted timestamps are left unchanged")
+
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(modified))
+
+	assert.Equal(t, http.StatusBadRequest, patch(`{"modified_at":"yesterday"}`).Code)
+}
+
+func TestPatchAudit(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file.txt"), []byte("data"), 0o600))
+
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root, Access: AccessPolicy{
+		Allow: []AccessRule{{Scopes: []string{ScopeRead}}, {Users: []string{"alice"}}},
+	}}}, Options{})
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id := auth.Identity{Subject: c.Request().Header.Get("X-Test-User")}
+			c.SetRequest(c.Request().WithContext(auth.ContextWithIdentity(c.Request().Context(), id)))
+			return next(c)
+		}
+	})
+	RegisterRoutes(e, svc, HandlerOptions{Audit: audit.New(&buf)})
+
+	patch := func(target, user, attributes string) int {
+		body := fmt.Sprintf(`{"data":{"type":"files","attributes":%s}}`, attributes)
+		req := httptest.NewRequest(http.MethodPatch, target, strings.NewReader(body))
+		req.Header.Set("X-Test-User", user)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, patch("/api/v1/files/public/file.txt", "alice",
+		`{"permission_mode":"0640","name":"renamed.txt"}`))
+	assert.Equal(t, http.StatusForbidden, patch("/api/v1/files/public/renamed.txt", "bob", `{"permission_mode":"0600"}`))
+	assert.Equal(t, http.StatusNotFound, patch("/api/v1/files/public/missing.txt", "alice", `{"permission_mode":"0600"}`))
+
+	var events []audit.Event
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var ev audit.Event
+		require.NoError(t, dec.Decode(&ev))
+		events = append(events, ev)
+	}
+	require.Len(t, events, 4)
+
+	assert.Equal(t, "chmod", events[0].Action)
+	assert.Equal(t, "/public/file.txt", events[0].Path)
+	assert.Equal(t, "0640", events[0].Detail)
+	assert.Equal(t, "alice", events[0].Subject)
+	assert.Equal(t, audit.ResultSuccess, events[0].Result)
+
+	assert.Equal(t, "move", events[1].Action)
+	assert.Equal(t, "/public/renamed.txt", events[1].Destination)
+	assert.Equal(t, audit.ResultSuccess, events[1].Result)
+
+	assert.Equal(t, "patch", events[2].Action)
+	assert.Equal(t, "bob", events[2].Subject)
+	assert.Equal(t, audit.ResultDenied, events[2].Result)
+
+	assert.Equal(t, "chmod", events[3].Action)
+	assert.Equal(t, audit.ResultFailure, events[3].Result)
+	assert.NotEmpty(t, events[3].Error)
+}
+
+func TestDownloadRangeRequests(t *testing.T) {
+	root := t.TempDir()
+	content := []byte("0123456789abcdefghij")
+	require.NoError(t, os.WriteFile(filepath.Join(root, "data.bin"), content, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "index.html"), []byte("<p>index</p>"), 0o600))
+	modTime := time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(root, "data.bin"), modTime, modTime))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	lastModified := modTime.Format(http.TimeFormat)
+	stale := modTime.Add(-time.Hour).Format(http.TimeFormat)
+	desc, err := svc.Describe(context.Background(), "/public", "data.bin")
+	require.NoError(t, err)
+	// Weak tags never match If-Range, so resuming needs Last-Modified.
+	etag := ComputeETag(desc)
+	tests := []struct {
+		name         string
+		target       string
+		rangeHeader  string
+		ifRange      string
+		wantStatus   int
+		wantBody     string
+		contentRange string
+	}{
+		{"full inline", "/api/v1/files/public/data.bin", "", "", http.StatusOK, string(content), ""},
+		{"inline range", "/api/v1/files/public/data.bin", "bytes=2-5", "", http.StatusPartialContent, "2345",
+			"bytes 2-5/20"},
+		{"attachment range", "/api/v1/files/public/data.bin?download=1", "bytes=10-", "", http.StatusPartialContent,
+			"abcdefghij", "bytes 10-19/20"},
+		{"suffix range", "/api/v1/files/public/data.bin?download=1", "bytes=-3", "", http.StatusPartialContent,
+			"hij", "bytes 17-19/20"},
+		{"if-range current", "/api/v1/files/public/data.bin?download=1", "bytes=0-1", lastModified,
+			http.StatusPartialContent, "01", "bytes 0-1/20"},
+		{"if-range stale", "/api/v1/files/public/data.bin?download=1", "bytes=0-1", stale, http.StatusOK,
+			string(content), ""},
+		{"if-range weak etag", "/api/v1/files/public/data.bin?download=1", "bytes=0-1", etag, http.StatusOK,
+			string(content), ""},
+		{"unsatisfiable", "/api/v1/files/public/data.bin?download=1", "bytes=50-60", "",
+			http.StatusRequestedRangeNotSatisfiable, "", "bytes */20"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.rangeHeader != "" {
+				req.Header.Set("Range", tt.rangeHeader)
+			}
+			if tt.ifRange != "" {
+				req.Header.Set("If-Range", tt.ifRange)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+			assert.Equal(t, tt.contentRange, rec.Header().Get("Content-Range"))
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("not modified", func(t *testing.T) {
+		desc, err := svc.Describe(context.Background(), "/public", "data.bin")
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/data.bin", nil)
+		req.Header.Set("If-None-Match", ComputeETag(desc))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusNotModified, rec.Code)
+		assert.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+	})
+
+	t.Run("index.html is served", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/index.html", nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "<p>index</p>", rec.Body.String())
+	})
+}
+
+func TestHeadRequests(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file.txt"), []byte("hello world"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "docs"), 0o750))
+	// An access time newer than the modification time keeps relatime mounts
+	// from updating it when listings sniff the file, which would change the
+	// length of accessed_at between requests.
+	now := time.Now()
+	require.NoError(t, os.Chtimes(filepath.Join(root, "file.txt"), now, now.Add(-time.Hour)))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, target := range []string{
+		"/api/v1/files", "/api/v1/files/public", "/api/v1/files/public/docs", "/api/v1/files/public/file.txt",
+	} {
+		t.Run(target, func(t *testing.T) {
+			get := serve(http.MethodGet, target)
+			head := serve(http.MethodHead, target)
+
+			require.Equal(t, http.StatusOK, head.Code)
+			assert.Empty(t, head.Body.Bytes())
+			assert.Equal(t, strconv.Itoa(get.Body.Len()), head.Header().Get(echo.HeaderContentLength))
+			for _, name := range []string{echo.HeaderContentType, headerETag, echo.HeaderLastModified} {
+				assert.Equal(t, get.Header().Get(name), head.Header().Get(name), name)
+			}
+		})
+	}
+
+	file := serve(http.MethodHead, "/api/v1/files/public/file.txt")
+	assert.NotEmpty(t, file.Header().Get(headerETag))
+	assert.NotEmpty(t, file.Header().Get(echo.HeaderLastModified))
+
+	missing := serve(http.MethodHead, "/api/v1/files/public/missing.txt")
+	assert.Equal(t, http.StatusNotFound, missing.Code)
+	assert.Empty(t, missing.Body.Bytes())
+
+	for _, target := range []string{
+		"/api/v1/files/public/-/grep?query=hello", "/api/v1/files/public/docs?archive=tar",
+		"/api/v1/files/public/file.txt?checksum=sha256", "/api/v1/files/public/file.txt/-/thumbnail",
+	} {
+		rec := serve(http.MethodHead, target)
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code, target)
+		assert.Equal(t, http.MethodGet, rec.Header().Get(echo.HeaderAllow), target)
+		assert.Empty(t, rec.Body.Bytes(), target)
+	}
+
+	// Handlers flushing a HEAD response must not fail.
+	req := httptest.NewRequest(http.MethodHead, "/", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	require.NoError(t, headOnly(func(c echo.Context) error {
+		_, err := c.Response().Write([]byte("data"))
+		c.Response().Flush()
+		return err
+	})(c))
+	assert.Equal(t, "4", rec.Header().Get(echo.HeaderContentLength))
+	assert.Empty(t, rec.Body.Bytes())
+}
+
+func TestFolderArchiveDownload(t *testing.T) {
+	root := t.TempDir()
+	folder := filepath.Join(root, "backup")
+	require.NoError(t, os.MkdirAll(filepath.Join(folder, "sub"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(folder, "sub", "data.txt"), []byte("payload"), 0o640))
+	require.NoError(t, os.Symlink("sub/data.txt", filepath.Join(folder, "link")))
+	modTime := time.Date(2022, 5, 6, 7, 8, 9, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(folder, "sub", "data.txt"), modTime, modTime))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	for _, format := range []string{"tar", "tar.gz"} {
+		t.Run(format, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/backup?archive="+format, nil)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			assert.Contains(t, rec.Header().Get("Content-Disposition"), `filename="backup.`+format+`"`)
+			var r io.Reader = rec.Body
+			if format == "tar.gz" {
+				gz, err := gzip.NewReader(rec.Body)
+				require.NoError(t, err)
+				r = gz
+			}
+
+			headers := map[string]*tar.Header{}
+			contents := map[string]string{}
+			tr := tar.NewReader(r)
+			for {
+				hdr, err := tr.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				require.NoError(t, err)
+				headers[hdr.Name] = hdr
+				data, err := io.ReadAll(tr)
+				require.NoError(t, err)
+				contents[hdr.Name] = string(data)
+			}
+
+			require.Contains(t, headers, "backup/")
+			require.Contains(t, headers, "backup/sub/")
+			require.Contains(t, headers, "backup/sub/data.txt")
+			require.Contains(t, headers, "backup/link")
+			file := headers["backup/sub/data.txt"]
+			assert.Equal(t, int64(0o640), file.Mode&0o777)
+			assert.True(t, file.ModTime.Equal(modTime))
+			assert.Equal(t, "payload", contents["backup/sub/data.txt"])
+			assert.Equal(t, int64(0o750), headers["backup/sub/"].Mode&0o777)
+			assert.Equal(t, byte(tar.TypeSymlink), headers["backup/link"].Typeflag)
+			assert.Equal(t, "sub/data.txt", headers["backup/link"].Linkname)
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/backup?archive=rar", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestBatchArchiveDownload(t *testing.T) {
+	public := t.TempDir()
+	archive := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(public, "a.txt"), []byte("a"), 0o600))
+	require.NoError(t, os.MkdirAll(filepath.Join(archive, "docs"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(archive, "docs", "a.txt"), []byte("b"), 0o600))
+
+	svc, err := NewService([]Root{
+		{Virtual: "/public", Source: public},
+		{Virtual: "/archive", Source: archive},
+	}, Options{})
+	require.NoError(t, err)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	post := func(target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post("/api/v1/files:archive?archive=tar",
+		`{"data":[{"type":"files","id":"/public/a.txt"},{"type":"files","id":"/archive/docs"}]}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Header().Get("Content-Disposition"), `filename="archive.tar"`)
+
+	contents := map[string]string{}
+	tr := tar.NewReader(rec.Body)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		contents[hdr.Name] = string(data)
+	}
+	assert.Equal(t, map[string]string{
+		"public/a.txt":       "a",
+		"archive/docs/":      "",
+		"archive/docs/a.txt": "b",
+	}, contents)
+
+	rec = post("/api/v1/files:archive", `{"data":[{"type":"files","id":"/public/a.txt"}]}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/gzip", rec.Header().Get(echo.HeaderContentType))
+
+	rec = post("/api/v1/files:archive",
+		`{"data":[{"type":"files","id":"/public/missing.txt"},{"type":"files","id":"/nowhere/x"}]}`)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "/public/missing.txt")
+	assert.Contains(t, rec.Body.String(), "/nowhere/x")
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"empty", `{"data":[]}`, http.StatusBadRequest},
+		{"invalid body", `{"data":`, http.StatusBadRequest},
+		{"wrong type", `{"data":[{"type":"folders","id":"/public/a.txt"}]}`, http.StatusConflict},
+		{"nested", `{"data":[{"type":"files","id":"/archive"},{"type":"files","id":"/archive/docs"}]}`,
+			http.StatusBadRequest},
+		{"duplicate", `{"data":[{"type":"files","id":"/public/a.txt"},{"type":"files","id":"/public/a.txt"}]}`,
+			http.StatusBadRequest},
+		{"traversal", `{"data":[{"type":"files","id":"/public/../../etc/passwd"}]}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.status, post("/api/v1/files:archive", tt.body).Code)
+		})
+	}
+}
+
+func TestFileChecksum(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file.txt"), []byte("hello"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "docs"), 0o750))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		algorithm string
+		digest    string
+	}{
+		{"md5", "5d41402abc4b2a76b9719d911017c592"},
+		{"sha1", "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+		{"sha256", "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{"blake2b", "e4cfa39a3d37be31c59609e807970799caa68a19bfaa15135f165085e01d41a6" +
+			"5ba1e1b146aeb6bd0092b49eac214c103ccfa3a365954bbbe52f74a2b3620c94"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			rec := get("/api/v1/files/public/file.txt?checksum=" + tt.algorithm)
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			var resp ChecksumResponse
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+			assert.Equal(t, "/public/file.txt", resp.Data.ID)
+			assert.Equal(t, "checksums", resp.Data.Type)
+			assert.Equal(t, tt.algorithm, resp.Data.Attributes.Algorithm)
+			assert.Equal(t, tt.digest, resp.Data.Attributes.Digest)
+		})
+	}
+
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/files/public/file.txt?checksum=crc32").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/files/public/docs?checksum=sha256").Code)
+
+	desc, err := svc.Describe(context.Background(), "/public", "file.txt")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = svc.Checksum(ctx, desc, "sha256")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestTreeListing(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "a", "b", "c"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a", "one.txt"), []byte("1"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a", "b", "two.txt"), []byte("2"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "empty"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "top.txt"), []byte("t"), 0o600))
+	require.NoError(t, os.Symlink("a", filepath.Join(root, "loop")))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/api/v1/files/public?depth=2")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp TreeResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+	assert.Equal(t, []int{4, 2}, resp.Meta.LevelCounts)
+	assert.Equal(t, 6, resp.Meta.TotalCount)
+	ids := func(resources []Resource) []string {
+		out := make([]string, len(resources))
+		for i, r := range resources {
+			out[i] = r.ID
+		}
+		return out
+	}
+	assert.Equal(t, []string{"/public/a", "/public/empty", "/public/loop", "/public/top.txt"}, ids(resp.Data))
+	assert.Equal(t, []string{"/public/a/b", "/public/a/one.txt"}, ids(resp.Included))
+
+	byID := map[string]Resource{}
+	for _, r := range append(resp.Data, resp.Included...) {
+		byID[r.ID] = r
+	}
+	require.NotNil(t, byID["/public/a"].Relationships)
+	assert.Equal(t, []ResourceIdentifier{
+		{Type: "files", ID: "/public/a/b"}, {Type: "files", ID: "/public/a/one.txt"},
+	}, byID["/public/a"].Relationships.Children.Data)
+	require.NotNil(t, byID["/public/empty"].Relationships)
+	assert.Empty(t, byID["/public/empty"].Relationships.Children.Data)
+	assert.Nil(t, byID["/public/a/b"].Relationships, "folders at the last level are not expanded")
+	assert.Nil(t, byID["/public/loop"].Relationships, "symlinked folders are not descended into")
+
+	rec = get("/api/v1/files/public?depth=5&sort=-name")
+	require.Equal(t, http.StatusOK, rec.Code)
+	resp = TreeResponse{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, []int{4, 2, 2}, resp.Meta.LevelCounts)
+	assert.Equal(t, "/public/top.txt", resp.Data[0].ID)
+
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/files/public?depth=0").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/files/public?depth=11").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/files/public/top.txt?depth=1").Code)
+
+	_, err := svc.ListTree(context.Background(), "/public", "", 5, 3)
+	assert.ErrorIs(t, err, ErrTreeLimit)
+}
+
+func TestDiskUsageHandler(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "data", "sub"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "data", "sub", "file.bin"), make([]byte, 300), 0o600))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{SizeAsString: true})
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/api/v1/files/public/data?usage=apparent")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp UsageResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, "usages", resp.Data.Type)
+	assert.Equal(t, "/public/data", resp.Data.ID)
+	assert.Equal(t, "apparent", resp.Data.Attributes.Mode)
+	assert.Equal(t, "300", resp.Data.Attributes.SizeBytes)
+	assert.Equal(t, 1, resp.Data.Attributes.FileCount)
+	assert.Equal(t, 1, resp.Data.Attributes.FolderCount)
+
+	assert.Equal(t, http.StatusOK, get("/api/v1/files/public/data?usage=allocated").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/files/public/data?usage=du").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/files/public/data/sub/file.bin?usage=apparent").Code)
+}
+
+func TestSearchByName(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "tracks", "2024"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "top.gpx"), []byte("t"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "tracks", "a.gpx"), []byte("a"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "tracks", "notes.txt"), []byte("n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "tracks", "2024", "b.gpx"), []byte("b"), 0o600))
+	require.NoError(t, os.Symlink("tracks", filepath.Join(root, "loop")))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	search := func(target string) Response {
+		rec := get(target)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var resp Response
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+		return resp
+	}
+	ids := func(resp Response) []string {
+		out := []string{}
+		for _, r := range resp.Data {
+			out = append(out, r.ID)
+		}
+		return out
+	}
+
+	resp := search("/api/v1/files/public/-/search?name=*.gpx")
+	assert.Equal(t, []string{"/public/top.gpx"}, ids(resp))
+
+	resp = search("/api/v1/files/public/-/search?name=*.gpx&recursive=true")
+	assert.Equal(t, []string{"/public/tracks/a.gpx", "/public/tracks/2024/b.gpx", "/public/top.gpx"}, ids(resp),
+		"matches are sorted by name; symlinked folders are not descended into")
+	assert.Equal(t, 3, resp.Meta.TotalCount)
+
+	resp = search("/api/v1/files/public/tracks/-/search?name=*.gpx&recursive=true&page[limit]=1")
+	assert.Equal(t, []string{"/public/tracks/a.gpx"}, ids(resp))
+	require.NotNil(t, resp.Links.Next)
+	assert.Equal(t, "/api/v1/files/public/tracks/-/search?page[offset]=1&page[limit]=1&name=%2A.gpx&recursive=true",
+		*resp.Links.Next)
+
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/files/public/-/search").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/files/public/-/search?name=[").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/files/public/-/search?name=*&recursive=yes").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/files/public/top.gpx/-/search?name=*").Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/files/public/missing/-/search?name=*").Code)
+}
+
+func TestContentSearch(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "src", "sub"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "src", "main.go"),
+		[]byte("package main\n// TODO: fix\nfunc main() {}\n// todo later\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "src", "sub", "notes.txt"), []byte("TODO\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "src", "blob.bin"), []byte("TODO\x00\x01\x02"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "many.txt"),
+		[]byte(strings.Repeat("x\n", maxGrepMatches+5)), 0o600))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	type grepResponse struct {
+		Data []GrepResource `json:"data"`
+		Meta GrepStats      `json:"meta"`
+	}
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	grep := func(target string) grepResponse {
+		rec := get(target)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Equal(t, api.ContentType, rec.Header().Get(echo.HeaderContentType))
+		var resp grepResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+		return resp
+	}
+
+	resp := grep("/api/v1/files/public/src/-/grep?query=TODO")
+	require.Len(t, resp.Data, 2, "the binary file is skipped")
+	byID := map[string][]GrepMatch{}
+	for _, r := range resp.Data {
+		assert.Equal(t, "content_matches", r.Type)
+		byID[r.ID] = r.Attributes.Matches
+	}
+	assert.Equal(t, []GrepMatch{{Line: 2, Snippet: "// TODO: fix"}}, byID["/public/src/main.go"])
+	assert.Equal(t, []GrepMatch{{Line: 1, Snippet: "TODO"}}, byID["/public/src/sub/notes.txt"])
+	assert.Equal(t, GrepStats{ScannedCount: 2, SkippedCount: 1, FileCount: 2, MatchCount: 2}, resp.Meta)
+
+	resp = grep("/api/v1/files/public/src/-/grep?query=(?i)todo&regex=true&name=*.go")
+	require.Len(t, resp.Data, 1)
+	assert.Equal(t, []GrepMatch{{Line: 2, Snippet: "// TODO: fix"}, {Line: 4, Snippet: "// todo later"}},
+		resp.Data[0].Attributes.Matches)
+
+	resp = grep("/api/v1/files/public/src/main.go/-/grep?query=func")
+	require.Len(t, resp.Data, 1)
+	assert.Equal(t, "/public/src/main.go", resp.Data[0].ID)
+
+	resp = grep("/api/v1/files/public/many.txt/-/grep?query=x")
+	assert.True(t, resp.Meta.Truncated)
+	assert.Equal(t, maxGrepMatches, resp.Meta.MatchCount)
+
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/files/public/-/grep").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/files/public/-/grep?query=(&regex=true").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/files/public/-/grep?query=a&regex=1").Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/files/public/missing/-/grep?query=a").Code)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	desc, err := svc.Describe(context.Background(), "/public", "src")
+	require.NoError(t, err)
+	_, err = svc.Grep(ctx, desc, GrepOptions{Pattern: regexp.MustCompile("TODO")},
+		func(string, []GrepMatch) error { return nil })
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestThumbnail(t *testing.T) {
+	root := t.TempDir()
+	writeImage := func(name string, width, height int, fill color.Color) {
+		t.Helper()
+		img := image.NewNRGBA(image.Rect(0, 0, width, height))
+		for y := range height {
+			for x := range width {
+				img.Set(x, y, fill)
+			}
+		}
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, img))
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), buf.Bytes(), 0o600))
+	}
+	writeImage("wide.png", 400, 200, color.NRGBA{R: 200, A: 255})
+	writeImage("clear.png", 300, 300, color.NRGBA{B: 200, A: 100})
+	writeImage("small.png", 50, 40, color.NRGBA{G: 200, A: 255})
+	require.NoError(t, os.WriteFile(filepath.Join(root, "notes.txt"), []byte("not an image"), 0o600))
+
+	cacheDir := t.TempDir()
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root}}, Options{ThumbnailCacheDir: cacheDir})
+	require.NoError(t, err)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+	get := func(target string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if len(header) == 2 {
+			req.Header.Set(header[0], header[1])
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	thumbnail := func(target, mimeType string) image.Config {
+		t.Helper()
+		rec := get(target)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Equal(t, mimeType, rec.Header().Get(echo.HeaderContentType))
+		config, _, err := image.DecodeConfig(rec.Body)
+		require.NoError(t, err)
+		return config
+	}
+
+	config := thumbnail("/api/v1/files/public/wide.png/-/thumbnail?w=100&h=100", "image/jpeg")
+	assert.Equal(t, []int{128, 64}, []int{config.Width, config.Height}, "sizes are rounded up, opaque images become JPEGs")
+	config = thumbnail("/api/v1/files/public/clear.png/-/thumbnail", "image/png")
+	assert.Equal(t, []int{256, 256}, []int{config.Width, config.Height}, "transparent images stay PNGs")
+	config = thumbnail("/api/v1/files/public/small.png/-/thumbnail?w=100", "image/jpeg")
+	assert.Equal(t, []int{50, 40}, []int{config.Width, config.Height}, "small images are not enlarged")
+
+	rec := get("/api/v1/files/public/wide.png/-/thumbnail?w=100&h=100")
+	etag := rec.Header().Get(headerETag)
+	require.NotEmpty(t, etag)
+	assert.Equal(t, http.StatusNotModified,
+		get("/api/v1/files/public/wide.png/-/thumbnail?w=100&h=100", "If-None-Match", etag).Code)
+	assert.Equal(t, etag, get("/api/v1/files/public/wide.png/-/thumbnail?w=128&h=120").Header().Get(headerETag))
+	assert.NotEqual(t, etag, get("/api/v1/files/public/wide.png/-/thumbnail?w=50").Header().Get(headerETag))
+
+	// Cached thumbnails are served as stored until the image changes.
+	cached, err := filepath.Glob(filepath.Join(cacheDir, "*", "*"))
+	require.NoError(t, err)
+	assert.Len(t, cached, 4)
+	desc, err := svc.Describe(t.Context(), "/public", "small.png")
+	require.NoError(t, err)
+	cachePath := svc.thumbnails.path(desc, 128, defaultThumbnailSize)
+	require.NoError(t, os.WriteFile(cachePath, []byte("\x89PNG\r\n\x1a\ncached"), 0o600))
+	rec = get("/api/v1/files/public/small.png/-/thumbnail?w=100")
+	assert.Equal(t, "\x89PNG\r\n\x1a\ncached", rec.Body.String())
+	assert.Equal(t, "image/png", rec.Header().Get(echo.HeaderContentType))
+	writeImage("small.png", 60, 40, color.NRGBA{G: 200, A: 255})
+	require.NoError(t, os.Chtimes(filepath.Join(root, "small.png"), time.Time{}, time.Now().Add(time.Minute)))
+	config = thumbnail("/api/v1/files/public/small.png/-/thumbnail?w=100", "image/jpeg")
+	assert.Equal(t, 60, config.Width)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, get("/api/v1/files/public/notes.txt/-/thumbnail").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/files/public/-/thumbnail").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/files/public/wide.png/-/thumbnail?w=0").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/files/public/wide.png/-/thumbnail?h=4096").Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/files/public/missing.png/-/thumbnail").Code)
+}
+
+func TestEventStream(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "incoming"), 0o750))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "other"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file.txt"), []byte("data"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "incoming", ".gitignore"), []byte("*.log\n"), 0o600))
+
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root}}, Options{RespectGitignore: true})
+	require.NoError(t, err)
+	events := watch.New([]watch.Root{{Virtual: "/public", Source: svc.Roots()[0].Source}}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = events.Run(ctx) }()
+
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{Events: events})
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/events").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/events?path=/public/file.txt").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/events?path=/public&recursive=yes").Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/events?path=/private").Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/events?path=/public/missing").Code)
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/v1/events?path=/public/incoming", nil)
+	require.NoError(t, err)
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get(echo.HeaderContentType))
+
+	// Give the watcher time to add its watches.
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "other", "skipped.txt"), []byte("s"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "incoming", ".hidden"), []byte("h"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "incoming", "ignored.log"), []byte("i"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "incoming", "a.txt"), []byte("a"), 0o600))
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	readLine := func() string {
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event received")
+			return ""
+		}
+	}
+	assert.Equal(t, "event: created", readLine())
+	data, ok := strings.CutPrefix(readLine(), "data: ")
+	require.True(t, ok)
+	var ev watch.Event
+	require.NoError(t, json.Unmarshal([]byte(data), &ev))
+	assert.Equal(t, "/public/incoming/a.txt", ev.Path)
+	assert.Equal(t, "file", ev.Metadata.Kind)
+	assert.Empty(t, readLine())
+}
+
+func TestInFolder(t *testing.T) {
+	tests := []struct {
+		folder, path string
+		recursive    bool
+		want         bool
+	}{
+		{"/public/incoming", "/public/incoming/a.txt", false, true},
+		{"/public/incoming", "/public/incoming/sub/a.txt", false, false},
+		{"/public/incoming", "/public/incoming/sub/a.txt", true, true},
+		{"/public/incoming", "/public/incoming2/a.txt", true, false},
+		{"/public/incoming", "/public/incoming", true, false},
+		{"/", "/a.txt", false, true},
+		{"/", "/sub/a.txt", true, true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, inFolder(tt.folder, tt.path, tt.recursive), "%s in %s", tt.path, tt.folder)
+	}
+}
+
+func TestStreamedListing(t *testing.T) {
+	root := t.TempDir()
+	for i := range 600 {
+		require.NoError(t, os.WriteFile(filepath.Join(root, fmt.Sprintf("f%03d.txt", i)), []byte("x"), 0o600))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(root, "sub"), 0o750))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set(echo.HeaderAccept, "application/x-ndjson; q=1, application/vnd.api+json; q=0.5")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	decode := func(rec *httptest.ResponseRecorder) []Resource {
+		t.Helper()
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Equal(t, MIMENDJSON, rec.Header().Get(echo.HeaderContentType))
+		var resources []Resource
+		dec := json.NewDecoder(rec.Body)
+		for dec.More() {
+			var resource Resource
+			require.NoError(t, dec.Decode(&resource))
+			resources = append(resources, resource)
+		}
+		return resources
+	}
+
+	resources := decode(get("/api/v1/files/public"))
+	assert.Len(t, resources, 601, "all entries, without the default page limit")
+	assert.Equal(t, strings.Count(get("/api/v1/files/public").Body.String(), "\n"), 601, "one resource per line")
+
+	resources = decode(get("/api/v1/files/public?filter[resource_kind]=folder&fields[files]=name"))
+	require.Len(t, resources, 1)
+	assert.Equal(t, "/public/sub", resources[0].ID)
+	assert.Equal(t, "sub", resources[0].Attributes.Name)
+	assert.Empty(t, resources[0].Attributes.ResourceKind, "sparse fieldsets apply")
+
+	assert.Empty(t, decode(get("/api/v1/files/public/sub")))
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/files/public?sort=-name").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/files/public?page[limit]=10").Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/files/public/missing").Code)
+}
+
+func TestListingDescribesOnlyThePage(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(name), 0o600))
+	}
+	// Describing the looping symlink fails, so only listings that describe
+	// every entry report its error.
+	require.NoError(t, os.Symlink("z-loop", filepath.Join(root, "z-loop")))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	rec := get("/api/v1/files/public?page[limit]=2&page[offset]=1")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp Response
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 5, resp.Meta.TotalCount)
+	require.Len(t, resp.Data, 2)
+	assert.Equal(t, "b.txt", resp.Data[0].Attributes.Name)
+	assert.Nil(t, resp.Data[0].Meta)
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Data[1].Attributes.MimeType)
+	require.NotNil(t, resp.Links.Next)
+	assert.Contains(t, *resp.Links.Next, "page[offset]=3")
+
+	rec = get("/api/v1/files/public?page[limit]=2&filter[name]=*.txt&sort=-name")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	resp = Response{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 4, resp.Meta.TotalCount)
+	assert.Equal(t, "d.txt", resp.Data[0].Attributes.Name)
+
+	for _, target := range []string{
+		"/api/v1/files/public?page[limit]=2&sort=-name",
+		"/api/v1/files/public?page[limit]=1&sort=-size_bytes",
+	} {
+		rec = get(target)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Contains(t, rec.Body.String(), `"meta":{"error":"symlink chain exceeds maximum depth"}`, target)
+	}
+}
+
+func TestListingMimeDetection(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "image.png"), []byte("not an image"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "notes"), []byte("plain text"), 0o600))
+	svc := newTestService(t, root)
+
+	mimeTypes := func(opts HandlerOptions, target string) map[string]string {
+		t.Helper()
+		e := echo.New()
+		e.HTTPErrorHandler = jsonAPIError
+		RegisterRoutes(e, svc, opts)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var resp Response
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		types := make(map[string]string)
+		for _, resource := range resp.Data {
+			types[resource.Attributes.Name] = resource.Attributes.MimeType
+		}
+		return types
+	}
+
+	sniffed := map[string]string{"image.png": "text/plain; charset=utf-8", "notes": "text/plain; charset=utf-8"}
+	byExtension := map[string]string{"image.png": "image/png", "notes": "application/octet-stream"}
+	assert.Equal(t, sniffed, mimeTypes(HandlerOptions{}, "/api/v1/files/public"))
+	assert.Equal(t, byExtension, mimeTypes(HandlerOptions{}, "/api/v1/files/public?mime_detection=extension"))
+	extension := HandlerOptions{ListingMimeDetection: "extension"}
+	assert.Equal(t, byExtension, mimeTypes(extension, "/api/v1/files/public"))
+	assert.Equal(t, sniffed, mimeTypes(extension, "/api/v1/files/public?mime_detection=content"))
+
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, extension)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/files/public/image.png?metadata=1", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"mime_type":"text/plain; charset=utf-8"`, "single entries are sniffed")
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/files/public?mime_detection=magic", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestListingBrokenEntries(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "notes.txt"), []byte("hello"), 0o600))
+	require.NoError(t, os.Symlink("missing.txt", filepath.Join(root, "dangling")))
+	require.NoError(t, os.Symlink("loop", filepath.Join(root, "loop")))
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/files/public", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp Response
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Data, 3)
+	errs := make(map[string]string)
+	for _, resource := range resp.Data {
+		if resource.Meta != nil {
+			errs[resource.Attributes.Name] = resource.Meta.Error
+			assert.Equal(t, "symlink", resource.Attributes.ResourceKind)
+			assert.NotNil(t, resource.Attributes.LinkTarget)
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"dangling": "file not found",
+		"loop":     "symlink chain exceeds maximum depth",
+	}, errs)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/files/public/dangling?metadata=1", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code, "single entries still fail")
+}
+
+func TestListingUnresolvedLinks(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "notes.txt"), []byte("hello"), 0o600))
+	require.NoError(t, os.Symlink("notes.txt", filepath.Join(root, "link")))
+	require.NoError(t, os.Symlink("missing.txt", filepath.Join(root, "broken")))
+	require.NoError(t, os.Symlink("loop", filepath.Join(root, "loop")))
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/files/public?resolve_links=none", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp Response
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	kinds := make(map[string]string)
+	targets := make(map[string]string)
+	for _, resource := range resp.Data {
+		kinds[resource.Attributes.Name] = resource.Attributes.ResourceKind
+		if resource.Attributes.LinkTarget != nil {
+			targets[resource.Attributes.Name] = *resource.Attributes.LinkTarget
+		}
+		assert.Nil(t, resource.Meta, "links are not resolved")
+	}
+	assert.Equal(t, map[string]string{
+		"notes.txt": "file", "link": "symlink", "broken": "symlink", "loop": "symlink",
+	}, kinds)
+	assert.Equal(t, map[string]string{"link": "notes.txt", "broken": "missing.txt", "loop": "loop"}, targets)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/files/public/link?metadata=1&follow=false", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), `"link_target":"notes.txt"`)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/files/public?resolve_links=partial", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
 func jsonAPIError(err error, c echo.Context) {
 	var he *echo.HTTPError
 	if !errors.As(err, &he) {
@@ -0,0 +1,72 @@
+package files
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// headOnly answers HEAD requests with the status and headers the GET handler
+// produces, including Content-Length, without sending the body. Bodies are
+// counted instead of buffered, so HEAD of a large listing stays cheap.
+func headOnly(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		res := c.Response()
+		w := &headWriter{ResponseWriter: res.Writer, status: http.StatusOK}
+		res.Writer = w
+		// Errors are rendered here, while the body is still discarded.
+		if err := next(c); err != nil {
+			c.Error(err)
+		}
+		res.Writer = w.ResponseWriter
+
+		if w.size > 0 && w.Header().Get(echo.HeaderContentLength) == "" {
+			w.Header().Set(echo.HeaderContentLength, strconv.FormatInt(w.size, 10))
+		}
+		w.ResponseWriter.WriteHeader(w.status)
+		return nil
+	}
+}
+
+// headWriter records the status and counts the body of a response without
+// writing either, leaving headOnly to send the headers.
+type headWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (w *headWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *headWriter) Write(b []byte) (int, error) {
+	w.size += int64(len(b))
+	return len(b), nil
+}
+
+// Flush does nothing: the headers are sent by headOnly once the handler
+// returned, and there is no body to flush.
+func (w *headWriter) Flush() {}
+
+// Unwrap returns the wrapped writer for http.ResponseController.
+func (w *headWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// rejectComputedHead fails HEAD requests for representations generated on
+// request, such as archives, checksums, thumbnails and content searches,
+// which would have to be produced in full just to count their bytes.
+func rejectComputedHead(c echo.Context, segment string) error {
+	if c.Request().Method != http.MethodHead {
+		return nil
+	}
+	computed := segment == grepSegment || segment == thumbnailSegment ||
+		c.QueryParam("archive") != "" || c.QueryParam("checksum") != ""
+	if !computed {
+		return nil
+	}
+	c.Response().Header().Set(echo.HeaderAllow, http.MethodGet)
+	return echo.NewHTTPError(http.StatusMethodNotAllowed, "HEAD is not supported for generated representations")
+}
@@ -0,0 +1,83 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/logging"
+)
+
+// ErrRootUnavailable indicates the source directory of a root is currently unreachable.
+var ErrRootUnavailable = errors.New("file root unavailable")
+
+// ticker abstracts time.Ticker so the monitor can be driven by a fake clock in tests.
+type ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type timeTicker struct {
+	*time.Ticker
+}
+
+func (t timeTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+func newTimeTicker(interval time.Duration) ticker {
+	return timeTicker{time.NewTicker(interval)}
+}
+
+// RootAvailable reports whether the root was reachable at the last health check.
+// Roots are considered available until the monitor observes otherwise.
+func (s *Service) RootAvailable(virtual string) bool {
+	flag, ok := s.roots.Load().available[virtual]
+	return !ok || flag.Load()
+}
+
+// MonitorRoots stats every root source each interval and records its
+// availability until ctx is canceled. Requests for unavailable roots then fail
+// fast with ErrRootUnavailable instead of hitting the filesystem.
+func (s *Service) MonitorRoots(ctx context.Context, interval time.Duration) {
+	t := s.newTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+			s.checkRoots(ctx)
+		}
+	}
+}
+
+func (s *Service) checkRoots(ctx context.Context) {
+	logger := logging.FromContext(ctx)
+	roots := s.roots.Load()
+	for _, root := range roots.ordered {
+		info, err := os.Stat(root.Source)
+		available := err == nil && info.IsDir()
+
+		if previous := roots.available[root.Virtual].Swap(available); previous != available && logger != nil {
+			if available {
+				logger.Info("file root available again", "virtual", root.Virtual, "source", root.Source)
+			} else {
+				logger.Warn("file root unavailable", "virtual", root.Virtual, "source", root.Source, "error", err)
+			}
+		}
+	}
+}
+
+func newAvailability(roots []Root) map[string]*atomic.Bool {
+	available := make(map[string]*atomic.Bool, len(roots))
+	for _, root := range roots {
+		flag := &atomic.Bool{}
+		flag.Store(true)
+		available[root.Virtual] = flag
+	}
+	return available
+}
@@ -0,0 +1,80 @@
+package files
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeTicker struct {
+	ch chan time.Time
+}
+
+func (f *fakeTicker) C() <-chan time.Time { return f.ch }
+
+func (f *fakeTicker) Stop() {}
+
+// tick delivers a tick and waits until the monitor finished processing it.
+func (f *fakeTicker) tick() {
+	f.ch <- time.Now()
+	f.ch <- time.Now()
+}
+
+func TestMonitorRootsFlipsAvailability(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "share")
+	require.NoError(t, os.MkdirAll(root, 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o600))
+
+	svc := newTestService(t, root)
+	fake := &fakeTicker{ch: make(chan time.Time)}
+	var interval time.Duration
+	svc.newTicker = func(d time.Duration) ticker {
+		interval = d
+		return fake
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		svc.MonitorRoots(ctx, 30*time.Second)
+		close(done)
+	}()
+
+	fake.tick()
+	assert.Equal(t, 30*time.Second, interval)
+	assert.True(t, svc.RootAvailable("/public"))
+
+	require.NoError(t, os.RemoveAll(root))
+	fake.tick()
+	assert.False(t, svc.RootAvailable("/public"))
+
+	_, err := svc.Describe(t.Context(), "/public", "a.txt")
+	assert.ErrorIs(t, err, ErrRootUnavailable)
+
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{})
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/a.txt", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	require.NoError(t, os.MkdirAll(root, 0o750))
+	fake.tick()
+	assert.True(t, svc.RootAvailable("/public"))
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("monitor did not stop after cancellation")
+	}
+}
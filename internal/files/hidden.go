@@ -0,0 +1,31 @@
+package files
+
+import "strings"
+
+// hiddenRules returns the rules hiding dotfiles and the HiddenPatterns of
+// root, or nil when the root shows hidden entries.
+func hiddenRules(root Root) ignoreRules {
+	if root.ShowHidden {
+		return nil
+	}
+	rules := ignoreRules{{pattern: ".*"}}
+	for _, pattern := range root.HiddenPatterns {
+		rules = append(rules, ignoreRule{pattern: pattern})
+	}
+	return rules
+}
+
+// isHidden reports whether rel, a path relative to root, or one of its
+// parent folders is hidden by the root's policy.
+func isHidden(root Root, rel string) bool {
+	rules := hiddenRules(root)
+	if rules == nil || rel == "" {
+		return false
+	}
+	for _, segment := range strings.Split(rel, "/") {
+		if rules.ignored(segment, true) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package files
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// RootReport describes the source of a root on disk, to diagnose
+// misconfigured mappings without starting the server.
+type RootReport struct {
+	Root Root
+	// Resolved is the source with symlinks resolved; empty when it does
+	// not resolve.
+	Resolved string
+	// FreeBytes is the space available on the filesystem of the source,
+	// or -1 when unknown.
+	FreeBytes int64
+	// Entries counts the entries directly inside the source folder.
+	Entries  int
+	Readable bool
+	// Err is the problem making the root unusable, nil if there is none.
+	Err error
+}
+
+// InspectRoot resolves the source of root and reads its folder. Unlike
+// NewService it reports problems per root instead of failing.
+func InspectRoot(root Root) RootReport {
+	report := RootReport{Root: root, FreeBytes: -1}
+	resolved, err := filepath.EvalSymlinks(root.Source)
+	if err != nil {
+		report.Err = fmt.Errorf("resolve source: %w", err)
+		return report
+	}
+	report.Resolved = resolved
+
+	if free, err := freeSpace(resolved); err == nil {
+		report.FreeBytes = free
+	}
+	entries, err := os.ReadDir(resolved)
+	if err != nil {
+		report.Err = fmt.Errorf("read source: %w", err)
+		return report
+	}
+	report.Readable = true
+	report.Entries = len(entries)
+	return report
+}
@@ -0,0 +1,65 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+type linkResolutionKey struct{}
+
+// contextWithoutLinkResolution marks listings within ctx to report symlinks
+// as themselves with their link target, instead of resolving and stat-ing
+// the target. Broken links then no longer fail the listing.
+func contextWithoutLinkResolution(ctx context.Context) context.Context {
+	return context.WithValue(ctx, linkResolutionKey{}, false)
+}
+
+// linksResolved reports whether listings within ctx resolve symlinks.
+func linksResolved(ctx context.Context) bool {
+	resolved, ok := ctx.Value(linkResolutionKey{}).(bool)
+	return !ok || resolved
+}
+
+// describeLink describes the entry at rel like describe, except that a
+// symlink is described itself rather than its target.
+func (s *Service) describeLink(ctx context.Context, root Root, rel string) (Descriptor, error) {
+	virtualPath := joinVirtual(root.Virtual, rel)
+	absPath := filepath.Join(root.Source, filepath.FromSlash(rel))
+	info, err := os.Lstat(absPath)
+	if err != nil {
+		return Descriptor{}, fmt.Errorf("stat %s: %w", virtualPath, err)
+	}
+	if classify(info) != kindSymlink {
+		return s.describe(ctx, root, rel)
+	}
+	return s.describeItself(ctx, root, rel, info), nil
+}
+
+// describeItself describes the entry at rel from its own info, without
+// following it if it is a symlink.
+func (s *Service) describeItself(ctx context.Context, root Root, rel string, info os.FileInfo) Descriptor {
+	absPath := filepath.Join(root.Source, filepath.FromSlash(rel))
+	kind := classify(info)
+	desc := Descriptor{
+		Root:         root,
+		RelPath:      rel,
+		Name:         entryName(root, rel),
+		Kind:         kind,
+		TargetKind:   kind,
+		AbsolutePath: absPath,
+		LinkPath:     absPath,
+		VirtualPath:  joinVirtual(root.Virtual, rel),
+	}
+	desc.Metadata = s.metadataFromInfo(ctx, desc, info)
+	if kind == kindSymlink {
+		size := info.Size()
+		desc.Metadata.SizeBytes = &size
+		if target, err := os.Readlink(absPath); err == nil {
+			desc.Metadata.LinkTarget = &target
+		}
+	}
+	desc.Metadata.MountPath = s.mountPath(absPath)
+	return desc
+}
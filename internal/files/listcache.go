@@ -0,0 +1,197 @@
+package files
+
+import (
+	"path"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultListingCacheEntries is the default number of folders whose listings
+// are cached.
+const DefaultListingCacheEntries = 1000
+
+// listingCache keeps the descriptors of recently listed folders, so repeated
+// listings skip the stat, ownership lookup and MIME sniffing of every entry.
+// A listing is reused while the modification time of its folder is unchanged
+// and it is younger than the TTL. Adding, removing or renaming entries
+// changes the folder's time; the TTL bounds how long changes to the entries
+// themselves, which leave it alone, go unnoticed. A nil cache caches nothing.
+type listingCache struct {
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu           sync.Mutex
+	listings     map[string]cachedListing
+	fingerprints map[string]cachedFingerprint
+}
+
+type cachedListing struct {
+	modTime  time.Time
+	cachedAt time.Time
+	// sniffed reports whether MIME types were sniffed from the content
+	// rather than derived from extensions.
+	sniffed bool
+	descs   []Descriptor
+}
+
+// cachedFingerprint is the subtree fingerprint of a folder; ok is false for
+// subtrees too large to fingerprint.
+type cachedFingerprint struct {
+	modTime     time.Time
+	cachedAt    time.Time
+	fingerprint uint64
+	ok          bool
+}
+
+// newListingCache returns a cache of up to maxEntries folders, or nil when
+// ttl disables caching.
+func newListingCache(ttl time.Duration, maxEntries int) *listingCache {
+	if ttl <= 0 {
+		return nil
+	}
+	if maxEntries <= 0 {
+		maxEntries = DefaultListingCacheEntries
+	}
+	return &listingCache{
+		ttl:          ttl,
+		maxEntries:   maxEntries,
+		now:          time.Now,
+		listings:     make(map[string]cachedListing),
+		fingerprints: make(map[string]cachedFingerprint),
+	}
+}
+
+// get returns the cached listing of the virtual folder if it is still valid
+// for the folder's modTime. With sniffed, listings whose MIME types were
+// derived from extensions are ignored.
+func (lc *listingCache) get(folder string, modTime time.Time, sniffed bool) ([]Descriptor, bool) {
+	if lc == nil {
+		return nil, false
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	cached, ok := lc.listings[folder]
+	if !ok || !cached.modTime.Equal(modTime) || lc.now().Sub(cached.cachedAt) >= lc.ttl || sniffed && !cached.sniffed {
+		return nil, false
+	}
+	// Callers sort and filter listings in place.
+	return slices.Clone(cached.descs), true
+}
+
+// put caches the listing of the virtual folder read at its modTime. When the
+// cache is full, expired listings are dropped first, then the oldest one.
+func (lc *listingCache) put(folder string, modTime time.Time, descs []Descriptor, sniffed bool) {
+	if lc == nil {
+		return
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	now := lc.now()
+	if _, ok := lc.listings[folder]; !ok && len(lc.listings) >= lc.maxEntries {
+		lc.evict(now)
+	}
+	lc.listings[folder] = cachedListing{modTime: modTime, cachedAt: now, sniffed: sniffed, descs: slices.Clone(descs)}
+}
+
+// getFingerprint returns the cached subtree fingerprint of the virtual
+// folder if it is still valid for the folder's modTime.
+func (lc *listingCache) getFingerprint(folder string, modTime time.Time) (fingerprint uint64, ok, found bool) {
+	if lc == nil {
+		return 0, false, false
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	cached, found := lc.fingerprints[folder]
+	if !found || !cached.modTime.Equal(modTime) || lc.now().Sub(cached.cachedAt) >= lc.ttl {
+		return 0, false, false
+	}
+	return cached.fingerprint, cached.ok, true
+}
+
+// putFingerprint caches the subtree fingerprint of the virtual folder taken
+// at its modTime. When the cache is full, the oldest fingerprint is dropped.
+func (lc *listingCache) putFingerprint(folder string, modTime time.Time, fingerprint uint64, ok bool) {
+	if lc == nil {
+		return
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	now := lc.now()
+	if _, cached := lc.fingerprints[folder]; !cached && len(lc.fingerprints) >= lc.maxEntries {
+		var oldest string
+		for folder, cached := range lc.fingerprints {
+			if oldest == "" || cached.cachedAt.Before(lc.fingerprints[oldest].cachedAt) {
+				oldest = folder
+			}
+		}
+		delete(lc.fingerprints, oldest)
+	}
+	lc.fingerprints[folder] = cachedFingerprint{modTime: modTime, cachedAt: now, fingerprint: fingerprint, ok: ok}
+}
+
+func (lc *listingCache) evict(now time.Time) {
+	var oldest string
+	for folder, cached := range lc.listings {
+		if now.Sub(cached.cachedAt) >= lc.ttl {
+			delete(lc.listings, folder)
+			continue
+		}
+		if oldest == "" || cached.cachedAt.Before(lc.listings[oldest].cachedAt) {
+			oldest = folder
+		}
+	}
+	if len(lc.listings) >= lc.maxEntries {
+		delete(lc.listings, oldest)
+	}
+}
+
+// invalidate drops the cached listing of the virtual folder and the cached
+// fingerprints of the folder and its ancestors, whose subtrees contain it.
+func (lc *listingCache) invalidate(folder string) {
+	if lc == nil {
+		return
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	delete(lc.listings, folder)
+	for {
+		delete(lc.fingerprints, folder)
+		parent := path.Dir(folder)
+		if parent == folder {
+			return
+		}
+		folder = parent
+	}
+}
+
+// clear drops all cached listings.
+func (lc *listingCache) clear() {
+	if lc == nil {
+		return
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	clear(lc.listings)
+	clear(lc.fingerprints)
+}
+
+// InvalidateListing drops the cached listing of the folder containing the
+// entry at virtualPath, e.g. when a watcher reports a change of the entry.
+func (s *Service) InvalidateListing(virtualPath string) {
+	s.listings.invalidate(path.Dir(virtualPath))
+}
+
+// folderModTime returns the modification time of the folder desc describes,
+// following a symlink to it.
+func folderModTime(desc Descriptor) time.Time {
+	meta := desc.Metadata
+	if desc.Target != nil {
+		meta = *desc.Target
+	}
+	if meta.ModifiedAt == nil {
+		return time.Time{}
+	}
+	return *meta.ModifiedAt
+}
@@ -0,0 +1,44 @@
+//go:build linux
+
+package files
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeFileRespectsLocks(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "upload.bin")
+	require.NoError(t, os.WriteFile(file, []byte("partial"), 0o600))
+
+	svc := newTestService(t, root)
+	e := echo.New()
+	e.HTTPErrorHandler = jsonAPIError
+	RegisterRoutes(e, svc, HandlerOptions{RespectLocks: true})
+
+	download := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/upload.bin", nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	writer, err := os.Open(file)
+	require.NoError(t, err)
+	defer func() { _ = writer.Close() }()
+	require.NoError(t, syscall.Flock(int(writer.Fd()), syscall.LOCK_EX))
+
+	assert.Equal(t, http.StatusServiceUnavailable, download())
+
+	require.NoError(t, syscall.Flock(int(writer.Fd()), syscall.LOCK_UN))
+	assert.Equal(t, http.StatusOK, download())
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package files
+
+// isLocked reports no locks on platforms without flock.
+func isLocked(string) (bool, error) {
+	return false, nil
+}
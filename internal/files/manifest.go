@@ -0,0 +1,38 @@
+package files
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// readManifest returns the entry names listed in a root manifest. The manifest
+// is a text file holding one entry name per line; blank lines are ignored.
+// Entries must be plain names directly beneath the root.
+func readManifest(manifestPath string) ([]string, error) {
+	// #nosec G304 -- manifest path comes from the server configuration.
+	f, err := os.Open(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("open manifest: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		name := strings.TrimRight(scanner.Text(), "\r")
+		if name == "" {
+			continue
+		}
+		if name == "." || name == ".." || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("manifest %s line %d: invalid entry name: %s", manifestPath, line, name)
+		}
+		names = append(names, name)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+
+	return names, nil
+}
@@ -0,0 +1,60 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MemoryStats reports the heap allocations made while serving a listing with
+// ?debug=mem. Allocations of concurrent requests are included, so the numbers
+// are only meaningful on an otherwise idle server.
+type MemoryStats struct {
+	HeapAllocDeltaBytes int64  `json:"heap_alloc_delta_bytes"`
+	TotalAllocBytes     uint64 `json:"total_alloc_bytes"`
+	Mallocs             uint64 `json:"mallocs"`
+}
+
+type memStatsKey struct{}
+
+// collectMemStats records the memory statistics at the start of requests
+// passing ?debug=mem. runtime.ReadMemStats stops the world, which is why it
+// is only registered in debug mode.
+func collectMemStats(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		switch c.QueryParam("debug") {
+		case "":
+			return next(c)
+		case "mem":
+		default:
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid debug: %s", c.QueryParam("debug")))
+		}
+
+		var before runtime.MemStats
+		runtime.ReadMemStats(&before)
+		req := c.Request()
+		c.SetRequest(req.WithContext(context.WithValue(req.Context(), memStatsKey{}, &before)))
+		return next(c)
+	}
+}
+
+// memoryStatsSince returns the allocations since the baseline stored by
+// collectMemStats, or nil when the request did not ask for them.
+func memoryStatsSince(ctx context.Context) *MemoryStats {
+	before, ok := ctx.Value(memStatsKey{}).(*runtime.MemStats)
+	if !ok {
+		return nil
+	}
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	// #nosec G115 -- heap sizes fit in an int64.
+	delta := int64(after.HeapAlloc) - int64(before.HeapAlloc)
+	return &MemoryStats{
+		HeapAllocDeltaBytes: delta,
+		TotalAllocBytes:     after.TotalAlloc - before.TotalAlloc,
+		Mallocs:             after.Mallocs - before.Mallocs,
+	}
+}
@@ -0,0 +1,61 @@
+package files
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MIME type detections of listing entries selectable with ?mime_detection=.
+const (
+	mimeDetectionContent   = "content"   // sniff the leading bytes of each file, the default
+	mimeDetectionExtension = "extension" // look up the extension of the name without opening the file
+)
+
+// validMimeDetection reports whether name is a supported MIME type detection.
+func validMimeDetection(name string) bool {
+	return name == mimeDetectionContent || name == mimeDetectionExtension
+}
+
+type mimeByExtensionKey struct{}
+
+// contextWithMimeByExtension marks describes within ctx to derive the MIME
+// types of files from their extensions instead of opening each of them.
+func contextWithMimeByExtension(ctx context.Context) context.Context {
+	return context.WithValue(ctx, mimeByExtensionKey{}, true)
+}
+
+// mimeByExtension reports whether describes within ctx skip content sniffing.
+func mimeByExtension(ctx context.Context) bool {
+	byExtension, _ := ctx.Value(mimeByExtensionKey{}).(bool)
+	return byExtension
+}
+
+// extensionMimeType returns the MIME type registered for the extension of
+// name, or application/octet-stream for unknown extensions.
+func extensionMimeType(name string) string {
+	if mimeType := mime.TypeByExtension(filepath.Ext(name)); mimeType != "" {
+		return mimeType
+	}
+	return "application/octet-stream"
+}
+
+// parseMimeDetection applies ?mime_detection=, defaulting to the configured
+// detection. Single entries are always sniffed; only listings can opt out.
+func (h Handler) parseMimeDetection(c echo.Context, params *ListParams) error {
+	detection := c.QueryParam("mime_detection")
+	if detection != "" && !validMimeDetection(detection) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid mime_detection: %s", detection))
+	}
+	params.MimeDetection = detection
+	if cmp.Or(detection, h.opts.ListingMimeDetection) == mimeDetectionExtension {
+		req := c.Request()
+		c.SetRequest(req.WithContext(contextWithMimeByExtension(req.Context())))
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrRootEntry indicates an attempt to modify a configured root folder itself.
+var ErrRootEntry = errors.New("root folders cannot be modified")
+
+// ErrExists indicates that the destination of a change already exists.
+var ErrExists = errors.New("destination already exists")
+
+// ErrInvalidMove indicates a move that cannot be carried out, such as moving
+// a folder into itself.
+var ErrInvalidMove = errors.New("invalid move")
+
+// ErrInvalidOwner indicates an unknown or ambiguous user or group in an
+// ownership change.
+var ErrInvalidOwner = errors.New("invalid owner")
+
+// Owner names the new owning user and group of an entry, either by name or by
+// numeric id. Nil fields leave the respective owner unchanged.
+type Owner struct {
+	User    *string
+	Group   *string
+	UserID  *int
+	GroupID *int
+}
+
+// String describes the owner as user:group, by name or id, leaving
+// unchanged parts empty.
+func (o Owner) String() string {
+	var usr, grp string
+	switch {
+	case o.User != nil:
+		usr = *o.User
+	case o.UserID != nil:
+		usr = strconv.Itoa(*o.UserID)
+	}
+	switch {
+	case o.Group != nil:
+		grp = *o.Group
+	case o.GroupID != nil:
+		grp = strconv.Itoa(*o.GroupID)
+	}
+	return usr + ":" + grp
+}
+
+// Move renames or moves the entry at rel beneath virtual to dstRel beneath
+// dstVirtual, which may be another root. Symlinks are moved themselves, not
+// their targets. Moves across filesystems fall back to copying the entry and
+// deleting the original. It returns the descriptor of the moved entry.
+func (s *Service) Move(ctx context.Context, virtual, rel, dstVirtual, dstRel string) (Descriptor, error) {
+	root, relClean, err := s.resolveRequest(virtual, rel)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	dstRoot, dstClean, err := s.resolveRequest(dstVirtual, dstRel)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	if relClean == "" || dstClean == "" {
+		return Descriptor{}, ErrRootEntry
+	}
+
+	src, err := existingEntryPath(root, relClean)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	dst, err := entryPath(dstRoot, dstClean)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return Descriptor{}, fmt.Errorf("%w: %s", ErrExists, joinVirtual(dstRoot.Virtual, dstClean))
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return Descriptor{}, fmt.Errorf("stat destination: %w", err)
+	}
+	if strings.HasPrefix(dst, src+string(filepath.Separator)) {
+		return Descriptor{}, fmt.Errorf("%w: cannot move a folder into itself", ErrInvalidMove)
+	}
+
+	if err := moveEntry(ctx, src, dst); err != nil {
+		return Descriptor{}, err
+	}
+	s.InvalidateListing(joinVirtual(root.Virtual, relClean))
+	s.InvalidateListing(joinVirtual(dstRoot.Virtual, dstClean))
+	return s.describe(ctx, dstRoot, dstClean)
+}
+
+// entryPath returns the absolute path of the entry at rel without following
+// a final symlink. Its parent folder is resolved and must lie within the
+// root, so changes cannot escape it through symlinked folders.
+func entryPath(root Root, rel string) (string, error) {
+	parent, err := filepath.EvalSymlinks(filepath.Join(root.Source, filepath.FromSlash(path.Dir(rel))))
+	if err != nil {
+		return "", fmt.Errorf("resolve parent of %s: %w", joinVirtual(root.Virtual, rel), err)
+	}
+	if err := ensureReachable(root, parent); err != nil {
+		return "", err
+	}
+	return filepath.Join(parent, path.Base(rel)), nil
+}
+
+// existingEntryPath is entryPath for entries that must exist.
+func existingEntryPath(root Root, rel string) (string, error) {
+	absPath, err := entryPath(root, rel)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(absPath); err != nil {
+		return "", fmt.Errorf("stat %s: %w", joinVirtual(root.Virtual, rel), err)
+	}
+	return absPath, nil
+}
+
+// moveEntry renames src to dst, copying and deleting when they live on
+// different filesystems.
+func moveEntry(ctx context.Context, src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		return fmt.Errorf("rename: %w", err)
+	}
+
+	if err := copyIntoPlace(ctx, src, dst); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(src); err != nil {
+		return fmt.Errorf("remove moved source: %w", err)
+	}
+	return nil
+}
+
+// copyIntoPlace copies src into a staging folder next to dst and renames the
+// copy to dst once complete, so dst never holds a partial copy. On failure
+// only the staging folder is removed, never an entry created at dst by
+// someone else meanwhile.
+func copyIntoPlace(ctx context.Context, src, dst string) error {
+	staging, err := os.MkdirTemp(filepath.Dir(dst), ".tmp-move-*")
+	if err != nil {
+		return fmt.Errorf("create staging folder: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(staging) }()
+
+	staged := filepath.Join(staging, filepath.Base(dst))
+	if err := copyEntry(ctx, src, staged); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%w: %s", ErrExists, filepath.Base(dst))
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("stat destination: %w", err)
+	}
+	if err := os.Rename(staged, dst); err != nil {
+		return fmt.Errorf("rename copy: %w", err)
+	}
+	return nil
+}
+
+// Chmod sets the permission mode of the entry at rel beneath virtual. Symlinks
+// are followed; their targets must lie within the root. It returns the
+// descriptor of the changed entry.
+func (s *Service) Chmod(ctx context.Context, virtual, rel string, mode fs.FileMode) (Descriptor, error) {
+	root, relClean, absPath, err := s.modifiablePath(virtual, rel)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	if err := os.Chmod(absPath, mode); err != nil {
+		return Descriptor{}, fmt.Errorf("chmod %s: %w", joinVirtual(root.Virtual, relClean), err)
+	}
+	s.InvalidateListing(joinVirtual(root.Virtual, relClean))
+	return s.describe(ctx, root, relClean)
+}
+
+// modifiablePath resolves the entry whose attributes a change applies to,
+// following symlinks. Root folders and targets outside the root are rejected.
+func (s *Service) modifiablePath(virtual, rel string) (Root, string, string, error) {
+	root, relClean, err := s.resolveRequest(virtual, rel)
+	if err != nil {
+		return Root{}, "", "", err
+	}
+	if relClean == "" {
+		return Root{}, "", "", ErrRootEntry
+	}
+	absPath, err := filepath.EvalSymlinks(filepath.Join(root.Source, filepath.FromSlash(relClean)))
+	if err != nil {
+		return Root{}, "", "", fmt.Errorf("resolve %s: %w", joinVirtual(root.Virtual, relClean), err)
+	}
+	if err := ensureReachable(root, absPath); err != nil {
+		return Root{}, "", "", err
+	}
+	return root, relClean, absPath, nil
+}
+
+// Chtimes sets the access and modification times of the entry at rel beneath
+// virtual. A zero time leaves the respective timestamp unchanged. Symlinks are
+// followed; their targets must lie within the root.
+func (s *Service) Chtimes(ctx context.Context, virtual, rel string, accessed, modified time.Time) (Descriptor, error) {
+	root, relClean, absPath, err := s.modifiablePath(virtual, rel)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	if err := os.Chtimes(absPath, accessed, modified); err != nil {
+		return Descriptor{}, fmt.Errorf("set times of %s: %w", joinVirtual(root.Virtual, relClean), err)
+	}
+	s.InvalidateListing(joinVirtual(root.Virtual, relClean))
+	return s.describe(ctx, root, relClean)
+}
+
+// Chown changes the owning user and group of the entry at rel beneath
+// virtual to uid and gid, where -1 leaves the respective id unchanged.
+// Symlinks are followed; their targets must lie within the root. Without the
+// privilege to change ownership (CAP_CHOWN) it fails with a permission error.
+func (s *Service) Chown(ctx context.Context, virtual, rel string, uid, gid int) (Descriptor, error) {
+	root, relClean, absPath, err := s.modifiablePath(virtual, rel)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	if err := os.Chown(absPath, uid, gid); err != nil {
+		return Descriptor{}, fmt.Errorf("chown %s: %w", joinVirtual(root.Virtual, relClean), err)
+	}
+	s.InvalidateListing(joinVirtual(root.Virtual, relClean))
+	return s.describe(ctx, root, relClean)
+}
+
+// IDs resolves the owner into the uid and gid passed to Chown, looking up
+// names in the host's user database. An id of -1 leaves the respective
+// owner unchanged.
+func (o Owner) IDs() (int, int, error) {
+	uid, err := ownerID("user", o.User, o.UserID, func(name string) (string, error) {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", fmt.Errorf("lookup user: %w", err)
+		}
+		return u.Uid, nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	gid, err := ownerID("group", o.Group, o.GroupID, func(name string) (string, error) {
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			return "", fmt.Errorf("lookup group: %w", err)
+		}
+		return g.Gid, nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return uid, gid, nil
+}
+
+// ownerID resolves one side of an ownership change given by name or id.
+func ownerID(kind string, name *string, id *int, lookup func(string) (string, error)) (int, error) {
+	switch {
+	case name != nil && id != nil:
+		return 0, fmt.Errorf("%w: %s and %s_id cannot be set together", ErrInvalidOwner, kind, kind)
+	case id != nil:
+		if *id < 0 {
+			return 0, fmt.Errorf("%w: negative %s_id %d", ErrInvalidOwner, kind, *id)
+		}
+		return *id, nil
+	case name != nil:
+		raw, err := lookup(*name)
+		if err != nil {
+			return 0, fmt.Errorf("%w: unknown %s %q", ErrInvalidOwner, kind, *name)
+		}
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s %q has no numeric id", ErrInvalidOwner, kind, *name)
+		}
+		return parsed, nil
+	}
+	return -1, nil
+}
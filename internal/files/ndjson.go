@@ -0,0 +1,140 @@
+package files
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MIMENDJSON is the media type of streamed listings: one JSON:API resource
+// object per line.
+const MIMENDJSON = "application/x-ndjson"
+
+// streamBatch is the number of directory entries read at once by
+// StreamDirectory, bounding its memory regardless of the folder size.
+const streamBatch = 256
+
+// StreamDirectory calls fn with the entries of a directory as they are read,
+// in directory order, instead of collecting them first like ListDirectory.
+// Entries hidden by gitignore rules or removed while reading are skipped. An
+// error returned by fn stops the listing and is returned.
+func (s *Service) StreamDirectory(ctx context.Context, virtual, rel string, fn func(Descriptor) error) error {
+	ctx, span := startSpan(ctx, "files.stream", virtual, rel)
+	count := 0
+	err := s.streamDirectory(ctx, virtual, rel, func(desc Descriptor) error {
+		count++
+		return fn(desc)
+	})
+	span.SetAttributes(attrEntries.Int(count))
+	endSpan(span, err)
+	return err
+}
+
+func (s *Service) streamDirectory(ctx context.Context, virtual, rel string, fn func(Descriptor) error) error {
+	parentDesc, err := s.describeFolder(ctx, virtual, rel)
+	if err != nil {
+		return err
+	}
+	root, relClean := parentDesc.Root, parentDesc.RelPath
+
+	if relClean == "" && root.Manifest != "" {
+		descs, err := s.listManifest(ctx, root)
+		if err != nil {
+			return err
+		}
+		for _, desc := range descs {
+			if err := fn(desc); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	dir, err := os.Open(parentDesc.AbsolutePath)
+	if err != nil {
+		return fmt.Errorf("read dir: %w", err)
+	}
+	defer func() { _ = dir.Close() }()
+
+	for {
+		entries, readErr := dir.ReadDir(streamBatch)
+		descs, err := s.describeEntries(ctx, root, relClean, entries)
+		if err != nil {
+			return err
+		}
+		for _, desc := range descs {
+			if err := fn(desc); err != nil {
+				return err
+			}
+		}
+		if errors.Is(readErr, io.EOF) {
+			return nil
+		}
+		if readErr != nil {
+			return fmt.Errorf("read dir: %w", readErr)
+		}
+	}
+}
+
+// wantsNDJSON reports whether the client asked for a streamed listing with
+// Accept: application/x-ndjson.
+func wantsNDJSON(c echo.Context) bool {
+	for _, accept := range strings.Split(c.Request().Header.Get(echo.HeaderAccept), ",") {
+		mediaType, _, _ := strings.Cut(accept, ";")
+		if strings.EqualFold(strings.TrimSpace(mediaType), MIMENDJSON) {
+			return true
+		}
+	}
+	return false
+}
+
+// streamListing answers a folder request with its entries as NDJSON, one
+// resource object per line, written as the directory is read. Such listings
+// are neither sorted nor paginated, as both need every entry first; filters
+// and sparse fieldsets apply.
+func (h Handler) streamListing(c echo.Context, desc Descriptor, params ListParams) error {
+	for _, name := range []string{"sort", "page[limit]", "page[offset]", "include_self"} {
+		if c.QueryParam(name) != "" {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				fmt.Sprintf("%s is not supported for streamed listings", name))
+		}
+	}
+
+	res := c.Response()
+	w := bufio.NewWriter(res)
+	enc := json.NewEncoder(w)
+	err := h.svc.StreamDirectory(c.Request().Context(), desc.Root.Virtual, desc.RelPath, func(entry Descriptor) error {
+		if len(filterDescriptors([]Descriptor{entry}, params)) == 0 {
+			return nil
+		}
+		if !res.Committed {
+			res.Header().Set(echo.HeaderContentType, MIMENDJSON)
+			res.WriteHeader(http.StatusOK)
+		}
+		return enc.Encode(h.resourceFrom(entry, params))
+	})
+	if err != nil {
+		if res.Committed {
+			// The status is sent already; the truncated stream tells the
+			// client the listing is incomplete.
+			return fmt.Errorf("stream listing: %w", err)
+		}
+		return toHTTPError(err)
+	}
+	if !res.Committed {
+		res.Header().Set(echo.HeaderContentType, MIMENDJSON)
+		res.WriteHeader(http.StatusOK)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("write streamed listing: %w", err)
+	}
+	return nil
+}
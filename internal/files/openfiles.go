@@ -0,0 +1,32 @@
+package files
+
+import (
+	"context"
+	"fmt"
+)
+
+// openFileLimiter caps the number of files the service holds open at once,
+// so heavy listings and downloads queue up instead of failing with EMFILE.
+// A nil limiter imposes no limit.
+type openFileLimiter chan struct{}
+
+func newOpenFileLimiter(limit int) openFileLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return make(openFileLimiter, limit)
+}
+
+// acquire blocks until a file may be opened or ctx is done. The returned
+// function releases the slot.
+func (l openFileLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	select {
+	case l <- struct{}{}:
+		return func() { <-l }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("wait for open file slot: %w", ctx.Err())
+	}
+}
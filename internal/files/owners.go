@@ -0,0 +1,98 @@
+package files
+
+import (
+	"container/list"
+	"os/user"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// ownerCacheEntries is the number of user and of group names cached.
+	ownerCacheEntries = 1024
+	// ownerCacheTTL bounds how long renamed or removed accounts keep being
+	// reported under their cached names.
+	ownerCacheTTL = 5 * time.Minute
+)
+
+// nameCache remembers the account names of recently seen user or group IDs,
+// so listings do not query the user database, possibly LDAP behind NSS, for
+// every entry. Unknown IDs are cached as well, as failing lookups tend to be
+// the slowest. The least recently used ID is dropped when the cache is full.
+type nameCache struct {
+	lookup func(id string) (string, bool)
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[int]*list.Element
+	recent  *list.List // of *cachedName, most recently used first
+}
+
+type cachedName struct {
+	id       int
+	name     string
+	found    bool
+	cachedAt time.Time
+}
+
+func newNameCache(lookup func(id string) (string, bool)) *nameCache {
+	return &nameCache{lookup: lookup, now: time.Now, entries: make(map[int]*list.Element), recent: list.New()}
+}
+
+// newUserNames caches the names of user IDs.
+func newUserNames() *nameCache {
+	return newNameCache(func(id string) (string, bool) {
+		u, err := user.LookupId(id)
+		if err != nil {
+			return "", false
+		}
+		return u.Username, true
+	})
+}
+
+// newGroupNames caches the names of group IDs.
+func newGroupNames() *nameCache {
+	return newNameCache(func(id string) (string, bool) {
+		g, err := user.LookupGroupId(id)
+		if err != nil {
+			return "", false
+		}
+		return g.Name, true
+	})
+}
+
+// name returns the account name of id, and false when the account is
+// unknown.
+func (nc *nameCache) name(id int) (string, bool) {
+	now := nc.now()
+	nc.mu.Lock()
+	if elem, ok := nc.entries[id]; ok {
+		cached := elem.Value.(*cachedName)
+		if now.Sub(cached.cachedAt) < ownerCacheTTL {
+			nc.recent.MoveToFront(elem)
+			nc.mu.Unlock()
+			return cached.name, cached.found
+		}
+		nc.recent.Remove(elem)
+		delete(nc.entries, id)
+	}
+	nc.mu.Unlock()
+
+	// Looked up without holding the lock, so a slow lookup does not stall
+	// the others; concurrent misses of the same ID may look it up twice.
+	name, found := nc.lookup(strconv.Itoa(id))
+
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if elem, ok := nc.entries[id]; ok {
+		nc.recent.Remove(elem)
+	}
+	nc.entries[id] = nc.recent.PushFront(&cachedName{id: id, name: name, found: found, cachedAt: now})
+	if nc.recent.Len() > ownerCacheEntries {
+		oldest := nc.recent.Back()
+		nc.recent.Remove(oldest)
+		delete(nc.entries, oldest.Value.(*cachedName).id)
+	}
+	return name, found
+}
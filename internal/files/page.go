@@ -0,0 +1,57 @@
+package files
+
+import (
+	"context"
+	"time"
+)
+
+// pagesByName reports whether a listing can be sorted, filtered and paginated
+// on names and kinds alone, so only the entries of the requested page need to
+// be described.
+func (p ListParams) pagesByName() bool {
+	return p.SortField == "name" && p.ModeFilter == nil && (p.Filter == nil || !p.Filter.needsMetadata())
+}
+
+// ListPage lists the page of a directory selected by the offset and limit of
+// params, sorted and filtered like a full listing. Entries are read by name
+// only and just those of the page are described, turning a stat per entry
+// into a stat per listed entry. It returns the page and the number of
+// matching entries. params must satisfy pagesByName.
+func (s *Service) ListPage(ctx context.Context, virtual, rel string, params ListParams) ([]Descriptor, int, error) {
+	ctx, span := startSpan(ctx, "files.list_page", virtual, rel)
+	page, total, err := s.listPage(ctx, virtual, rel, params)
+	span.SetAttributes(attrEntries.Int(total))
+	endSpan(span, err)
+	return page, total, err
+}
+
+func (s *Service) listPage(ctx context.Context, virtual, rel string, params ListParams) ([]Descriptor, int, error) {
+	timings := timingsFromContext(ctx)
+	start := time.Now()
+	names, err := s.listNames(ctx, virtual, rel)
+	timings.add(timingReadDir, time.Since(start))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	names = filterDescriptors(names, params)
+	sortDescriptors(names, params)
+	total := len(names)
+	first := min(params.Offset, total)
+	names = names[first:min(first+params.Limit, total)]
+	if len(names) == 0 {
+		return nil, total, nil
+	}
+
+	start = time.Now()
+	defer func() { timings.add(timingDescribe, time.Since(start)) }()
+	children := make([]string, 0, len(names))
+	for _, name := range names {
+		children = append(children, name.RelPath)
+	}
+	page, err := s.describeAll(ctx, names[0].Root, children)
+	if err != nil {
+		return nil, 0, err
+	}
+	return page, total, nil
+}
@@ -0,0 +1,258 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/api"
+	"github.com/thorstenkramm/dendrite-pulse/internal/audit"
+	"github.com/thorstenkramm/dendrite-pulse/internal/auth"
+)
+
+// PatchRequest is the JSON:API document accepted by PATCH on a file resource.
+type PatchRequest struct {
+	Data PatchResource `json:"data"`
+}
+
+// PatchResource identifies the resource to change and the new attributes.
+type PatchResource struct {
+	Type       string          `json:"type"`
+	ID         string          `json:"id"`
+	Attributes PatchAttributes `json:"attributes"`
+}
+
+// PatchAttributes lists the attributes a PATCH may change. Omitted
+// attributes are left untouched.
+type PatchAttributes struct {
+	// Name renames the entry within its folder.
+	Name *string `json:"name"`
+	// Path moves the entry to another virtual path, possibly in another root.
+	Path *string `json:"path"`
+	// PermissionMode sets the octal permission mode, e.g. "0640".
+	PermissionMode *string `json:"permission_mode"`
+	// User and Group change the owner by name; UserID and GroupID by id.
+	User    *string `json:"user"`
+	Group   *string `json:"group"`
+	UserID  *int    `json:"user_id"`
+	GroupID *int    `json:"group_id"`
+	// AccessedAt and ModifiedAt set the timestamps (RFC 3339), e.g. to
+	// restore them from a backup.
+	AccessedAt *time.Time `json:"accessed_at"`
+	ModifiedAt *time.Time `json:"modified_at"`
+}
+
+// patchResource applies the attributes of a JSON:API PATCH document to the
+// addressed entry and answers with the updated resource.
+func (h Handler) patchResource(c echo.Context) error {
+	root, rel, err := parseVirtualPath(c, h.svc.Roots())
+	if err != nil {
+		return err
+	}
+	if h.opts.StrictPaths {
+		if err := checkStrictPath(c); err != nil {
+			return err
+		}
+	}
+	if err := authorize(c, root, ScopeWrite); err != nil {
+		h.audit(c, audit.Event{Action: "patch", Path: joinVirtual(root.Virtual, rel)}, err)
+		return err
+	}
+	if _, authenticated := auth.IdentityFromContext(c.Request().Context()); !authenticated && !h.opts.AnonymousWrites {
+		err := echo.NewHTTPError(http.StatusForbidden, "changes require authentication")
+		h.audit(c, audit.Event{Action: "patch", Path: joinVirtual(root.Virtual, rel)}, err)
+		return err
+	}
+
+	var req PatchRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+	}
+	if req.Data.Type != "files" {
+		return echo.NewHTTPError(http.StatusConflict, `resource type must be "files"`)
+	}
+	if req.Data.ID != "" && req.Data.ID != joinVirtual(root.Virtual, rel) {
+		return echo.NewHTTPError(http.StatusConflict, "resource id does not match the request path")
+	}
+
+	desc, err := h.applyPatch(c, root, rel, req.Data.Attributes)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, api.ContentType)
+	if err := c.JSON(http.StatusOK, ResourceResponse{Data: h.resourceFrom(desc, ListParams{})}); err != nil {
+		return fmt.Errorf("write patch response: %w", err)
+	}
+	return nil
+}
+
+// patchStep is one change of a PATCH, described for the audit log.
+type patchStep struct {
+	action      string
+	detail      string
+	destination string
+	// run applies the change and describes the changed entry.
+	run func(ctx context.Context) (Descriptor, error)
+}
+
+// applyPatch validates all requested changes before carrying them out in
+// order and describes the result. Moves run last so the other changes apply
+// to the entry at its current path.
+func (h Handler) applyPatch(c echo.Context, root Root, rel string, attrs PatchAttributes) (Descriptor, error) {
+	var steps []patchStep
+	if attrs.PermissionMode != nil {
+		mode, err := parsePermissionMode(*attrs.PermissionMode)
+		if err != nil {
+			return Descriptor{}, err
+		}
+		steps = append(steps, patchStep{action: "chmod", detail: *attrs.PermissionMode,
+			run: func(ctx context.Context) (Descriptor, error) {
+				return h.svc.Chmod(ctx, root.Virtual, rel, mode)
+			}})
+	}
+
+	if owner, ok := patchOwner(attrs); ok {
+		// Look up names now, so an unknown owner fails before any change.
+		uid, gid, err := owner.IDs()
+		if err != nil {
+			return Descriptor{}, toHTTPError(err)
+		}
+		steps = append(steps, patchStep{action: "chown", detail: owner.String(),
+			run: func(ctx context.Context) (Descriptor, error) {
+				return h.svc.Chown(ctx, root.Virtual, rel, uid, gid)
+			}})
+	}
+	if accessed, modified, ok := patchTimes(attrs); ok {
+		steps = append(steps, patchStep{action: "chtimes", detail: timesDetail(accessed, modified),
+			run: func(ctx context.Context) (Descriptor, error) {
+				return h.svc.Chtimes(ctx, root.Virtual, rel, accessed, modified)
+			}})
+	}
+
+	dstRoot, dstRel, move, err := h.moveDestination(root, rel, attrs)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	if move {
+		destination := joinVirtual(dstRoot.Virtual, dstRel)
+		if err := authorizeMove(c, root, dstRoot); err != nil {
+			h.audit(c, audit.Event{Action: "move", Path: joinVirtual(root.Virtual, rel), Destination: destination}, err)
+			return Descriptor{}, err
+		}
+		steps = append(steps, patchStep{action: "move", destination: destination,
+			run: func(ctx context.Context) (Descriptor, error) {
+				return h.svc.Move(ctx, root.Virtual, rel, dstRoot.Virtual, dstRel)
+			}})
+	}
+
+	ctx := c.Request().Context()
+	if len(steps) == 0 {
+		desc, err := h.svc.Describe(ctx, root.Virtual, rel)
+		return desc, toHTTPError(err)
+	}
+	var desc Descriptor
+	for _, step := range steps {
+		desc, err = step.run(ctx)
+		h.audit(c, audit.Event{
+			Action:      step.action,
+			Path:        joinVirtual(root.Virtual, rel),
+			Destination: step.destination,
+			Detail:      step.detail,
+		}, err)
+		if err != nil {
+			return Descriptor{}, toHTTPError(err)
+		}
+	}
+	return desc, nil
+}
+
+// patchOwner collects the ownership attributes of a PATCH and reports whether
+// any is set.
+func patchOwner(attrs PatchAttributes) (Owner, bool) {
+	owner := Owner{User: attrs.User, Group: attrs.Group, UserID: attrs.UserID, GroupID: attrs.GroupID}
+	return owner, attrs.User != nil || attrs.Group != nil || attrs.UserID != nil || attrs.GroupID != nil
+}
+
+// patchTimes returns the timestamps a PATCH sets, zero for those it leaves
+// unchanged, and reports whether any is set.
+func patchTimes(attrs PatchAttributes) (time.Time, time.Time, bool) {
+	var accessed, modified time.Time
+	if attrs.AccessedAt != nil {
+		accessed = *attrs.AccessedAt
+	}
+	if attrs.ModifiedAt != nil {
+		modified = *attrs.ModifiedAt
+	}
+	return accessed, modified, attrs.AccessedAt != nil || attrs.ModifiedAt != nil
+}
+
+// timesDetail describes the timestamps a PATCH sets for the audit log.
+func timesDetail(accessed, modified time.Time) string {
+	var parts []string
+	if !accessed.IsZero() {
+		parts = append(parts, "accessed_at="+accessed.Format(time.RFC3339Nano))
+	}
+	if !modified.IsZero() {
+		parts = append(parts, "modified_at="+modified.Format(time.RFC3339Nano))
+	}
+	return strings.Join(parts, " ")
+}
+
+// parsePermissionMode parses an octal permission mode such as "0644". The
+// setuid, setgid and sticky bits are rejected, so clients cannot create
+// setuid executables.
+func parsePermissionMode(raw string) (fs.FileMode, error) {
+	bits, err := strconv.ParseUint(raw, 8, 32)
+	if err != nil || bits > uint64(fs.ModePerm) {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid permission_mode: %s", raw))
+	}
+	return fs.FileMode(bits), nil
+}
+
+// authorizeMove checks the scopes a move from root to dstRoot needs on top
+// of write access to root: moving to another root removes the entry from
+// root and writes it to dstRoot.
+func authorizeMove(c echo.Context, root, dstRoot Root) error {
+	if dstRoot.Virtual == root.Virtual {
+		return nil
+	}
+	if err := authorize(c, root, ScopeDelete); err != nil {
+		return err
+	}
+	return authorize(c, dstRoot, ScopeWrite)
+}
+
+// moveDestination returns where name or path move the entry, and whether a
+// move was requested at all.
+func (h Handler) moveDestination(root Root, rel string, attrs PatchAttributes) (Root, string, bool, error) {
+	switch {
+	case attrs.Name != nil && attrs.Path != nil:
+		return Root{}, "", false, echo.NewHTTPError(http.StatusBadRequest, "name and path cannot be changed together")
+	case attrs.Name != nil:
+		name := *attrs.Name
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\x00") {
+			return Root{}, "", false, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid name: %q", name))
+		}
+		return root, path.Join(path.Dir(rel), name), true, nil
+	case attrs.Path != nil:
+		target := *attrs.Path
+		if !strings.HasPrefix(target, "/") {
+			return Root{}, "", false, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid path: %q", target))
+		}
+		dstRoot, dstRel, ok := matchRoot(path.Clean(target), h.svc.Roots())
+		if !ok {
+			return Root{}, "", false, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("no file root for path: %s", target))
+		}
+		return dstRoot, dstRel, true, nil
+	}
+	return Root{}, "", false, nil
+}
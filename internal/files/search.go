@@ -0,0 +1,158 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// searchSegment is the path suffix that turns a folder request into a
+	// search below that folder, e.g. /api/v1/files/public/-/search.
+	searchSegment = "-/search"
+	// maxSearchDepth is the deepest folder level a recursive search visits.
+	maxSearchDepth = 32
+	// maxSearchResults bounds the matches of one search, so a broad pattern
+	// on a large subtree cannot exhaust memory.
+	maxSearchResults = 1000
+)
+
+// ErrSearchLimit indicates a search with more than maxSearchResults matches.
+var ErrSearchLimit = errors.New("search exceeds result limit")
+
+// SearchOptions selects the entries a search returns.
+type SearchOptions struct {
+	// Name is a path.Match glob matched against entry names, e.g. *.gpx.
+	Name string
+	// Recursive searches all subfolders instead of the folder's own entries.
+	Recursive bool
+}
+
+// query renders the options as query parameters for pagination links.
+func (o SearchOptions) query() string {
+	return fmt.Sprintf("&name=%s&recursive=%t", url.QueryEscape(o.Name), o.Recursive)
+}
+
+// cutSearchPath strips a -/search, -/grep or -/thumbnail suffix from rel and
+// returns it as the second result, which is empty when rel has none.
+func cutSearchPath(rel string) (string, string) {
+	for _, segment := range []string{searchSegment, grepSegment, thumbnailSegment} {
+		if rel == segment {
+			return "", segment
+		}
+		if base, ok := strings.CutSuffix(rel, "/"+segment); ok {
+			return base, segment
+		}
+	}
+	return rel, ""
+}
+
+// Search returns the entries below the folder desc resolves to whose names
+// match opts.Name. Recursive searches descend up to maxSearchDepth levels;
+// symlinked folders are not descended into, subfolders that cannot be read
+// are skipped, and entries hidden by respected gitignore rules are left
+// out. It fails with ErrSearchLimit once more than maxSearchResults entries
+// match.
+func (s *Service) Search(ctx context.Context, desc Descriptor, opts SearchOptions) ([]Descriptor, error) {
+	maxDepth := 1
+	if opts.Recursive {
+		maxDepth = maxSearchDepth
+	}
+
+	results := []Descriptor{}
+	walker := treeWalker{
+		svc:  s,
+		root: desc.Root,
+		visit: func(rel, _ string, info fs.FileInfo, depth int) (bool, error) {
+			matched, err := path.Match(opts.Name, info.Name())
+			if err != nil {
+				return false, fmt.Errorf("match %s: %w", opts.Name, err)
+			}
+			if matched {
+				if len(results) == maxSearchResults {
+					return false, ErrSearchLimit
+				}
+				match, err := s.describe(ctx, desc.Root, rel)
+				if err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return false, err
+				}
+				if err == nil {
+					results = append(results, match)
+				}
+			}
+			return depth < maxDepth, nil
+		},
+		unreadable: func(string) {},
+	}
+	if err := walker.walk(ctx, desc.RelPath, desc.AbsolutePath); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// serveSearch answers GET <folder>/-/search?name=<glob>&recursive=true with
+// the matching entries as a paginated listing.
+func (h Handler) serveSearch(c echo.Context, root Root, rel string) error {
+	opts, err := parseSearchOptions(c)
+	if err != nil {
+		return err
+	}
+	params, err := h.parseListParams(c, root)
+	if err != nil {
+		return err
+	}
+	params.Search = &opts
+
+	ctx := c.Request().Context()
+	desc, err := h.svc.Describe(ctx, root.Virtual, rel)
+	if err != nil {
+		return toHTTPError(err)
+	}
+	if desc.TargetKind != kindFolder {
+		return echo.NewHTTPError(http.StatusBadRequest, "search requires a folder")
+	}
+
+	results, err := h.svc.Search(ctx, desc, opts)
+	if errors.Is(err, ErrSearchLimit) {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity,
+			fmt.Sprintf("search matches more than %d entries", maxSearchResults))
+	}
+	if err != nil {
+		return toHTTPError(err)
+	}
+	return h.sendCollectionJSON(c, results, params, &desc)
+}
+
+func parseSearchOptions(c echo.Context) (SearchOptions, error) {
+	opts := SearchOptions{Name: c.QueryParam("name")}
+	if opts.Name == "" {
+		return opts, echo.NewHTTPError(http.StatusBadRequest, "search requires name")
+	}
+	if _, err := path.Match(opts.Name, ""); err != nil {
+		return opts, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid name pattern: %s", opts.Name))
+	}
+
+	recursive, err := parseRecursive(c)
+	opts.Recursive = recursive
+	return opts, err
+}
+
+// parseRecursive parses ?recursive=true|false, which defaults to false.
+func parseRecursive(c echo.Context) (bool, error) {
+	switch c.QueryParam("recursive") {
+	case "", "false":
+		return false, nil
+	case "true":
+		return true, nil
+	default:
+		return false, echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("invalid recursive: %s", c.QueryParam("recursive")))
+	}
+}
@@ -2,18 +2,23 @@
 package files
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
-	"os/user"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/parallel"
 )
 
 // ErrRootNotFound indicates the requested virtual root does not exist.
@@ -22,52 +27,227 @@ var ErrRootNotFound = errors.New("file root not found")
 // ErrOutsideRoot indicates a path resolves outside its configured root.
 var ErrOutsideRoot = errors.New("path escapes configured root")
 
+// ErrSymlinkDepth indicates a symlink chain longer than the configured maximum.
+var ErrSymlinkDepth = errors.New("symlink chain exceeds maximum depth")
+
+// ErrPathDepth indicates a path with more segments than the configured maximum.
+var ErrPathDepth = errors.New("path exceeds maximum depth")
+
+// ErrOverlappingPaths indicates a set of paths where one contains another.
+var ErrOverlappingPaths = errors.New("paths overlap")
+
 // Root maps a virtual folder to a source directory.
 type Root struct {
 	Virtual string
 	Source  string
+	// Manifest optionally names a file listing the entries of the root folder,
+	// one per line, used instead of reading the directory. Entries missing on
+	// disk are skipped; downloads always access the real files.
+	Manifest string
+	// DefaultLimit is the page size of listings when the client omits
+	// page[limit]. Zero uses the global default.
+	DefaultLimit int
+	// Access restricts the clients that may use the root.
+	Access AccessPolicy
+	// ReadOnly rejects every change to the entries of the root, whatever
+	// Access grants.
+	ReadOnly bool
+	// FollowSymlinksOutside lists absolute folders outside Source that
+	// symlinks within the root may point into, e.g. other mounts linked into
+	// the root. Targets elsewhere outside Source are rejected.
+	FollowSymlinksOutside []string
+	// ShowHidden lists dotfiles and entries matching HiddenPatterns. By
+	// default they are left out of listings and not found when requested.
+	ShowHidden bool
+	// HiddenPatterns are path.Match globs of further entry names hidden
+	// unless ShowHidden is set, e.g. "*.bak".
+	HiddenPatterns []string
 }
 
+// Options tunes how the Service describes filesystem entries.
+type Options struct {
+	// ExportBase is the directory exported to NFS clients. When set, each
+	// entry reports its path relative to it as MountPath.
+	ExportBase string
+	// SniffBytes is the number of leading bytes read to detect the MIME type
+	// of files. Defaults to DefaultSniffBytes when zero.
+	SniffBytes int
+	// MaxSymlinkDepth is the number of chained symlinks followed before an
+	// entry is rejected. Defaults to DefaultMaxSymlinkDepth when zero.
+	MaxSymlinkDepth int
+	// HideOwnership leaves user, group and their IDs empty so host account
+	// names are not exposed.
+	HideOwnership bool
+	// NumericOwners reports user and group IDs in place of their account
+	// names, skipping the user database lookups.
+	NumericOwners bool
+	// ExposeFileID reports a stable ID derived from device and inode as
+	// FileID, so clients can track entries across renames.
+	ExposeFileID bool
+	// MaxOpenFiles caps the files opened concurrently for MIME sniffing and
+	// downloads; further opens wait for a free slot. Zero means no limit.
+	MaxOpenFiles int
+	// MaxPathDepth rejects relative paths with more segments than this,
+	// bounding the work spent on pathologically deep paths. Zero means no limit.
+	MaxPathDepth int
+	// ExposeACL reports the POSIX access ACL of each entry as ACL. Only
+	// supported on Linux.
+	ExposeACL bool
+	// StartupConcurrency bounds the root sources resolved at once by
+	// NewService. Defaults to DefaultStartupConcurrency when zero.
+	StartupConcurrency int
+	// RespectGitignore hides entries matched by .gitignore files from
+	// listings and answers direct requests for them as not found.
+	RespectGitignore bool
+	// ListingCacheTTL caches the listings of folders for this long, as long
+	// as the folder's modification time is unchanged. Zero disables caching.
+	ListingCacheTTL time.Duration
+	// ListingCacheEntries caps the folders whose listings are cached.
+	// Defaults to DefaultListingCacheEntries when zero.
+	ListingCacheEntries int
+	// ListConcurrency bounds the entries described at once while listing a
+	// folder. Defaults to DefaultListConcurrency when zero.
+	ListConcurrency int
+	// MimeTypes maps lowercase file name extensions with their leading dot
+	// to MIME types reported without sniffing the content, for formats
+	// http.DetectContentType reports as text/xml or octet-stream.
+	MimeTypes map[string]string
+	// ThumbnailCacheDir keeps generated thumbnails for reuse. Thumbnails are
+	// generated on every request when empty.
+	ThumbnailCacheDir string
+	// ThumbnailCacheSize bounds the bytes kept in ThumbnailCacheDir; the
+	// least recently used thumbnails are deleted beyond it. Defaults to
+	// DefaultThumbnailCacheSize when zero.
+	ThumbnailCacheSize int64
+}
+
+// DefaultSniffBytes is the default MIME sniffing sample size, matching the
+// amount of data http.DetectContentType considers.
+const DefaultSniffBytes = 512
+
+// DefaultStartupConcurrency is the default number of root sources resolved at once.
+const DefaultStartupConcurrency = 8
+
+// DefaultListConcurrency is the default number of entries described at once
+// while listing a folder.
+const DefaultListConcurrency = 8
+
+// DefaultMaxSymlinkDepth is the default number of chained symlinks followed.
+const DefaultMaxSymlinkDepth = 8
+
 // Service exposes file operations scoped to configured roots.
 type Service struct {
-	roots   map[string]Root
-	ordered []Root
+	roots     atomic.Pointer[rootSet]
+	opts      Options
+	newTicker func(time.Duration) ticker
+	readDir   func(string) ([]os.DirEntry, error)
+	openFiles openFileLimiter
+	// decodes bounds the images decoded for thumbnails at once.
+	decodes    chan struct{}
+	thumbnails *thumbnailCache
+	listings   *listingCache
+	users      *nameCache
+	groups     *nameCache
 }
 
 const (
 	kindFile    = "file"
 	kindFolder  = "folder"
 	kindSymlink = "symlink"
+	kindFIFO    = "fifo"
+	kindSocket  = "socket"
+	kindDevice  = "device"
 )
 
 // NewService creates a new Service.
-func NewService(roots []Root) (*Service, error) {
+func NewService(roots []Root, opts Options) (*Service, error) {
 	if len(roots) == 0 {
 		return nil, fmt.Errorf("no file roots provided")
 	}
 
-	ordered := make([]Root, 0, len(roots))
-	rootMap := make(map[string]Root, len(roots))
-	for _, r := range roots {
-		if _, exists := rootMap[r.Virtual]; exists {
-			return nil, fmt.Errorf("duplicate file root: %s", r.Virtual)
-		}
-		resolvedSource, err := filepath.EvalSymlinks(r.Source)
+	if opts.SniffBytes <= 0 {
+		opts.SniffBytes = DefaultSniffBytes
+	}
+	if opts.MaxSymlinkDepth <= 0 {
+		opts.MaxSymlinkDepth = DefaultMaxSymlinkDepth
+	}
+	if opts.StartupConcurrency <= 0 {
+		opts.StartupConcurrency = DefaultStartupConcurrency
+	}
+	if opts.ListConcurrency <= 0 {
+		opts.ListConcurrency = DefaultListConcurrency
+	}
+	if opts.ExportBase != "" {
+		resolvedBase, err := filepath.EvalSymlinks(opts.ExportBase)
 		if err != nil {
-			return nil, fmt.Errorf("resolve file root %s: %w", r.Virtual, err)
+			return nil, fmt.Errorf("resolve export base: %w", err)
 		}
-		normalized := Root{
-			Virtual: r.Virtual,
-			Source:  filepath.Clean(resolvedSource),
-		}
-		ordered = append(ordered, normalized)
-		rootMap[r.Virtual] = normalized
+		opts.ExportBase = filepath.Clean(resolvedBase)
+	}
+
+	ordered, err := resolveRoots(roots, opts.StartupConcurrency)
+	if err != nil {
+		return nil, err
 	}
 
-	return &Service{
-		roots:   rootMap,
-		ordered: ordered,
-	}, nil
+	s := &Service{
+		opts:       opts,
+		newTicker:  newTimeTicker,
+		readDir:    os.ReadDir,
+		openFiles:  newOpenFileLimiter(opts.MaxOpenFiles),
+		decodes:    make(chan struct{}, maxThumbnailDecodes),
+		thumbnails: newThumbnailCache(opts.ThumbnailCacheDir, opts.ThumbnailCacheSize),
+		listings:   newListingCache(opts.ListingCacheTTL, opts.ListingCacheEntries),
+		users:      newUserNames(),
+		groups:     newGroupNames(),
+	}
+	s.roots.Store(newRootSet(ordered, nil))
+	return s, nil
+}
+
+// ReplaceRoots swaps the configured roots for roots, e.g. after the
+// configuration was reloaded. The roots are resolved first and left
+// unchanged on errors. Requests in flight finish with the roots they
+// started with; roots kept with the same source keep their availability.
+func (s *Service) ReplaceRoots(roots []Root) error {
+	if len(roots) == 0 {
+		return fmt.Errorf("no file roots provided")
+	}
+	ordered, err := resolveRoots(roots, s.opts.StartupConcurrency)
+	if err != nil {
+		return err
+	}
+	s.roots.Store(newRootSet(ordered, s.roots.Load()))
+	s.listings.clear()
+	return nil
+}
+
+// rootSet holds the roots a Service serves. It is never modified, but
+// replaced as a whole by ReplaceRoots.
+type rootSet struct {
+	byVirtual map[string]Root
+	ordered   []Root
+	available map[string]*atomic.Bool
+}
+
+// newRootSet indexes ordered, taking over the availability of roots with the
+// same virtual folder and source from previous, which may be nil.
+func newRootSet(ordered []Root, previous *rootSet) *rootSet {
+	set := &rootSet{
+		byVirtual: make(map[string]Root, len(ordered)),
+		ordered:   ordered,
+		available: newAvailability(ordered),
+	}
+	for _, r := range ordered {
+		set.byVirtual[r.Virtual] = r
+		if previous == nil {
+			continue
+		}
+		if old, ok := previous.byVirtual[r.Virtual]; ok && old.Source == r.Source {
+			set.available[r.Virtual] = previous.available[r.Virtual]
+		}
+	}
+	return set
 }
 
 // Descriptor describes a resolved filesystem entry.
@@ -76,11 +256,13 @@ type Descriptor struct {
 	VirtualPath  string
 	RelPath      string
 	Name         string
-	Kind         string // file, folder, symlink
+	Kind         string // file, folder, symlink, fifo, socket, device
 	TargetKind   string // after resolving symlinks
 	AbsolutePath string // resolved target path (for file or directory)
 	LinkPath     string // symlink path; equals AbsolutePath when not a symlink
 	Metadata     Metadata
+	Target       *Metadata // resolved target metadata; set for symlinks only
+	Err          error     // why a listed entry could not be described; Metadata then describes the entry itself
 }
 
 // Metadata captures file attributes.
@@ -99,17 +281,23 @@ type Metadata struct {
 	ModifiedAt     *time.Time
 	ChangedAt      *time.Time
 	BornAt         *time.Time
+	MountPath      *string // path relative to the configured export base
+	LinkTarget     *string // target of a symlink described itself, as stored in the link
+	FileID         *string // device and inode; nil unless exposed and supported
+	ACL            *ACL    // access ACL; nil unless exposed
 }
 
 // HasSingleRootSlash returns true if there's exactly one root and its virtual path is "/".
 func (s *Service) HasSingleRootSlash() bool {
-	return len(s.ordered) == 1 && s.ordered[0].Virtual == "/"
+	ordered := s.roots.Load().ordered
+	return len(ordered) == 1 && ordered[0].Virtual == "/"
 }
 
 // ListRoots returns descriptors for all configured roots.
 func (s *Service) ListRoots(ctx context.Context) ([]Descriptor, error) {
-	descs := make([]Descriptor, 0, len(s.ordered))
-	for _, root := range s.ordered {
+	ordered := s.roots.Load().ordered
+	descs := make([]Descriptor, 0, len(ordered))
+	for _, root := range ordered {
 		desc, err := s.describe(ctx, root, "")
 		if err != nil {
 			return nil, err
@@ -119,57 +307,352 @@ func (s *Service) ListRoots(ctx context.Context) ([]Descriptor, error) {
 	return descs, nil
 }
 
+// resolveRoots resolves the symlinks of every root source, at most
+// concurrency at a time, and reports all roots that fail to resolve.
+func resolveRoots(roots []Root, concurrency int) ([]Root, error) {
+	seen := make(map[string]bool, len(roots))
+	for _, r := range roots {
+		if seen[r.Virtual] {
+			return nil, fmt.Errorf("duplicate file root: %s", r.Virtual)
+		}
+		seen[r.Virtual] = true
+	}
+
+	resolved := make([]Root, len(roots))
+	err := parallel.Each(len(roots), concurrency, func(i int) error {
+		r := roots[i]
+		source, err := filepath.EvalSymlinks(r.Source)
+		if err != nil {
+			return fmt.Errorf("resolve file root %s: %w", r.Virtual, err)
+		}
+		// Symlink targets are compared fully resolved, so the allowed
+		// folders are resolved as well.
+		outside := make([]string, 0, len(r.FollowSymlinksOutside))
+		for _, dir := range r.FollowSymlinksOutside {
+			resolvedDir, err := filepath.EvalSymlinks(dir)
+			if err != nil {
+				return fmt.Errorf("resolve symlink target folder of file root %s: %w", r.Virtual, err)
+			}
+			outside = append(outside, filepath.Clean(resolvedDir))
+		}
+		resolved[i] = Root{
+			Virtual:               r.Virtual,
+			Source:                filepath.Clean(source),
+			Manifest:              r.Manifest,
+			DefaultLimit:          r.DefaultLimit,
+			Access:                r.Access,
+			ReadOnly:              r.ReadOnly,
+			FollowSymlinksOutside: outside,
+			ShowHidden:            r.ShowHidden,
+			HiddenPatterns:        r.HiddenPatterns,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("resolve file roots: %w", err)
+	}
+	return resolved, nil
+}
+
+// resolveRequest resolves the root and cleaned relative path of a requested
+// path, rejecting paths that are too deep or hidden by the root or gitignore
+// rules.
+func (s *Service) resolveRequest(virtual, rel string) (Root, string, error) {
+	root, err := s.resolveRoot(virtual)
+	if err != nil {
+		return Root{}, "", err
+	}
+	relClean, err := cleanRelativePath(rel, s.opts.MaxPathDepth)
+	if err != nil {
+		return Root{}, "", err
+	}
+	if err := s.checkIgnored(root, relClean); err != nil {
+		return Root{}, "", err
+	}
+	return root, relClean, nil
+}
+
 // Describe resolves a single path beneath a virtual root.
 func (s *Service) Describe(ctx context.Context, virtual, rel string) (Descriptor, error) {
-	root, ok := s.lookupRoot(virtual)
-	if !ok {
-		return Descriptor{}, fmt.Errorf("%w: %s", ErrRootNotFound, virtual)
+	ctx, span := startSpan(ctx, "files.describe", virtual, rel)
+	desc, err := s.describePath(ctx, virtual, rel)
+	endSpan(span, err)
+	return desc, err
+}
+
+func (s *Service) describePath(ctx context.Context, virtual, rel string) (Descriptor, error) {
+	root, relClean, err := s.resolveRequest(virtual, rel)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	return s.describe(ctx, root, relClean)
+}
+
+// ResolvePaths describes each of a list of absolute virtual paths, possibly
+// in different roots, like Describe. Every path is validated independently and
+// the errors of all failing paths are joined, each prefixed with its path.
+// Duplicates and paths nested within another are rejected with
+// ErrOverlappingPaths.
+func (s *Service) ResolvePaths(ctx context.Context, virtualPaths []string) ([]Descriptor, error) {
+	ordered := s.roots.Load().ordered
+	descs := make([]Descriptor, 0, len(virtualPaths))
+	var errs []error
+	for _, p := range virtualPaths {
+		root, rel, ok := matchRoot(path.Clean("/"+p), ordered)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %w", p, ErrRootNotFound))
+			continue
+		}
+		desc, err := s.Describe(ctx, root.Virtual, rel)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p, err))
+			continue
+		}
+		descs = append(descs, desc)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	for i, a := range descs {
+		for _, b := range descs[i+1:] {
+			if a.VirtualPath == b.VirtualPath || isWithin(a.VirtualPath, b.VirtualPath) ||
+				isWithin(b.VirtualPath, a.VirtualPath) {
+				return nil, fmt.Errorf("%w: %s and %s", ErrOverlappingPaths, a.VirtualPath, b.VirtualPath)
+			}
+		}
 	}
-	return s.describe(ctx, root, rel)
+	return descs, nil
+}
+
+// isWithin reports whether virtual path child lies below parent.
+func isWithin(parent, child string) bool {
+	return parent == "/" || strings.HasPrefix(child, parent+"/")
+}
+
+// DescribeLink returns the descriptor for a virtual path like Describe, but
+// reports the own metadata of a symlink (lstat) instead of its target's.
+func (s *Service) DescribeLink(ctx context.Context, virtual, rel string) (Descriptor, error) {
+	root, relClean, err := s.resolveRequest(virtual, rel)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	return s.describeLink(ctx, root, relClean)
 }
 
 // Roots returns configured roots.
 func (s *Service) Roots() []Root {
-	out := make([]Root, len(s.ordered))
-	copy(out, s.ordered)
+	ordered := s.roots.Load().ordered
+	out := make([]Root, len(ordered))
+	copy(out, ordered)
 	return out
 }
 
 // ListDirectory lists entries within a directory.
 func (s *Service) ListDirectory(ctx context.Context, virtual, rel string) ([]Descriptor, error) {
-	root, ok := s.lookupRoot(virtual)
-	if !ok {
-		return nil, fmt.Errorf("%w: %s", ErrRootNotFound, virtual)
+	ctx, span := startSpan(ctx, "files.list", virtual, rel)
+	descs, err := s.listDirectory(ctx, virtual, rel)
+	span.SetAttributes(attrEntries.Int(len(descs)))
+	endSpan(span, err)
+	return descs, err
+}
+
+func (s *Service) listDirectory(ctx context.Context, virtual, rel string) ([]Descriptor, error) {
+	parentDesc, err := s.describeFolder(ctx, virtual, rel)
+	if err != nil {
+		return nil, err
 	}
+	root, relClean := parentDesc.Root, parentDesc.RelPath
 
-	relClean, err := cleanRelativePath(rel)
+	if relClean == "" && root.Manifest != "" {
+		return s.listManifest(ctx, root)
+	}
+	modTime := folderModTime(parentDesc)
+	sniffed := !mimeByExtension(ctx)
+	// Listings with unresolved symlinks are neither served from nor kept in
+	// the cache of resolved ones.
+	cacheable := linksResolved(ctx)
+	if descs, ok := s.listings.get(parentDesc.VirtualPath, modTime, sniffed); ok && cacheable {
+		return descs, nil
+	}
+
+	timings := timingsFromContext(ctx)
+	start := time.Now()
+	entries, err := s.readDir(parentDesc.AbsolutePath)
+	timings.add(timingReadDir, time.Since(start))
+	if err != nil {
+		return nil, fmt.Errorf("read dir: %w", err)
+	}
+
+	start = time.Now()
+	defer func() { timings.add(timingDescribe, time.Since(start)) }()
+
+	descs, err := s.describeEntries(ctx, root, relClean, entries)
 	if err != nil {
 		return nil, err
 	}
 
-	parentDesc, err := s.describe(ctx, root, relClean)
+	// Listings without owner names are incomplete for other requests, while
+	// complete ones serve those as well.
+	if ownerNamesWanted(ctx) && cacheable {
+		s.listings.put(parentDesc.VirtualPath, modTime, descs, sniffed)
+	}
+	return descs, nil
+}
+
+// describeEntries describes the entries of the folder rel read from disk,
+// leaving out those hidden by gitignore rules.
+func (s *Service) describeEntries(ctx context.Context, root Root, rel string, entries []os.DirEntry) ([]Descriptor, error) {
+	ignores := s.listingIgnores(root, rel)
+	children := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		childRel := path.Join(rel, entry.Name())
+		if !ignores.ignored(childRel, entry.IsDir()) {
+			children = append(children, childRel)
+		}
+	}
+	return s.describeAll(ctx, root, children)
+}
+
+// describeAll describes the entries at the relative paths children, up to
+// ListConcurrency at once so the stat, ownership lookup and MIME sniffing of
+// slow filesystems overlap. The descriptors keep the order of children;
+// entries removed since the directory was read are left out.
+func (s *Service) describeAll(ctx context.Context, root Root, children []string) ([]Descriptor, error) {
+	describe := s.describe
+	if !linksResolved(ctx) {
+		describe = s.describeLink
+	}
+	descs := make([]Descriptor, len(children))
+	found := make([]bool, len(children))
+	errs := make([]error, len(children))
+	// Errors are kept per entry rather than returned, so the first one in
+	// directory order is reported instead of all of them joined.
+	_ = parallel.Each(len(children), s.opts.ListConcurrency, func(i int) error {
+		if err := ctx.Err(); err != nil {
+			errs[i] = fmt.Errorf("context canceled: %w", err)
+			return nil
+		}
+		desc, err := describe(ctx, root, children[i])
+		if err != nil && ctx.Err() == nil {
+			// One broken entry, such as a looping symlink, does not fail the
+			// listing; it is listed along with its error.
+			desc, err = s.describeBroken(ctx, root, children[i], err)
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			// Removed since the directory was read; list the remaining entries.
+			return nil
+		}
+		descs[i], found[i], errs[i] = desc, err == nil, err
+		return nil
+	})
+	if err := cmp.Or(errs...); err != nil {
+		return nil, err
+	}
+
+	listed := descs[:0]
+	for i, desc := range descs {
+		if found[i] {
+			listed = append(listed, desc)
+		}
+	}
+	return listed, nil
+}
+
+// ListNames lists a directory like ListDirectory, but only fills in the name,
+// virtual path and kind of each entry. Kinds come from the directory entries
+// read in one pass, without a stat per entry; symlinks are not resolved.
+// Root folders with a manifest are listed from the manifest in full, as
+// ListDirectory does.
+func (s *Service) ListNames(ctx context.Context, virtual, rel string) ([]Descriptor, error) {
+	ctx, span := startSpan(ctx, "files.list_names", virtual, rel)
+	descs, err := s.listNames(ctx, virtual, rel)
+	span.SetAttributes(attrEntries.Int(len(descs)))
+	endSpan(span, err)
+	return descs, err
+}
+
+func (s *Service) listNames(ctx context.Context, virtual, rel string) ([]Descriptor, error) {
+	parentDesc, err := s.describeFolder(ctx, virtual, rel)
 	if err != nil {
 		return nil, err
 	}
-	if parentDesc.TargetKind != kindFolder {
-		return nil, fmt.Errorf("not a directory: %s", parentDesc.VirtualPath)
+	root, relClean := parentDesc.Root, parentDesc.RelPath
+
+	if relClean == "" && root.Manifest != "" {
+		return s.listManifest(ctx, root)
 	}
 
-	entries, err := os.ReadDir(parentDesc.AbsolutePath)
+	entries, err := s.readDir(parentDesc.AbsolutePath)
 	if err != nil {
 		return nil, fmt.Errorf("read dir: %w", err)
 	}
 
+	ignores := s.listingIgnores(root, relClean)
 	descs := make([]Descriptor, 0, len(entries))
 	for _, entry := range entries {
-		select {
-		case <-ctx.Done():
-			return nil, fmt.Errorf("context canceled: %w", ctx.Err())
-		default:
+		childRel := path.Join(relClean, entry.Name())
+		if ignores.ignored(childRel, entry.IsDir()) {
+			continue
+		}
+		kind := classifyMode(entry.Type())
+		desc := Descriptor{
+			Root:        root,
+			RelPath:     childRel,
+			Name:        entry.Name(),
+			Kind:        kind,
+			TargetKind:  kind,
+			VirtualPath: joinVirtual(root.Virtual, childRel),
 		}
+		desc.Metadata = Metadata{Name: desc.Name, VirtualPath: desc.VirtualPath, ResourceKind: kind}
+		descs = append(descs, desc)
+	}
 
-		childRel := path.Join(relClean, entry.Name())
-		desc, err := s.describe(ctx, root, childRel)
+	return descs, nil
+}
+
+// describeFolder describes the folder a listing reads, failing for other kinds.
+func (s *Service) describeFolder(ctx context.Context, virtual, rel string) (Descriptor, error) {
+	root, relClean, err := s.resolveRequest(virtual, rel)
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	desc, err := s.describe(ctx, root, relClean)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	if desc.TargetKind != kindFolder {
+		return Descriptor{}, fmt.Errorf("not a directory: %s", desc.VirtualPath)
+	}
+	return desc, nil
+}
+
+// listManifest lists the root folder from its manifest instead of reading
+// the directory, describing every listed entry.
+func (s *Service) listManifest(ctx context.Context, root Root) ([]Descriptor, error) {
+	timings := timingsFromContext(ctx)
+	start := time.Now()
+	names, err := readManifest(root.Manifest)
+	timings.add(timingReadDir, time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+	names = slices.DeleteFunc(names, func(name string) bool { return isHidden(root, name) })
+
+	start = time.Now()
+	defer func() { timings.add(timingDescribe, time.Since(start)) }()
+
+	descs := make([]Descriptor, 0, len(names))
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("context canceled: %w", err)
+		}
+
+		desc, err := s.describe(ctx, root, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -179,8 +662,65 @@ func (s *Service) ListDirectory(ctx context.Context, virtual, rel string) ([]Des
 	return descs, nil
 }
 
-func (s *Service) describe(_ context.Context, root Root, rel string) (Descriptor, error) {
-	relClean, err := cleanRelativePath(rel)
+// CanonicalPath resolves rel beneath a virtual root case-insensitively and
+// returns it with the casing of the on-disk directory entries. Segments
+// naming an existing entry exactly are kept without reading their folder.
+func (s *Service) CanonicalPath(ctx context.Context, virtual, rel string) (string, error) {
+	root, err := s.resolveRoot(virtual)
+	if err != nil {
+		return "", err
+	}
+
+	relClean, err := cleanRelativePath(rel, s.opts.MaxPathDepth)
+	if err != nil || relClean == "" {
+		return relClean, err
+	}
+
+	segments := strings.Split(relClean, "/")
+	for i := range segments {
+		if err := ctx.Err(); err != nil {
+			return "", fmt.Errorf("context canceled: %w", err)
+		}
+		name, err := s.matchEntryName(root, strings.Join(segments[:i], "/"), segments[i])
+		if err != nil {
+			return "", err
+		}
+		segments[i] = name
+	}
+
+	return strings.Join(segments, "/"), nil
+}
+
+// matchEntryName returns the entry of the folder parent matching name: name
+// itself when it exists, otherwise the first entry matching it
+// case-insensitively. Hidden and ignored entries never match, so redirects
+// do not reveal them.
+func (s *Service) matchEntryName(root Root, parent, name string) (string, error) {
+	dir := filepath.Join(root.Source, filepath.FromSlash(parent))
+	if _, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+		if err := s.checkIgnored(root, path.Join(parent, name)); err != nil {
+			return "", err
+		}
+		return name, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("read dir: %w", err)
+	}
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if strings.EqualFold(entryName, name) && s.checkIgnored(root, path.Join(parent, entryName)) == nil {
+			return entryName, nil
+		}
+	}
+	return "", fmt.Errorf("stat %s: %w", joinVirtual(root.Virtual, path.Join(parent, name)), fs.ErrNotExist)
+}
+
+func (s *Service) describe(ctx context.Context, root Root, rel string) (Descriptor, error) {
+	// The depth limit applies to requested paths only, so the children of a
+	// folder at the maximum depth remain listable.
+	relClean, err := cleanRelativePath(rel, 0)
 	if err != nil {
 		return Descriptor{}, err
 	}
@@ -208,11 +748,14 @@ func (s *Service) describe(_ context.Context, root Root, rel string) (Descriptor
 	var targetInfo os.FileInfo
 	switch kind {
 	case kindSymlink:
+		if err := checkSymlinkDepth(absPath, s.opts.MaxSymlinkDepth); err != nil {
+			return Descriptor{}, fmt.Errorf("resolve symlink %s: %w", virtualPath, err)
+		}
 		resolved, err := filepath.EvalSymlinks(absPath)
 		if err != nil {
 			return Descriptor{}, fmt.Errorf("resolve symlink %s: %w", virtualPath, err)
 		}
-		if err := ensureWithinRoot(root.Source, resolved); err != nil {
+		if err := ensureReachable(root, resolved); err != nil {
 			return Descriptor{}, err
 		}
 		tInfo, err := os.Stat(resolved)
@@ -227,31 +770,119 @@ func (s *Service) describe(_ context.Context, root Root, rel string) (Descriptor
 		targetInfo = info
 	}
 
-	desc.Metadata = metadataFromInfo(desc, targetInfo)
+	desc.Metadata = s.metadataFromInfo(ctx, desc, targetInfo)
+	desc.Metadata.MountPath = s.mountPath(desc.AbsolutePath)
+	if kind == kindSymlink {
+		desc.Target = targetMetadata(desc, targetInfo)
+	}
 
 	return desc, nil
 }
 
+// checkSymlinkDepth follows the chain of links starting at absPath and fails
+// once more than limit links are chained. Broken links end the walk early and
+// are left for filepath.EvalSymlinks to report.
+func checkSymlinkDepth(absPath string, limit int) error {
+	current := absPath
+	for depth := 0; ; depth++ {
+		info, err := os.Lstat(current)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+		if depth == limit {
+			return fmt.Errorf("%w (%d)", ErrSymlinkDepth, limit)
+		}
+		target, err := os.Readlink(current)
+		if err != nil {
+			return nil
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(current), target)
+		}
+		current = target
+	}
+}
+
+// targetMetadata derives the metadata of a symlink target from the already
+// collected link metadata, which is based on the target's file info.
+func targetMetadata(desc Descriptor, info os.FileInfo) *Metadata {
+	target := desc.Metadata
+	target.Name = filepath.Base(desc.AbsolutePath)
+	target.ResourceKind = desc.TargetKind
+	target.SizeBytes = pointerSize(info, desc.TargetKind)
+
+	target.VirtualPath = desc.Root.Virtual
+	if rel, err := filepath.Rel(desc.Root.Source, desc.AbsolutePath); err == nil && rel != "." {
+		target.VirtualPath = joinVirtual(desc.Root.Virtual, filepath.ToSlash(rel))
+		if ensureWithinRoot(desc.Root.Source, desc.AbsolutePath) != nil {
+			// Targets in FollowSymlinksOutside folders have no virtual path
+			// of their own; the real one must not leak.
+			target.VirtualPath = desc.VirtualPath
+		}
+	}
+	return &target
+}
+
+// mountPath returns absPath relative to the export base, or nil when no
+// export base is configured or absPath lies outside of it.
+func (s *Service) mountPath(absPath string) *string {
+	if s.opts.ExportBase == "" {
+		return nil
+	}
+	if ensureWithinRoot(s.opts.ExportBase, absPath) != nil {
+		return nil
+	}
+	rel, err := filepath.Rel(s.opts.ExportBase, absPath)
+	if err != nil {
+		return nil
+	}
+	mountPath := filepath.ToSlash(rel)
+	return &mountPath
+}
+
+// resolveRoot looks up a virtual root and ensures it is currently available.
+func (s *Service) resolveRoot(virtual string) (Root, error) {
+	root, ok := s.lookupRoot(virtual)
+	if !ok {
+		return Root{}, fmt.Errorf("%w: %s", ErrRootNotFound, virtual)
+	}
+	if !s.RootAvailable(root.Virtual) {
+		return Root{}, fmt.Errorf("%w: %s", ErrRootUnavailable, root.Virtual)
+	}
+	return root, nil
+}
+
 func (s *Service) lookupRoot(virtual string) (Root, bool) {
 	if !strings.HasPrefix(virtual, "/") {
 		virtual = "/" + virtual
 	}
-	root, ok := s.roots[virtual]
+	root, ok := s.roots.Load().byVirtual[virtual]
 	return root, ok
 }
 
 func classify(info os.FileInfo) string {
-	switch mode := info.Mode(); {
+	return classifyMode(info.Mode())
+}
+
+// classifyMode maps file mode type bits to a resource kind.
+func classifyMode(mode fs.FileMode) string {
+	switch {
 	case mode.IsDir():
 		return kindFolder
 	case mode&os.ModeSymlink != 0:
 		return kindSymlink
+	case mode&os.ModeNamedPipe != 0:
+		return kindFIFO
+	case mode&os.ModeSocket != 0:
+		return kindSocket
+	case mode&os.ModeDevice != 0:
+		return kindDevice
 	default:
 		return kindFile
 	}
 }
 
-func cleanRelativePath(rel string) (string, error) {
+func cleanRelativePath(rel string, maxDepth int) (string, error) {
 	if hasTraversal(rel) {
 		return "", fmt.Errorf("%w: %s", ErrOutsideRoot, rel)
 	}
@@ -263,6 +894,9 @@ func cleanRelativePath(rel string) (string, error) {
 	if strings.HasPrefix(cleaned, "/../") || cleaned == "/.." {
 		return "", fmt.Errorf("%w: %s", ErrOutsideRoot, rel)
 	}
+	if maxDepth > 0 && strings.Count(cleaned, "/") > maxDepth {
+		return "", fmt.Errorf("%w: %s", ErrPathDepth, rel)
+	}
 	return strings.TrimPrefix(cleaned, "/"), nil
 }
 
@@ -293,14 +927,23 @@ func entryName(root Root, rel string) string {
 	return path.Base(rel)
 }
 
-func metadataFromInfo(desc Descriptor, info os.FileInfo) Metadata {
+func (s *Service) metadataFromInfo(ctx context.Context, desc Descriptor, info os.FileInfo) Metadata {
 	mode := info.Mode().Perm()
 	sizeBytes := pointerSize(info, desc.Kind)
 
-	uid, gid, userName, groupName := ownership(info)
+	var (
+		uid, gid            int
+		userName, groupName string
+	)
+	if !s.opts.HideOwnership {
+		uid, gid, userName, groupName = s.ownership(info, ownerNamesWanted(ctx) && !s.opts.NumericOwners)
+	}
 	accessed, modified, changed, born := fileTimes(info)
 
-	mimeType := mimeFor(desc.TargetKind, desc.AbsolutePath)
+	mimeType, special := specialMimeType(info.Mode())
+	if !special {
+		mimeType = s.mimeFor(ctx, desc.TargetKind, desc.AbsolutePath)
+	}
 
 	return Metadata{
 		Name:           desc.Name,
@@ -317,9 +960,26 @@ func metadataFromInfo(desc Descriptor, info os.FileInfo) Metadata {
 		ModifiedAt:     modified,
 		ChangedAt:      changed,
 		BornAt:         born,
+		FileID:         s.fileID(info),
+		ACL:            s.acl(desc, info),
 	}
 }
 
+// fileID returns an opaque ID built from the device and inode of info, which
+// survives renames within a filesystem. It is nil when disabled or when the
+// platform provides no inode.
+func (s *Service) fileID(info os.FileInfo) *string {
+	if !s.opts.ExposeFileID {
+		return nil
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	id := fmt.Sprintf("%x-%x", stat.Dev, stat.Ino)
+	return &id
+}
+
 func pointerSize(info os.FileInfo, kind string) *int64 {
 	if kind == kindFile {
 		size := info.Size()
@@ -328,7 +988,9 @@ func pointerSize(info os.FileInfo, kind string) *int64 {
 	return nil
 }
 
-func ownership(info os.FileInfo) (int, int, string, string) {
+// ownership returns the owning user and group IDs of info, and with names
+// their account names, falling back to the IDs for unknown accounts.
+func (s *Service) ownership(info os.FileInfo, names bool) (int, int, string, string) {
 	stat, ok := info.Sys().(*syscall.Stat_t)
 	if !ok {
 		return 0, 0, "", ""
@@ -339,12 +1001,15 @@ func ownership(info os.FileInfo) (int, int, string, string) {
 
 	userName := strconvOrEmpty(uid)
 	groupName := strconvOrEmpty(gid)
+	if !names {
+		return uid, gid, userName, groupName
+	}
 
-	if u, err := user.LookupId(fmt.Sprintf("%d", uid)); err == nil {
-		userName = u.Username
+	if name, ok := s.users.name(uid); ok {
+		userName = name
 	}
-	if g, err := user.LookupGroupId(fmt.Sprintf("%d", gid)); err == nil {
-		groupName = g.Name
+	if name, ok := s.groups.name(gid); ok {
+		groupName = name
 	}
 
 	return uid, gid, userName, groupName
@@ -365,6 +1030,21 @@ func toPtr(t time.Time) *time.Time {
 	return &t
 }
 
+// ensureReachable checks that target lies within the source of root or one
+// of the folders its symlinks may point into.
+func ensureReachable(root Root, target string) error {
+	err := ensureWithinRoot(root.Source, target)
+	if err == nil || len(root.FollowSymlinksOutside) == 0 {
+		return err
+	}
+	for _, dir := range root.FollowSymlinksOutside {
+		if ensureWithinRoot(dir, target) == nil {
+			return nil
+		}
+	}
+	return err
+}
+
 func ensureWithinRoot(root, target string) error {
 	root = filepath.Clean(root)
 	rel, err := filepath.Rel(root, target)
@@ -377,13 +1057,48 @@ func ensureWithinRoot(root, target string) error {
 	return nil
 }
 
-func mimeFor(kind, absPath string) string {
+// isSpecialKind reports whether kind is a FIFO, socket or device, whose
+// content must never be read: opening a FIFO blocks until a writer appears.
+func isSpecialKind(kind string) bool {
+	return kind == kindFIFO || kind == kindSocket || kind == kindDevice
+}
+
+// specialMimeType returns the MIME type of FIFOs, sockets and devices, which
+// are never opened for sniffing.
+func specialMimeType(mode fs.FileMode) (string, bool) {
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		return "inode/fifo", true
+	case mode&os.ModeSocket != 0:
+		return "inode/socket", true
+	case mode&os.ModeCharDevice != 0:
+		return "inode/chardevice", true
+	case mode&os.ModeDevice != 0:
+		return "inode/blockdevice", true
+	default:
+		return "", false
+	}
+}
+
+func (s *Service) mimeFor(ctx context.Context, kind, absPath string) string {
 	if kind == kindFolder {
 		return "inode/directory"
 	}
 	if kind == kindSymlink {
 		return "inode/symlink"
 	}
+	if mimeType, ok := s.opts.MimeTypes[strings.ToLower(filepath.Ext(absPath))]; ok {
+		return mimeType
+	}
+	if mimeByExtension(ctx) {
+		return extensionMimeType(absPath)
+	}
+
+	release, err := s.openFiles.acquire(ctx)
+	if err != nil {
+		return ""
+	}
+	defer release()
 
 	// #nosec G304 -- absPath is validated to be within the configured root.
 	f, err := os.Open(absPath)
@@ -392,13 +1107,37 @@ func mimeFor(kind, absPath string) string {
 	}
 	defer func() { _ = f.Close() }()
 
-	buf := make([]byte, 512)
-	n, err := f.Read(buf)
-	if err != nil && !errors.Is(err, io.EOF) {
+	buf := make([]byte, s.opts.SniffBytes)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
 		return ""
 	}
 
-	return http.DetectContentType(buf[:n])
+	return detectContentType(buf[:n])
+}
+
+// detectContentType sniffs the MIME type of sample. http.DetectContentType
+// only considers the first 512 bytes; samples beyond that are checked for
+// binary data so that text-looking headers of binary files are not reported
+// as text.
+func detectContentType(sample []byte) string {
+	ctype := http.DetectContentType(sample)
+	if len(sample) > DefaultSniffBytes && strings.HasPrefix(ctype, "text/plain") &&
+		containsBinary(sample[DefaultSniffBytes:]) {
+		return "application/octet-stream"
+	}
+	return ctype
+}
+
+// containsBinary reports whether data holds control bytes that do not occur
+// in text, using the same byte classes as http.DetectContentType.
+func containsBinary(data []byte) bool {
+	for _, b := range data {
+		if b <= 0x08 || b == 0x0B || (b >= 0x0E && b <= 0x1A) || (b >= 0x1C && b <= 0x1F) {
+			return true
+		}
+	}
+	return false
 }
 
 func strconvOrEmpty(v int) string {
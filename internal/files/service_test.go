@@ -1,12 +1,24 @@
 package files
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestDescribeSymlinkToFile(t *testing.T) {
@@ -64,10 +76,755 @@ func TestSymlinkOutsideRootRejected(t *testing.T) {
 	assert.ErrorIs(t, err, ErrOutsideRoot)
 }
 
+func TestSymlinkIntoAllowedFolder(t *testing.T) {
+	root := t.TempDir()
+	mount := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(mount, "data"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(mount, "data", "a.txt"), []byte("a"), 0o600))
+	secret := filepath.Join(t.TempDir(), "secret.txt")
+	require.NoError(t, os.WriteFile(secret, []byte("secret"), 0o600))
+	require.NoError(t, os.Symlink(filepath.Join(mount, "data"), filepath.Join(root, "data")))
+	require.NoError(t, os.Symlink(secret, filepath.Join(root, "leak")))
+
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root, FollowSymlinksOutside: []string{mount}}},
+		Options{})
+	require.NoError(t, err)
+
+	desc, err := svc.Describe(t.Context(), "/public", "data")
+	require.NoError(t, err)
+	assert.Equal(t, kindFolder, desc.TargetKind)
+	require.NotNil(t, desc.Target)
+	assert.Equal(t, "/public/data", desc.Target.VirtualPath, "the real path does not leak")
+
+	entries, err := svc.ListDirectory(t.Context(), "/public", "data")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "/public/data/a.txt", entries[0].VirtualPath)
+
+	_, err = svc.Describe(t.Context(), "/public", "leak")
+	require.ErrorIs(t, err, ErrOutsideRoot, "targets outside the allowed folders stay rejected")
+
+	_, err = NewService([]Root{{Virtual: "/public", Source: root, FollowSymlinksOutside: []string{"/definitely/missing"}}},
+		Options{})
+	require.Error(t, err)
+}
+
+func TestListDirectorySkipsEntriesRemovedMidWalk(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(name), 0o600))
+	}
+
+	svc := newTestService(t, root)
+	svc.readDir = func(dir string) ([]os.DirEntry, error) {
+		entries, err := os.ReadDir(dir)
+		// Simulate a concurrent delete between reading and describing entries.
+		require.NoError(t, os.Remove(filepath.Join(root, "b.txt")))
+		return entries, err
+	}
+
+	entries, err := svc.ListDirectory(t.Context(), "/public", "")
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Metadata.Name)
+	}
+	assert.Equal(t, []string{"a.txt", "c.txt"}, names)
+}
+
+func TestListDirectoryConcurrently(t *testing.T) {
+	root := t.TempDir()
+	for i := range 100 {
+		name := filepath.Join(root, fmt.Sprintf("f%03d.txt", i))
+		require.NoError(t, os.WriteFile(name, []byte(strings.Repeat("x", i)), 0o600))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(root, "sub"), 0o750))
+
+	// Access times change as files are sniffed, so compare the rest.
+	type listed struct {
+		name, kind, mime string
+		size             int64
+	}
+	list := func(concurrency int) []listed {
+		svc, err := NewService([]Root{{Virtual: "/public", Source: root}}, Options{ListConcurrency: concurrency})
+		require.NoError(t, err)
+		entries, err := svc.ListDirectory(t.Context(), "/public", "")
+		require.NoError(t, err)
+		out := make([]listed, 0, len(entries))
+		for _, entry := range entries {
+			meta := entry.Metadata
+			item := listed{name: meta.Name, kind: meta.ResourceKind, mime: meta.MimeType}
+			if meta.SizeBytes != nil {
+				item.size = *meta.SizeBytes
+			}
+			out = append(out, item)
+		}
+		return out
+	}
+
+	serial := list(1)
+	require.Len(t, serial, 101)
+	assert.Equal(t, listed{"f042.txt", "file", "text/plain; charset=utf-8", 42}, serial[42])
+	assert.Equal(t, serial, list(16), "entries keep their order and attributes")
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	svc := newTestService(t, root)
+	_, err := svc.ListDirectory(ctx, "/public", "")
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestServiceSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "b.txt"), []byte("b"), 0o600))
+	svc := newTestService(t, root)
+
+	_, err := svc.ListDirectory(context.Background(), "/public", "")
+	require.NoError(t, err)
+	_, err = svc.Describe(context.Background(), "/public", "missing.txt")
+	require.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "files.list", spans[0].Name())
+	assert.Contains(t, spans[0].Attributes(), attrEntries.Int(2))
+	assert.Equal(t, "files.describe", spans[1].Name())
+	assert.Contains(t, spans[1].Attributes(), attrPath.String("missing.txt"))
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+}
+
+func TestReplaceRoots(t *testing.T) {
+	public := t.TempDir()
+	archive := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(archive, "old.txt"), []byte("old"), 0o600))
+	svc := newTestService(t, public)
+	svc.roots.Load().available["/public"].Store(false)
+
+	require.NoError(t, svc.ReplaceRoots([]Root{{Virtual: "/public", Source: public}, {Virtual: "/archive", Source: archive}}))
+	assert.Len(t, svc.Roots(), 2)
+	assert.False(t, svc.RootAvailable("/public"), "unchanged roots keep their availability")
+	desc, err := svc.Describe(context.Background(), "/archive", "old.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "/archive/old.txt", desc.VirtualPath)
+
+	err = svc.ReplaceRoots([]Root{{Virtual: "/public", Source: filepath.Join(public, "missing")}})
+	require.Error(t, err)
+	assert.Len(t, svc.Roots(), 2, "roots are kept when the new ones fail to resolve")
+
+	require.NoError(t, svc.ReplaceRoots([]Root{{Virtual: "/archive", Source: archive}}))
+	_, err = svc.Describe(context.Background(), "/public", "")
+	require.ErrorIs(t, err, ErrRootNotFound)
+}
+
+func TestInspectRoot(t *testing.T) {
+	source := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(source, "a.txt"), []byte("a"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(source, "docs"), 0o750))
+	link := filepath.Join(t.TempDir(), "link")
+	require.NoError(t, os.Symlink(source, link))
+
+	report := InspectRoot(Root{Virtual: "/public", Source: link})
+	require.NoError(t, report.Err)
+	resolved, err := filepath.EvalSymlinks(source)
+	require.NoError(t, err)
+	assert.Equal(t, resolved, report.Resolved)
+	assert.True(t, report.Readable)
+	assert.Equal(t, 2, report.Entries)
+
+	report = InspectRoot(Root{Virtual: "/file", Source: filepath.Join(source, "a.txt")})
+	require.Error(t, report.Err)
+	assert.False(t, report.Readable)
+
+	report = InspectRoot(Root{Virtual: "/missing", Source: filepath.Join(source, "missing")})
+	require.ErrorIs(t, report.Err, fs.ErrNotExist)
+	assert.Empty(t, report.Resolved)
+	assert.Equal(t, int64(-1), report.FreeBytes)
+}
+
+func TestCanonicalPath(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "Reports"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "Reports", "Q1.csv"), []byte("q1"), 0o600))
+
+	svc := newTestService(t, root)
+
+	canonical, err := svc.CanonicalPath(t.Context(), "/public", "reports/q1.CSV")
+	require.NoError(t, err)
+	assert.Equal(t, "Reports/Q1.csv", canonical)
+
+	_, err = svc.CanonicalPath(t.Context(), "/public", "reports/missing.csv")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".Secret"), []byte("s"), 0o600))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "Build"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".gitignore"), []byte("Build/\n"), 0o600))
+	svc, err = NewService([]Root{{Virtual: "/public", Source: root}}, Options{RespectGitignore: true})
+	require.NoError(t, err)
+	for _, rel := range []string{".secret", ".Secret", "build", "Build"} {
+		_, err = svc.CanonicalPath(t.Context(), "/public", rel)
+		assert.ErrorIs(t, err, os.ErrNotExist, "%s is hidden", rel)
+	}
+	canonical, err = svc.CanonicalPath(t.Context(), "/public", "Reports/q1.csv")
+	require.NoError(t, err)
+	assert.Equal(t, "Reports/Q1.csv", canonical)
+}
+
+func TestListDirectoryFromManifest(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "unlisted.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(name), 0o600))
+	}
+	manifest := filepath.Join(t.TempDir(), "public.manifest")
+	require.NoError(t, os.WriteFile(manifest, []byte("a.txt\nb.txt\n\nremoved.txt\n"), 0o600))
+
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root, Manifest: manifest}}, Options{})
+	require.NoError(t, err)
+
+	entries, err := svc.ListDirectory(t.Context(), "/public", "")
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Metadata.Name)
+	}
+	assert.Equal(t, []string{"a.txt", "b.txt"}, names, "only manifest entries present on disk are listed")
+
+	desc, err := svc.Describe(t.Context(), "/public", "unlisted.txt")
+	require.NoError(t, err, "files outside the manifest stay accessible")
+	assert.Equal(t, "file", desc.Kind)
+}
+
+func TestListDirectoryManifestRejectsNestedEntries(t *testing.T) {
+	root := t.TempDir()
+	manifest := filepath.Join(t.TempDir(), "public.manifest")
+	require.NoError(t, os.WriteFile(manifest, []byte("../etc/passwd\n"), 0o600))
+
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root, Manifest: manifest}}, Options{})
+	require.NoError(t, err)
+
+	_, err = svc.ListDirectory(t.Context(), "/public", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid entry name")
+}
+
+func TestDescribeMountPathRelativeToExportBase(t *testing.T) {
+	exportBase := t.TempDir()
+	root := filepath.Join(exportBase, "projects", "public")
+	require.NoError(t, os.MkdirAll(root, 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "plan.txt"), []byte("plan"), 0o600))
+
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root}}, Options{ExportBase: exportBase})
+	require.NoError(t, err)
+
+	desc, err := svc.Describe(t.Context(), "/public", "plan.txt")
+	require.NoError(t, err)
+	require.NotNil(t, desc.Metadata.MountPath)
+	assert.Equal(t, "projects/public/plan.txt", *desc.Metadata.MountPath)
+
+	outside, err := NewService([]Root{{Virtual: "/public", Source: root}}, Options{ExportBase: t.TempDir()})
+	require.NoError(t, err)
+	desc, err = outside.Describe(t.Context(), "/public", "plan.txt")
+	require.NoError(t, err)
+	assert.Nil(t, desc.Metadata.MountPath, "paths outside the export base have no mount path")
+
+	desc, err = newTestService(t, root).Describe(t.Context(), "/public", "plan.txt")
+	require.NoError(t, err)
+	assert.Nil(t, desc.Metadata.MountPath, "no export base configured")
+}
+
+func TestDescribeSniffBytes(t *testing.T) {
+	root := t.TempDir()
+	// Plain text for the first 1000 bytes, binary data afterwards.
+	content := append(bytes.Repeat([]byte("a"), 1000), 0x00, 0x01, 0x02, 0x03)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "blob.dat"), content, 0o600))
+
+	desc, err := newTestService(t, root).Describe(t.Context(), "/public", "blob.dat")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", desc.Metadata.MimeType, "default sample misses the binary tail")
+
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root}}, Options{SniffBytes: 4096})
+	require.NoError(t, err)
+	desc, err = svc.Describe(t.Context(), "/public", "blob.dat")
+	require.NoError(t, err)
+	assert.Equal(t, "application/octet-stream", desc.Metadata.MimeType)
+}
+
+func TestDescribeMimeTypeOverrides(t *testing.T) {
+	root := t.TempDir()
+	gpx := `<?xml version="1.0"?><gpx version="1.1"></gpx>`
+	require.NoError(t, os.WriteFile(filepath.Join(root, "Track.GPX"), []byte(gpx), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "feed.xml"), []byte(gpx), 0o600))
+
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root}},
+		Options{MimeTypes: map[string]string{".gpx": "application/gpx+xml"}})
+	require.NoError(t, err)
+	desc, err := svc.Describe(t.Context(), "/public", "Track.GPX")
+	require.NoError(t, err)
+	assert.Equal(t, "application/gpx+xml", desc.Metadata.MimeType)
+
+	desc, err = svc.Describe(t.Context(), "/public", "feed.xml")
+	require.NoError(t, err)
+	assert.Equal(t, "text/xml; charset=utf-8", desc.Metadata.MimeType, "other extensions are sniffed")
+}
+
+func TestDescribeRejectsDeepSymlinkChain(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "data.txt"), []byte("data"), 0o600))
+	// link3 -> link2 -> link1 -> data.txt
+	previous := "data.txt"
+	for _, name := range []string{"link1", "link2", "link3"} {
+		require.NoError(t, os.Symlink(previous, filepath.Join(root, name)))
+		previous = name
+	}
+
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root}}, Options{MaxSymlinkDepth: 2})
+	require.NoError(t, err)
+
+	desc, err := svc.Describe(t.Context(), "/public", "link2")
+	require.NoError(t, err, "chains up to the limit resolve")
+	assert.Equal(t, "file", desc.TargetKind)
+
+	_, err = svc.Describe(t.Context(), "/public", "link3")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrSymlinkDepth)
+}
+
+func TestFileIDSurvivesRename(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "draft.txt"), []byte("draft"), 0o600))
+
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root}}, Options{ExposeFileID: true})
+	require.NoError(t, err)
+
+	before, err := svc.Describe(t.Context(), "/public", "draft.txt")
+	require.NoError(t, err)
+	require.NotNil(t, before.Metadata.FileID)
+
+	require.NoError(t, os.Rename(filepath.Join(root, "draft.txt"), filepath.Join(root, "final.txt")))
+
+	after, err := svc.Describe(t.Context(), "/public", "final.txt")
+	require.NoError(t, err)
+	require.NotNil(t, after.Metadata.FileID)
+	assert.Equal(t, *before.Metadata.FileID, *after.Metadata.FileID)
+	assert.NotEqual(t, before.Metadata.VirtualPath, after.Metadata.VirtualPath)
+
+	desc, err := newTestService(t, root).Describe(t.Context(), "/public", "final.txt")
+	require.NoError(t, err)
+	assert.Nil(t, desc.Metadata.FileID, "not exposed by default")
+}
+
+func TestListNamesUsesDirectoryEntryKinds(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "dir"), 0o750))
+	require.NoError(t, os.Symlink("a.txt", filepath.Join(root, "link")))
+
+	entries, err := newTestService(t, root).ListNames(t.Context(), "/public", "")
+	require.NoError(t, err)
+
+	kinds := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		kinds[entry.Metadata.Name] = entry.Metadata.ResourceKind
+		assert.Nil(t, entry.Metadata.ModifiedAt, "entries are not stat'ed")
+		assert.Nil(t, entry.Metadata.SizeBytes, "entries are not stat'ed")
+	}
+	assert.Equal(t, map[string]string{"a.txt": "file", "dir": "folder", "link": "symlink"}, kinds)
+}
+
+func BenchmarkListDirectory(b *testing.B) {
+	root := b.TempDir()
+	for i := range 500 {
+		require.NoError(b, os.WriteFile(filepath.Join(root, fmt.Sprintf("file-%03d.txt", i)), []byte("data"), 0o600))
+	}
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root}}, Options{})
+	require.NoError(b, err)
+
+	b.Run("describe", func(b *testing.B) {
+		for b.Loop() {
+			_, err := svc.ListDirectory(b.Context(), "/public", "")
+			require.NoError(b, err)
+		}
+	})
+	b.Run("names", func(b *testing.B) {
+		for b.Loop() {
+			_, err := svc.ListNames(b.Context(), "/public", "")
+			require.NoError(b, err)
+		}
+	})
+}
+
+func BenchmarkNewServiceManyRoots(b *testing.B) {
+	base := b.TempDir()
+	roots := make([]Root, 0, 500)
+	for i := range 500 {
+		source := filepath.Join(base, fmt.Sprintf("root-%03d", i))
+		require.NoError(b, os.Mkdir(source, 0o750))
+		roots = append(roots, Root{Virtual: fmt.Sprintf("/root-%03d", i), Source: source})
+	}
+
+	for _, concurrency := range []int{1, DefaultStartupConcurrency} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			for b.Loop() {
+				if _, err := NewService(roots, Options{StartupConcurrency: concurrency}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestRespectGitignore(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".gitignore"), []byte("# artifacts\n*.log\n!keep.log\nbuild/\n"), 0o600))
+	for _, name := range []string{"main.go", "app.log", "keep.log"} {
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(name), 0o600))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "build"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "build", "out.bin"), []byte("out"), 0o600))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "logs"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "logs", "debug.log"), []byte("debug"), 0o600))
+
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root, ShowHidden: true}}, Options{RespectGitignore: true})
+	require.NoError(t, err)
+
+	entries, err := svc.ListDirectory(t.Context(), "/public", "")
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	assert.ElementsMatch(t, []string{".gitignore", "keep.log", "logs", "main.go"}, names)
+
+	nested, err := svc.ListNames(t.Context(), "/public", "logs")
+	require.NoError(t, err)
+	assert.Empty(t, nested)
+
+	for _, rel := range []string{"app.log", "logs/debug.log", "build", "build/out.bin"} {
+		_, err := svc.Describe(t.Context(), "/public", rel)
+		require.ErrorIs(t, err, fs.ErrNotExist, rel)
+	}
+	_, err = svc.Describe(t.Context(), "/public", "keep.log")
+	require.NoError(t, err)
+}
+
+func TestHiddenEntries(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{".env", "a.txt", "a.txt.bak"} {
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(name), 0o600))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(root, ".git"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".git", "config"), []byte("[core]"), 0o600))
+
+	list := func(svc *Service) []string {
+		entries, err := svc.ListDirectory(t.Context(), "/public", "")
+		require.NoError(t, err)
+		names := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			names = append(names, entry.Name)
+		}
+		return names
+	}
+
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root, HiddenPatterns: []string{"*.bak"}}}, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.txt"}, list(svc))
+	for _, rel := range []string{".env", ".git", ".git/config", "a.txt.bak"} {
+		_, err := svc.Describe(t.Context(), "/public", rel)
+		require.ErrorIs(t, err, fs.ErrNotExist, rel)
+	}
+
+	svc, err = NewService([]Root{{Virtual: "/public", Source: root, ShowHidden: true, HiddenPatterns: []string{"*.bak"}}},
+		Options{})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{".env", ".git", "a.txt", "a.txt.bak"}, list(svc))
+	_, err = svc.Describe(t.Context(), "/public", ".git/config")
+	require.NoError(t, err)
+}
+
+func TestCopyEntryPreservesTree(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "tree")
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "sub"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "sub", "file.txt"), []byte("data"), 0o640))
+	require.NoError(t, os.Symlink("sub/file.txt", filepath.Join(src, "link")))
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(src, "sub", "file.txt"), modTime, modTime))
+
+	dst := filepath.Join(t.TempDir(), "copy")
+	require.NoError(t, copyEntry(context.Background(), src, dst))
+
+	info, err := os.Stat(filepath.Join(dst, "sub", "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+	assert.True(t, info.ModTime().Equal(modTime))
+	dirInfo, err := os.Stat(filepath.Join(dst, "sub"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o750), dirInfo.Mode().Perm())
+	target, err := os.Readlink(filepath.Join(dst, "link"))
+	require.NoError(t, err)
+	assert.Equal(t, "sub/file.txt", target)
+}
+
+func TestCopyIntoPlace(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "tree")
+	require.NoError(t, os.MkdirAll(src, 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "file.txt"), []byte("data"), 0o600))
+	target := t.TempDir()
+	leftovers := func() []string {
+		names, err := filepath.Glob(filepath.Join(target, ".tmp-move-*"))
+		require.NoError(t, err)
+		return names
+	}
+
+	dst := filepath.Join(target, "tree")
+	require.NoError(t, copyIntoPlace(t.Context(), src, dst))
+	data, err := os.ReadFile(filepath.Join(dst, "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+	assert.Empty(t, leftovers())
+
+	// A destination created meanwhile is neither replaced nor removed.
+	taken := filepath.Join(target, "taken")
+	require.NoError(t, os.WriteFile(taken, []byte("theirs"), 0o600))
+	require.ErrorIs(t, copyIntoPlace(t.Context(), src, taken), ErrExists)
+	data, err = os.ReadFile(taken)
+	require.NoError(t, err)
+	assert.Equal(t, "theirs", string(data))
+	assert.Empty(t, leftovers())
+
+	require.NoError(t, syscall.Mkfifo(filepath.Join(src, "pipe"), 0o600))
+	require.ErrorIs(t, copyIntoPlace(t.Context(), src, filepath.Join(target, "failed")), ErrInvalidMove)
+	assert.NoFileExists(t, filepath.Join(target, "failed"))
+	assert.Empty(t, leftovers(), "a failed copy leaves nothing behind")
+}
+
+func TestDiskUsage(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "data", "sub"), 0o750))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "data", "locked"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "data", "a.bin"), make([]byte, 1000), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "data", "sub", "b.bin"), make([]byte, 24), 0o600))
+	require.NoError(t, os.Link(filepath.Join(root, "data", "a.bin"), filepath.Join(root, "data", "sub", "hard.bin")))
+	require.NoError(t, os.Symlink("a.bin", filepath.Join(root, "data", "link")))
+
+	svc := newTestService(t, root)
+	readDir := svc.readDir
+	svc.readDir = func(dir string) ([]os.DirEntry, error) {
+		if filepath.Base(dir) == "locked" {
+			return nil, fs.ErrPermission
+		}
+		return readDir(dir)
+	}
+	desc, err := svc.Describe(context.Background(), "/public", "data")
+	require.NoError(t, err)
+
+	usage, err := svc.DiskUsage(context.Background(), desc, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000+24+len("a.bin")), usage.SizeBytes, "hard links count once")
+	assert.Equal(t, 4, usage.FileCount)
+	assert.Equal(t, 2, usage.FolderCount)
+	assert.Equal(t, 1, usage.Unreadable)
+
+	allocated, err := svc.DiskUsage(context.Background(), desc, true)
+	require.NoError(t, err)
+	assert.Positive(t, allocated.SizeBytes)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = svc.DiskUsage(ctx, desc, false)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestDescribeWithoutOwnerNames(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o600))
+	current, err := user.Current()
+	require.NoError(t, err)
+
+	svc := newTestService(t, root)
+
+	desc, err := svc.Describe(t.Context(), "/public", "a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, current.Username, desc.Metadata.User)
+
+	desc, err = svc.Describe(contextWithoutOwnerNames(t.Context()), "/public", "a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, strconvOrEmpty(os.Getuid()), desc.Metadata.User, "names are not looked up")
+	assert.Equal(t, os.Getuid(), desc.Metadata.UserID)
+}
+
+func TestNumericOwners(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o600))
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root}}, Options{NumericOwners: true})
+	require.NoError(t, err)
+	svc.users = newNameCache(func(string) (string, bool) {
+		t.Fatal("user names are not looked up")
+		return "", false
+	})
+
+	desc, err := svc.Describe(t.Context(), "/public", "a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, strconvOrEmpty(os.Getuid()), desc.Metadata.User)
+	assert.Equal(t, os.Getuid(), desc.Metadata.UserID)
+}
+
+func TestNameCache(t *testing.T) {
+	lookups := map[string]int{}
+	nc := newNameCache(func(id string) (string, bool) {
+		lookups[id]++
+		return "user" + id, id != "7"
+	})
+	now := time.Now()
+	nc.now = func() time.Time { return now }
+
+	name, ok := nc.name(1)
+	assert.True(t, ok)
+	assert.Equal(t, "user1", name)
+	_, ok = nc.name(7)
+	assert.False(t, ok)
+	nc.name(1)
+	nc.name(7)
+	assert.Equal(t, map[string]int{"1": 1, "7": 1}, lookups, "names and unknown IDs are cached")
+
+	now = now.Add(ownerCacheTTL)
+	nc.name(1)
+	assert.Equal(t, 2, lookups["1"], "expired names are looked up again")
+
+	for id := 100; id < 100+ownerCacheEntries; id++ {
+		if id%10 == 0 {
+			// Keeps 1 recently used while the cache fills up.
+			nc.name(1)
+		}
+		nc.name(id)
+	}
+	nc.name(1)
+	nc.name(7)
+	assert.Equal(t, 2, lookups["1"], "recently used names stay")
+	assert.Equal(t, 2, lookups["7"], "the least recently used name is evicted")
+}
+
+func TestListingCache(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "a.txt")
+	require.NoError(t, os.WriteFile(file, []byte("a"), 0o600))
+
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root}}, Options{ListingCacheTTL: time.Minute})
+	require.NoError(t, err)
+	now := time.Now()
+	svc.listings.now = func() time.Time { return now }
+	reads := 0
+	readDir := svc.readDir
+	svc.readDir = func(dir string) ([]os.DirEntry, error) {
+		reads++
+		return readDir(dir)
+	}
+	sizes := func() []int64 {
+		t.Helper()
+		descs, err := svc.ListDirectory(t.Context(), "/public", "")
+		require.NoError(t, err)
+		var out []int64
+		for _, desc := range descs {
+			out = append(out, *desc.Metadata.SizeBytes)
+		}
+		return out
+	}
+
+	assert.Equal(t, []int64{1}, sizes())
+	require.NoError(t, os.WriteFile(file, []byte("abc"), 0o600))
+	assert.Equal(t, []int64{1}, sizes(), "changed entries are served from the cache")
+	assert.Equal(t, 1, reads)
+
+	svc.InvalidateListing("/public/a.txt")
+	assert.Equal(t, []int64{3}, sizes())
+	assert.Equal(t, 2, reads)
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "b.txt"), []byte("b"), 0o600))
+	// Ensure a new modification time on filesystems with coarse timestamps.
+	require.NoError(t, os.Chtimes(root, now, now.Add(time.Hour)))
+	assert.Len(t, sizes(), 2, "a changed folder is read again")
+	assert.Equal(t, 3, reads)
+
+	_, err = svc.Chmod(t.Context(), "/public", "b.txt", 0o640)
+	require.NoError(t, err)
+	sizes()
+	assert.Equal(t, 4, reads, "changes through the service invalidate the listing")
+
+	sizes()
+	now = now.Add(time.Minute)
+	sizes()
+	assert.Equal(t, 5, reads, "listings expire after the TTL")
+
+	svc.InvalidateListing("/public/a.txt")
+	_, err = svc.ListDirectory(contextWithoutOwnerNames(t.Context()), "/public", "")
+	require.NoError(t, err)
+	sizes()
+	assert.Equal(t, 7, reads, "listings without owner names are not cached")
+}
+
+func TestListingCacheEviction(t *testing.T) {
+	lc := newListingCache(time.Minute, 2)
+	now := time.Now()
+	lc.now = func() time.Time { return now }
+	lc.put("/a", now, nil, true)
+	now = now.Add(time.Second)
+	lc.put("/b", now, nil, true)
+	lc.put("/c", now, nil, true)
+
+	_, ok := lc.get("/a", now.Add(-time.Second), true)
+	assert.False(t, ok, "the oldest listing is evicted")
+	_, ok = lc.get("/b", now, true)
+	assert.True(t, ok)
+	_, ok = lc.get("/c", now.Add(time.Second), true)
+	assert.False(t, ok, "a listing of another modification time is not used")
+
+	lc.put("/d", now, nil, false)
+	_, ok = lc.get("/d", now, true)
+	assert.False(t, ok, "listings typed by extension do not serve sniffing requests")
+	_, ok = lc.get("/d", now, false)
+	assert.True(t, ok)
+
+	assert.Nil(t, newListingCache(0, 10), "zero TTL disables the cache")
+}
+
+func TestThumbnailCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	tc := newThumbnailCache(dir, 100)
+	now := time.Now()
+	tc.now = func() time.Time { return now }
+	thumb := Thumbnail{Data: bytes.Repeat([]byte("x"), 40)}
+	put := func(name string, age time.Duration) string {
+		t.Helper()
+		cachePath := filepath.Join(dir, name[:2], name)
+		require.NoError(t, tc.put(cachePath, thumb))
+		require.NoError(t, os.Chtimes(cachePath, now.Add(-age), now.Add(-age)))
+		return cachePath
+	}
+	a := put("aaaa", 2*time.Hour)
+	b := put("bbbb", time.Hour)
+	_, ok := tc.get(a)
+	require.True(t, ok)
+	c := put("cccc", 0)
+
+	assert.FileExists(t, a, "reading a thumbnail marks it as recently used")
+	assert.NoFileExists(t, b, "the least recently used thumbnail is deleted")
+	assert.FileExists(t, c)
+	assert.Equal(t, int64(80), tc.size)
+
+	assert.Nil(t, newThumbnailCache("", 100), "no directory disables the cache")
+}
+
 func newTestService(t *testing.T, root string) *Service {
 	t.Helper()
 
-	svc, err := NewService([]Root{{Virtual: "/public", Source: root}})
+	svc, err := NewService([]Root{{Virtual: "/public", Source: root}}, Options{})
 	require.NoError(t, err)
 	return svc
 }
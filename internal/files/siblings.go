@@ -0,0 +1,51 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+)
+
+// resolvePath maps the requested path onto the entry that is served: the
+// on-disk casing when matching case-insensitively, then a sibling
+// representation for extensionless paths.
+func (h Handler) resolvePath(c echo.Context, root Root, rel string) (string, error) {
+	if h.opts.CaseInsensitive {
+		if canonical, err := h.svc.CanonicalPath(c.Request().Context(), root.Virtual, rel); err == nil {
+			rel = canonical
+		}
+	}
+	if len(h.opts.SiblingExtensions) == 0 || rel == "" || path.Ext(rel) != "" {
+		return rel, nil
+	}
+	return h.resolveSibling(c, root, rel)
+}
+
+// resolveSibling picks the representation of an extensionless path. An
+// explicit ?accept=<ext> always selects rel.<ext>; otherwise an existing rel
+// is served as is and the configured extensions are tried in order.
+func (h Handler) resolveSibling(c echo.Context, root Root, rel string) (string, error) {
+	if accept := c.QueryParam("accept"); accept != "" {
+		if !slices.Contains(h.opts.SiblingExtensions, accept) {
+			return "", echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unsupported accept: %s", accept))
+		}
+		return rel + "." + accept, nil
+	}
+
+	ctx := c.Request().Context()
+	if _, err := h.svc.Describe(ctx, root.Virtual, rel); !errors.Is(err, fs.ErrNotExist) {
+		return rel, nil
+	}
+	for _, ext := range h.opts.SiblingExtensions {
+		sibling := rel + "." + ext
+		if _, err := h.svc.Describe(ctx, root.Virtual, sibling); err == nil {
+			return sibling, nil
+		}
+	}
+	return rel, nil
+}
@@ -0,0 +1,142 @@
+package files
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/api"
+)
+
+// Query parameters of signed download URLs.
+const (
+	paramExpires   = "expires"
+	paramSignature = "signature"
+)
+
+// DefaultSigningMaxTTL is the default longest lifetime of a signed URL.
+const DefaultSigningMaxTTL = 24 * time.Hour
+
+// SignedURLResponse is the JSON:API document returned when signing a download URL.
+type SignedURLResponse struct {
+	Data SignedURLResource `json:"data"`
+}
+
+// SignedURLResource represents a signed download URL.
+type SignedURLResource struct {
+	ID         string              `json:"id"`
+	Type       string              `json:"type"`
+	Attributes SignedURLAttributes `json:"attributes"`
+}
+
+// SignedURLAttributes holds the signed URL and its expiry.
+type SignedURLAttributes struct {
+	URL       string `json:"url"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// signResource answers POST ?sign=1&ttl=1h with a time-limited download URL
+// of a file. The ttl is bounded by HandlerOptions.SigningMaxTTL.
+func (h Handler) signResource(c echo.Context) error {
+	if h.opts.SigningSecret == "" {
+		return echo.NewHTTPError(http.StatusNotFound, "signed URLs are not enabled")
+	}
+	if c.QueryParam("sign") != "1" {
+		return echo.NewHTTPError(http.StatusBadRequest, "sign=1 is required")
+	}
+	ttl, err := time.ParseDuration(c.QueryParam("ttl"))
+	if err != nil || ttl <= 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid ttl: %s", c.QueryParam("ttl")))
+	}
+	maxTTL := h.opts.SigningMaxTTL
+	if maxTTL <= 0 {
+		maxTTL = DefaultSigningMaxTTL
+	}
+	if ttl > maxTTL {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("ttl must not exceed %s: %s", maxTTL, ttl))
+	}
+
+	root, rel, err := parseVirtualPath(c, h.svc.Roots())
+	if err != nil {
+		return err
+	}
+	if err := authorize(c, root, ScopeRead); err != nil {
+		return err
+	}
+	desc, err := h.svc.Describe(c.Request().Context(), root.Virtual, rel)
+	if err != nil {
+		return toHTTPError(err)
+	}
+	// The signature covers only the path, so it must not unlock folder
+	// archives or other representations selected by query parameters.
+	if desc.TargetKind != kindFile {
+		return echo.NewHTTPError(http.StatusBadRequest, "only files can be signed")
+	}
+
+	expires := time.Now().Add(ttl).Unix()
+	query := url.Values{}
+	query.Set(paramExpires, strconv.FormatInt(expires, 10))
+	query.Set(paramSignature, signPath(h.opts.SigningSecret, desc.VirtualPath, expires))
+	location := escapeVirtualPath(desc.VirtualPath) + "?" + query.Encode()
+
+	resp := SignedURLResponse{Data: SignedURLResource{
+		ID:   desc.VirtualPath,
+		Type: "signed_urls",
+		Attributes: SignedURLAttributes{
+			URL:       location,
+			ExpiresAt: time.Unix(expires, 0).UTC().Format(time.RFC3339),
+		},
+	}}
+	c.Response().Header().Set(echo.HeaderContentType, api.ContentType)
+	if err := c.JSON(http.StatusCreated, resp); err != nil {
+		return fmt.Errorf("write signed url response: %w", err)
+	}
+	return nil
+}
+
+// IsSignedRequest reports whether the request carries signed URL parameters.
+func IsSignedRequest(c echo.Context) bool {
+	return c.QueryParam(paramSignature) != "" || c.QueryParam(paramExpires) != ""
+}
+
+// verifySignedRequest checks the signature and expiry of a signed download URL
+// for virtualPath. Valid signed requests are served without further checks.
+// The signature does not cover the query, so signed URLs carrying any
+// parameter besides expires and signature are rejected.
+func (h Handler) verifySignedRequest(c echo.Context, virtualPath string) error {
+	if h.opts.SigningSecret == "" {
+		return echo.NewHTTPError(http.StatusForbidden, "signed URLs are not enabled")
+	}
+	for name := range c.QueryParams() {
+		if name != paramExpires && name != paramSignature {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				fmt.Sprintf("signed URLs accept no query parameter %s", name))
+		}
+	}
+	expires, err := strconv.ParseInt(c.QueryParam(paramExpires), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, "invalid signed URL")
+	}
+	want := signPath(h.opts.SigningSecret, virtualPath, expires)
+	if !hmac.Equal([]byte(c.QueryParam(paramSignature)), []byte(want)) {
+		return echo.NewHTTPError(http.StatusForbidden, "invalid signed URL")
+	}
+	if time.Now().Unix() > expires {
+		return echo.NewHTTPError(http.StatusForbidden, "signed URL expired")
+	}
+	return nil
+}
+
+// signPath returns the hex HMAC-SHA256 of the virtual path and expiry.
+func signPath(secret, virtualPath string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = fmt.Fprintf(mac, "%s\n%d", virtualPath, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,20 @@
+//go:build darwin
+
+package files
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// freeSpace returns the bytes available to unprivileged users on the
+// filesystem holding path.
+func freeSpace(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, fmt.Errorf("statfs %s: %w", path, err)
+	}
+	// Block counts and sizes fit in int64.
+	//nolint:gosec
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,10 @@
+//go:build !darwin && !linux
+
+package files
+
+import "errors"
+
+// freeSpace reports an error on platforms without statfs support.
+func freeSpace(string) (int64, error) {
+	return 0, errors.New("free space is not supported on this platform")
+}
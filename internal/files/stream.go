@@ -0,0 +1,75 @@
+package files
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// streamCollection writes resp with the resources of paged as its data,
+// encoding one resource at a time instead of the whole document at once.
+// Meta and links carry precomputed totals, so the output matches the
+// buffered encoding byte for byte.
+func (h Handler) streamCollection(c echo.Context, resp Response, paged []Descriptor, params ListParams) error {
+	if timings := timingsFromContext(c.Request().Context()); timings != nil {
+		c.Response().Header().Set("Server-Timing", timings.header())
+	}
+	c.Response().WriteHeader(http.StatusOK)
+
+	w := bufio.NewWriter(c.Response())
+	cw := collectionWriter{w: w}
+	cw.raw("{")
+	if resp.Meta != nil {
+		cw.raw(`"meta":`)
+		cw.value(resp.Meta)
+		cw.raw(",")
+	}
+	cw.raw(`"data":[`)
+	for i, entry := range paged {
+		if i > 0 {
+			cw.raw(",")
+		}
+		cw.value(h.resourceFrom(entry, params))
+	}
+	cw.raw("]")
+	if resp.Links != nil {
+		cw.raw(`,"links":`)
+		cw.value(resp.Links)
+	}
+	cw.raw("}\n")
+	if cw.err == nil {
+		cw.err = w.Flush()
+	}
+	if cw.err != nil {
+		return fmt.Errorf("write collection response: %w", cw.err)
+	}
+	return nil
+}
+
+// collectionWriter keeps the first write or encoding error, so a document can
+// be written piece by piece and checked once at the end.
+type collectionWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (cw *collectionWriter) raw(s string) {
+	if cw.err == nil {
+		_, cw.err = cw.w.WriteString(s)
+	}
+}
+
+func (cw *collectionWriter) value(v any) {
+	if cw.err != nil {
+		return
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		cw.err = err
+		return
+	}
+	_, cw.err = cw.w.Write(body)
+}
@@ -0,0 +1,167 @@
+package files
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultThumbnailCacheSize is the default number of bytes of thumbnails
+// kept in the thumbnail cache directory.
+const DefaultThumbnailCacheSize = 1 << 30
+
+// thumbnailCache keeps generated thumbnails in a directory, named after the
+// image path, its ETag and the thumbnail size. Once the stored thumbnails
+// exceed maxBytes, the least recently used ones are deleted until they take
+// up at most 90% of it, so outdated thumbnails of changed or deleted images
+// age out. A nil cache caches nothing.
+type thumbnailCache struct {
+	dir      string
+	maxBytes int64
+	now      func() time.Time
+
+	mu sync.Mutex
+	// size is the number of bytes stored, or -1 until the directory has
+	// been measured.
+	size int64
+}
+
+type cachedThumbnailFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// newThumbnailCache returns a cache in dir bounded to maxBytes, or nil
+// without a directory.
+func newThumbnailCache(dir string, maxBytes int64) *thumbnailCache {
+	if dir == "" {
+		return nil
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultThumbnailCacheSize
+	}
+	return &thumbnailCache{dir: dir, maxBytes: maxBytes, now: time.Now, size: -1}
+}
+
+// path returns the file caching the thumbnail of desc at the given size, or
+// "" for a nil cache. The name covers the ETag of the image, so changed
+// images get new thumbnails.
+func (tc *thumbnailCache) path(desc Descriptor, width, height int) string {
+	if tc == nil {
+		return ""
+	}
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s\x00%s\x00%dx%d", desc.VirtualPath, ComputeETag(desc), width, height))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(tc.dir, key[:2], key)
+}
+
+// get returns the thumbnail cached at cachePath, if any, and marks it as
+// recently used.
+func (tc *thumbnailCache) get(cachePath string) (Thumbnail, bool) {
+	if tc == nil {
+		return Thumbnail{}, false
+	}
+	// #nosec G304 -- the name is a hash below the configured cache directory.
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		return Thumbnail{}, false
+	}
+	now := tc.now()
+	_ = os.Chtimes(cachePath, now, now)
+	return Thumbnail{Data: data, MimeType: http.DetectContentType(data)}, true
+}
+
+// put stores thumb at cachePath through a temporary file, so concurrent
+// requests never read a partial thumbnail, then prunes the cache when it
+// grew beyond its bound.
+func (tc *thumbnailCache) put(cachePath string, thumb Thumbnail) error {
+	if tc == nil {
+		return nil
+	}
+	dir := filepath.Dir(cachePath)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("create thumbnail cache: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create cached thumbnail: %w", err)
+	}
+	_, err = tmp.Write(thumb.Data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), cachePath)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("write cached thumbnail: %w", err)
+	}
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.size >= 0 {
+		tc.size += int64(len(thumb.Data))
+		if tc.size <= tc.maxBytes {
+			return nil
+		}
+	}
+	return tc.prune()
+}
+
+// prune measures the cache directory and, when it holds more than maxBytes,
+// deletes the least recently used thumbnails down to 90% of it. Callers
+// hold tc.mu.
+func (tc *thumbnailCache) prune() error {
+	var cached []cachedThumbnailFile
+	var size int64
+	// Thumbnails vanishing meanwhile were replaced by concurrent requests.
+	err := filepath.WalkDir(tc.dir, func(path string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if errors.Is(walkErr, fs.ErrNotExist) {
+				return nil
+			}
+			return walkErr
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".tmp-") {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		cached = append(cached, cachedThumbnailFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("measure thumbnail cache: %w", err)
+	}
+	if size > tc.maxBytes {
+		slices.SortFunc(cached, func(a, b cachedThumbnailFile) int { return a.modTime.Compare(b.modTime) })
+		target := tc.maxBytes / 10 * 9
+		for _, file := range cached {
+			if size <= target {
+				break
+			}
+			if err := os.Remove(file.path); err == nil || errors.Is(err, fs.ErrNotExist) {
+				size -= file.size
+			}
+		}
+	}
+	tc.size = size
+	return nil
+}
@@ -0,0 +1,214 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // registers the WebP decoder
+)
+
+// thumbnailSizes are the widths and heights thumbnails are made in; requested
+// sizes are rounded up to the next one, bounding the variants of each image.
+var thumbnailSizes = []int{64, 128, 256, 512, 1024, maxThumbnailSize}
+
+const (
+	// thumbnailSegment is the path suffix that turns a request into a
+	// thumbnail of the image file, e.g.
+	// /api/v1/files/public/photo.jpg/-/thumbnail?w=256&h=256.
+	thumbnailSegment = "-/thumbnail"
+	// defaultThumbnailSize is the width and height thumbnails fit into when
+	// the request omits w or h.
+	defaultThumbnailSize = 256
+	// maxThumbnailSize bounds the requested width and height.
+	maxThumbnailSize = 2048
+	// maxThumbnailDecodes bounds the images decoded for thumbnails at once.
+	maxThumbnailDecodes = 4
+	// maxThumbnailSourcePixels bounds the images decoded for thumbnails, as
+	// decoding holds every pixel in memory: 50 megapixels take 200 MiB.
+	maxThumbnailSourcePixels = 50_000_000
+	// thumbnailQuality is the JPEG quality of thumbnails of opaque images.
+	thumbnailQuality = 85
+)
+
+// ErrUnsupportedImage indicates a file that is no JPEG, PNG, GIF or WebP image.
+var ErrUnsupportedImage = errors.New("unsupported image format")
+
+// ErrImageTooLarge indicates an image with more pixels than thumbnails are made of.
+var ErrImageTooLarge = errors.New("image too large for a thumbnail")
+
+// Thumbnail is an encoded thumbnail image.
+type Thumbnail struct {
+	Data     []byte
+	MimeType string // image/jpeg or image/png
+}
+
+// Thumbnail returns a thumbnail of the image file desc resolves to that fits
+// into width x height pixels, keeping the aspect ratio; smaller images keep
+// their size. Opaque images are encoded as JPEG, images with transparency as
+// PNG. With Options.ThumbnailCacheDir, thumbnails are stored there and
+// reused while the modification time and size of the image are unchanged;
+// Options.ThumbnailCacheSize bounds the directory.
+func (s *Service) Thumbnail(ctx context.Context, desc Descriptor, width, height int) (Thumbnail, error) {
+	ctx, span := startSpan(ctx, "files.thumbnail", desc.Root.Virtual, desc.RelPath)
+	thumb, err := s.thumbnail(ctx, desc, width, height)
+	endSpan(span, err)
+	return thumb, err
+}
+
+func (s *Service) thumbnail(ctx context.Context, desc Descriptor, width, height int) (Thumbnail, error) {
+	cachePath := s.thumbnails.path(desc, width, height)
+	if thumb, ok := s.thumbnails.get(cachePath); ok {
+		return thumb, nil
+	}
+
+	img, err := s.decodeImage(ctx, desc.AbsolutePath)
+	if err != nil {
+		return Thumbnail{}, err
+	}
+	thumb, err := encodeThumbnail(scaleToFit(img, width, height))
+	if err != nil {
+		return Thumbnail{}, err
+	}
+	// A thumbnail that cannot be cached is still served; the next request
+	// generates it again.
+	_ = s.thumbnails.put(cachePath, thumb)
+	return thumb, nil
+}
+
+// decodeImage decodes the image at absPath after checking its dimensions
+// against maxThumbnailSourcePixels. At most maxThumbnailDecodes images are
+// decoded at once, bounding the memory held by decoded pixels.
+func (s *Service) decodeImage(ctx context.Context, absPath string) (image.Image, error) {
+	select {
+	case s.decodes <- struct{}{}:
+		defer func() { <-s.decodes }()
+	case <-ctx.Done():
+		return nil, fmt.Errorf("wait for image decode slot: %w", ctx.Err())
+	}
+	release, err := s.openFiles.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// #nosec G304 -- the path is resolved within a configured root.
+	f, err := os.Open(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("open image: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnsupportedImage, err)
+	}
+	if int64(config.Width)*int64(config.Height) > maxThumbnailSourcePixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrImageTooLarge, config.Width, config.Height)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("read image: %w", err)
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnsupportedImage, err)
+	}
+	return img, nil
+}
+
+// scaleToFit scales img down to fit into width x height pixels, keeping the
+// aspect ratio. Smaller images keep their size.
+func scaleToFit(img image.Image, width, height int) *image.RGBA {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w > width || h > height {
+		scale := min(float64(width)/float64(w), float64(height)/float64(h))
+		w = max(1, int(math.Round(float64(w)*scale)))
+		h = max(1, int(math.Round(float64(h)*scale)))
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// encodeThumbnail encodes img as JPEG, or as PNG when it has transparent pixels.
+func encodeThumbnail(img *image.RGBA) (Thumbnail, error) {
+	var buf bytes.Buffer
+	if img.Opaque() {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+			return Thumbnail{}, fmt.Errorf("encode thumbnail: %w", err)
+		}
+		return Thumbnail{Data: buf.Bytes(), MimeType: "image/jpeg"}, nil
+	}
+	if err := png.Encode(&buf, img); err != nil {
+		return Thumbnail{}, fmt.Errorf("encode thumbnail: %w", err)
+	}
+	return Thumbnail{Data: buf.Bytes(), MimeType: "image/png"}, nil
+}
+
+// serveThumbnail answers GET <path>/-/thumbnail?w=<px>&h=<px> with a
+// thumbnail of the image file, or 304 when its ETag matches If-None-Match.
+func (h Handler) serveThumbnail(c echo.Context, root Root, rel string) error {
+	width, err := thumbnailDimension(c, "w")
+	if err != nil {
+		return err
+	}
+	height, err := thumbnailDimension(c, "h")
+	if err != nil {
+		return err
+	}
+	ctx := c.Request().Context()
+	desc, err := h.svc.Describe(ctx, root.Virtual, rel)
+	if err != nil {
+		return toHTTPError(err)
+	}
+	if desc.TargetKind != kindFile {
+		return echo.NewHTTPError(http.StatusBadRequest, "thumbnails require an image file")
+	}
+
+	if etag := ComputeETag(desc); etag != "" {
+		// The thumbnail changes with the image and the requested size.
+		etag = fmt.Sprintf(`%s-%dx%d"`, strings.TrimSuffix(etag, `"`), width, height)
+		c.Response().Header().Set(headerETag, etag)
+		if notModified(c.Request(), etag) {
+			return c.NoContent(http.StatusNotModified)
+		}
+	}
+
+	thumb, err := h.svc.Thumbnail(ctx, desc, width, height)
+	if err != nil {
+		return toHTTPError(err)
+	}
+	return c.Blob(http.StatusOK, thumb.MimeType, thumb.Data)
+}
+
+// thumbnailDimension parses the width or height query parameter name,
+// defaulting to defaultThumbnailSize, and rounds it up to the next of
+// thumbnailSizes.
+func thumbnailDimension(c echo.Context, name string) (int, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return defaultThumbnailSize, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > maxThumbnailSize {
+		return 0, echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("%s must be between 1 and %d: %s", name, maxThumbnailSize, value))
+	}
+	i, _ := slices.BinarySearch(thumbnailSizes, n)
+	return thumbnailSizes[i], nil
+}
@@ -0,0 +1,76 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Server-Timing metric names of the listing phases.
+const (
+	timingReadDir   = "readdir"
+	timingDescribe  = "describe"
+	timingSerialize = "serialize"
+)
+
+type timingsKey struct{}
+
+// phaseTimings accumulates the time spent per phase of a request.
+type phaseTimings struct {
+	mu        sync.Mutex
+	order     []string
+	durations map[string]time.Duration
+}
+
+// contextWithTimings stores a new phase recorder in the context.
+func contextWithTimings(ctx context.Context) context.Context {
+	return context.WithValue(ctx, timingsKey{}, &phaseTimings{durations: make(map[string]time.Duration)})
+}
+
+// timingsFromContext returns the phase recorder of the context, or nil when
+// timings are not collected.
+func timingsFromContext(ctx context.Context) *phaseTimings {
+	if t, ok := ctx.Value(timingsKey{}).(*phaseTimings); ok {
+		return t
+	}
+	return nil
+}
+
+// add records d for phase. It is a no-op on a nil recorder.
+func (t *phaseTimings) add(phase string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, seen := t.durations[phase]; !seen {
+		t.order = append(t.order, phase)
+	}
+	t.durations[phase] += d
+}
+
+// header renders the recorded phases as a Server-Timing header value with
+// durations in milliseconds.
+func (t *phaseTimings) header() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	metrics := make([]string, 0, len(t.order))
+	for _, phase := range t.order {
+		ms := float64(t.durations[phase].Microseconds()) / 1000
+		metrics = append(metrics, fmt.Sprintf("%s;dur=%.3f", phase, ms))
+	}
+	return strings.Join(metrics, ", ")
+}
+
+// collectServerTiming enables phase timings for the request.
+func collectServerTiming(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		c.SetRequest(req.WithContext(contextWithTimings(req.Context())))
+		return next(c)
+	}
+}
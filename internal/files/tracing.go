@@ -0,0 +1,36 @@
+package files
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records spans of filesystem work. It stays a no-op until a
+// tracer provider is installed.
+var tracer = otel.Tracer("github.com/thorstenkramm/dendrite-pulse/internal/files")
+
+// Span attributes of filesystem work.
+const (
+	attrRoot    = attribute.Key("dendrite.root")
+	attrPath    = attribute.Key("dendrite.path")
+	attrEntries = attribute.Key("dendrite.entries")
+	attrSize    = attribute.Key("dendrite.size_bytes")
+)
+
+// startSpan starts a span for work on rel beneath the virtual root.
+func startSpan(ctx context.Context, name, virtual, rel string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrRoot.String(virtual), attrPath.String(rel)))
+}
+
+// endSpan records err, if any, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,180 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/api"
+)
+
+const (
+	// maxTreeDepth is the deepest tree listing ?depth= accepts.
+	maxTreeDepth = 10
+	// maxTreeEntries bounds the entries of one tree listing, so a deep
+	// request on a large subtree cannot exhaust memory.
+	maxTreeEntries = 10000
+)
+
+// ErrTreeLimit indicates a tree listing with more than maxTreeEntries entries.
+var ErrTreeLimit = errors.New("tree exceeds entry limit")
+
+// TreeNode is an entry of a tree listing. Children is set for folders whose
+// children were listed, and empty for those without any.
+type TreeNode struct {
+	Descriptor
+	Children []TreeNode
+}
+
+// ListTree lists the folder at rel beneath virtual and the descendants of
+// its subfolders down to depth levels, depth 1 being the folder's own
+// entries. Symlinked folders are not descended into, so links cannot cause
+// cycles; subfolders that cannot be read are returned without children.
+// It fails with ErrTreeLimit once the tree has more than maxEntries entries.
+func (s *Service) ListTree(ctx context.Context, virtual, rel string, depth, maxEntries int) ([]TreeNode, error) {
+	parent, err := s.describeFolder(ctx, virtual, rel)
+	if err != nil {
+		return nil, err
+	}
+	budget := maxEntries
+	return s.listTree(ctx, parent.Root.Virtual, parent.RelPath, depth, &budget)
+}
+
+func (s *Service) listTree(ctx context.Context, virtual, rel string, depth int, budget *int) ([]TreeNode, error) {
+	entries, err := s.ListDirectory(ctx, virtual, rel)
+	if err != nil {
+		return nil, err
+	}
+	*budget -= len(entries)
+	if *budget < 0 {
+		return nil, ErrTreeLimit
+	}
+
+	nodes := make([]TreeNode, len(entries))
+	for i, entry := range entries {
+		nodes[i].Descriptor = entry
+		if depth <= 1 || entry.Kind != kindFolder {
+			continue
+		}
+		children, err := s.listTree(ctx, virtual, entry.RelPath, depth-1, budget)
+		if errors.Is(err, fs.ErrPermission) || errors.Is(err, ErrPathDepth) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if children == nil {
+			children = []TreeNode{}
+		}
+		nodes[i].Children = children
+	}
+	return nodes, nil
+}
+
+// TreeResponse is the JSON:API compound document of a tree listing. Data
+// holds the entries of the listed folder; the deeper entries are included
+// and referenced through the children relationship of their folder.
+type TreeResponse struct {
+	Meta     TreeMeta   `json:"meta"`
+	Data     []Resource `json:"data"`
+	Included []Resource `json:"included"`
+}
+
+// TreeMeta counts the entries of a tree listing, in total and per level.
+type TreeMeta struct {
+	TotalCount  int   `json:"total_count"`
+	LevelCounts []int `json:"level_counts"`
+}
+
+// ResourceRelationships relates a folder of a tree listing to its children.
+type ResourceRelationships struct {
+	Children RelationshipData `json:"children"`
+}
+
+// RelationshipData holds the identifiers of related resources.
+type RelationshipData struct {
+	Data []ResourceIdentifier `json:"data"`
+}
+
+// serveTree answers ?depth=N on a folder with its descendants down to N
+// levels. Sorting and sparse fieldsets apply per level; pagination does not.
+func (h Handler) serveTree(c echo.Context, desc Descriptor) error {
+	depth, err := strconv.Atoi(c.QueryParam("depth"))
+	if err != nil || depth < 1 || depth > maxTreeDepth {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("invalid depth: must be between 1 and %d", maxTreeDepth))
+	}
+	if desc.TargetKind != kindFolder {
+		return echo.NewHTTPError(http.StatusBadRequest, "depth requires a folder")
+	}
+	params, err := h.parseListParams(c, desc.Root)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := h.svc.ListTree(c.Request().Context(), desc.Root.Virtual, desc.RelPath, depth, maxTreeEntries)
+	if errors.Is(err, ErrTreeLimit) {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity,
+			fmt.Sprintf("tree has more than %d entries", maxTreeEntries))
+	}
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	resp := TreeResponse{Meta: TreeMeta{LevelCounts: []int{}}, Included: []Resource{}}
+	resp.Data = h.treeResources(nodes, params, 0, &resp)
+	c.Response().Header().Set(echo.HeaderContentType, api.ContentType)
+	if err := c.JSON(http.StatusOK, resp); err != nil {
+		return fmt.Errorf("write tree response: %w", err)
+	}
+	return nil
+}
+
+// treeResources converts the nodes of one level, adding their descendants
+// to resp.Included and counting every level in resp.Meta.
+func (h Handler) treeResources(nodes []TreeNode, params ListParams, level int, resp *TreeResponse) []Resource {
+	if len(nodes) == 0 {
+		return []Resource{}
+	}
+	sortTreeNodes(nodes, params)
+	if len(resp.Meta.LevelCounts) <= level {
+		resp.Meta.LevelCounts = append(resp.Meta.LevelCounts, 0)
+	}
+	resp.Meta.LevelCounts[level] += len(nodes)
+	resp.Meta.TotalCount += len(nodes)
+
+	resources := make([]Resource, len(nodes))
+	for i, node := range nodes {
+		resources[i] = h.resourceFrom(node.Descriptor, params)
+		if node.Children == nil {
+			continue
+		}
+		children := h.treeResources(node.Children, params, level+1, resp)
+		ids := make([]ResourceIdentifier, len(children))
+		for j, child := range children {
+			ids[j] = ResourceIdentifier{Type: child.Type, ID: child.ID}
+		}
+		resources[i].Relationships = &ResourceRelationships{Children: RelationshipData{Data: ids}}
+		resp.Included = append(resp.Included, children...)
+	}
+	return resources
+}
+
+// sortTreeNodes orders one level of a tree like a listing.
+func sortTreeNodes(nodes []TreeNode, params ListParams) {
+	descs := make([]Descriptor, len(nodes))
+	index := make(map[string]TreeNode, len(nodes))
+	for i, node := range nodes {
+		descs[i] = node.Descriptor
+		index[node.VirtualPath] = node
+	}
+	sortDescriptors(descs, params)
+	for i, desc := range descs {
+		nodes[i] = index[desc.VirtualPath]
+	}
+}
@@ -0,0 +1,144 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"syscall"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/api"
+)
+
+// Disk usage modes of ?usage=.
+const (
+	usageApparent  = "apparent"
+	usageAllocated = "allocated"
+)
+
+// Usage aggregates the entries below a folder.
+type Usage struct {
+	SizeBytes   int64
+	FileCount   int
+	FolderCount int
+	// Unreadable counts the subfolders skipped for lack of permission.
+	Unreadable int
+}
+
+// DiskUsage walks the folder desc resolves to and sums its files like du.
+// With allocated false it sums the apparent sizes of files and symlinks;
+// with allocated true the blocks allocated for every entry, including
+// folders. Files with several hard links count once. Symlinks are not
+// followed, subfolders that cannot be read are counted and skipped, entries
+// hidden by respected gitignore rules are left out, and the walk stops once
+// ctx is canceled.
+func (s *Service) DiskUsage(ctx context.Context, desc Descriptor, allocated bool) (Usage, error) {
+	w := usageWalk{allocated: allocated, seen: make(map[string]bool)}
+	walker := treeWalker{
+		svc:  s,
+		root: desc.Root,
+		visit: func(_, _ string, info fs.FileInfo, _ int) (bool, error) {
+			w.add(info)
+			return true, nil
+		},
+		unreadable: func(string) { w.usage.Unreadable++ },
+	}
+	if err := walker.walk(ctx, desc.RelPath, desc.AbsolutePath); err != nil {
+		return Usage{}, err
+	}
+	return w.usage, nil
+}
+
+// usageWalk carries the state of one DiskUsage walk.
+type usageWalk struct {
+	allocated bool
+	seen      map[string]bool // device and inode of hard-linked files
+	usage     Usage
+}
+
+// add counts one entry and its size.
+func (w *usageWalk) add(info fs.FileInfo) {
+	if info.IsDir() {
+		w.usage.FolderCount++
+	} else {
+		w.usage.FileCount++
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if ok && !info.IsDir() && stat.Nlink > 1 {
+		id := fmt.Sprintf("%x-%x", stat.Dev, stat.Ino)
+		if w.seen[id] {
+			return
+		}
+		w.seen[id] = true
+	}
+
+	switch {
+	case w.allocated && ok:
+		w.usage.SizeBytes += stat.Blocks * 512
+	case !w.allocated && !info.IsDir():
+		w.usage.SizeBytes += info.Size()
+	}
+}
+
+// UsageResponse is the JSON:API document of a folder's disk usage.
+type UsageResponse struct {
+	Data UsageResource `json:"data"`
+}
+
+// UsageResource represents the aggregated disk usage of a folder.
+type UsageResource struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Attributes UsageAttributes `json:"attributes"`
+}
+
+// UsageAttributes holds the totals of a disk usage walk. SizeBytes is a
+// number, or a string with api.size_as_string.
+type UsageAttributes struct {
+	Mode            string `json:"mode"`
+	SizeBytes       any    `json:"size_bytes"`
+	FileCount       int    `json:"file_count"`
+	FolderCount     int    `json:"folder_count"`
+	UnreadableCount int    `json:"unreadable_count"`
+}
+
+// sendUsage answers ?usage=apparent or ?usage=allocated on a folder with
+// the aggregated size and entry counts of its subtree.
+func (h Handler) sendUsage(c echo.Context, desc Descriptor, mode string) error {
+	if mode != usageApparent && mode != usageAllocated {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid usage: %s", mode))
+	}
+	if desc.TargetKind != kindFolder {
+		return echo.NewHTTPError(http.StatusBadRequest, "usage requires a folder")
+	}
+
+	usage, err := h.svc.DiskUsage(c.Request().Context(), desc, mode == usageAllocated)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	var size any = usage.SizeBytes
+	if h.opts.SizeAsString {
+		size = strconv.FormatInt(usage.SizeBytes, 10)
+	}
+	resp := UsageResponse{Data: UsageResource{
+		ID:   desc.VirtualPath,
+		Type: "usages",
+		Attributes: UsageAttributes{
+			Mode:            mode,
+			SizeBytes:       size,
+			FileCount:       usage.FileCount,
+			FolderCount:     usage.FolderCount,
+			UnreadableCount: usage.Unreadable,
+		},
+	}}
+	c.Response().Header().Set(echo.HeaderContentType, api.ContentType)
+	if err := c.JSON(http.StatusOK, resp); err != nil {
+		return fmt.Errorf("write usage response: %w", err)
+	}
+	return nil
+}
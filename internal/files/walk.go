@@ -0,0 +1,76 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// treeWalker visits the entries below a folder depth-first. Entries hidden
+// by respected gitignore rules and entries removed while walking are
+// skipped, symlinks are not followed and the walk stops once its context
+// is canceled.
+type treeWalker struct {
+	svc  *Service
+	root Root
+	// visit is called with every entry, its depth below the walked folder
+	// starting at 1, and its Lstat info. It reports whether to descend into
+	// a folder.
+	visit func(rel, absPath string, info fs.FileInfo, depth int) (bool, error)
+	// unreadable is called for subfolders that cannot be read for lack of
+	// permission; the walk continues with their siblings. When nil, the walk
+	// fails instead.
+	unreadable func(rel string)
+}
+
+// walk visits the entries below the folder at absPath, rel within the root.
+func (w treeWalker) walk(ctx context.Context, rel, absPath string) error {
+	return w.folder(ctx, rel, absPath, 1)
+}
+
+func (w treeWalker) folder(ctx context.Context, rel, absPath string, depth int) error {
+	entries, err := w.svc.readDir(absPath)
+	if err != nil {
+		return fmt.Errorf("read dir %s: %w", joinVirtual(w.root.Virtual, rel), err)
+	}
+	ignores := w.svc.listingIgnores(w.root, rel)
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("context canceled: %w", err)
+		}
+		childRel := path.Join(rel, entry.Name())
+		if ignores.ignored(childRel, entry.IsDir()) {
+			continue
+		}
+		childPath := filepath.Join(absPath, entry.Name())
+		info, err := os.Lstat(childPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Removed since the directory was read.
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("stat %s: %w", joinVirtual(w.root.Virtual, childRel), err)
+		}
+
+		descend, err := w.visit(childRel, childPath, info, depth)
+		if err != nil {
+			return err
+		}
+		if !descend || !info.IsDir() {
+			continue
+		}
+		err = w.folder(ctx, childRel, childPath, depth+1)
+		if errors.Is(err, fs.ErrPermission) && w.unreadable != nil {
+			w.unreadable(childRel)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
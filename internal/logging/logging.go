@@ -41,23 +41,15 @@ func NewLogger(logFile, format, level string) (*slog.Logger, func() error, error
 	if err != nil {
 		return nil, nil, err
 	}
+	return New(logFile, format, lvl)
+}
 
-	var (
-		writer io.Writer
-		closer func() error
-	)
-
-	if logFile == "-" {
-		writer = os.Stdout
-	} else {
-		// Path is user-supplied by design.
-		//nolint:gosec
-		f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
-		if err != nil {
-			return nil, nil, fmt.Errorf("open log file: %w", err)
-		}
-		writer = f
-		closer = f.Close
+// New is NewLogger with a parsed level. Passing a *slog.LevelVar allows the
+// level to be changed while the logger is in use.
+func New(logFile, format string, lvl slog.Leveler) (*slog.Logger, func() error, error) {
+	writer, closer, err := OpenFile(logFile)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	handlerOpts := slog.HandlerOptions{
@@ -88,6 +80,30 @@ func NewLogger(logFile, format, level string) (*slog.Logger, func() error, error
 	return logger, closer, nil
 }
 
+// OpenFile opens logFile for appending, creating it if needed. "-" is
+// stdout, which needs no closing, so the returned closer is nil then.
+func OpenFile(logFile string) (io.Writer, func() error, error) {
+	if logFile == "-" {
+		return os.Stdout, nil, nil
+	}
+	// Path is user-supplied by design.
+	//nolint:gosec
+	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open log file: %w", err)
+	}
+	return f, f.Close, nil
+}
+
+// ParseLevel parses a configured log level: debug, info, warn or error.
+func ParseLevel(level string) (slog.Level, error) {
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return 0, err
+	}
+	return lvl.Level(), nil
+}
+
 func parseLevel(level string) (slog.Leveler, error) {
 	switch strings.ToLower(level) {
 	case "", "info":
@@ -0,0 +1,34 @@
+// Package parallel runs independent blocking calls with bounded concurrency.
+package parallel
+
+import (
+	"errors"
+	"sync"
+)
+
+// Each calls fn for every index in [0, n) with at most limit calls running at
+// once; a limit below 1 runs them one at a time. All calls run even when some
+// fail, and the errors are joined in index order.
+func Each(n, limit int, fn func(i int) error) error {
+	if limit < 1 {
+		limit = 1
+	}
+
+	errs := make([]error, n)
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := range n {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = fn(i)
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,41 @@
+package parallel
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEach(t *testing.T) {
+	var running, peak atomic.Int32
+	err := Each(20, 4, func(i int) error {
+		current := running.Add(1)
+		defer running.Add(-1)
+		for {
+			seen := peak.Load()
+			if current <= seen || peak.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		if i%7 == 0 {
+			return fmt.Errorf("call %d failed", i)
+		}
+		return nil
+	})
+
+	require.Error(t, err)
+	assert.Equal(t, "call 0 failed\ncall 7 failed\ncall 14 failed", err.Error())
+	assert.LessOrEqual(t, peak.Load(), int32(4))
+}
+
+func TestEachWithoutErrors(t *testing.T) {
+	var calls atomic.Int32
+	require.NoError(t, Each(5, 0, func(int) error {
+		calls.Add(1)
+		return nil
+	}))
+	assert.Equal(t, int32(5), calls.Load())
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package pidfile
+
+import (
+	"errors"
+	"syscall"
+)
+
+// alive reports whether a process with the given ID exists. Processes of
+// other users count as alive even though they cannot be signaled.
+func alive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,79 @@
+// Package pidfile records the ID of the server process for init scripts and
+// monitoring tools.
+package pidfile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrRunning indicates that the PID file names another live process.
+var ErrRunning = errors.New("already running")
+
+// Write creates the PID file at path holding the ID of the current process.
+// An existing file naming another live process fails with ErrRunning; a file
+// naming a process that no longer exists, or holding no ID at all, is stale
+// and replaced. The returned function removes the file again unless another
+// process has taken it over meanwhile.
+func Write(path string) (func() error, error) {
+	pid := os.Getpid()
+	// A second attempt follows the removal of a stale file.
+	for range 2 {
+		// PID files are read by init scripts and monitoring tools running as
+		// other users.
+		//nolint:gosec
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			if _, err := fmt.Fprintf(f, "%d\n", pid); err != nil {
+				_ = f.Close()
+				_ = os.Remove(path)
+				return nil, fmt.Errorf("write pid file: %w", err)
+			}
+			if err := f.Close(); err != nil {
+				return nil, fmt.Errorf("write pid file: %w", err)
+			}
+			return func() error { return remove(path, pid) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("create pid file: %w", err)
+		}
+
+		if other, err := read(path); err == nil && other != pid && alive(other) {
+			return nil, fmt.Errorf("%w with pid %d according to %s", ErrRunning, other, path)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("remove stale pid file: %w", err)
+		}
+	}
+	return nil, fmt.Errorf("create pid file %s: %w", path, fs.ErrExist)
+}
+
+// read returns the process ID stored in the PID file at path.
+func read(path string) (int, error) {
+	// Path is user-supplied by design.
+	//nolint:gosec
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("read pid file: %w", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid pid file %s", path)
+	}
+	return pid, nil
+}
+
+// remove deletes the PID file at path if it still names pid.
+func remove(path string, pid int) error {
+	if current, err := read(path); err != nil || current != pid {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove pid file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package pidfile
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dendrite.pid")
+
+	remove, err := Write(path)
+	require.NoError(t, err)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid())+"\n", string(content))
+
+	require.NoError(t, remove())
+	assert.NoFileExists(t, path)
+}
+
+func TestWrite_Running(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dendrite.pid")
+	cmd := exec.Command("sleep", "10")
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	require.NoError(t, os.WriteFile(path, []byte(strconv.Itoa(cmd.Process.Pid)), 0o600))
+
+	_, err := Write(path)
+	require.ErrorIs(t, err, ErrRunning)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(cmd.Process.Pid), string(content), "the file of the running process is kept")
+}
+
+func TestWrite_Stale(t *testing.T) {
+	cmd := exec.Command("true")
+	require.NoError(t, cmd.Run())
+
+	for name, content := range map[string]string{
+		"exited process": strconv.Itoa(cmd.Process.Pid),
+		"garbage":        "not a pid",
+		"empty":          "",
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "dendrite.pid")
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+			remove, err := Write(path)
+			require.NoError(t, err)
+			defer func() { _ = remove() }()
+			written, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, strconv.Itoa(os.Getpid())+"\n", string(written))
+		})
+	}
+}
+
+func TestRemove_TakenOver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dendrite.pid")
+	remove, err := Write(path)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("1\n"), 0o600))
+	require.NoError(t, remove())
+	assert.FileExists(t, path, "a file taken over by another process is kept")
+}
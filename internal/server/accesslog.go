@@ -0,0 +1,145 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/auth"
+	"github.com/thorstenkramm/dendrite-pulse/internal/files"
+)
+
+// Access log formats.
+const (
+	AccessLogJSON     = "json"
+	AccessLogCombined = "combined"
+)
+
+// combinedTimeFormat is the timestamp layout of the combined log format.
+const combinedTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// accessEntry is one line of the access log.
+type accessEntry struct {
+	Time      time.Time `json:"time"`
+	RemoteIP  string    `json:"remote_ip"`
+	User      string    `json:"user,omitempty"`
+	Method    string    `json:"method"`
+	URI       string    `json:"uri"`
+	Proto     string    `json:"proto"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"`
+	Duration  float64   `json:"duration_ms"`
+	Root      string    `json:"root,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+// accessLog writes one entry per completed request to w in the given
+// format. Like slogErrorLogger it runs the error handler itself, so the
+// entry holds the final status and size of the response.
+func accessLog(w io.Writer, format string) echo.MiddlewareFunc {
+	var mu sync.Mutex
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			line, err := newAccessEntry(c, start).format(format)
+			if err != nil {
+				c.Logger().Errorf("format access log entry: %v", err)
+				return nil
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if _, err := w.Write(line); err != nil {
+				c.Logger().Errorf("write access log: %v", err)
+			}
+			return nil
+		}
+	}
+}
+
+func newAccessEntry(c echo.Context, start time.Time) accessEntry {
+	req := c.Request()
+	res := c.Response()
+	root, virtualPath := files.RequestTarget(c)
+
+	rid := res.Header().Get(echo.HeaderXRequestID)
+	if rid == "" {
+		rid = req.Header.Get(echo.HeaderXRequestID)
+	}
+	var user string
+	if id, ok := auth.IdentityFromContext(req.Context()); ok {
+		user = id.Subject
+	}
+
+	return accessEntry{
+		Time:      start,
+		RemoteIP:  c.RealIP(),
+		User:      user,
+		Method:    req.Method,
+		URI:       req.RequestURI,
+		Proto:     req.Proto,
+		Status:    res.Status,
+		Bytes:     res.Size,
+		Duration:  float64(time.Since(start).Microseconds()) / 1000,
+		Root:      root,
+		Path:      virtualPath,
+		RequestID: rid,
+		Referer:   req.Referer(),
+		UserAgent: req.UserAgent(),
+	}
+}
+
+// format renders e as one line in the given access log format.
+func (e accessEntry) format(format string) ([]byte, error) {
+	if format == AccessLogCombined {
+		return e.combined(), nil
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("encode access log entry: %w", err)
+	}
+	return append(line, '\n'), nil
+}
+
+// combined formats e in the Apache combined log format.
+func (e accessEntry) combined() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s - %s [%s] %s %d %s %s %s\n",
+		e.RemoteIP,
+		orDash(e.User),
+		e.Time.Format(combinedTimeFormat),
+		strconv.Quote(e.Method+" "+e.URI+" "+e.Proto),
+		e.Status,
+		sizeOrDash(e.Bytes),
+		strconv.Quote(orDash(e.Referer)),
+		strconv.Quote(orDash(e.UserAgent)),
+	)
+	return b.Bytes()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func sizeOrDash(n int64) string {
+	if n == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(n, 10)
+}
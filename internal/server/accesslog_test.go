@@ -0,0 +1,66 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/files"
+)
+
+func TestAccessLog_JSON(t *testing.T) {
+	source := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(source, "a.txt"), []byte("hello"), 0o600))
+	svc, err := files.NewService([]files.Root{{Virtual: "/public", Source: source}}, files.Options{})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	e := buildRouter(Config{FileService: svc, AccessLog: &buf, AccessLogFormat: AccessLogJSON})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/public/a.txt", nil)
+	req.Header.Set("User-Agent", "test-agent")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	dec := json.NewDecoder(&buf)
+	var entry map[string]any
+	require.NoError(t, dec.Decode(&entry))
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, "/api/v1/files/public/a.txt", entry["uri"])
+	assert.InDelta(t, http.StatusOK, entry["status"], 0)
+	assert.InDelta(t, rec.Body.Len(), entry["bytes"], 0)
+	assert.Contains(t, entry, "duration_ms")
+	assert.Equal(t, "/public", entry["root"])
+	assert.Equal(t, "/public/a.txt", entry["path"])
+	assert.Equal(t, "test-agent", entry["user_agent"])
+
+	entry = nil
+	require.NoError(t, dec.Decode(&entry))
+	assert.InDelta(t, http.StatusNotFound, entry["status"], 0)
+	assert.NotContains(t, entry, "root")
+	assert.False(t, dec.More())
+}
+
+func TestAccessLog_Combined(t *testing.T) {
+	var buf bytes.Buffer
+	e := buildRouter(Config{AccessLog: &buf, AccessLogFormat: AccessLogCombined})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/ping?x=1", nil)
+	req.Header.Set("Referer", "https://example.com/")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	pattern := `^192\.0\.2\.1 - - \[[^\]]+\] "GET /api/v1/ping\?x=1 HTTP/1\.1" 200 \d+ ` +
+		`"https://example\.com/" "-"\n$`
+	assert.Regexp(t, regexp.MustCompile(pattern), buf.String())
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/auth"
+	"github.com/thorstenkramm/dendrite-pulse/internal/files"
+)
+
+// HeaderAPIKey is the request header carrying an API key, as an
+// alternative to Authorization: Bearer <key>.
+const HeaderAPIKey = "X-API-Key"
+
+// authenticate rejects /api/v1 requests without a valid API key or OIDC ID
+// token with 401 and stores the identity of the others in the request
+// context. Ping and the login endpoints stay public, and signed download
+// URLs carry their own authorization, verified by the file handler.
+func authenticate(keys auth.APIKeys, provider *auth.OIDC) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !needsAuthentication(c) {
+				return next(c)
+			}
+			req := c.Request()
+			id, ok := identify(req, keys, provider)
+			if !ok {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+				return echo.NewHTTPError(http.StatusUnauthorized, "missing or invalid credentials")
+			}
+			c.SetRequest(req.WithContext(auth.ContextWithIdentity(req.Context(), id)))
+			return next(c)
+		}
+	}
+}
+
+func needsAuthentication(c echo.Context) bool {
+	req := c.Request()
+	switch {
+	case !strings.HasPrefix(req.URL.Path, "/api/v1/"), req.URL.Path == "/api/v1/ping",
+		strings.HasPrefix(req.URL.Path, "/api/v1/auth/"):
+		return false
+	case (req.Method == http.MethodGet || req.Method == http.MethodHead) &&
+		strings.HasPrefix(req.URL.Path, "/api/v1/files/") && files.IsSignedRequest(c):
+		return false
+	}
+	return true
+}
+
+// identify checks the API key or bearer token of req, then the session
+// cookie of the authorization code flow.
+func identify(req *http.Request, keys auth.APIKeys, provider *auth.OIDC) (auth.Identity, bool) {
+	credential := req.Header.Get(HeaderAPIKey)
+	if token, ok := strings.CutPrefix(req.Header.Get(echo.HeaderAuthorization), "Bearer "); ok {
+		credential = token
+	}
+	if id, ok := keys.Identify(credential); ok {
+		return id, true
+	}
+	if provider == nil {
+		return auth.Identity{}, false
+	}
+	if credential == "" {
+		credential = auth.SessionToken(req)
+	}
+	id, err := provider.Verify(req.Context(), credential)
+	return id, err == nil
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// defaultRetryAfter is the Retry-After sent when requests are rejected for
+// exceeding Limits.MaxConcurrentRequests.
+const defaultRetryAfter = time.Second
+
+// Limits protects the server from more work than it can handle at once.
+// Zero values mean no limit.
+type Limits struct {
+	// MaxConcurrentRequests caps the requests handled at the same time.
+	// Further requests are rejected with 503 Service Unavailable.
+	MaxConcurrentRequests int
+	// MaxConnections caps the open connections across all listeners.
+	// Further connections wait in the accept backlog of the kernel.
+	MaxConnections int
+	// RetryAfter tells rejected clients when to try again; rounded up to
+	// whole seconds. Defaults to one second.
+	RetryAfter time.Duration
+	// MaxBodySize caps request bodies in bytes. Larger requests are
+	// rejected with 413 Request Entity Too Large.
+	MaxBodySize int64
+}
+
+// concurrencyLimit rejects requests while limit requests are in flight.
+func concurrencyLimit(limit int, retryAfter time.Duration) echo.MiddlewareFunc {
+	if retryAfter <= 0 {
+		retryAfter = defaultRetryAfter
+	}
+	seconds := strconv.Itoa(int((retryAfter + time.Second - 1) / time.Second))
+	slots := make(chan struct{}, limit)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+				return next(c)
+			default:
+				c.Response().Header().Set("Retry-After", seconds)
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "too many concurrent requests")
+			}
+		}
+	}
+}
+
+// connLimiter caps the open connections of the listeners it wraps.
+type connLimiter struct {
+	slots chan struct{}
+}
+
+func newConnLimiter(limit int) *connLimiter {
+	return &connLimiter{slots: make(chan struct{}, limit)}
+}
+
+// wrap returns l accepting connections only while a slot is free.
+func (cl *connLimiter) wrap(l net.Listener) net.Listener {
+	return &limitListener{Listener: l, limiter: cl, done: make(chan struct{})}
+}
+
+type limitListener struct {
+	net.Listener
+	limiter *connLimiter
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.limiter.slots <- struct{}{}:
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.limiter.slots
+		// http.Server inspects Accept errors, e.g. for net.ErrClosed.
+		//nolint:wrapcheck
+		return nil, err
+	}
+	return &limitConn{Conn: conn, release: func() { <-l.limiter.slots }}, nil
+}
+
+func (l *limitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	//nolint:wrapcheck
+	return l.Listener.Close()
+}
+
+// limitConn frees its slot when closed.
+type limitConn struct {
+	net.Conn
+	releaseOnce sync.Once
+	release     func()
+}
+
+func (c *limitConn) Close() error {
+	c.releaseOnce.Do(c.release)
+	//nolint:wrapcheck
+	return c.Conn.Close()
+}
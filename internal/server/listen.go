@@ -0,0 +1,70 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// unixPrefix marks listen addresses of Unix domain sockets, e.g.
+// unix:/run/dendrite.sock.
+const unixPrefix = "unix:"
+
+// DefaultSocketMode lets the owner and group of the server connect to its
+// Unix domain socket.
+const DefaultSocketMode fs.FileMode = 0o660
+
+// listen opens a TCP listener on addr, or a Unix domain socket with mode
+// for unix:<path> addresses. A socket left behind by a previous run is
+// replaced; a socket another process still serves is not.
+func listen(addr string, mode fs.FileMode) (net.Listener, error) {
+	socket, ok := strings.CutPrefix(addr, unixPrefix)
+	if !ok {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("listen on %s: %w", addr, err)
+		}
+		return l, nil
+	}
+
+	if err := removeStaleSocket(socket); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", addr, err)
+	}
+	if mode == 0 {
+		mode = DefaultSocketMode
+	}
+	if err := os.Chmod(socket, mode); err != nil {
+		_ = l.Close()
+		return nil, fmt.Errorf("set permissions of %s: %w", socket, err)
+	}
+	return l, nil
+}
+
+func removeStaleSocket(socket string) error {
+	info, err := os.Lstat(socket)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", socket, err)
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%s exists and is not a socket", socket)
+	}
+	if conn, err := net.DialTimeout("unix", socket, time.Second); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("%s is in use by another process", socket)
+	}
+	if err := os.Remove(socket); err != nil {
+		return fmt.Errorf("remove stale socket %s: %w", socket, err)
+	}
+	return nil
+}
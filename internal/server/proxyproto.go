@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyHeaderTimeout bounds how long a connection may take to send its
+// PROXY protocol header.
+const proxyHeaderTimeout = 5 * time.Second
+
+// maxProxyV1Header is the longest valid version 1 header, including CRLF.
+const maxProxyV1Header = 107
+
+// proxyV2Signature starts every version 2 header.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var errNoProxyHeader = errors.New("missing PROXY protocol header")
+
+// proxyListener expects the HAProxy PROXY protocol header, version 1 or 2,
+// on every accepted connection and reports the client address it carries
+// as the remote address. Connections without a valid header fail on their
+// first read.
+type proxyListener struct {
+	net.Listener
+}
+
+func (l proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		// http.Server inspects Accept errors, e.g. for net.ErrClosed.
+		//nolint:wrapcheck
+		return nil, err
+	}
+	return &proxyConn{Conn: conn}, nil
+}
+
+// proxyConn reads the PROXY protocol header on first use, so a slow client
+// does not hold up the accept loop. It remembers the read deadline set by
+// http.Server, e.g. for ReadHeaderTimeout, and restores it after the
+// header, so the header timeout cannot lift the server's.
+type proxyConn struct {
+	net.Conn
+
+	once   sync.Once
+	reader *bufio.Reader
+	remote net.Addr
+	err    error
+
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func (c *proxyConn) readHeader() {
+	c.once.Do(func() {
+		c.reader = bufio.NewReader(c.Conn)
+		c.mu.Lock()
+		deadline := c.deadline
+		c.mu.Unlock()
+		headerDeadline := time.Now().Add(proxyHeaderTimeout)
+		if !deadline.IsZero() && deadline.Before(headerDeadline) {
+			headerDeadline = deadline
+		}
+		_ = c.Conn.SetReadDeadline(headerDeadline)
+		c.remote, c.err = readProxyHeader(c.reader)
+		c.mu.Lock()
+		_ = c.Conn.SetReadDeadline(c.deadline)
+		c.mu.Unlock()
+		if c.err != nil {
+			// Drop the connection rather than answer a client that bypassed
+			// the proxy.
+			_ = c.Conn.Close()
+		}
+		if c.remote == nil {
+			c.remote = c.Conn.RemoteAddr()
+		}
+	})
+}
+
+func (c *proxyConn) Read(p []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	// Callers compare against io.EOF, so Read errors stay unwrapped.
+	//nolint:wrapcheck
+	return c.reader.Read(p)
+}
+
+// SetDeadline sets the read and write deadlines of the connection.
+func (c *proxyConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	//nolint:wrapcheck
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the connection, which also
+// applies once the PROXY protocol header has been read.
+func (c *proxyConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	//nolint:wrapcheck
+	return c.Conn.SetReadDeadline(t)
+}
+
+// RemoteAddr returns the client address of the PROXY protocol header, or
+// the address of the proxy for LOCAL and UNKNOWN connections.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	return c.remote
+}
+
+// readProxyHeader consumes the PROXY protocol header from r. It returns a
+// nil address when the header carries none.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	sig, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errNoProxyHeader, err)
+	}
+	switch {
+	case bytes.Equal(sig, proxyV2Signature):
+		return readProxyV2(r)
+	case bytes.HasPrefix(sig, []byte("PROXY ")):
+		return readProxyV1(r)
+	default:
+		return nil, errNoProxyHeader
+	}
+}
+
+// readProxyV1 parses a header like "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n".
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < maxProxyV1Header {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("read PROXY protocol header: %w", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	header, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return nil, errors.New("invalid PROXY protocol header")
+	}
+	fields := strings.Split(header, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid PROXY protocol header: %q", header)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("invalid PROXY protocol source: %s %s", fields[2], fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyV2 parses the binary header of version 2.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, len(proxyV2Signature)+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("read PROXY protocol header: %w", err)
+	}
+	verCmd, family := header[12], header[13]
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("read PROXY protocol header: %w", err)
+	}
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", verCmd>>4)
+	}
+	switch verCmd & 0x0f {
+	case 0: // LOCAL, e.g. health checks of the proxy itself
+		return nil, nil
+	case 1: // PROXY
+	default:
+		return nil, fmt.Errorf("unsupported PROXY protocol command %d", verCmd&0x0f)
+	}
+
+	var ipLen int
+	switch family >> 4 {
+	case 1: // AF_INET
+		ipLen = net.IPv4len
+	case 2: // AF_INET6
+		ipLen = net.IPv6len
+	default: // AF_UNSPEC and AF_UNIX carry no client IP
+		return nil, nil
+	}
+	if len(payload) < 2*ipLen+4 {
+		return nil, errors.New("truncated PROXY protocol addresses")
+	}
+	ip := net.IP(bytes.Clone(payload[:ipLen]))
+	port := binary.BigEndian.Uint16(payload[2*ipLen:])
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadProxyHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  []byte
+		want    string
+		wantErr bool
+	}{
+		{"v1 TCP4", []byte("PROXY TCP4 203.0.113.7 192.0.2.1 56324 443\r\n"), "203.0.113.7:56324", false},
+		{"v1 TCP6", []byte("PROXY TCP6 2001:db8::7 2001:db8::1 56324 443\r\n"), "[2001:db8::7]:56324", false},
+		{"v1 UNKNOWN", []byte("PROXY UNKNOWN\r\n"), "", false},
+		{"v1 family mismatch", []byte("PROXY TCP4 2001:db8::7 2001:db8::1 56324 443\r\n"), "", true},
+		{"v1 missing CRLF", []byte("PROXY TCP4 203.0.113.7 192.0.2.1 56324 443\n"), "", true},
+		{"v1 too long", []byte("PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n"), "", true},
+		{"v2 IPv4", proxyV2(0x21, 0x11, net.ParseIP("203.0.113.7").To4(), 56324), "203.0.113.7:56324", false},
+		{"v2 IPv6", proxyV2(0x21, 0x21, net.ParseIP("2001:db8::7"), 56324), "[2001:db8::7]:56324", false},
+		{"v2 LOCAL", proxyV2(0x20, 0x00, nil, 0), "", false},
+		{"v2 truncated", proxyV2(0x21, 0x21, net.ParseIP("203.0.113.7").To4(), 56324), "", true},
+		{"v2 bad version", proxyV2(0x11, 0x11, net.ParseIP("203.0.113.7").To4(), 56324), "", true},
+		{"no header", []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(io.MultiReader(bytes.NewReader(tt.header), strings.NewReader("GET /")))
+			addr, err := readProxyHeader(r)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tt.want == "" {
+				assert.Nil(t, addr)
+			} else {
+				require.NotNil(t, addr)
+				assert.Equal(t, tt.want, addr.String())
+			}
+			rest, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, "GET /", string(rest), "header consumed exactly")
+		})
+	}
+}
+
+func TestServe_ProxyProtocol(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	var logs syncBuffer
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Serve(ctx, Config{
+			Logger:      slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+			LogRequests: true,
+		}, Listener{Addr: addr, ProxyProtocol: true})
+	}()
+
+	var conn net.Conn
+	require.Eventually(t, func() bool {
+		conn, err = net.Dial("tcp", addr)
+		return err == nil
+	}, 2*time.Second, 20*time.Millisecond)
+	_, err = io.WriteString(conn, "PROXY TCP4 203.0.113.7 192.0.2.1 56324 443\r\n"+
+		"GET /api/v1/ping HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	resp, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+	assert.True(t, strings.HasPrefix(string(resp), "HTTP/1.1 200 "), string(resp))
+	assert.Contains(t, logs.String(), `"remote_ip":"203.0.113.7"`)
+
+	conn, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	_, err = io.WriteString(conn, "GET /api/v1/ping HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	require.NoError(t, err)
+	resp, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+	assert.Empty(t, resp, "connections without header are dropped")
+
+	cancel()
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("server did not shut down in time")
+	}
+}
+
+func TestServe_ProxyProtocolReadHeaderTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Serve(ctx, Config{Timeouts: Timeouts{ReadHeader: 200 * time.Millisecond}},
+			Listener{Addr: addr, ProxyProtocol: true})
+	}()
+
+	var conn net.Conn
+	require.Eventually(t, func() bool {
+		conn, err = net.Dial("tcp", addr)
+		return err == nil
+	}, 2*time.Second, 20*time.Millisecond)
+	defer func() { _ = conn.Close() }()
+	// Send the PROXY header and the start of a request, then stall.
+	_, err = io.WriteString(conn, "PROXY TCP4 203.0.113.7 192.0.2.1 56324 443\r\nGET /api/v1/ping HTTP/1.1\r\n")
+	require.NoError(t, err)
+	start := time.Now()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(3*time.Second)))
+	_, err = io.ReadAll(conn)
+	require.NoError(t, err, "the server closes the stalled connection")
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	cancel()
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("server did not shut down in time")
+	}
+}
+
+func TestProxyConnKeepsReadDeadline(t *testing.T) {
+	server, client := net.Pipe()
+	defer func() { _ = client.Close() }()
+	conn := &proxyConn{Conn: server}
+	defer func() { _ = conn.Close() }()
+
+	go func() { _, _ = io.WriteString(client, "PROXY TCP4 203.0.113.7 192.0.2.1 56324 443\r\n") }()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	assert.Equal(t, "203.0.113.7:56324", conn.RemoteAddr().String())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		var netErr net.Error
+		require.ErrorAs(t, err, &netErr)
+		assert.True(t, netErr.Timeout())
+	case <-time.After(2 * time.Second):
+		t.Fatal("reading the PROXY header lifted the read deadline")
+	}
+}
+
+// proxyV2 builds a version 2 header for a connection from ip:port. The
+// address length follows ip, regardless of family.
+func proxyV2(verCmd, family byte, ip net.IP, port uint16) []byte {
+	header := append(bytes.Clone(proxyV2Signature), verCmd, family, 0, 0)
+	var payload []byte
+	if ip != nil {
+		payload = append(payload, ip...)
+		payload = append(payload, make([]byte, len(ip))...)
+		payload = binary.BigEndian.AppendUint16(payload, port)
+		payload = binary.BigEndian.AppendUint16(payload, 443)
+	}
+	binary.BigEndian.PutUint16(header[14:], uint16(len(payload)))
+	return append(header, payload...)
+}
+
+// syncBuffer is a bytes.Buffer safe for the concurrent writes of a logger.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -3,17 +3,27 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"log/slog"
+	"net"
 	"net/http"
+	"slices"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/otel/trace"
 
+	apidoc "github.com/thorstenkramm/dendrite-pulse/api-doc"
 	"github.com/thorstenkramm/dendrite-pulse/internal/api"
+	"github.com/thorstenkramm/dendrite-pulse/internal/auth"
 	"github.com/thorstenkramm/dendrite-pulse/internal/files"
 	"github.com/thorstenkramm/dendrite-pulse/internal/logging"
 	"github.com/thorstenkramm/dendrite-pulse/internal/ping"
@@ -23,48 +33,205 @@ import (
 type Config struct {
 	Logger      *slog.Logger
 	LogRequests bool
+	// LogErrors logs every 4xx response at warn and every 5xx at error
+	// level, including the underlying error, to Logger.
+	LogErrors   bool
 	FileService *files.Service
+	FileOptions files.HandlerOptions
+	// RobotsTxt and SecurityTxt are served at /robots.txt and
+	// /.well-known/security.txt when set.
+	RobotsTxt   []byte
+	SecurityTxt []byte
+	// CORS lets browser applications on the allowed origins call the API.
+	// Disabled when CORS.AllowOrigins is empty.
+	CORS middleware.CORSConfig
+	// APIKeys and OIDC authenticate clients on all /api/v1 routes except
+	// ping. Authentication is disabled when neither is set.
+	APIKeys auth.APIKeys
+	OIDC    *auth.OIDC
+	// TLS makes Serve serve HTTPS instead of plain HTTP.
+	TLS *tls.Config
+	// TrustedProxies are the networks whose X-Forwarded-For header is
+	// trusted for the client IP. Without any, the client IP is the address
+	// of the connection.
+	TrustedProxies []*net.IPNet
+	// Limits caps concurrent requests and connections.
+	Limits Limits
+	// Timeouts bound how long clients and handlers may take.
+	Timeouts Timeouts
+	// Tracing records an OpenTelemetry span per request with the global
+	// tracer provider, and adds the trace id to request logs.
+	Tracing bool
+	// AccessLog receives one entry per completed request in AccessLogFormat,
+	// AccessLogJSON or AccessLogCombined. Disabled when nil.
+	AccessLog       io.Writer
+	AccessLogFormat string
+	// Ready is called once every listener is bound and serving, Stopping
+	// when the shutdown begins, e.g. to notify systemd. Both are optional.
+	Ready    func()
+	Stopping func()
 }
 
-// Run starts the HTTP server on the given address (e.g., ":3000") and blocks until shutdown.
-func Run(ctx context.Context, addr string, cfg Config) error {
+// defaultReadHeaderTimeout guards against slowloris attacks when
+// Timeouts.ReadHeader is zero.
+const defaultReadHeaderTimeout = 5 * time.Second
+
+// Timeouts of the HTTP servers. Zero disables a timeout, except for
+// ReadHeader which defaults to defaultReadHeaderTimeout.
+type Timeouts struct {
+	// ReadHeader, Read, Write and Idle are those of http.Server.
+	ReadHeader time.Duration
+	Read       time.Duration
+	Write      time.Duration
+	Idle       time.Duration
+	// Handler cancels the context of requests running longer; handlers
+	// stopped by it are answered with 503 Service Unavailable.
+	Handler time.Duration
+}
+
+// Listener is an address Serve listens on, e.g. "127.0.0.1:3000" or
+// "unix:/run/dendrite.sock".
+type Listener struct {
+	Addr string
+	// SocketMode sets the permissions of a Unix domain socket. Defaults to
+	// DefaultSocketMode when zero.
+	SocketMode fs.FileMode
+	// ProxyProtocol expects the HAProxy PROXY protocol header on every
+	// connection, so the client address of L4 load balancers is preserved.
+	ProxyProtocol bool
+}
+
+// Serve starts one HTTP server per listener, all sharing the same router,
+// and blocks until ctx is canceled or one of them fails. Either way all
+// servers are shut down together.
+func Serve(ctx context.Context, cfg Config, listeners ...Listener) error {
 	// contextcheck: base context is propagated through Echo requests; server lifecycle is controlled via ctx.
 	//nolint:contextcheck
 	e := buildRouter(cfg)
+	netListeners, err := openListeners(cfg, listeners)
+	if err != nil {
+		return err
+	}
 
-	srv := &http.Server{
-		Addr:    addr,
-		Handler: e,
-		// Guard against slowloris attacks.
-		ReadHeaderTimeout: 5 * time.Second,
-	}
-
-	go func() {
-		<-ctx.Done()
-		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
-		defer cancel()
-		if err := srv.Shutdown(shutdownCtx); err != nil {
-			if cfg.Logger != nil {
-				cfg.Logger.Error("server shutdown error", "error", err)
-			} else {
-				log.Printf("server shutdown error: %v", err)
-			}
+	readHeaderTimeout := cfg.Timeouts.ReadHeader
+	if readHeaderTimeout == 0 {
+		readHeaderTimeout = defaultReadHeaderTimeout
+	}
+	servers := make([]*http.Server, len(netListeners))
+	errCh := make(chan error, len(netListeners))
+	for i, l := range netListeners {
+		servers[i] = &http.Server{
+			Handler:           e,
+			TLSConfig:         cfg.TLS,
+			ReadHeaderTimeout: readHeaderTimeout,
+			ReadTimeout:       cfg.Timeouts.Read,
+			WriteTimeout:      cfg.Timeouts.Write,
+			IdleTimeout:       cfg.Timeouts.Idle,
 		}
-	}()
+		go func() { errCh <- servers[i].Serve(l) }()
+	}
+	if cfg.Ready != nil {
+		cfg.Ready()
+	}
 
-	if err := e.StartServer(srv); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		return fmt.Errorf("start server: %w", err)
+	var errs []error
+	pending := len(servers)
+	select {
+	case <-ctx.Done():
+	case err := <-errCh:
+		errs = append(errs, err)
+		pending--
+	}
+	if cfg.Stopping != nil {
+		cfg.Stopping()
+	}
+	shutdown(ctx, cfg.Logger, servers)
+	for ; pending > 0; pending-- {
+		errs = append(errs, <-errCh)
 	}
 
+	errs = slices.DeleteFunc(errs, func(err error) bool { return errors.Is(err, http.ErrServerClosed) })
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("start server: %w", err)
+	}
 	return nil
 }
 
+// openListeners opens all listeners, or none when one of them fails.
+func openListeners(cfg Config, listeners []Listener) ([]net.Listener, error) {
+	var connLimit *connLimiter
+	if cfg.Limits.MaxConnections > 0 {
+		connLimit = newConnLimiter(cfg.Limits.MaxConnections)
+	}
+	netListeners := make([]net.Listener, 0, len(listeners))
+	for _, lc := range listeners {
+		l, err := listen(lc.Addr, lc.SocketMode)
+		if err != nil {
+			for _, opened := range netListeners {
+				_ = opened.Close()
+			}
+			return nil, err
+		}
+		if connLimit != nil {
+			l = connLimit.wrap(l)
+		}
+		if lc.ProxyProtocol {
+			l = proxyListener{Listener: l}
+		}
+		if cfg.TLS != nil {
+			l = tls.NewListener(l, cfg.TLS)
+		}
+		netListeners = append(netListeners, l)
+	}
+	return netListeners, nil
+}
+
+// shutdown gracefully stops all servers at once, giving open requests five
+// seconds to finish.
+func shutdown(ctx context.Context, logger *slog.Logger, servers []*http.Server) {
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, srv := range servers {
+		wg.Go(func() {
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				if logger != nil {
+					logger.Error("server shutdown error", "error", err)
+				} else {
+					log.Printf("server shutdown error: %v", err)
+				}
+			}
+		})
+	}
+	wg.Wait()
+}
+
 func buildRouter(cfg Config) *echo.Echo {
 	e := echo.New()
 	e.HideBanner = true
 	e.HidePort = true
 
 	e.Use(middleware.Recover())
+	if cfg.Tracing {
+		e.Use(traceRequests())
+	}
+	// Registered before the limits and authentication, so rejected requests
+	// are logged too.
+	if cfg.AccessLog != nil {
+		e.Use(accessLog(cfg.AccessLog, cfg.AccessLogFormat))
+	}
+	if len(cfg.CORS.AllowOrigins) > 0 {
+		e.Use(middleware.CORSWithConfig(cfg.CORS))
+	}
+	if cfg.Limits.MaxConcurrentRequests > 0 {
+		e.Use(concurrencyLimit(cfg.Limits.MaxConcurrentRequests, cfg.Limits.RetryAfter))
+	}
+	if cfg.Limits.MaxBodySize > 0 {
+		e.Use(middleware.BodyLimit(strconv.FormatInt(cfg.Limits.MaxBodySize, 10)))
+	}
+	if len(cfg.APIKeys) > 0 || cfg.OIDC != nil {
+		e.Use(authenticate(cfg.APIKeys, cfg.OIDC))
+	}
 
 	if cfg.LogRequests && cfg.Logger != nil {
 		e.Use(middleware.RequestID())
@@ -72,17 +239,65 @@ func buildRouter(cfg Config) *echo.Echo {
 	} else {
 		e.Use(middleware.Logger())
 	}
+	if cfg.LogErrors && cfg.Logger != nil {
+		e.Use(slogErrorLogger(cfg.Logger))
+	}
+
+	// Registered after the loggers, which render errors themselves, so the
+	// timeout is reported as 503 rather than as a failed handler.
+	if cfg.Timeouts.Handler > 0 {
+		e.Use(middleware.ContextTimeout(cfg.Timeouts.Handler))
+	}
 
 	e.HTTPErrorHandler = jsonAPIErrorHandler
+	e.IPExtractor = ipExtractor(cfg.TrustedProxies)
 
 	ping.RegisterRoutes(e)
+	if cfg.OIDC != nil && cfg.OIDC.BrowserFlow() {
+		e.GET("/api/v1/auth/login", cfg.OIDC.Login)
+		e.GET("/api/v1/auth/callback", cfg.OIDC.Callback)
+	}
+	registerOpenAPI(e)
+	registerTextFile(e, "/robots.txt", cfg.RobotsTxt)
+	registerTextFile(e, "/.well-known/security.txt", cfg.SecurityTxt)
 	if cfg.FileService != nil {
-		files.RegisterRoutes(e, cfg.FileService)
+		files.RegisterRoutes(e, cfg.FileService, cfg.FileOptions)
 	}
 
 	return e
 }
 
+// registerTextFile serves content as plain text at path unless it is empty.
+func registerTextFile(e *echo.Echo, path string, content []byte) {
+	if len(content) == 0 {
+		return
+	}
+	e.GET(path, func(c echo.Context) error {
+		if err := c.Blob(http.StatusOK, echo.MIMETextPlainCharsetUTF8, content); err != nil {
+			return fmt.Errorf("write %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// registerOpenAPI serves the OpenAPI reference bundled into one JSON
+// document at /api/v1/openapi.json. It is bundled on the first request.
+func registerOpenAPI(e *echo.Echo) {
+	spec := sync.OnceValues(func() ([]byte, error) {
+		return api.BundleOpenAPI(apidoc.Files, apidoc.Entry)
+	})
+	e.GET("/api/v1/openapi.json", func(c echo.Context) error {
+		body, err := spec()
+		if err != nil {
+			return fmt.Errorf("bundle openapi: %w", err)
+		}
+		if err := c.Blob(http.StatusOK, echo.MIMEApplicationJSON, body); err != nil {
+			return fmt.Errorf("write openapi: %w", err)
+		}
+		return nil
+	})
+}
+
 func jsonAPIErrorHandler(err error, c echo.Context) {
 	code := http.StatusInternalServerError
 	detail := "An unexpected error occurred."
@@ -113,6 +328,23 @@ func jsonAPIErrorHandler(err error, c echo.Context) {
 	}
 }
 
+// ipExtractor returns the client IP from X-Forwarded-For, skipping the
+// trusted proxies, or the address of the connection without any.
+func ipExtractor(trusted []*net.IPNet) echo.IPExtractor {
+	if len(trusted) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, ipNet := range trusted {
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
 // slogRequestLogger logs incoming requests with slog and stores a request-scoped logger.
 func slogRequestLogger(logger *slog.Logger) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
@@ -126,6 +358,9 @@ func slogRequestLogger(logger *slog.Logger) echo.MiddlewareFunc {
 			if rid != "" {
 				reqLogger = logger.With(slog.String("request_id", rid))
 			}
+			if sc := trace.SpanContextFromContext(c.Request().Context()); sc.IsValid() {
+				reqLogger = reqLogger.With(slog.String("trace_id", sc.TraceID().String()))
+			}
 
 			ctxWithLogger := logging.ContextWithLogger(c.Request().Context(), reqLogger)
 			c.SetRequest(c.Request().WithContext(ctxWithLogger))
@@ -144,3 +379,52 @@ func slogRequestLogger(logger *slog.Logger) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// slogErrorLogger logs responses with a 4xx status at warn and 5xx at error
+// level. It runs the error handler itself so the final status is known, and
+// records the underlying cause that the client only sees as a generic detail.
+func slogErrorLogger(logger *slog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			if status < http.StatusBadRequest {
+				return nil
+			}
+			level := slog.LevelWarn
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+
+			attrs := []slog.Attr{
+				slog.String("route", c.Path()),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("method", c.Request().Method),
+				slog.Int("status", status),
+				slog.String("request_id", c.Response().Header().Get(echo.HeaderXRequestID)),
+			}
+			if err != nil {
+				attrs = append(attrs, slog.String("error", errorDetail(err)))
+			}
+			logger.LogAttrs(c.Request().Context(), level, "request failed", attrs...)
+			return nil
+		}
+	}
+}
+
+// errorDetail describes err for logs, including the internal cause of HTTP errors.
+func errorDetail(err error) string {
+	var httpErr *echo.HTTPError
+	if !errors.As(err, &httpErr) {
+		return err.Error()
+	}
+	detail := fmt.Sprint(httpErr.Message)
+	if httpErr.Internal != nil {
+		detail += ": " + httpErr.Internal.Error()
+	}
+	return detail
+}
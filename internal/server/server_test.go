@@ -3,20 +3,44 @@ package server
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"log/slog"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
 
 	"github.com/thorstenkramm/dendrite-pulse/internal/api"
+	"github.com/thorstenkramm/dendrite-pulse/internal/auth"
+	"github.com/thorstenkramm/dendrite-pulse/internal/files"
 	"github.com/thorstenkramm/dendrite-pulse/internal/logging"
 	"github.com/thorstenkramm/dendrite-pulse/internal/ping"
+	"github.com/thorstenkramm/dendrite-pulse/internal/watch"
 )
 
 func TestPingHandler(t *testing.T) {
@@ -40,6 +64,36 @@ func TestPingHandler(t *testing.T) {
 	assert.Equal(t, "/api/v1/ping", resp.Links.Self)
 }
 
+func TestWellKnownTextFiles(t *testing.T) {
+	e := buildRouter(Config{
+		RobotsTxt:   []byte("User-agent: *\nDisallow: /\n"),
+		SecurityTxt: []byte("Contact: mailto:security@example.com\n"),
+	})
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/robots.txt", want: "User-agent: *\nDisallow: /\n"},
+		{path: "/.well-known/security.txt", want: "Contact: mailto:security@example.com\n"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code, tt.path)
+		assert.Equal(t, "text/plain; charset=UTF-8", rec.Header().Get("Content-Type"))
+		assert.Equal(t, tt.want, rec.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/robots.txt", nil)
+	rec := httptest.NewRecorder()
+	buildRouter(Config{}).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code, "disabled by default")
+}
+
 func TestNotFoundHandler(t *testing.T) {
 	e := buildRouter(Config{})
 
@@ -79,12 +133,12 @@ func TestMethodNotAllowed(t *testing.T) {
 	assert.Equal(t, http.StatusText(http.StatusMethodNotAllowed), resp.Errors[0].Title)
 }
 
-func TestRun_GracefulShutdown(t *testing.T) {
+func TestServe_GracefulShutdown(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	errCh := make(chan error, 1)
 	go func() {
-		errCh <- Run(ctx, ":0", Config{})
+		errCh <- Serve(ctx, Config{}, Listener{Addr: ":0"})
 	}()
 
 	// Give the server time to start
@@ -101,6 +155,270 @@ func TestRun_GracefulShutdown(t *testing.T) {
 	}
 }
 
+func TestServe_TLS(t *testing.T) {
+	der, key := selfSignedCert(t, 1)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Serve(ctx, Config{TLS: &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+			MinVersion:   tls.VersionTLS12,
+		}}, Listener{Addr: addr})
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	var resp *http.Response
+	require.Eventually(t, func() bool {
+		resp, err = client.Get("https://" + addr + "/api/v1/ping")
+		return err == nil
+	}, 2*time.Second, 20*time.Millisecond)
+	defer func() { _ = resp.Body.Close() }()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotNil(t, resp.TLS)
+
+	cancel()
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("server did not shut down in time")
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	e := buildRouter(Config{Timeouts: Timeouts{Handler: 20 * time.Millisecond}})
+	e.GET("/slow", func(c echo.Context) error {
+		<-c.Request().Context().Done()
+		return c.Request().Context().Err()
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/ping", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestServe_UnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "dendrite.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Serve(ctx, Config{}, Listener{Addr: "unix:" + socket, SocketMode: 0o600})
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}
+	var resp *http.Response
+	var err error
+	require.Eventually(t, func() bool {
+		resp, err = client.Get("http://dendrite/api/v1/ping")
+		return err == nil
+	}, 2*time.Second, 20*time.Millisecond)
+	defer func() { _ = resp.Body.Close() }()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	info, err := os.Stat(socket)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	cancel()
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("server did not shut down in time")
+	}
+}
+
+func TestServe_MultipleListeners(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "dendrite.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Serve(ctx, Config{}, Listener{Addr: "127.0.0.1:0"}, Listener{Addr: "unix:" + socket})
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}
+	require.Eventually(t, func() bool {
+		resp, err := client.Get("http://dendrite/api/v1/ping")
+		if err != nil {
+			return false
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 2*time.Second, 20*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("servers did not shut down in time")
+	}
+	_, err := os.Stat(socket)
+	assert.ErrorIs(t, err, os.ErrNotExist, "socket removed on shutdown")
+}
+
+func TestServe_ReadyAndStopping(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "dendrite.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ready := make(chan struct{})
+	stopping := make(chan struct{})
+	cfg := Config{
+		Ready: func() {
+			_, err := os.Stat(socket)
+			assert.NoError(t, err, "listeners are bound when ready")
+			close(ready)
+		},
+		Stopping: func() { close(stopping) },
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Serve(ctx, cfg, Listener{Addr: "unix:" + socket})
+	}()
+
+	select {
+	case <-ready:
+	case <-time.After(2 * time.Second):
+		t.Fatal("server not ready in time")
+	}
+	select {
+	case <-stopping:
+		t.Fatal("stopping before shutdown")
+	default:
+	}
+
+	cancel()
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("server did not shut down in time")
+	}
+	select {
+	case <-stopping:
+	default:
+		t.Fatal("stopping not called on shutdown")
+	}
+}
+
+func TestServe_ListenFailureClosesOthers(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = busy.Close() }()
+	socket := filepath.Join(t.TempDir(), "dendrite.sock")
+
+	err = Serve(context.Background(), Config{},
+		Listener{Addr: "unix:" + socket}, Listener{Addr: busy.Addr().String()})
+	require.Error(t, err)
+	_, err = os.Stat(socket)
+	assert.ErrorIs(t, err, os.ErrNotExist, "opened listeners are closed again")
+}
+
+func TestListen_StaleSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "dendrite.sock")
+	l, err := listen("unix:"+socket, 0)
+	require.NoError(t, err)
+	_, err = listen("unix:"+socket, 0)
+	require.ErrorContains(t, err, "in use")
+
+	// Leave the socket file behind, as a crashed server would.
+	unixListener, ok := l.(*net.UnixListener)
+	require.True(t, ok)
+	unixListener.SetUnlinkOnClose(false)
+	require.NoError(t, l.Close())
+	l, err = listen("unix:"+socket, 0)
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	require.NoError(t, os.WriteFile(socket, nil, 0o600))
+	_, err = listen("unix:"+socket, 0)
+	require.ErrorContains(t, err, "not a socket")
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCert := func(serial int64) {
+		der, key := selfSignedCert(t, serial)
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+		require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	}
+	serial := func(r *CertReloader) int64 {
+		cert, err := r.GetCertificate(nil)
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		return leaf.SerialNumber.Int64()
+	}
+
+	writeCert(1)
+	reloader, err := NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), serial(reloader))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- reloader.Watch(ctx) }()
+	time.Sleep(50 * time.Millisecond)
+
+	writeCert(2)
+	assert.Eventually(t, func() bool { return serial(reloader) == 2 }, 3*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(certFile, []byte("broken"), 0o600))
+	time.Sleep(2 * certReloadDelay)
+	assert.Equal(t, int64(2), serial(reloader), "failed reload keeps the previous certificate")
+
+	cancel()
+	require.NoError(t, <-done)
+	_, err = NewCertReloader(certFile, keyFile)
+	require.Error(t, err)
+}
+
+// selfSignedCert returns a certificate for 127.0.0.1 with serial and its key.
+func selfSignedCert(t *testing.T, serial int64) ([]byte, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return der, key
+}
+
 func TestSlogRequestLogger(t *testing.T) {
 	var buf bytes.Buffer
 	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
@@ -126,6 +444,65 @@ func TestSlogRequestLogger(t *testing.T) {
 	assert.Contains(t, logOutput, "user_agent=test-agent")
 }
 
+func TestTrustedProxies(t *testing.T) {
+	_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		trusted []*net.IPNet
+		remote  string
+		xff     string
+		want    string
+	}{
+		{"no trusted proxies ignores header", nil, "10.0.0.5:1234", "203.0.113.7", "10.0.0.5"},
+		{"trusted proxy", []*net.IPNet{proxies}, "10.0.0.5:1234", "203.0.113.7", "203.0.113.7"},
+		{"trusted hops are skipped", []*net.IPNet{proxies}, "10.0.0.5:1234", "203.0.113.7, 10.1.1.1", "203.0.113.7"},
+		{"spoofed hop stops the walk", []*net.IPNet{proxies}, "10.0.0.5:1234", "198.51.100.1, 203.0.113.7",
+			"203.0.113.7"},
+		{"untrusted peer", []*net.IPNet{proxies}, "192.0.2.1:1234", "203.0.113.7", "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := buildRouter(Config{TrustedProxies: tt.trusted})
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/ping", nil)
+			req.RemoteAddr = tt.remote
+			req.Header.Set(echo.HeaderXForwardedFor, tt.xff)
+			assert.Equal(t, tt.want, e.NewContext(req, httptest.NewRecorder()).RealIP())
+		})
+	}
+}
+
+func TestTraceRequests(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	e := buildRouter(Config{Tracing: true, Logger: logger, LogRequests: true})
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/ping", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "GET /api/v1/ping", span.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	assert.Contains(t, span.Attributes(), semconv.HTTPResponseStatusCode(http.StatusOK))
+	assert.Contains(t, buf.String(), "trace_id=4bf92f3577b34da6a3ce929d0e0e4736")
+}
+
 func TestSlogRequestLogger_WithRequestID(t *testing.T) {
 	var buf bytes.Buffer
 	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
@@ -173,3 +550,167 @@ func TestSlogRequestLogger_ContextLogger(t *testing.T) {
 	require.Equal(t, http.StatusOK, rec.Code)
 	assert.NotNil(t, ctxLogger, "logger should be available in request context")
 }
+
+func TestSlogErrorLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	e := buildRouter(Config{Logger: logger, LogRequests: true, LogErrors: true})
+	e.GET("/fail", func(_ echo.Context) error {
+		return errors.New("disk on fire")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/does-not-exist", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	logOutput := buf.String()
+	assert.Contains(t, logOutput, "level=WARN")
+	assert.Contains(t, logOutput, "path=/does-not-exist")
+	assert.Contains(t, logOutput, "status=404")
+	assert.Contains(t, logOutput, "request_id=")
+
+	buf.Reset()
+	req = httptest.NewRequest(http.MethodGet, "/fail", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "disk on fire")
+	logOutput = buf.String()
+	assert.Contains(t, logOutput, "level=ERROR")
+	assert.Contains(t, logOutput, "route=/fail")
+	assert.Contains(t, logOutput, `error="disk on fire"`)
+
+	// Errors are logged without request logging, too.
+	buf.Reset()
+	e = buildRouter(Config{Logger: logger, LogErrors: true})
+	e.GET("/fail", func(_ echo.Context) error {
+		return errors.New("disk on fire")
+	})
+	req = httptest.NewRequest(http.MethodGet, "/fail", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, buf.String(), `error="disk on fire"`)
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	svc, err := files.NewService([]files.Root{{Virtual: "/public", Source: t.TempDir()}}, files.Options{})
+	require.NoError(t, err)
+	e := buildRouter(Config{FileService: svc, FileOptions: files.HandlerOptions{Events: watch.New(nil, nil)}})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, echo.MIMEApplicationJSON, rec.Header().Get("Content-Type"))
+
+	var doc struct {
+		OpenAPI    string                               `json:"openapi"`
+		Paths      map[string]map[string]any            `json:"paths"`
+		Components map[string]map[string]map[string]any `json:"components"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, "3.1.0", doc.OpenAPI)
+	assert.Contains(t, doc.Components["schemas"], "FileResource")
+	assert.NotContains(t, doc.Components["schemas"]["FileResource"], "$ref", "components are inlined")
+
+	for _, ref := range regexp.MustCompile(`"\$ref":"([^"]*)"`).FindAllStringSubmatch(rec.Body.String(), -1) {
+		assert.True(t, strings.HasPrefix(ref[1], "#/components/"), "unbundled reference %s", ref[1])
+	}
+
+	// Every API route is documented, so the reference stays in sync with the router.
+	for _, route := range e.Routes() {
+		if !strings.HasPrefix(route.Path, "/api/") || route.Method == echo.RouteNotFound {
+			continue
+		}
+		documented := strings.NewReplacer(`\:`, ":", "/*", "/{resourcePath}").Replace(route.Path)
+		require.Contains(t, doc.Paths, documented, route.Path)
+		assert.Contains(t, doc.Paths[documented], strings.ToLower(route.Method), route.Path)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	e := buildRouter(Config{CORS: middleware.CORSConfig{
+		AllowOrigins: []string{"https://app.example.com"},
+		AllowMethods: []string{http.MethodGet, http.MethodPatch},
+		MaxAge:       600,
+	}})
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/v1/ping", nil)
+	req.Header.Set(echo.HeaderOrigin, "https://app.example.com")
+	req.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodPatch)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "https://app.example.com", rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+	assert.Equal(t, "GET,PATCH", rec.Header().Get(echo.HeaderAccessControlAllowMethods))
+	assert.Equal(t, "600", rec.Header().Get(echo.HeaderAccessControlMaxAge))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/ping", nil)
+	req.Header.Set(echo.HeaderOrigin, "https://other.example.com")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get(echo.HeaderAccessControlAllowOrigin), "origin not allowed")
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/ping", nil)
+	req.Header.Set(echo.HeaderOrigin, "https://app.example.com")
+	rec = httptest.NewRecorder()
+	buildRouter(Config{}).ServeHTTP(rec, req)
+	assert.Empty(t, rec.Header().Get(echo.HeaderAccessControlAllowOrigin), "disabled by default")
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	const key = "0123456789abcdef0123456789abcdef"
+	const hashedKey = "fedcba9876543210fedcba9876543210"
+	digest := sha256.Sum256([]byte(hashedKey))
+	keys, err := auth.ParseAPIKeys([]string{key, "sha256:" + hex.EncodeToString(digest[:])})
+	require.NoError(t, err)
+	svc, err := files.NewService([]files.Root{{Virtual: "/public", Source: t.TempDir()}}, files.Options{})
+	require.NoError(t, err)
+	e := buildRouter(Config{
+		FileService: svc,
+		FileOptions: files.HandlerOptions{SigningSecret: strings.Repeat("s", 32)},
+		APIKeys:     keys,
+	})
+
+	tests := []struct {
+		name   string
+		target string
+		header string
+		value  string
+		want   int
+	}{
+		{"ping is public", "/api/v1/ping", "", "", http.StatusOK},
+		{"missing key", "/api/v1/files", "", "", http.StatusUnauthorized},
+		{"wrong key", "/api/v1/files", HeaderAPIKey, "wrong", http.StatusUnauthorized},
+		{"bearer token", "/api/v1/files", echo.HeaderAuthorization, "Bearer " + key, http.StatusOK},
+		{"api key header", "/api/v1/files", HeaderAPIKey, key, http.StatusOK},
+		{"hashed key", "/api/v1/openapi.json", HeaderAPIKey, hashedKey, http.StatusOK},
+		{"signed url checked by handler", "/api/v1/files/public?expires=1&signature=x", "", "", http.StatusForbidden},
+		{"signed root listing", "/api/v1/files?expires=1&signature=x", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.want, rec.Code, rec.Body.String())
+			if tt.want == http.StatusUnauthorized {
+				assert.Equal(t, "Bearer", rec.Header().Get(echo.HeaderWWWAuthenticate))
+				assert.Equal(t, api.ContentType, rec.Header().Get(echo.HeaderContentType))
+				assert.Contains(t, rec.Body.String(), `"status":"401"`)
+			}
+		})
+	}
+}
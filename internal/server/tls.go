@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/logging"
+)
+
+// certReloadDelay lets a certificate renewal finish writing both files
+// before they are loaded.
+const certReloadDelay = 500 * time.Millisecond
+
+// CertReloader serves a TLS certificate that is reloaded when its files
+// change, so renewals take effect without a restart.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewCertReloader loads the certificate from certFile and keyFile.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, for tls.Config.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *CertReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load tls certificate: %w", err)
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the certificate whenever the folders holding its files
+// change, until ctx is canceled. Folders are watched rather than the files,
+// so certificates replaced by renaming or by swapping symlinks, as certbot
+// does, are picked up too. A failed reload keeps the previous certificate.
+func (r *CertReloader) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("watch tls certificate: %w", err)
+	}
+	defer func() { _ = watcher.Close() }()
+	for _, dir := range []string{filepath.Dir(r.certFile), filepath.Dir(r.keyFile)} {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("watch tls certificate folder %s: %w", dir, err)
+		}
+	}
+
+	logger := logging.FromContext(ctx)
+	timer := time.NewTimer(certReloadDelay)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-watcher.Events:
+			timer.Reset(certReloadDelay)
+		case err := <-watcher.Errors:
+			if logger != nil {
+				logger.Warn("tls certificate watch error", "error", err)
+			}
+		case <-timer.C:
+			err := r.reload()
+			switch {
+			case logger == nil:
+			case err != nil:
+				logger.Error("tls certificate reload failed, keeping the previous one", "error", err)
+			default:
+				logger.Info("tls certificate reloaded", "cert_file", r.certFile)
+			}
+		}
+	}
+}
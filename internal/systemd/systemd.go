@@ -0,0 +1,79 @@
+// Package systemd implements the sd_notify protocol, so systemd services of
+// Type=notify learn when the server is ready or stopping and can restart it
+// when it stops answering the watchdog.
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Service states sent with Notify.
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Notify sends state to the service manager. It reports false without an
+// error when the process was not started by systemd with a notify socket.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// A leading @ marks a socket in the abstract namespace.
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("connect to notify socket: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("notify systemd: %w", err)
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the interval within which systemd expects
+// watchdog notifications from this process, or zero when the watchdog is
+// disabled.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// RunWatchdog notifies the watchdog at half its interval until ctx is
+// canceled, calling onError for failed notifications. It returns at once
+// when the watchdog is disabled.
+func RunWatchdog(ctx context.Context, onError func(error)) {
+	interval := WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	t := time.NewTicker(interval / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if _, err := Notify(Watchdog); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Package tracing exports OpenTelemetry traces over OTLP/HTTP.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// Config selects where and how many traces are exported.
+type Config struct {
+	// Endpoint is the URL of the OTLP/HTTP traces endpoint, e.g.
+	// http://localhost:4318/v1/traces.
+	Endpoint string
+	// Headers are sent with every export, e.g. for authentication.
+	Headers     map[string]string
+	ServiceName string
+	// SampleRatio is the fraction of new traces recorded, from 0 to 1.
+	// Requests continuing a trace follow the sampling decision of the caller.
+	SampleRatio float64
+}
+
+// Setup installs a global tracer provider exporting to cfg.Endpoint and the
+// W3C trace context propagator. The returned function flushes pending spans
+// and stops the exporter.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx,
+		otlptracehttp.WithEndpointURL(cfg.Endpoint),
+		otlptracehttp.WithHeaders(cfg.Headers),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create trace exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("describe trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+	return func(ctx context.Context) error {
+		if err := provider.Shutdown(ctx); err != nil {
+			return fmt.Errorf("shut down tracing: %w", err)
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,318 @@
+// Package watch reports created, modified and deleted entries below file
+// roots, for webhooks and event streams alike.
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Event types.
+const (
+	Created  = "created"
+	Modified = "modified"
+	Deleted  = "deleted"
+)
+
+// defaultDelay coalesces the changes of a path within this period, so a file
+// written in many chunks is reported once.
+const defaultDelay = time.Second
+
+// Event is a change below a watched root.
+type Event struct {
+	Type string `json:"type"`
+	// Root is the virtual folder of the root and Path the virtual path of
+	// the changed entry.
+	Root string    `json:"root"`
+	Path string    `json:"path"`
+	Time time.Time `json:"time"`
+	// Metadata describes the entry after the change; nil for deleted ones.
+	Metadata *Metadata `json:"metadata,omitempty"`
+}
+
+// Metadata describes a created or modified entry.
+type Metadata struct {
+	// Kind is file, folder, symlink or other.
+	Kind           string    `json:"kind"`
+	SizeBytes      int64     `json:"size_bytes"`
+	PermissionMode string    `json:"permission_mode"`
+	ModifiedAt     time.Time `json:"modified_at"`
+}
+
+// Root is a watched file root.
+type Root struct {
+	Virtual string
+	Source  string
+}
+
+// Watcher turns filesystem notifications below the root sources into
+// Events for its subscribers, coalescing the changes of each path.
+type Watcher struct {
+	roots  []Root
+	delay  time.Duration
+	logger *slog.Logger
+
+	mu     sync.RWMutex
+	subs   map[int]func(Event)
+	nextID int
+
+	// fsw and pending are owned by Run.
+	fsw     *fsnotify.Watcher
+	pending map[string]*change
+}
+
+// change is a pending change of the entry at an absolute path.
+type change struct {
+	eventType string
+	root      Root
+	rel       string
+	seen      time.Time
+}
+
+// New returns a Watcher for roots. Watch problems are logged to logger,
+// which may be nil.
+func New(roots []Root, logger *slog.Logger) *Watcher {
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	return &Watcher{
+		roots:   roots,
+		delay:   defaultDelay,
+		logger:  logger,
+		subs:    make(map[int]func(Event)),
+		pending: make(map[string]*change),
+	}
+}
+
+// Subscribe calls fn with every event until the returned function is
+// called. fn runs on the goroutine of Run and must not block.
+func (w *Watcher) Subscribe(fn func(Event)) (unsubscribe func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	id := w.nextID
+	w.nextID++
+	w.subs[id] = fn
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.subs, id)
+	}
+}
+
+func (w *Watcher) publish(ev Event) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	for _, fn := range w.subs {
+		fn(ev)
+	}
+}
+
+// Run watches every folder below the root sources and publishes changes
+// until ctx is canceled. A change is published once its path saw no further
+// changes for the delay. fsnotify watches single folders, so each one needs
+// its own watch.
+func (w *Watcher) Run(ctx context.Context) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("watch file roots: %w", err)
+	}
+	defer func() { _ = fsw.Close() }()
+	w.fsw = fsw
+	for _, root := range w.roots {
+		if err := w.addTree(root, root.Source, false); err != nil {
+			return err
+		}
+	}
+
+	t := time.NewTicker(w.delay / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			w.handle(ev)
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			w.logger.Warn("file root watch error", "error", err)
+		case now := <-t.C:
+			w.flush(now)
+		}
+	}
+}
+
+// handle records the change an fsnotify event reports. Folders created
+// below a root are watched, and entries already inside reported as created,
+// as folders are often moved into place with their content.
+func (w *Watcher) handle(ev fsnotify.Event) {
+	root, rel, ok := w.locate(ev.Name)
+	if !ok {
+		return
+	}
+	switch {
+	case ev.Has(fsnotify.Create):
+		w.record(ev.Name, root, rel, Created)
+		if info, err := os.Lstat(ev.Name); err == nil && info.IsDir() {
+			if err := w.addTree(root, ev.Name, true); err != nil {
+				w.logger.Warn("watch new folder", "path", ev.Name, "error", err)
+			}
+		}
+	case ev.Has(fsnotify.Write):
+		w.record(ev.Name, root, rel, Modified)
+	case ev.Has(fsnotify.Remove), ev.Has(fsnotify.Rename):
+		w.record(ev.Name, root, rel, Deleted)
+	}
+}
+
+// addTree watches dir and every folder below it, skipping those that cannot
+// be read. With announce, the entries below dir are recorded as created.
+func (w *Watcher) addTree(root Root, dir string, announce bool) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir && !announce {
+				return fmt.Errorf("watch file root %s: %w", root.Virtual, err)
+			}
+			w.logger.Debug("skip unreadable folder", "path", p, "error", err)
+			return nil
+		}
+		if announce && p != dir {
+			if rel, ok := relPath(root, p); ok {
+				w.record(p, root, rel, Created)
+			}
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if err := w.fsw.Add(p); err != nil {
+			if p == dir && !announce {
+				return fmt.Errorf("watch file root %s: %w", root.Virtual, err)
+			}
+			w.logger.Warn("watch folder", "path", p, "error", err)
+		}
+		return nil
+	})
+}
+
+// locate returns the root containing the absolute path p, preferring the
+// most specific one, and the path relative to its source.
+func (w *Watcher) locate(p string) (Root, string, bool) {
+	var (
+		best    Root
+		bestRel string
+		found   bool
+	)
+	for _, root := range w.roots {
+		rel, ok := relPath(root, p)
+		if ok && (!found || len(root.Source) > len(best.Source)) {
+			best, bestRel, found = root, rel, true
+		}
+	}
+	return best, bestRel, found
+}
+
+// relPath returns p relative to the source of root, if p lies below it.
+func relPath(root Root, p string) (string, bool) {
+	rel, err := filepath.Rel(root.Source, p)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// record merges a change of p into the one pending for it.
+func (w *Watcher) record(p string, root Root, rel, eventType string) {
+	if prev, ok := w.pending[p]; ok {
+		eventType = mergeChange(prev.eventType, eventType)
+	}
+	if eventType == "" {
+		delete(w.pending, p)
+		return
+	}
+	w.pending[p] = &change{eventType: eventType, root: root, rel: rel, seen: time.Now()}
+}
+
+// mergeChange combines two successive changes of a path into one. It
+// returns "" when the entry was created and deleted again.
+func mergeChange(prev, next string) string {
+	switch {
+	case prev == Created && next == Deleted:
+		return ""
+	case prev == Created:
+		return Created
+	case prev == Deleted && next != Deleted:
+		// The entry was replaced.
+		return Modified
+	default:
+		return next
+	}
+}
+
+// flush publishes the pending changes that settled for the delay, oldest
+// first.
+func (w *Watcher) flush(now time.Time) {
+	var settled []string
+	for p, c := range w.pending {
+		if now.Sub(c.seen) >= w.delay {
+			settled = append(settled, p)
+		}
+	}
+	slices.SortFunc(settled, func(a, b string) int { return w.pending[a].seen.Compare(w.pending[b].seen) })
+
+	for _, p := range settled {
+		c := w.pending[p]
+		delete(w.pending, p)
+		ev := Event{
+			Type: c.eventType,
+			Root: c.root.Virtual,
+			Path: path.Join(c.root.Virtual, c.rel),
+			Time: c.seen.UTC(),
+		}
+		if ev.Type != Deleted {
+			info, err := os.Lstat(p)
+			switch {
+			case errors.Is(err, fs.ErrNotExist) && ev.Type == Created:
+				continue
+			case err != nil:
+				ev.Type = Deleted
+			default:
+				ev.Metadata = metadataOf(info)
+			}
+		}
+		w.publish(ev)
+	}
+}
+
+func metadataOf(info fs.FileInfo) *Metadata {
+	kind := "other"
+	switch {
+	case info.Mode().IsRegular():
+		kind = "file"
+	case info.IsDir():
+		kind = "folder"
+	case info.Mode()&fs.ModeSymlink != 0:
+		kind = "symlink"
+	}
+	return &Metadata{
+		Kind:           kind,
+		SizeBytes:      info.Size(),
+		PermissionMode: fmt.Sprintf("%04o", info.Mode().Perm()),
+		ModifiedAt:     info.ModTime().UTC(),
+	}
+}
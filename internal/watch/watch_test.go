@@ -0,0 +1,108 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startWatcher runs a watcher of roots and returns the events it publishes.
+func startWatcher(t *testing.T, roots ...Root) <-chan Event {
+	t.Helper()
+	w := New(roots, nil)
+	w.delay = 50 * time.Millisecond
+	events := make(chan Event, 16)
+	unsubscribe := w.Subscribe(func(ev Event) { events <- ev })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-done)
+		unsubscribe()
+	})
+	// Give the watcher time to add its watches.
+	time.Sleep(50 * time.Millisecond)
+	return events
+}
+
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event published")
+		return Event{}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	events := startWatcher(t, Root{Virtual: "/public", Source: dir})
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "reports"), 0o750))
+	ev := nextEvent(t, events)
+	assert.Equal(t, Created, ev.Type)
+	assert.Equal(t, "/public/reports", ev.Path)
+	assert.Equal(t, "folder", ev.Metadata.Kind)
+
+	file := filepath.Join(dir, "reports", "q1.csv")
+	require.NoError(t, os.WriteFile(file, []byte("a,b\n"), 0o640))
+	ev = nextEvent(t, events)
+	assert.Equal(t, Created, ev.Type, "writes right after creation are coalesced")
+	assert.Equal(t, "/public", ev.Root)
+	assert.Equal(t, "/public/reports/q1.csv", ev.Path)
+	require.NotNil(t, ev.Metadata)
+	assert.Equal(t, "file", ev.Metadata.Kind)
+	assert.Equal(t, int64(4), ev.Metadata.SizeBytes)
+	assert.Equal(t, "0640", ev.Metadata.PermissionMode)
+
+	require.NoError(t, os.WriteFile(file, []byte("a,b\nc,d\n"), 0o640))
+	ev = nextEvent(t, events)
+	assert.Equal(t, Modified, ev.Type)
+	assert.Equal(t, int64(8), ev.Metadata.SizeBytes)
+
+	require.NoError(t, os.Remove(file))
+	ev = nextEvent(t, events)
+	assert.Equal(t, Deleted, ev.Type)
+	assert.Equal(t, "/public/reports/q1.csv", ev.Path)
+	assert.Nil(t, ev.Metadata)
+}
+
+func TestWatcherAnnouncesMovedFolders(t *testing.T) {
+	dir, outside := t.TempDir(), t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(outside, "batch", "sub"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "batch", "sub", "a.txt"), []byte("a"), 0o600))
+	events := startWatcher(t, Root{Virtual: "/public", Source: dir})
+
+	require.NoError(t, os.Rename(filepath.Join(outside, "batch"), filepath.Join(dir, "batch")))
+	var paths []string
+	for range 3 {
+		ev := nextEvent(t, events)
+		assert.Equal(t, Created, ev.Type)
+		paths = append(paths, ev.Path)
+	}
+	assert.ElementsMatch(t, []string{"/public/batch", "/public/batch/sub", "/public/batch/sub/a.txt"}, paths)
+}
+
+func TestMergeChange(t *testing.T) {
+	tests := []struct {
+		prev, next, want string
+	}{
+		{Created, Modified, Created},
+		{Created, Deleted, ""},
+		{Modified, Modified, Modified},
+		{Modified, Deleted, Deleted},
+		{Deleted, Created, Modified},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, mergeChange(tt.prev, tt.next), "%s then %s", tt.prev, tt.next)
+	}
+}
@@ -0,0 +1,186 @@
+// Package webhook posts changes below watched file roots to configured URLs,
+// so external systems can react to files dropped into a root.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/watch"
+)
+
+// Headers of webhook requests.
+const (
+	HeaderEvent     = "X-Dendrite-Event"
+	HeaderSignature = "X-Dendrite-Signature"
+)
+
+const (
+	// maxAttempts bounds the deliveries of one event.
+	maxAttempts = 5
+	// queueSize bounds the events waiting for delivery to one URL; further
+	// events are dropped.
+	queueSize      = 1024
+	requestTimeout = 10 * time.Second
+)
+
+// Target is a URL events are posted to as JSON.
+type Target struct {
+	URL string
+	// Secret signs every body with HMAC-SHA256 in the X-Dendrite-Signature
+	// header. Empty sends unsigned requests.
+	Secret string
+	// Roots lists the virtual folders of the roots whose changes are sent;
+	// empty sends the changes of all roots.
+	Roots []string
+}
+
+// Wants reports whether the changes of the root are sent to t.
+func (t Target) Wants(root string) bool {
+	return len(t.Roots) == 0 || slices.Contains(t.Roots, root)
+}
+
+// Sign returns the X-Dendrite-Signature header of body: sha256= followed by
+// the hex HMAC-SHA256 of body keyed with secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notifier posts the changes of a watch.Watcher to targets. Events
+// are delivered in order per target and retried with exponential backoff on
+// network errors, 429 and 5xx responses.
+type Notifier struct {
+	targets []target
+	client  *http.Client
+	logger  *slog.Logger
+	// backoff returns the wait after the given failed attempt.
+	backoff func(attempt int) time.Duration
+}
+
+// target is a Target with its queue of pending events.
+type target struct {
+	Target
+	queue chan watch.Event
+}
+
+// New returns a Notifier for targets. Delivery problems are logged to
+// logger, which may be nil.
+func New(targets []Target, logger *slog.Logger) *Notifier {
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	n := &Notifier{
+		client:  &http.Client{Timeout: requestTimeout},
+		logger:  logger,
+		backoff: func(attempt int) time.Duration { return time.Second << (attempt - 1) },
+	}
+	for _, t := range targets {
+		n.targets = append(n.targets, target{Target: t, queue: make(chan watch.Event, queueSize)})
+	}
+	return n
+}
+
+// Run delivers the events of w until ctx is canceled. Events still queued
+// then are dropped.
+func (n *Notifier) Run(ctx context.Context, w *watch.Watcher) {
+	unsubscribe := w.Subscribe(n.publish)
+	defer unsubscribe()
+
+	var wg sync.WaitGroup
+	for _, t := range n.targets {
+		wg.Go(func() { n.deliver(ctx, t) })
+	}
+	wg.Wait()
+}
+
+// publish queues ev for every target wanting it.
+func (n *Notifier) publish(ev watch.Event) {
+	for _, t := range n.targets {
+		if !t.Wants(ev.Root) {
+			continue
+		}
+		select {
+		case t.queue <- ev:
+		default:
+			n.logger.Warn("webhook queue full, dropping event", "url", t.URL, "type", ev.Type, "path", ev.Path)
+		}
+	}
+}
+
+// deliver sends the events queued for t one after the other.
+func (n *Notifier) deliver(ctx context.Context, t target) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-t.queue:
+			n.send(ctx, t.Target, ev)
+		}
+	}
+}
+
+// send posts ev to t, retrying failures that may be temporary.
+func (n *Notifier) send(ctx context.Context, t Target, ev watch.Event) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		n.logger.Error("encode webhook event", "error", err)
+		return
+	}
+	for attempt := 1; ; attempt++ {
+		retry, err := n.post(ctx, t, ev.Type, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt == maxAttempts {
+			n.logger.Error("webhook delivery failed", "url", t.URL, "type", ev.Type, "path", ev.Path,
+				"attempts", attempt, "error", err)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(n.backoff(attempt)):
+		}
+	}
+}
+
+// post sends one request and reports whether a failure is worth retrying.
+func (n *Notifier) post(ctx context.Context, t Target, eventType string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "dendrite-pulse")
+	req.Header.Set(HeaderEvent, eventType)
+	if t.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(t.Secret, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("post webhook: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	// Drain a bounded amount so the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+	return retry, fmt.Errorf("webhook answered %s", resp.Status)
+}
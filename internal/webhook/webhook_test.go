@@ -0,0 +1,151 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thorstenkramm/dendrite-pulse/internal/watch"
+)
+
+// received is a request a test webhook server got.
+type received struct {
+	event     watch.Event
+	header    http.Header
+	signature string
+}
+
+// hookServer answers with the given statuses in turn, then 200, and sends
+// the requests it received on the returned channel.
+func hookServer(t *testing.T, secret string, statuses ...int) (*httptest.Server, <-chan received) {
+	t.Helper()
+	got := make(chan received, 16)
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if !assert.NoError(t, err) {
+			return
+		}
+		var ev watch.Event
+		assert.NoError(t, json.Unmarshal(body, &ev))
+		got <- received{event: ev, header: r.Header, signature: Sign(secret, body)}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(statuses) > 0 {
+			w.WriteHeader(statuses[0])
+			statuses = statuses[1:]
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, got
+}
+
+// startNotifier runs a Notifier for targets and returns a function
+// publishing events to it.
+func startNotifier(t *testing.T, targets ...Target) func(watch.Event) {
+	t.Helper()
+	n := New(targets, nil)
+	n.backoff = func(int) time.Duration { return time.Millisecond }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		n.Run(ctx, watch.New(nil, nil))
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return n.publish
+}
+
+func next(t *testing.T, got <-chan received) received {
+	t.Helper()
+	select {
+	case r := <-got:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook request received")
+		return received{}
+	}
+}
+
+func assertNoRequest(t *testing.T, got <-chan received) {
+	t.Helper()
+	select {
+	case r := <-got:
+		t.Fatalf("unexpected webhook request: %+v", r.event)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestNotifierPostsSignedEvents(t *testing.T) {
+	srv, got := hookServer(t, "s3cret")
+	publish := startNotifier(t, Target{URL: srv.URL, Secret: "s3cret"})
+
+	modified := time.Date(2026, 1, 5, 9, 30, 0, 0, time.UTC)
+	publish(watch.Event{Type: watch.Created, Root: "/public", Path: "/public/q1.csv", Time: modified,
+		Metadata: &watch.Metadata{Kind: "file", SizeBytes: 4, PermissionMode: "0640", ModifiedAt: modified}})
+	publish(watch.Event{Type: watch.Deleted, Root: "/public", Path: "/public/old.csv", Time: modified})
+
+	r := next(t, got)
+	assert.Equal(t, watch.Created, r.event.Type)
+	assert.Equal(t, "/public/q1.csv", r.event.Path)
+	require.NotNil(t, r.event.Metadata)
+	assert.Equal(t, int64(4), r.event.Metadata.SizeBytes)
+	assert.Equal(t, watch.Created, r.header.Get(HeaderEvent))
+	assert.Equal(t, "application/json", r.header.Get("Content-Type"))
+	assert.Equal(t, r.signature, r.header.Get(HeaderSignature))
+
+	r = next(t, got)
+	assert.Equal(t, watch.Deleted, r.event.Type, "events are delivered in order")
+	assert.Nil(t, r.event.Metadata)
+}
+
+func TestNotifierRetries(t *testing.T) {
+	srv, got := hookServer(t, "", http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	publish := startNotifier(t, Target{URL: srv.URL})
+
+	publish(watch.Event{Type: watch.Created, Root: "/public", Path: "/public/a.txt"})
+	for range 3 {
+		r := next(t, got)
+		assert.Equal(t, "/public/a.txt", r.event.Path)
+		assert.Empty(t, r.header.Get(HeaderSignature), "unsigned without secret")
+	}
+	assertNoRequest(t, got)
+}
+
+func TestNotifierGivesUpOnClientErrors(t *testing.T) {
+	srv, got := hookServer(t, "", http.StatusBadRequest)
+	publish := startNotifier(t, Target{URL: srv.URL})
+
+	publish(watch.Event{Type: watch.Created, Root: "/public", Path: "/public/a.txt"})
+	next(t, got)
+	assertNoRequest(t, got)
+}
+
+func TestNotifierFiltersRoots(t *testing.T) {
+	srv, got := hookServer(t, "")
+	publish := startNotifier(t, Target{URL: srv.URL, Roots: []string{"/public"}})
+
+	publish(watch.Event{Type: watch.Created, Root: "/private", Path: "/private/secret.txt"})
+	publish(watch.Event{Type: watch.Created, Root: "/public", Path: "/public/open.txt"})
+	assert.Equal(t, "/public/open.txt", next(t, got).event.Path)
+	assertNoRequest(t, got)
+}
+
+func TestSign(t *testing.T) {
+	// HMAC-SHA256 test vector 2 of RFC 4231.
+	assert.Equal(t, "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843",
+		Sign("Jefe", []byte("what do ya want for nothing?")))
+}